@@ -0,0 +1,368 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/SShadowS/claude-code-lsps/al-language-server-go/wrapper"
+)
+
+// runSubcommand runs a CLI subcommand and returns the process exit code.
+// ok is false if args do not name a subcommand, in which case the wrapper
+// runs as a language server.
+func runSubcommand(args []string) (code int, ok bool) {
+	if len(args) == 0 {
+		return 0, false
+	}
+
+	switch args[0] {
+	case "support-bundle":
+		return runSupportBundle(args[1:]), true
+	case "install":
+		return runInstall(args[1:]), true
+	case "init":
+		return runInit(args[1:]), true
+	case "audit":
+		return runAudit(args[1:]), true
+	case "cache":
+		return runCache(args[1:]), true
+	case "plan":
+		return runPlan(args[1:]), true
+	case "build":
+		return runBuild(args[1:]), true
+	case "version", "--version":
+		fmt.Println(wrapper.Version)
+		return 0, true
+	}
+	return 0, false
+}
+
+func runSupportBundle(args []string) int {
+	fs := flag.NewFlagSet("support-bundle", flag.ContinueOnError)
+	output := fs.String("o", "", "output zip path (default al-lsp-support-<timestamp>.zip)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: al-lsp-wrapper support-bundle [-o file.zip] [workspace-dir]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	workspaceDir, _ := os.Getwd()
+	if fs.NArg() > 0 {
+		workspaceDir = fs.Arg(0)
+	}
+	workspaceDir, _ = filepath.Abs(workspaceDir)
+
+	outPath := *output
+	if outPath == "" {
+		outPath = fmt.Sprintf("al-lsp-support-%s.zip", time.Now().Format("20060102-150405"))
+	}
+
+	if err := wrapper.WriteSupportBundle(outPath, workspaceDir); err != nil {
+		fmt.Fprintf(os.Stderr, "support-bundle: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Support bundle written to %s\n", outPath)
+	fmt.Println("Review it before attaching to a GitHub issue; home directory and user name are masked.")
+	return 0
+}
+
+func runInstall(args []string) int {
+	fs := flag.NewFlagSet("install", flag.ContinueOnError)
+	version := fs.String("version", "", "AL extension version to install, e.g. 16.0.1463980 (default latest)")
+	vsix := fs.String("vsix", "", "install from a local .vsix file instead of downloading")
+	sha := fs.String("sha256", "", "expected SHA-256 of the VSIX (required)")
+	force := fs.Bool("force", false, "reinstall if the version is already installed")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: al-lsp-wrapper install --sha256 hash [--version X] [--vsix file.vsix] [--force]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	result, err := wrapper.InstallALExtension(wrapper.InstallOptions{
+		Version:  *version,
+		VSIXPath: *vsix,
+		SHA256:   *sha,
+		Force:    *force,
+		Progress: func(format string, args ...interface{}) {
+			fmt.Printf(format+"\n", args...)
+		},
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "install: %v\n", err)
+		return 1
+	}
+	if result.AlreadyInstalled {
+		fmt.Printf("AL extension %s is already installed in %s (use --force to reinstall)\n", result.Version, result.Path)
+	} else {
+		fmt.Printf("Installed AL extension %s to %s\n", result.Version, result.Path)
+	}
+	if result.SHA256 != "" {
+		fmt.Printf("VSIX SHA-256: %s\n", result.SHA256)
+	}
+	return 0
+}
+
+func runInit(args []string) int {
+	fs := flag.NewFlagSet("init", flag.ContinueOnError)
+	platform := fs.String("platform", runtime.GOOS, "target platform: windows, linux or darwin")
+	check := fs.Bool("check", false, "validate an existing .lsp.json instead of writing one")
+	force := fs.Bool("force", false, "overwrite an existing .lsp.json")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: al-lsp-wrapper init [--platform os] [--force] [file]")
+		fmt.Fprintln(fs.Output(), "       al-lsp-wrapper init --check [--platform os] [file]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	path := ".lsp.json"
+	if fs.NArg() > 0 {
+		path = fs.Arg(0)
+	}
+
+	if *check {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "init: %v\n", err)
+			return 1
+		}
+		code := 0
+		for _, issue := range wrapper.ValidateLSPConfig(data, *platform) {
+			fmt.Printf("%s: %s: %s\n", path, issue.Severity, issue.Message)
+			if issue.Severity == "error" {
+				code = 1
+			}
+		}
+		if code == 0 {
+			fmt.Printf("%s is valid for %s\n", path, *platform)
+		}
+		return code
+	}
+
+	data, err := wrapper.GenerateLSPConfig(*platform)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "init: %v\n", err)
+		return 1
+	}
+	if _, err := os.Stat(path); err == nil && !*force {
+		fmt.Fprintf(os.Stderr, "init: %s already exists (use --force to overwrite, or --check to validate it)\n", path)
+		return 1
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "init: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Wrote %s for %s (plugin %s)\n", path, *platform, wrapper.PluginName(*platform))
+	return 0
+}
+
+func runAudit(args []string) int {
+	fs := flag.NewFlagSet("audit", flag.ContinueOnError)
+	limit := fs.Int("n", 20, "number of most recent entries to show (0 for all)")
+	all := fs.Bool("all", false, "show entries of every workspace")
+	asJSON := fs.Bool("json", false, "print entries as JSON lines")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: al-lsp-wrapper audit [-n count] [-all] [-json] [workspace-dir]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	workspaceDir := ""
+	if !*all {
+		workspaceDir, _ = os.Getwd()
+		if fs.NArg() > 0 {
+			workspaceDir = fs.Arg(0)
+		}
+		workspaceDir, _ = filepath.Abs(workspaceDir)
+	}
+
+	path := wrapper.GetAuditLogPath()
+	entries, err := wrapper.ReadAuditLog(path, workspaceDir, *limit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "audit: %v\n", err)
+		return 1
+	}
+	if len(entries) == 0 {
+		fmt.Printf("No audit entries in %s\n", path)
+		return 0
+	}
+
+	for _, entry := range entries {
+		if *asJSON {
+			data, _ := json.Marshal(entry)
+			fmt.Println(string(data))
+			continue
+		}
+		fmt.Printf("%s  %-9s  %s", entry.Time.Local().Format("2006-01-02 15:04:05"), entry.Action, entry.Method)
+		if entry.Label != "" {
+			fmt.Printf(" %q", entry.Label)
+		}
+		if entry.RequestID != "" {
+			fmt.Printf(" [%s]", entry.RequestID)
+		}
+		fmt.Println()
+		for _, file := range entry.Files {
+			fmt.Printf("    %-7s  %s (%+d bytes)\n", file.Change, file.Path, file.ByteDelta)
+		}
+		if entry.BackupDir != "" {
+			fmt.Printf("    backup   %s\n", entry.BackupDir)
+		}
+		if entry.Error != "" {
+			fmt.Printf("    error    %s\n", entry.Error)
+		}
+	}
+	return 0
+}
+
+func runCache(args []string) int {
+	fs := flag.NewFlagSet("cache clear", flag.ContinueOnError)
+	all := fs.Bool("all", false, "clear the saved state of every workspace")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: al-lsp-wrapper cache clear [-all] [workspace-dir]")
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 || args[0] != "clear" {
+		fs.Usage()
+		return 2
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	workspaceDir := ""
+	if !*all {
+		workspaceDir, _ = os.Getwd()
+		if fs.NArg() > 0 {
+			workspaceDir = fs.Arg(0)
+		}
+		workspaceDir, _ = filepath.Abs(workspaceDir)
+	}
+
+	removed, err := wrapper.ClearWarmState(workspaceDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cache clear: %v\n", err)
+		return 1
+	}
+	if workspaceDir == "" {
+		fmt.Printf("Removed the saved state of %d workspace(s)\n", removed)
+	} else if removed == 0 {
+		fmt.Printf("No saved state for %s\n", workspaceDir)
+	} else {
+		fmt.Printf("Removed the saved state of %s\n", workspaceDir)
+	}
+	return 0
+}
+
+func runPlan(args []string) int {
+	fs := flag.NewFlagSet("plan", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the plan as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: al-lsp-wrapper plan [-json] [workspace-dir]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	workspaceDir, _ := os.Getwd()
+	if fs.NArg() > 0 {
+		workspaceDir = fs.Arg(0)
+	}
+	workspaceDir, _ = filepath.Abs(workspaceDir)
+	if info, err := os.Stat(workspaceDir); err != nil || !info.IsDir() {
+		fmt.Fprintf(os.Stderr, "plan: %s is not a directory\n", workspaceDir)
+		return 1
+	}
+
+	plan := wrapper.BuildInitPlan(workspaceDir)
+	if *asJSON {
+		data, _ := json.MarshalIndent(plan, "", "  ")
+		fmt.Println(string(data))
+		return 0
+	}
+	plan.Write(os.Stdout)
+	return 0
+}
+
+func runBuild(args []string) int {
+	fs := flag.NewFlagSet("build", flag.ContinueOnError)
+	output := fs.String("out", "", "write the .app to this file (default: build to a temporary file)")
+	asJSON := fs.Bool("json", false, "print the result as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: al-lsp-wrapper build [-out file.app] [-json] [project-dir]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	projectDir, _ := os.Getwd()
+	if fs.NArg() > 0 {
+		projectDir = fs.Arg(0)
+	}
+	projectDir, _ = filepath.Abs(projectDir)
+	projectRoot := wrapper.GetProjectRoot(filepath.Join(projectDir, "app.json"))
+	if projectRoot == "" {
+		fmt.Fprintf(os.Stderr, "build: no app.json in or above %s\n", projectDir)
+		return 1
+	}
+	if *output != "" {
+		*output, _ = filepath.Abs(*output)
+	}
+
+	// Configuration is read as for a workspace opened at the given folder
+	cfg, err := wrapper.LoadConfig(projectDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "build: %v\n", err)
+	}
+	result, err := wrapper.BuildProject(wrapper.BuildOptions{
+		ProjectRoot:   projectRoot,
+		Compiler:      cfg.Build.CompilerPath,
+		Output:        *output,
+		Arguments:     cfg.Build.Arguments,
+		DotNet:        cfg.DotNet,
+		RuleSet:       cfg.RuleSet,
+		WorkspaceRoot: projectDir,
+		Timeout:       time.Duration(cfg.Build.TimeoutSeconds) * time.Second,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "build: %v\n", err)
+		return 1
+	}
+
+	if *asJSON {
+		data, _ := json.MarshalIndent(result, "", "  ")
+		fmt.Println(string(data))
+	} else {
+		for _, file := range result.Files {
+			path := file.Path
+			if rel, err := filepath.Rel(projectRoot, path); err == nil {
+				path = rel
+			}
+			for _, d := range file.Diagnostics {
+				fmt.Printf("%s(%d,%d): %s %s: %s\n", path, d.Range.Start.Line+1, d.Range.Start.Character+1,
+					wrapper.SeverityName(d.Severity), d.RuleID(), d.Message)
+			}
+		}
+		fmt.Printf("%d error(s), %d warning(s) in %.1fs\n", result.Errors, result.Warnings, result.DurationMs/1000)
+		if result.Output != "" {
+			fmt.Printf("Wrote %s\n", result.Output)
+		}
+	}
+	if !result.Success {
+		return 1
+	}
+	return 0
+}
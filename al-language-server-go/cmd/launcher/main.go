@@ -10,6 +10,8 @@ import (
 	"runtime"
 	"sort"
 	"syscall"
+
+	"github.com/SShadowS/claude-code-lsps/al-language-server-go/internal/hostarch"
 )
 
 func main() {
@@ -26,11 +28,17 @@ func main() {
 	}
 }
 
-func getWrapperName() string {
+// getWrapperNames returns the wrapper binary names to look for, preferred first.
+// On Windows ARM64 a native arm64 build is preferred when the plugin ships one;
+// the x64 build still works there under emulation.
+func getWrapperNames() []string {
 	if runtime.GOOS == "windows" {
-		return "al-lsp-wrapper.exe"
+		if hostarch.Native() == "arm64" {
+			return []string{"al-lsp-wrapper-arm64.exe", "al-lsp-wrapper.exe"}
+		}
+		return []string{"al-lsp-wrapper.exe"}
 	}
-	return "al-lsp-wrapper"
+	return []string{"al-lsp-wrapper"}
 }
 
 func findWrapper() (string, error) {
@@ -40,23 +48,29 @@ func findWrapper() (string, error) {
 	}
 
 	// Look for wrapper in plugin cache (platform-specific binary name)
-	wrapperName := getWrapperName()
 	pattern := filepath.Join(home, ".claude", "plugins", "cache",
-		"al-lsp-wrappers", "al-language-server-go", "*", "bin", wrapperName)
+		"al-lsp-wrappers", "al-language-server-go", "*", "bin")
 
-	matches, err := filepath.Glob(pattern)
+	binDirs, err := filepath.Glob(pattern)
 	if err != nil {
 		return "", fmt.Errorf("failed to search for wrapper: %w", err)
 	}
 
-	if len(matches) == 0 {
-		return "", fmt.Errorf("wrapper not found at %s", pattern)
-	}
-
 	// Sort to get newest version (lexicographic sort works for semver)
-	sort.Sort(sort.Reverse(sort.StringSlice(matches)))
+	sort.Sort(sort.Reverse(sort.StringSlice(binDirs)))
+
+	// Newest version wins; within it, the preferred binary name
+	wrapperNames := getWrapperNames()
+	for _, binDir := range binDirs {
+		for _, name := range wrapperNames {
+			candidate := filepath.Join(binDir, name)
+			if _, err := os.Stat(candidate); err == nil {
+				return candidate, nil
+			}
+		}
+	}
 
-	return matches[0], nil
+	return "", fmt.Errorf("wrapper not found at %s", filepath.Join(pattern, wrapperNames[len(wrapperNames)-1]))
 }
 
 func execWrapper(path string) error {
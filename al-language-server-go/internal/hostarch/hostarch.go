@@ -0,0 +1,19 @@
+// Package hostarch reports the machine's native CPU architecture, which can
+// differ from runtime.GOARCH when the current binary runs under emulation
+// (an amd64 build on Windows ARM64, for example).
+package hostarch
+
+import "runtime"
+
+// Native returns the host's native architecture in GOARCH form
+func Native() string {
+	if arch := nativeArch(); arch != "" {
+		return arch
+	}
+	return runtime.GOARCH
+}
+
+// Emulated returns true if this process runs under CPU emulation
+func Emulated() bool {
+	return Native() != runtime.GOARCH
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package hostarch
+
+// nativeArch is not detected on non-Windows platforms; runtime.GOARCH is used
+func nativeArch() string {
+	return ""
+}
@@ -0,0 +1,63 @@
+//go:build windows
+
+package hostarch
+
+import (
+	"os"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32              = syscall.NewLazyDLL("kernel32.dll")
+	procIsWow64Process2   = kernel32.NewProc("IsWow64Process2")
+	procGetCurrentProcess = kernel32.NewProc("GetCurrentProcess")
+)
+
+// IMAGE_FILE_MACHINE_* values returned by IsWow64Process2
+const (
+	imageFileMachineI386  = 0x014c
+	imageFileMachineAMD64 = 0x8664
+	imageFileMachineARM64 = 0xAA64
+)
+
+// nativeArch asks Windows for the native machine type. IsWow64Process2 also
+// reports the truth for x64 processes emulated on ARM64, where
+// PROCESSOR_ARCHITECTURE claims AMD64.
+func nativeArch() string {
+	if procIsWow64Process2.Find() == nil {
+		process, _, _ := procGetCurrentProcess.Call()
+		var processMachine, nativeMachine uint16
+		ok, _, _ := procIsWow64Process2.Call(
+			process,
+			uintptr(unsafe.Pointer(&processMachine)),
+			uintptr(unsafe.Pointer(&nativeMachine)),
+		)
+		if ok != 0 {
+			switch nativeMachine {
+			case imageFileMachineARM64:
+				return "arm64"
+			case imageFileMachineAMD64:
+				return "amd64"
+			case imageFileMachineI386:
+				return "386"
+			}
+		}
+	}
+
+	// Older Windows versions without IsWow64Process2
+	arch := os.Getenv("PROCESSOR_ARCHITEW6432")
+	if arch == "" {
+		arch = os.Getenv("PROCESSOR_ARCHITECTURE")
+	}
+	switch strings.ToUpper(arch) {
+	case "ARM64":
+		return "arm64"
+	case "AMD64":
+		return "amd64"
+	case "X86":
+		return "386"
+	}
+	return ""
+}
@@ -0,0 +1,132 @@
+// Package project models an AL project's app.json: the app's identity, its
+// object ID ranges, the runtime and platform it targets and its dependencies.
+package project
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// App is an AL project's app.json
+type App struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Publisher   string `json:"publisher"`
+	Version     string `json:"version"`
+	Brief       string `json:"brief,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Platform and Application are the versions of the Microsoft System and
+	// Application apps the project builds against
+	Platform    string `json:"platform,omitempty"`
+	Application string `json:"application,omitempty"`
+	// Runtime is the AL runtime version, e.g. "13.0"
+	Runtime string `json:"runtime,omitempty"`
+	// Target is "Cloud", "Extension", "OnPrem" or "Internal"
+	Target   string    `json:"target,omitempty"`
+	IDRanges []IDRange `json:"idRanges"`
+	// PropagateDependencies makes the app's dependencies available to the
+	// apps depending on it
+	PropagateDependencies bool         `json:"propagateDependencies"`
+	Dependencies          []Dependency `json:"dependencies"`
+}
+
+// IDRange is an object ID range reserved by an app
+type IDRange struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// Dependency is an app a project depends on
+type Dependency struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Publisher string `json:"publisher"`
+	// Version is the lowest version accepted
+	Version string `json:"version"`
+}
+
+// manifest is app.json as written, with the older forms of its properties:
+// a single idRange and dependencies identified by appId
+type manifest struct {
+	App
+	IDRange      *IDRange `json:"idRange"`
+	Dependencies []struct {
+		Dependency
+		AppID string `json:"appId"`
+	} `json:"dependencies"`
+}
+
+// Parse parses an app.json document (plain JSON; strip comments first). App
+// and dependency IDs are returned without braces, and the older idRange and
+// appId properties as IDRanges and ID.
+func Parse(data []byte) (*App, error) {
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("app.json is not valid JSON: %w", err)
+	}
+	app := m.App
+	app.ID = trimBraces(app.ID)
+	if m.IDRange != nil {
+		app.IDRanges = append(app.IDRanges, *m.IDRange)
+	}
+	app.Dependencies = nil
+	for _, d := range m.Dependencies {
+		dep := d.Dependency
+		if dep.ID == "" {
+			dep.ID = d.AppID
+		}
+		dep.ID = trimBraces(dep.ID)
+		app.Dependencies = append(app.Dependencies, dep)
+	}
+	return &app, nil
+}
+
+// trimBraces returns a GUID without the braces of its registry form
+func trimBraces(id string) string {
+	return strings.Trim(strings.TrimSpace(id), "{}")
+}
+
+// RefersTo reports whether a dependency names an app, by ID or else by name
+// and publisher
+func (d Dependency) RefersTo(app *App) bool {
+	if d.ID != "" && app.ID != "" {
+		return strings.EqualFold(d.ID, app.ID)
+	}
+	return strings.EqualFold(d.Name, app.Name) && strings.EqualFold(d.Publisher, app.Publisher)
+}
+
+// DependsOn reports whether an app declares another as a dependency
+func (a *App) DependsOn(other *App) bool {
+	for _, dep := range a.Dependencies {
+		if dep.RefersTo(other) {
+			return true
+		}
+	}
+	return false
+}
+
+// Dependency returns the app's dependency on another app, if it declares one
+func (a *App) Dependency(other *App) (Dependency, bool) {
+	for _, dep := range a.Dependencies {
+		if dep.RefersTo(other) {
+			return dep, true
+		}
+	}
+	return Dependency{}, false
+}
+
+// ContainsID reports whether an object ID is in one of the app's ID ranges
+func (a *App) ContainsID(id int) bool {
+	for _, r := range a.IDRanges {
+		if r.From <= id && id <= r.To {
+			return true
+		}
+	}
+	return false
+}
+
+// String names the app as hovers do: "Name" by Publisher vVersion
+func (a *App) String() string {
+	return fmt.Sprintf("%q by %s v%s", a.Name, a.Publisher, a.Version)
+}
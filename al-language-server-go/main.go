@@ -8,6 +8,10 @@ import (
 )
 
 func main() {
+	if code, ok := runSubcommand(os.Args[1:]); ok {
+		os.Exit(code)
+	}
+
 	w := wrapper.New()
 
 	if err := w.Run(); err != nil {
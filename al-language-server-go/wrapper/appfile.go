@@ -0,0 +1,144 @@
+package wrapper
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// An .app package starts with a NAVX header: the magic "NAVX", the header
+// length as a little-endian uint32, the package ID and the magic again. The
+// zip archive holding NavxManifest.xml, SymbolReference.json and, unless the
+// publisher left them out, the app's .al sources follows the header.
+
+// navxMagic starts the header of an .app package
+const navxMagic = "NAVX"
+
+// maxNavxHeader bounds the header length read from a package
+const maxNavxHeader = 4096
+
+// AppFile is an open .app package
+type AppFile struct {
+	// Path is the .app file
+	Path    string
+	file    *os.File
+	archive *zip.Reader
+}
+
+// OpenAppFile opens an .app package for reading. Files without a NAVX
+// header are read as plain zip archives.
+func OpenAppFile(filePath string) (*AppFile, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	offset := navxHeaderLength(f, info.Size())
+	archive, err := zip.NewReader(io.NewSectionReader(f, offset, info.Size()-offset), info.Size()-offset)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s is not a readable app package: %w", filepath.Base(filePath), err)
+	}
+	return &AppFile{Path: filePath, file: f, archive: archive}, nil
+}
+
+// navxHeaderLength returns where the zip archive of a package starts: after
+// its NAVX header, or 0 if the file has no header or the zip does not start
+// where the header says
+func navxHeaderLength(f *os.File, size int64) int64 {
+	var header [8]byte
+	if _, err := f.ReadAt(header[:], 0); err != nil || string(header[:4]) != navxMagic {
+		return 0
+	}
+	length := int64(binary.LittleEndian.Uint32(header[4:]))
+	if length < int64(len(header)) || length > maxNavxHeader || length >= size {
+		return 0
+	}
+	var signature [4]byte
+	if _, err := f.ReadAt(signature[:], length); err != nil || string(signature[:]) != "PK\x03\x04" {
+		return 0
+	}
+	return length
+}
+
+// Close closes the package file
+func (a *AppFile) Close() error {
+	return a.file.Close()
+}
+
+// entry returns the entry with a name, matched case-insensitively, or nil
+func (a *AppFile) entry(name string) *zip.File {
+	for _, f := range a.archive.File {
+		if strings.EqualFold(f.Name, name) {
+			return f
+		}
+	}
+	return nil
+}
+
+// ReadEntry reads the content of an entry
+func (a *AppFile) ReadEntry(name string) ([]byte, error) {
+	f := a.entry(name)
+	if f == nil {
+		return nil, fmt.Errorf("%s has no entry %q", filepath.Base(a.Path), name)
+	}
+	return readZipEntry(f)
+}
+
+// Sources returns the .al entries of the package
+func (a *AppFile) Sources() []*zip.File {
+	var sources []*zip.File
+	for _, f := range a.archive.File {
+		if strings.EqualFold(path.Ext(f.Name), ".al") {
+			sources = append(sources, f)
+		}
+	}
+	return sources
+}
+
+// SymbolReference returns the package's SymbolReference.json, without the
+// byte order mark the compiler writes
+func (a *AppFile) SymbolReference() ([]byte, error) {
+	f := a.entry("SymbolReference.json")
+	if f == nil {
+		return nil, fmt.Errorf("%s has no SymbolReference.json", filepath.Base(a.Path))
+	}
+	data, err := readZipEntry(f)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")), nil
+}
+
+// decodeSymbols unmarshals the package's SymbolReference.json into v
+func (a *AppFile) decodeSymbols(v interface{}) error {
+	data, err := a.SymbolReference()
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("invalid SymbolReference.json in %s: %w", filepath.Base(a.Path), err)
+	}
+	return nil
+}
+
+// readZipEntry reads the content of a zip entry
+func readZipEntry(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
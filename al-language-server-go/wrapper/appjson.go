@@ -0,0 +1,55 @@
+package wrapper
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/SShadowS/claude-code-lsps/al-language-server-go/internal/project"
+)
+
+// The app.json of each project is parsed into a project.App (see
+// internal/project) once per change: the dependency model of the workspace,
+// the init plan, hovers and ID checks read it on every request.
+
+// projectApps caches parsed app.json files by path
+var projectApps = struct {
+	mu    sync.Mutex
+	files map[string]cachedProjectApp
+}{files: make(map[string]cachedProjectApp)}
+
+// cachedProjectApp is a parsed app.json and the file state it was parsed from
+type cachedProjectApp struct {
+	modTime time.Time
+	size    int64
+	app     *project.App
+	err     error
+}
+
+// readProjectApp reads the app.json of a project, comments allowed
+func readProjectApp(projectRoot string) (*project.App, error) {
+	path := filepath.Join(projectRoot, "app.json")
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	projectApps.mu.Lock()
+	defer projectApps.mu.Unlock()
+	if cached, ok := projectApps.files[path]; ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.app, cached.err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	app, err := project.Parse(StripJSONComments(data))
+	projectApps.files[path] = cachedProjectApp{modTime: info.ModTime(), size: info.Size(), app: app, err: err}
+	return app, err
+}
+
+// ProjectApp returns the parsed app.json of a project
+func (w *ALLSPWrapper) ProjectApp(projectRoot string) (*project.App, error) {
+	return readProjectApp(projectRoot)
+}
@@ -0,0 +1,307 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Dependencies of an AL project are symbol packages (.app files) in the
+// project's package cache (.alpackages). An .app is a zip archive behind a
+// short NAVX header (see appfile.go); its NavxManifest.xml names the app, publisher, version
+// and object ID ranges. After a project loads, the wrapper reads these
+// manifests so definitions and hovers into dependencies can say which app
+// they come from.
+
+// AppManifest is the identity of an AL app package, from its NavxManifest.xml
+type AppManifest struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Publisher string    `json:"publisher"`
+	Version   string    `json:"version"`
+	IDRanges  []IDRange `json:"idRanges,omitempty"`
+	// Path is the .app file the manifest was read from
+	Path string `json:"path"`
+}
+
+// IDRange is an object ID range reserved by an app
+type IDRange struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// DefinedIn describes the app for annotations, e.g.
+// `defined in "Base Application" by Microsoft v24.0.16410.18056`
+func (m AppManifest) DefinedIn() string {
+	return fmt.Sprintf("defined in %q by %s v%s", m.Name, m.Publisher, m.Version)
+}
+
+// navxManifest is the subset of NavxManifest.xml the wrapper reads
+type navxManifest struct {
+	App struct {
+		ID        string `xml:"Id,attr"`
+		Name      string `xml:"Name,attr"`
+		Publisher string `xml:"Publisher,attr"`
+		Version   string `xml:"Version,attr"`
+	} `xml:"App"`
+	IDRanges []struct {
+		Min int `xml:"MinObjectId,attr"`
+		Max int `xml:"MaxObjectId,attr"`
+	} `xml:"IdRanges>IdRange"`
+}
+
+// ReadAppManifest reads the manifest of an .app file
+func ReadAppManifest(path string) (*AppManifest, error) {
+	pkg, err := OpenAppFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer pkg.Close()
+
+	f := pkg.entry("NavxManifest.xml")
+	if f == nil {
+		return nil, fmt.Errorf("%s has no NavxManifest.xml", filepath.Base(path))
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	var manifest navxManifest
+	err = xml.NewDecoder(rc).Decode(&manifest)
+	rc.Close()
+	if err != nil {
+		return nil, fmt.Errorf("invalid NavxManifest.xml in %s: %w", filepath.Base(path), err)
+	}
+
+	app := &AppManifest{
+		ID:        strings.Trim(manifest.App.ID, "{}"),
+		Name:      manifest.App.Name,
+		Publisher: manifest.App.Publisher,
+		Version:   manifest.App.Version,
+		Path:      path,
+	}
+	for _, r := range manifest.IDRanges {
+		app.IDRanges = append(app.IDRanges, IDRange{From: r.Min, To: r.Max})
+	}
+	return app, nil
+}
+
+// packageCacheDirs returns the package cache directories of a project
+func packageCacheDirs(projectRoot string) []string {
+	var dirs []string
+	for _, dir := range NewWorkspaceSettings(projectRoot).ALResourceConfigurationSettings.PackageCachePaths {
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(projectRoot, dir)
+		}
+		dirs = append(dirs, filepath.Clean(dir))
+	}
+	return dirs
+}
+
+// cachedManifest is a manifest read from an .app, valid until the file changes
+type cachedManifest struct {
+	modTime  time.Time
+	size     int64
+	manifest *AppManifest
+	// objects are read from SymbolReference.json on first use
+	objects []AppObject
+}
+
+// packageIndex caches the manifests of the .app files in package caches.
+// Files are read again only when their size or modification time changes.
+type packageIndex struct {
+	mu    sync.Mutex
+	files map[string]*cachedManifest
+}
+
+func newPackageIndex() *packageIndex {
+	return &packageIndex{files: make(map[string]*cachedManifest)}
+}
+
+// packages returns the manifests of the .app files in a project's package
+// caches, with the newest version first when an app is present more than once
+func (idx *packageIndex) packages(projectRoot string, logf func(format string, args ...interface{})) []AppManifest {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	var apps []AppManifest
+	for _, dir := range packageCacheDirs(projectRoot) {
+		paths, _ := filepath.Glob(filepath.Join(dir, "*.app"))
+		for _, path := range paths {
+			info, err := os.Stat(path)
+			if err != nil {
+				continue
+			}
+			cached := idx.files[path]
+			if cached == nil || !cached.modTime.Equal(info.ModTime()) || cached.size != info.Size() {
+				manifest, err := ReadAppManifest(path)
+				if err != nil {
+					logf("Skipping package: %v", err)
+				}
+				cached = &cachedManifest{modTime: info.ModTime(), size: info.Size(), manifest: manifest}
+				idx.files[path] = cached
+			}
+			if cached.manifest != nil {
+				apps = append(apps, *cached.manifest)
+			}
+		}
+	}
+
+	sortManifests(apps)
+	return apps
+}
+
+// sortManifests orders manifests by name, newest version first
+func sortManifests(apps []AppManifest) {
+	sort.SliceStable(apps, func(i, j int) bool {
+		if !strings.EqualFold(apps[i].Name, apps[j].Name) {
+			return strings.ToLower(apps[i].Name) < strings.ToLower(apps[j].Name)
+		}
+		return compareAppVersions(apps[i].Version, apps[j].Version) > 0
+	})
+}
+
+// compareAppVersions compares dotted numeric versions such as 24.0.16410.18056
+func compareAppVersions(a, b string) int {
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < max(len(pa), len(pb)); i++ {
+		var na, nb int
+		if i < len(pa) {
+			na, _ = strconv.Atoi(pa[i])
+		}
+		if i < len(pb) {
+			nb, _ = strconv.Atoi(pb[i])
+		}
+		if na != nb {
+			if na < nb {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// DependencyPackages returns the manifests of a project's dependency packages
+func (w *ALLSPWrapper) DependencyPackages(projectRoot string) []AppManifest {
+	if projectRoot == "" {
+		return nil
+	}
+	return w.packages.packages(projectRoot, w.Log)
+}
+
+// prefetchPackages reads the dependency manifests of a loaded project, so the
+// first annotated definition or hover does not pay for it
+func (w *ALLSPWrapper) prefetchPackages(scope WrapperInterface, projectRoot string) {
+	start := time.Now()
+	apps := w.packages.packages(projectRoot, scope.Log)
+	scope.Log("Read %d dependency package manifest(s) for %s in %s",
+		len(apps), projectRoot, time.Since(start).Round(time.Millisecond))
+}
+
+// packageForLocation returns the dependency package a location points into,
+// or nil for locations in the project itself or in no known package. The AL
+// server shows dependency sources as documents whose URI names the app by its
+// ID, its package file name or its publisher and name.
+func packageForLocation(uri string, projectRoot string, apps []AppManifest) *AppManifest {
+	if len(apps) == 0 {
+		return nil
+	}
+	if path, err := FileURIToPath(uri); err == nil && strings.HasPrefix(uri, "file://") {
+		if projectRoot != "" && isWithin(NormalizePath(path), projectRoot) {
+			return nil
+		}
+	}
+
+	target := uri
+	if decoded, err := url.PathUnescape(uri); err == nil {
+		target = decoded
+	}
+	target = strings.ToLower(target)
+
+	// apps are sorted newest first, so the first match is the newest version
+	for _, app := range apps {
+		if app.ID != "" && strings.Contains(target, strings.ToLower(app.ID)) {
+			return &app
+		}
+	}
+	for _, app := range apps {
+		stem := strings.TrimSuffix(filepath.Base(app.Path), filepath.Ext(app.Path))
+		if strings.Contains(target, strings.ToLower(stem)) {
+			return &app
+		}
+	}
+	var best *AppManifest
+	for i, app := range apps {
+		if app.Name == "" || !strings.Contains(target, strings.ToLower(app.Name)) ||
+			!strings.Contains(target, strings.ToLower(app.Publisher)) {
+			continue
+		}
+		if best == nil || len(app.Name) > len(best.Name) {
+			best = &apps[i]
+		}
+	}
+	return best
+}
+
+// isWithin reports whether path is root or inside it
+func isWithin(path string, root string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// annotateDefinitionResult adds a definedIn property naming the dependency
+// package to each location of a definition result that points into one. It
+// returns the annotated result and the package of the first such location.
+func annotateDefinitionResult(result json.RawMessage, projectRoot string, apps []AppManifest) (json.RawMessage, *AppManifest) {
+	if len(apps) == 0 || isEmptyDefinitionResult(result) {
+		return result, nil
+	}
+	var locations []map[string]interface{}
+	single := false
+	if err := json.Unmarshal(result, &locations); err != nil {
+		var location map[string]interface{}
+		if err := json.Unmarshal(result, &location); err != nil || location == nil {
+			return result, nil
+		}
+		locations, single = []map[string]interface{}{location}, true
+	}
+
+	var first *AppManifest
+	for _, location := range locations {
+		uri, _ := location["uri"].(string)
+		if uri == "" {
+			// LocationLink
+			uri, _ = location["targetUri"].(string)
+		}
+		if app := packageForLocation(uri, projectRoot, apps); app != nil {
+			location["definedIn"] = app.DefinedIn()
+			if first == nil {
+				first = app
+			}
+		}
+	}
+	if first == nil {
+		return result, nil
+	}
+
+	var data []byte
+	var err error
+	if single {
+		data, err = json.Marshal(locations[0])
+	} else {
+		data, err = json.Marshal(locations)
+	}
+	if err != nil {
+		return result, nil
+	}
+	return data, first
+}
@@ -0,0 +1,168 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Projects using DotNet types need the assemblies declaring them, or hover and
+// definition on DotNet variables fail. The AL server looks for assemblies in
+// the project's assemblyProbingPaths, which the wrapper builds per project:
+//
+//  1. ./.netpackages, where VS Code downloads assemblies
+//  2. al.assemblyProbingPaths from the project's .vscode/settings.json
+//  3. dotNet.probingPaths from the wrapper config, e.g. the Add-ins folder of
+//     a Business Central service tier
+//  4. with dotNet.discover, for projects declaring DotNet types, the service
+//     tier and .NET runtime folders found on this machine
+//
+// Paths that do not exist are left out, except ./.netpackages.
+
+// dotNetPattern matches the dotnet keyword of DotNet declarations and variables
+var dotNetPattern = regexp.MustCompile(`(?i)\bdotnet\b`)
+
+// usesDotNet reports whether any .al file of a project declares a dotnet
+// package or a DotNet variable
+func usesDotNet(projectRoot string) bool {
+	found := false
+	walkDir(projectRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if path != projectRoot && (strings.HasPrefix(name, ".") || name == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.EqualFold(filepath.Ext(path), ".al") {
+			return nil
+		}
+		inComment := false
+		for _, line := range readLines(path) {
+			var code string
+			code, inComment = stripALComments(line, inComment)
+			if dotNetPattern.MatchString(maskALNonCode(code)) {
+				found = true
+				return filepath.SkipAll
+			}
+		}
+		return nil
+	})
+	return found
+}
+
+// vscodeProbingPaths returns al.assemblyProbingPaths from a project's
+// .vscode/settings.json
+func vscodeProbingPaths(projectRoot string) []string {
+	data, err := os.ReadFile(filepath.Join(projectRoot, ".vscode", "settings.json"))
+	if err != nil {
+		return nil
+	}
+	var settings struct {
+		Paths []string `json:"al.assemblyProbingPaths"`
+	}
+	json.Unmarshal(StripJSONComments(data), &settings)
+	return settings.Paths
+}
+
+// wellKnownProbingPatterns are glob patterns of the service tier and .NET
+// runtime folders holding the assemblies AL projects commonly use
+func wellKnownProbingPatterns() []string {
+	if runtime.GOOS == "windows" {
+		programFiles := os.Getenv("ProgramFiles")
+		if programFiles == "" {
+			programFiles = `C:\Program Files`
+		}
+		return []string{
+			filepath.Join(programFiles, "Microsoft Dynamics 365 Business Central", "*", "Service"),
+			filepath.Join(programFiles, "Microsoft Dynamics 365 Business Central", "*", "Service", "Add-ins"),
+			filepath.Join(programFiles, "dotnet", "shared", "Microsoft.NETCore.App", "*"),
+			filepath.Join(programFiles, "dotnet", "shared", "Microsoft.AspNetCore.App", "*"),
+			filepath.Join(os.Getenv("WINDIR"), "Microsoft.NET", "assembly"),
+		}
+	}
+	patterns := []string{
+		"/usr/share/dotnet/shared/Microsoft.NETCore.App/*",
+		"/usr/lib/dotnet/shared/Microsoft.NETCore.App/*",
+		"/usr/local/share/dotnet/shared/Microsoft.NETCore.App/*",
+	}
+	if home := homeSubdir(".dotnet"); home != "" {
+		patterns = append(patterns, filepath.Join(home, "shared", "Microsoft.NETCore.App", "*"))
+	}
+	return patterns
+}
+
+// discoverProbingPaths returns the existing folder matching each well-known
+// pattern, the newest version where several match
+func discoverProbingPaths() []string {
+	var paths []string
+	for _, pattern := range wellKnownProbingPatterns() {
+		matches, _ := filepath.Glob(pattern)
+		var dirs []string
+		for _, match := range matches {
+			if info, err := os.Stat(match); err == nil && info.IsDir() {
+				dirs = append(dirs, match)
+			}
+		}
+		if len(dirs) == 0 {
+			continue
+		}
+		// Versioned folders are named 24.0.2 or, for service tiers, 240
+		sort.Slice(dirs, func(i, j int) bool {
+			return compareAppVersions(versionedFolder(dirs[i]), versionedFolder(dirs[j])) > 0
+		})
+		paths = append(paths, dirs[0])
+	}
+	return paths
+}
+
+// versionedFolder returns the version folder of a path: the folder itself, or
+// the parent of a service tier's Service or Add-ins folder
+func versionedFolder(path string) string {
+	for {
+		switch filepath.Base(path) {
+		case "Service", "Add-ins":
+			path = filepath.Dir(path)
+		default:
+			return filepath.Base(path)
+		}
+	}
+}
+
+// assemblyProbingPaths returns the assembly probing paths of a project
+func assemblyProbingPaths(projectRoot string, cfg DotNetConfig) []string {
+	paths := []string{"./.netpackages"}
+	seen := map[string]bool{filepath.Join(projectRoot, ".netpackages"): true}
+	add := func(candidates []string) {
+		for _, path := range candidates {
+			full := path
+			if !filepath.IsAbs(full) {
+				full = filepath.Join(projectRoot, full)
+			}
+			full = filepath.Clean(full)
+			if seen[full] {
+				continue
+			}
+			if info, err := os.Stat(full); err != nil || !info.IsDir() {
+				continue
+			}
+			seen[full] = true
+			paths = append(paths, path)
+		}
+	}
+
+	add(vscodeProbingPaths(projectRoot))
+	add(cfg.ProbingPaths)
+	if cfg.Discover && usesDotNet(projectRoot) {
+		add(discoverProbingPaths())
+	}
+	return paths
+}
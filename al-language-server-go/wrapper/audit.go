@@ -0,0 +1,217 @@
+package wrapper
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Every edit the wrapper writes to disk, and every edit-producing result it
+// passes to the client (renames, code actions, the AL server's
+// workspace/applyEdit requests), is recorded as one JSON line in the audit
+// log, so users can review what the language server pathway changed or
+// proposed to change in their repository.
+
+// Audit actions
+const (
+	// AuditApplied marks an edit the wrapper wrote to disk
+	AuditApplied = "applied"
+	// AuditForwarded marks an edit passed to the client to apply
+	AuditForwarded = "forwarded"
+)
+
+// auditMaxBytes is the size at which the audit log is rotated to audit.jsonl.1
+const auditMaxBytes = 10 << 20
+
+// AuditEntry is one audit log record
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	SessionID string    `json:"sessionId"`
+	Workspace string    `json:"workspace,omitempty"`
+	// Action is AuditApplied or AuditForwarded
+	Action string `json:"action"`
+	// Method is the request that produced the edit
+	Method string `json:"method"`
+	// RequestID is the correlation ID of the client message, as in the log
+	RequestID string `json:"requestId,omitempty"`
+	// Label describes the edit, e.g. a code action title
+	Label     string      `json:"label,omitempty"`
+	Files     []AuditFile `json:"files"`
+	BackupDir string      `json:"backupDir,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// AuditFile is a file touched by an audited edit
+type AuditFile struct {
+	Path string `json:"path"`
+	// Change is "created", "changed" or "deleted"
+	Change      string `json:"change"`
+	BytesBefore int    `json:"bytesBefore"`
+	BytesAfter  int    `json:"bytesAfter"`
+	ByteDelta   int    `json:"byteDelta"`
+}
+
+// GetAuditLogPath returns the path of the audit log
+func GetAuditLogPath() string {
+	return filepath.Join(GetStateDir(), "audit.jsonl")
+}
+
+// auditFiles converts applied file changes to audit records
+func auditFiles(changes []FileChange) []AuditFile {
+	files := make([]AuditFile, 0, len(changes))
+	for _, c := range changes {
+		change := "changed"
+		switch c.Type {
+		case FileCreated:
+			change = "created"
+		case FileDeleted:
+			change = "deleted"
+		}
+		files = append(files, AuditFile{
+			Path:        c.Path,
+			Change:      change,
+			BytesBefore: c.BytesBefore,
+			BytesAfter:  c.BytesAfter,
+			ByteDelta:   c.BytesAfter - c.BytesBefore,
+		})
+	}
+	return files
+}
+
+// audit completes an entry with the session and request it belongs to and
+// appends it to the audit log
+func (w *ALLSPWrapper) audit(scope WrapperInterface, entry AuditEntry) {
+	if !w.Config().Audit.Enabled {
+		return
+	}
+	entry.Time = time.Now()
+	entry.SessionID = SessionID()
+	entry.Workspace = w.workspaceRoot
+	if s, ok := scope.(*requestScope); ok {
+		entry.RequestID = s.correlationID
+	}
+	if entry.Files == nil {
+		entry.Files = []AuditFile{}
+	}
+
+	w.auditMu.Lock()
+	defer w.auditMu.Unlock()
+	if err := appendAuditEntry(GetAuditLogPath(), entry); err != nil {
+		scope.Log("Failed to write audit entry: %v", err)
+	}
+}
+
+// auditEdit records an edit the client is given to apply. The files and byte
+// deltas are computed from the current file contents without writing them.
+func (w *ALLSPWrapper) auditEdit(scope WrapperInterface, method string, label string, edit *WorkspaceEdit) {
+	if !w.Config().Audit.Enabled {
+		return
+	}
+	entry := AuditEntry{Action: AuditForwarded, Method: method, Label: label}
+	if plan, err := w.planEdit(edit); err != nil {
+		entry.Error = err.Error()
+	} else {
+		entry.Files = auditFiles(plan.changes())
+	}
+	w.audit(scope, entry)
+}
+
+// AuditResult records the edits in a result forwarded to the client
+func (w *ALLSPWrapper) AuditResult(method string, result json.RawMessage) {
+	w.auditResult(w, method, result)
+}
+
+// auditResult records the edits in a result forwarded to the client:
+// a rename's WorkspaceEdit, or the edits of code actions and resolved actions
+func (w *ALLSPWrapper) auditResult(scope WrapperInterface, method string, result json.RawMessage) {
+	switch method {
+	case "textDocument/rename":
+		var edit WorkspaceEdit
+		if json.Unmarshal(result, &edit) == nil && (len(edit.Changes) > 0 || len(edit.DocumentChanges) > 0) {
+			w.auditEdit(scope, method, "", &edit)
+		}
+	case "textDocument/codeAction":
+		var actions []struct {
+			Title string         `json:"title"`
+			Edit  *WorkspaceEdit `json:"edit"`
+		}
+		if json.Unmarshal(result, &actions) != nil {
+			return
+		}
+		for _, action := range actions {
+			if action.Edit != nil {
+				w.auditEdit(scope, method, action.Title, action.Edit)
+			}
+		}
+	case "codeAction/resolve":
+		var action struct {
+			Title string         `json:"title"`
+			Edit  *WorkspaceEdit `json:"edit"`
+		}
+		if json.Unmarshal(result, &action) == nil && action.Edit != nil {
+			w.auditEdit(scope, method, action.Title, action.Edit)
+		}
+	}
+}
+
+// appendAuditEntry appends one entry to the audit log, rotating it when it
+// grows past auditMaxBytes
+func appendAuditEntry(path string, entry AuditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if info, err := os.Stat(path); err == nil && info.Size() > auditMaxBytes {
+		os.Rename(path, path+".1")
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadAuditLog returns the last limit audit entries (all if limit <= 0),
+// only those of workspace if it is not empty
+func ReadAuditLog(path string, workspace string, limit int) ([]AuditEntry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if workspace != "" && NormalizePath(entry.Workspace) != NormalizePath(workspace) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	return entries, nil
+}
@@ -0,0 +1,68 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// Some clients and test tools send JSON-RPC batches: an array of requests and
+// notifications in one message. The wrapper handles each element as if it
+// had arrived on its own, and answers the batch with one array holding the
+// responses to its requests, in completion order, once all are answered. A
+// batch of notifications only gets no response, an empty batch a single
+// InvalidRequest error.
+
+// clientBatch collects the responses to the requests of one client batch
+type clientBatch struct {
+	mu        sync.Mutex
+	pending   int
+	responses []*Message
+}
+
+// newClientBatch returns the collector of a batch, expecting a response for
+// every request and for every element that is not a message
+func newClientBatch(msgs []*Message) *clientBatch {
+	batch := &clientBatch{}
+	for _, msg := range msgs {
+		if msg == nil || msg.IsRequest() {
+			batch.pending++
+		}
+	}
+	return batch
+}
+
+// add records the response to one request of the batch and sends the batch
+// response after the last one
+func (b *clientBatch) add(w *ALLSPWrapper, response *Message) {
+	b.mu.Lock()
+	if response != nil {
+		b.responses = append(b.responses, response)
+	}
+	b.pending--
+	done := b.pending == 0
+	b.mu.Unlock()
+
+	if done {
+		w.writeBatchToClient(b.responses)
+	}
+}
+
+// writeBatchToClient writes the responses to a batch as one array message
+func (w *ALLSPWrapper) writeBatchToClient(responses []*Message) error {
+	if len(responses) == 0 {
+		return nil
+	}
+	for _, response := range responses {
+		w.validateMessage("wrapper", "client", response)
+		if response.Error != nil {
+			w.recordError("client", errorSummary(response.Error))
+		}
+	}
+	content, err := json.Marshal(responses)
+	if err != nil {
+		return err
+	}
+	w.clientMu.Lock()
+	defer w.clientMu.Unlock()
+	return WriteRawMessage(w.clientWriter, content)
+}
@@ -0,0 +1,207 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Latency budgets bound how long a client waits for an expensive request,
+// such as references across a large dependency closure. The request is sent
+// with a partialResultToken, so the AL server can stream results as $/progress
+// notifications while it works. When the method's soft budget runs out, the
+// results streamed so far are returned, the log says they are partial, and
+// the request is cancelled. Without streamed results the wrapper keeps
+// waiting for the full response, as an empty partial result is no answer at
+// all. The budgets of both methods default to 3 seconds, the wait for an
+// interactive lookup; references, the slowest, need it most.
+
+// partialResultPrefix starts the partialResultTokens the wrapper creates
+const partialResultPrefix = "al-wrapper-partial-"
+
+// partialResults collects the results the AL server streams for a request
+type partialResults struct {
+	items []json.RawMessage
+}
+
+// SendRequestToLSPWithBudget sends a request within the method's latency
+// budget. It reports whether the response holds only the results gathered
+// before the budget ran out.
+func (w *ALLSPWrapper) SendRequestToLSPWithBudget(method string, params interface{}) (*Message, bool, error) {
+	return w.sendRequestWithBudget("", method, params)
+}
+
+// sendRequestWithBudget sends a request within its method's latency budget,
+// tagging its log lines with the given span
+func (w *ALLSPWrapper) sendRequestWithBudget(span string, method string, params interface{}) (*Message, bool, error) {
+	budget := time.Duration(w.Config().LatencyBudget.Methods[method]) * time.Millisecond
+	if budget <= 0 || budget >= defaultRequestTimeout {
+		resp, err := w.sendRequest(span, method, params, defaultRequestTimeout)
+		return resp, false, err
+	}
+
+	if err := w.checkCircuit(method); err != nil {
+		w.logTagged(span, "Short-circuiting request to AL LSP: %v", err)
+		return nil, false, err
+	}
+
+	token := fmt.Sprintf("%s%d", partialResultPrefix, atomic.AddInt64(&w.partialSeq, 1))
+	tokenParams, err := withPartialResultToken(params, token)
+	if err != nil {
+		return nil, false, err
+	}
+	collected := &partialResults{}
+	w.pendingMu.Lock()
+	w.partials[token] = collected
+	w.pendingMu.Unlock()
+	defer func() {
+		w.pendingMu.Lock()
+		delete(w.partials, token)
+		w.pendingMu.Unlock()
+	}()
+
+	var resp *Message
+	var partial bool
+	sent := false
+	err = w.inProject(span, w.requestProject(params), func() (err error) {
+		sent = true
+		resp, partial, err = w.roundTripWithBudget(span, method, tokenParams, budget, collected)
+		return err
+	})
+	if failure := requestFailure(resp, err); failure != nil {
+		w.recordError(method, failure.Error())
+	}
+	if sent {
+		w.recordOutcome(span, method, err)
+	}
+	return resp, partial, err
+}
+
+// roundTripWithBudget sends one request and waits for its response, or for
+// the budget if results were streamed by then
+func (w *ALLSPWrapper) roundTripWithBudget(span string, method string, params interface{}, budget time.Duration, collected *partialResults) (*Message, bool, error) {
+	id, respChan, err := w.startRequest(span, method, params)
+	if err != nil {
+		return nil, false, err
+	}
+
+	select {
+	case resp := <-respChan:
+		w.logTagged(span, "Received response from AL LSP: id=%d", id)
+		return mergePartialResults(resp, w.takePartialResults(collected)), false, nil
+	case <-time.After(budget):
+	}
+
+	w.pendingMu.Lock()
+	items := collected.items
+	if len(items) == 0 {
+		w.pendingMu.Unlock()
+		w.logTagged(span, "Latency budget of %s for %s ran out with no streamed results; waiting for the full response", budget, method)
+		resp, err := w.awaitResponse(span, method, id, respChan, defaultRequestTimeout-budget)
+		if err != nil {
+			return nil, false, err
+		}
+		return mergePartialResults(resp, w.takePartialResults(collected)), false, nil
+	}
+	collected.items = nil
+	delete(w.pendingReqs, id)
+	w.pendingMu.Unlock()
+
+	// The response may have arrived while the budget ran out
+	select {
+	case resp := <-respChan:
+		w.logTagged(span, "Received response from AL LSP: id=%d", id)
+		return mergePartialResults(resp, items), false, nil
+	default:
+	}
+
+	w.logTagged(span, "Latency budget of %s for %s ran out: returning %d streamed result(s), cancelling id=%d", budget, method, len(items), id)
+	w.abandonRequest(span, id, method)
+	result, err := json.Marshal(items)
+	if err != nil {
+		return nil, false, err
+	}
+	return &Message{JSONRPC: "2.0", Result: result}, true, nil
+}
+
+// takePartialResults removes and returns the results collected so far
+func (w *ALLSPWrapper) takePartialResults(collected *partialResults) []json.RawMessage {
+	w.pendingMu.Lock()
+	defer w.pendingMu.Unlock()
+	items := collected.items
+	collected.items = nil
+	return items
+}
+
+// mergePartialResults prepends streamed results to a response's result. A
+// server that streams results returns only the remaining ones at the end.
+func mergePartialResults(resp *Message, items []json.RawMessage) *Message {
+	if len(items) == 0 || resp.Error != nil {
+		return resp
+	}
+	var rest []json.RawMessage
+	if !isEmptyResult(resp.Result) && json.Unmarshal(resp.Result, &rest) != nil {
+		return resp
+	}
+	if result, err := json.Marshal(append(items, rest...)); err == nil {
+		resp.Result = result
+	}
+	return resp
+}
+
+// collectPartialResult records a $/progress notification carrying results
+// for one of the wrapper's partialResultTokens. It returns false for other
+// progress notifications, which are forwarded to the client.
+func (w *ALLSPWrapper) collectPartialResult(msg *Message) bool {
+	var params struct {
+		Token json.RawMessage `json:"token"`
+		Value json.RawMessage `json:"value"`
+	}
+	var token string
+	if json.Unmarshal(msg.Params, &params) != nil || json.Unmarshal(params.Token, &token) != nil {
+		return false
+	}
+
+	w.pendingMu.Lock()
+	defer w.pendingMu.Unlock()
+	collected, ok := w.partials[token]
+	if !ok {
+		// Late results of a request already answered
+		return strings.HasPrefix(token, partialResultPrefix)
+	}
+	var items []json.RawMessage
+	if json.Unmarshal(params.Value, &items) == nil {
+		collected.items = append(collected.items, items...)
+	}
+	return true
+}
+
+// withPartialResultToken adds a partialResultToken to request params
+func withPartialResultToken(params interface{}, token string) (map[string]interface{}, error) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil || fields == nil {
+		return nil, fmt.Errorf("request params are not an object")
+	}
+	fields["partialResultToken"] = token
+	return fields, nil
+}
+
+// logPartialResult tells the client, through window/logMessage, and the log
+// that a list result is partial and which setting controls the budget. The
+// result itself holds only the streamed entries.
+func logPartialResult(result json.RawMessage, method string, w WrapperInterface) {
+	var entries []json.RawMessage
+	json.Unmarshal(result, &entries)
+	budget := w.Config().LatencyBudget.Methods[method]
+	w.Log("Partial %s result: %d entries streamed before the AL server finished within %d ms (latencyBudget.methods[%q])",
+		method, len(entries), budget, method)
+	w.LogToClient(MessageTypeInfo, fmt.Sprintf(
+		"AL LSP wrapper: %s result is partial: %d entries the AL server found within %d ms (latencyBudget.methods[%q])",
+		method, len(entries), budget, method))
+}
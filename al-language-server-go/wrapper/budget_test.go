@@ -0,0 +1,17 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestPartialResultsAreAnnounced(t *testing.T) {
+	w, _, client := newTestWrapper()
+	logPartialResult(json.RawMessage(`[{"name":"A"},{"name":"B"}]`), "workspace/symbol", w)
+
+	texts := clientLogMessages(t, client)
+	if len(texts) != 1 || !strings.Contains(texts[0], "workspace/symbol result is partial") || !strings.Contains(texts[0], "2 entries") {
+		t.Errorf("partial result messages = %q, want one saying the workspace/symbol result of 2 entries is partial", texts)
+	}
+}
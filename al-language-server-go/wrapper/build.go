@@ -0,0 +1,456 @@
+package wrapper
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SShadowS/claude-code-lsps/al-language-server-go/internal/hostarch"
+)
+
+// The AL server compiles what it needs for the open files; some errors only
+// show when the whole project is compiled into an .app (a missing object in
+// a file nobody opened, app.json problems, cyclic references). The AL
+// extension ships the command line compiler, alc, next to EditorServices.
+// A build runs alc on a project with its package caches and assembly probing
+// paths, into a temporary .app unless an output file is given, and parses the
+// compiler's output:
+//
+//	C:\App\src\Customer.Table.al(12,5): error AL0118: The name 'X' does not exist
+//	error AL1022: The package containing the object 'Base Application' could not be loaded
+//
+// The al-wrapper.build command publishes the diagnostics to the client with
+// the AL server's own (duplicates removed) until the next build of the
+// project, or until the file is edited; the build CLI subcommand prints them.
+
+// BuildCommand compiles a project with alc and publishes its diagnostics
+const BuildCommand = "al-wrapper.build"
+
+// buildSource is the source of build diagnostics
+const buildSource = "alc"
+
+// maxBuildMessages bounds the compiler output lines kept besides diagnostics
+const maxBuildMessages = 50
+
+// compilerOutputPattern matches a located diagnostic of alc's output:
+// path(line,column) or path(line,column,endLine,endColumn)
+var compilerOutputPattern = regexp.MustCompile(`^(.+?)\((\d+),(\d+)(?:,(\d+),(\d+))?\): (error|warning|info|hidden) (\w+): (.*)$`)
+
+// compilerMessagePattern matches a diagnostic without a location
+var compilerMessagePattern = regexp.MustCompile(`^(error|warning|info|hidden) (\w+): (.*)$`)
+
+// compilerName returns the alc file name for an OS
+func compilerName(goos string) string {
+	if goos == "windows" {
+		return "alc.exe"
+	}
+	return "alc"
+}
+
+// compilerCandidates lists where AL extensions have shipped alc, preferred
+// first: the directories of the EditorServices binary, and bin/ of older
+// Windows-only extensions
+func compilerCandidates(extensionPath, goos, goarch string) []string {
+	var candidates []string
+	for _, executable := range executableCandidates(extensionPath, goos, goarch) {
+		candidates = append(candidates, filepath.Join(filepath.Dir(executable), compilerName(goos)))
+	}
+	if goos == "windows" {
+		candidates = append(candidates, filepath.Join(extensionPath, "bin", "alc.exe"))
+	}
+	return candidates
+}
+
+// FindALCompiler returns the alc of an AL extension
+func FindALCompiler(extensionPath string) (string, error) {
+	candidates := compilerCandidates(extensionPath, runtime.GOOS, hostarch.Native())
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("alc not found in the AL extension (probed: %s)", strings.Join(candidates, ", "))
+}
+
+// BuildCommandArgs represents the optional argument object of al-wrapper.build
+type BuildCommandArgs struct {
+	// Project is a file or folder URI/path inside the project
+	Project string `json:"project"`
+}
+
+// BuildOptions configures a project build
+type BuildOptions struct {
+	ProjectRoot string
+	// Compiler is the alc to run ("" finds it in the newest AL extension)
+	Compiler string
+	// Output is the .app to write ("" builds to a temporary file)
+	Output string
+	// Arguments are passed to alc after the wrapper's, e.g. /analyzer:...
+	Arguments []string
+	// DotNet adds configured assembly probing paths
+	DotNet DotNetConfig
+	// RuleSet and WorkspaceRoot find the project's ruleset (see ruleset.go)
+	RuleSet       RuleSetConfig
+	WorkspaceRoot string
+	Timeout       time.Duration
+}
+
+// BuildFileDiagnostics are the build diagnostics of one file
+type BuildFileDiagnostics struct {
+	Path        string       `json:"path"`
+	URI         string       `json:"uri"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+// BuildResult describes a project build
+type BuildResult struct {
+	Success  bool   `json:"success"`
+	Project  string `json:"project"`
+	Compiler string `json:"compiler"`
+	// Output is the built .app ("" if it was built to a temporary file)
+	Output     string  `json:"output,omitempty"`
+	DurationMs float64 `json:"durationMs"`
+	Errors     int     `json:"errors"`
+	Warnings   int     `json:"warnings"`
+	// Files holds the diagnostics by file, sorted by path. Diagnostics
+	// without a location are reported on the project's app.json.
+	Files []BuildFileDiagnostics `json:"files"`
+	// Messages are the last output lines that are not diagnostics, such as
+	// the compiler's summary
+	Messages []string `json:"messages"`
+}
+
+// BuildProject compiles a project with alc
+func BuildProject(opts BuildOptions) (*BuildResult, error) {
+	compiler := opts.Compiler
+	if compiler == "" {
+		extensionPath, err := FindALExtension()
+		if err != nil {
+			return nil, err
+		}
+		if compiler, err = FindALCompiler(extensionPath); err != nil {
+			return nil, err
+		}
+	}
+
+	output := opts.Output
+	if output == "" {
+		dir, err := os.MkdirTemp("", "al-lsp-build-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+		output = filepath.Join(dir, "build.app")
+	}
+
+	var probing []string
+	for _, path := range assemblyProbingPaths(opts.ProjectRoot, opts.DotNet) {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(opts.ProjectRoot, path)
+		}
+		probing = append(probing, filepath.Clean(path))
+	}
+	args := []string{
+		"/project:" + opts.ProjectRoot,
+		"/packagecachepath:" + strings.Join(packageCacheDirs(opts.ProjectRoot), ","),
+		"/assemblyprobingpaths:" + strings.Join(probing, ","),
+		"/out:" + output,
+	}
+	if ruleSet, _ := ruleSetPath(opts.ProjectRoot, opts.WorkspaceRoot, opts.RuleSet, func(string, ...interface{}) {}); ruleSet != "" {
+		args = append(args, "/ruleset:"+ruleSet)
+	}
+	args = append(args, opts.Arguments...)
+
+	ctx := context.Background()
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, compiler, args...)
+	cmd.Dir = opts.ProjectRoot
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	start := time.Now()
+	runErr := cmd.Run()
+	result := parseCompilerOutput(out.Bytes(), opts.ProjectRoot)
+	result.Project = opts.ProjectRoot
+	result.Compiler = compiler
+	result.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("build of %s timed out after %s", opts.ProjectRoot, opts.Timeout)
+	}
+	var exitErr *exec.ExitError
+	if runErr != nil && !errors.As(runErr, &exitErr) {
+		return nil, fmt.Errorf("failed to run %s: %w", compiler, runErr)
+	}
+	result.Success = runErr == nil && result.Errors == 0
+	if opts.Output != "" && result.Success {
+		result.Output = opts.Output
+	}
+	return result, nil
+}
+
+// parseCompilerOutput collects the diagnostics and other messages of alc's
+// output; relative paths are resolved against the project root
+func parseCompilerOutput(data []byte, projectRoot string) *BuildResult {
+	result := &BuildResult{Files: []BuildFileDiagnostics{}, Messages: []string{}}
+	files := make(map[string][]Diagnostic)
+	seen := make(map[string]bool)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		if line == "" {
+			continue
+		}
+		// A diagnostic reported twice is kept once
+		if seen[line] {
+			continue
+		}
+
+		var path, severity, code, message string
+		var r Range
+		if m := compilerOutputPattern.FindStringSubmatch(line); m != nil {
+			path, severity, code, message = m[1], m[6], m[7], m[8]
+			r.Start = compilerPosition(m[2], m[3])
+			r.End = r.Start
+			if m[4] != "" {
+				r.End = compilerPosition(m[4], m[5])
+			}
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(projectRoot, path)
+			}
+		} else if m := compilerMessagePattern.FindStringSubmatch(line); m != nil {
+			path, severity, code, message = filepath.Join(projectRoot, "app.json"), m[1], m[2], m[3]
+		} else {
+			result.Messages = append(result.Messages, line)
+			if len(result.Messages) > maxBuildMessages {
+				result.Messages = result.Messages[1:]
+			}
+			continue
+		}
+		seen[line] = true
+
+		codeJSON, _ := json.Marshal(code)
+		diagnostic := Diagnostic{
+			Range:    r,
+			Severity: compilerSeverity(severity),
+			Code:     codeJSON,
+			Source:   buildSource,
+			Message:  message,
+		}
+		switch diagnostic.Severity {
+		case SeverityError:
+			result.Errors++
+		case SeverityWarning:
+			result.Warnings++
+		}
+		path = NormalizePath(filepath.Clean(path))
+		files[path] = append(files[path], diagnostic)
+	}
+
+	for path, diagnostics := range files {
+		result.Files = append(result.Files, BuildFileDiagnostics{Path: path, URI: PathToFileURI(path), Diagnostics: diagnostics})
+	}
+	sort.Slice(result.Files, func(i, j int) bool { return result.Files[i].Path < result.Files[j].Path })
+	return result
+}
+
+// compilerPosition converts alc's one-based line and column
+func compilerPosition(line string, column string) Position {
+	l, _ := strconv.Atoi(line)
+	c, _ := strconv.Atoi(column)
+	if l > 0 {
+		l--
+	}
+	if c > 0 {
+		c--
+	}
+	return Position{Line: l, Character: c}
+}
+
+// compilerSeverity maps an alc severity to an LSP severity
+func compilerSeverity(severity string) int {
+	switch severity {
+	case "error":
+		return SeverityError
+	case "warning":
+		return SeverityWarning
+	case "info":
+		return SeverityInformation
+	}
+	return SeverityHint
+}
+
+// buildDiagnostics holds the diagnostics of the last build of each project
+type buildDiagnostics struct {
+	mu sync.Mutex
+	// running holds the projects being built
+	running map[string]bool
+	// projects maps a project root to its build diagnostics by file path
+	projects map[string]map[string][]Diagnostic
+}
+
+func newBuildDiagnostics() *buildDiagnostics {
+	return &buildDiagnostics{
+		running:  make(map[string]bool),
+		projects: make(map[string]map[string][]Diagnostic),
+	}
+}
+
+// BuildProject compiles a project with alc as configured (build.*) and
+// publishes its diagnostics to the client
+func (w *ALLSPWrapper) BuildProject(projectRoot string) (*BuildResult, error) {
+	b := w.builds
+	b.mu.Lock()
+	if b.running[projectRoot] {
+		b.mu.Unlock()
+		return nil, fmt.Errorf("a build of %s is already running", projectRoot)
+	}
+	b.running[projectRoot] = true
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		delete(b.running, projectRoot)
+		b.mu.Unlock()
+	}()
+
+	config := w.Config()
+	cfg := config.Build
+	compiler := cfg.CompilerPath
+	if extensionPath := w.serverExtensionPath(); compiler == "" && extensionPath != "" {
+		var err error
+		if compiler, err = FindALCompiler(extensionPath); err != nil {
+			return nil, err
+		}
+	}
+	w.Log("Building %s with %s", projectRoot, compiler)
+	result, err := BuildProject(BuildOptions{
+		ProjectRoot:   projectRoot,
+		Compiler:      compiler,
+		Arguments:     cfg.Arguments,
+		DotNet:        config.DotNet,
+		RuleSet:       config.RuleSet,
+		WorkspaceRoot: w.WorkspaceRoot(),
+		Timeout:       time.Duration(cfg.TimeoutSeconds) * time.Second,
+	})
+	if err != nil {
+		w.Log("Build failed: %v", err)
+		return nil, err
+	}
+	w.Log("Built %s in %.0fms: %d error(s), %d warning(s)", projectRoot, result.DurationMs, result.Errors, result.Warnings)
+
+	files := make(map[string][]Diagnostic)
+	for i := range result.Files {
+		diagnostics := ApplyDiagnosticRules(result.Files[i].Diagnostics, config.Diagnostics)
+		addCodeDescriptions(diagnostics)
+		result.Files[i].Diagnostics = diagnostics
+		if len(diagnostics) > 0 {
+			files[result.Files[i].Path] = diagnostics
+		}
+	}
+
+	b.mu.Lock()
+	changed := make(map[string]bool)
+	for path := range b.projects[projectRoot] {
+		changed[path] = true
+	}
+	for path := range files {
+		changed[path] = true
+	}
+	b.projects[projectRoot] = files
+	b.mu.Unlock()
+
+	paths := make([]string, 0, len(changed))
+	for path := range changed {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		w.republishDiagnostics(path)
+	}
+	return result, nil
+}
+
+// clearBuildDiagnostics drops the build diagnostics of a file the client
+// edits; their positions no longer match
+func (w *ALLSPWrapper) clearBuildDiagnostics(msg *Message) {
+	if msg.Method != "textDocument/didChange" {
+		return
+	}
+	path, err := FileURIToPath(documentURI(msg))
+	if err != nil {
+		return
+	}
+	path = NormalizePath(path)
+	b := w.builds
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, files := range b.projects {
+		delete(files, path)
+	}
+}
+
+// withBuildDiagnostics returns a file's diagnostics with those of the last
+// build added, leaving out the ones the AL server reports too
+func (w *ALLSPWrapper) withBuildDiagnostics(path string, diagnostics []Diagnostic) []Diagnostic {
+	b := w.builds
+	b.mu.Lock()
+	var built []Diagnostic
+	for _, files := range b.projects {
+		built = append(built, files[path]...)
+	}
+	b.mu.Unlock()
+	if len(built) == 0 {
+		return diagnostics
+	}
+
+	reported := make(map[string]bool)
+	key := func(d *Diagnostic) string {
+		return fmt.Sprintf("%s|%d|%d|%s", d.RuleID(), d.Range.Start.Line, d.Range.Start.Character, d.Message)
+	}
+	for i := range diagnostics {
+		reported[key(&diagnostics[i])] = true
+	}
+	merged := append([]Diagnostic{}, diagnostics...)
+	for i := range built {
+		if !reported[key(&built[i])] {
+			merged = append(merged, built[i])
+		}
+	}
+	return merged
+}
+
+func buildCommand(msg *Message, args []json.RawMessage, w WrapperInterface) (*Message, *Message) {
+	var cmdArgs BuildCommandArgs
+	if err := decodeCommandArgs(args, &cmdArgs); err != nil {
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "Invalid "+BuildCommand+" arguments: "+err.Error())
+	}
+	projectRoot := resolveCommandProject(cmdArgs.Project, w)
+	if projectRoot == "" {
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "No AL project found to build")
+	}
+
+	result, err := w.BuildProject(projectRoot)
+	if err != nil {
+		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	}
+	return newResultMessage(msg.ID, result)
+}
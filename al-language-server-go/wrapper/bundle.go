@@ -0,0 +1,260 @@
+package wrapper
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/SShadowS/claude-code-lsps/al-language-server-go/internal/hostarch"
+)
+
+const (
+	// bundleLogBytes is how much of the end of the wrapper log goes into a bundle
+	bundleLogBytes = 512 * 1024
+	// bundleStderrLines is how many AL server stderr lines go into a bundle
+	bundleStderrLines = 200
+)
+
+// sensitiveKeyPattern matches config keys whose values must not leave the machine
+var sensitiveKeyPattern = regexp.MustCompile(`(?i)password|secret|token|credential|apikey|authentication`)
+
+// SupportEnvironment describes the machine a support bundle was created on
+type SupportEnvironment struct {
+	WrapperVersion   string            `json:"wrapperVersion"`
+	GoVersion        string            `json:"goVersion"`
+	Platform         string            `json:"platform"`
+	HostArch         string            `json:"hostArch"`
+	CreatedAt        time.Time         `json:"createdAt"`
+	WorkspaceDir     string            `json:"workspaceDir"`
+	ExtensionPath    string            `json:"extensionPath"`
+	ExtensionVersion string            `json:"extensionVersion"`
+	ExtensionError   string            `json:"extensionError,omitempty"`
+	Executable       string            `json:"executable"`
+	ExecutableExists bool              `json:"executableExists"`
+	ExecutableArch   string            `json:"executableArch"`
+	ExecutableAdvice string            `json:"executableAdvice,omitempty"`
+	LogDir           string            `json:"logDir"`
+	ConfigPaths      []string          `json:"configPaths"`
+	Environment      map[string]string `json:"environment"`
+}
+
+// WriteSupportBundle writes a zip with the recent wrapper log, the AL server
+// stderr tail, the last self-test report, the sanitized config and
+// environment facts, for attaching to GitHub issues
+func WriteSupportBundle(outPath string, workspaceDir string) error {
+	f, err := os.Create(outPath)
+	if err != nil {
+		return fmt.Errorf("failed to create bundle: %w", err)
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+
+	logTail := ""
+	logPath, logErr := FindLatestLogPath()
+	if logErr == nil {
+		logTail, logErr = readFileTail(logPath, bundleLogBytes)
+	}
+	if logErr != nil {
+		logTail = fmt.Sprintf("failed to read log: %v\n", logErr)
+	}
+	logTail = sanitizeText(logTail)
+
+	files := map[string]string{
+		"wrapper.log":      logTail,
+		"al-server-stderr": extractStderrTail(logTail, bundleStderrLines),
+		"self-test.json":   extractLastSelfTest(logTail),
+		"config.json":      sanitizedConfig(workspaceDir),
+		"environment.json": sanitizeText(toIndentedJSON(collectSupportEnvironment(workspaceDir))),
+	}
+
+	for _, name := range []string{"environment.json", "self-test.json", "config.json", "al-server-stderr", "wrapper.log"} {
+		entry, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(entry, files[name]); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// collectSupportEnvironment gathers the environment facts for a bundle
+func collectSupportEnvironment(workspaceDir string) SupportEnvironment {
+	env := SupportEnvironment{
+		WrapperVersion: Version,
+		GoVersion:      runtime.Version(),
+		Platform:       runtime.GOOS + "/" + runtime.GOARCH,
+		HostArch:       hostarch.Native(),
+		CreatedAt:      time.Now(),
+		WorkspaceDir:   workspaceDir,
+		LogDir:         GetStateDir(),
+		ConfigPaths:    GetConfigPaths(workspaceDir),
+		Environment:    map[string]string{},
+	}
+
+	if extensionPath, err := FindALExtension(); err != nil {
+		env.ExtensionError = err.Error()
+	} else {
+		env.ExtensionPath = extensionPath
+		env.ExtensionVersion = ALExtensionVersion(extensionPath)
+		selection := SelectALLSPExecutable(extensionPath)
+		env.Executable = selection.Path
+		env.ExecutableArch = selection.Arch
+		env.ExecutableAdvice = selection.Advice
+		_, statErr := os.Stat(env.Executable)
+		env.ExecutableExists = statErr == nil
+	}
+
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		upper := strings.ToUpper(name)
+		if strings.HasPrefix(upper, "AL_") || strings.HasPrefix(upper, "XDG_") ||
+			upper == "ENABLE_LSP_TOOL" || upper == "PROCESSOR_ARCHITECTURE" {
+			if sensitiveKeyPattern.MatchString(name) {
+				value = "[redacted]"
+			}
+			env.Environment[name] = value
+		}
+	}
+
+	return env
+}
+
+// sanitizedConfig returns the effective config with secrets redacted
+func sanitizedConfig(workspaceDir string) string {
+	cfg, err := LoadConfig(workspaceDir)
+	data, marshalErr := json.Marshal(cfg)
+	if marshalErr != nil {
+		return marshalErr.Error()
+	}
+
+	var tree interface{}
+	json.Unmarshal(data, &tree)
+	result := map[string]interface{}{
+		"sources":  cfg.Sources(),
+		"settings": redactSensitive(tree),
+	}
+	if err != nil {
+		result["errors"] = err.Error()
+	}
+	return sanitizeText(toIndentedJSON(result))
+}
+
+// redactSensitive replaces the values of sensitive-looking keys in a JSON tree
+func redactSensitive(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if sensitiveKeyPattern.MatchString(key) {
+				v[key] = "[redacted]"
+			} else {
+				v[key] = redactSensitive(child)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = redactSensitive(v[i])
+		}
+	}
+	return value
+}
+
+// sanitizeText replaces the home directory and user name with placeholders
+func sanitizeText(text string) string {
+	if home, err := os.UserHomeDir(); err == nil && home != "" {
+		text = strings.ReplaceAll(text, home, "~")
+		text = strings.ReplaceAll(text, strings.ReplaceAll(home, `\`, `\\`), "~")
+		text = strings.ReplaceAll(text, strings.ReplaceAll(home, `\`, "/"), "~")
+	}
+	if u, err := user.Current(); err == nil {
+		name := u.Username
+		if i := strings.LastIndexAny(name, `\/`); i >= 0 {
+			name = name[i+1:]
+		}
+		if len(name) > 2 {
+			text = strings.ReplaceAll(text, name, "[user]")
+		}
+	}
+	return text
+}
+
+// readFileTail returns up to maxBytes from the end of a file, starting at a line boundary
+func readFileTail(path string, maxBytes int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	offset := int64(0)
+	if info.Size() > maxBytes {
+		offset = info.Size() - maxBytes
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return "", err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return "", err
+	}
+
+	text := string(data)
+	if offset > 0 {
+		if i := strings.IndexByte(text, '\n'); i >= 0 {
+			text = text[i+1:]
+		}
+	}
+	return text, nil
+}
+
+// extractStderrTail returns the last AL server stderr lines recorded in a log
+func extractStderrTail(logText string, maxLines int) string {
+	var lines []string
+	for _, line := range strings.Split(logText, "\n") {
+		if strings.Contains(line, "[AL LSP stderr]") {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > maxLines {
+		lines = lines[len(lines)-maxLines:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// extractLastSelfTest returns the JSON body of the last self-test block in a log
+func extractLastSelfTest(logText string) string {
+	const begin, end = "=== Self-test report ===", "=== End self-test report ==="
+	start := strings.LastIndex(logText, begin)
+	if start < 0 {
+		return "{}"
+	}
+	body := logText[start+len(begin):]
+	if stop := strings.Index(body, end); stop >= 0 {
+		body = body[:stop]
+	}
+	return strings.TrimSpace(body)
+}
+
+// toIndentedJSON marshals v for human consumption
+func toIndentedJSON(v interface{}) string {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
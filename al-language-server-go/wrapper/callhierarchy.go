@@ -0,0 +1,424 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// The AL server has no call hierarchy, so the wrapper synthesizes it from
+// requests the server does answer. prepareCallHierarchy returns the procedure
+// or trigger declared at the position, or the one the identifier there is
+// defined as. Incoming calls are the references to the procedure, grouped by
+// the procedure or trigger containing them. Outgoing calls are found by
+// scanning the procedure body for calls (identifiers followed by "(" or ";",
+// or after a ".") and resolving each with a definition lookup; those that
+// resolve to a procedure or trigger declaration are the calls.
+
+// maxOutgoingLookups caps the definition lookups for one outgoing calls request
+const maxOutgoingLookups = 200
+
+// symbolKindEvent is the LSP SymbolKind used for triggers
+const symbolKindEvent = 24
+
+var (
+	// beginPattern matches the begin keyword opening a procedure body
+	beginPattern = regexp.MustCompile(`(?i)\bbegin\b`)
+	// qualifierPattern matches the qualifier before a member access, e.g. `Customer.`
+	qualifierPattern = regexp.MustCompile(`("(?:[^"]|"")+"|[A-Za-z_][A-Za-z0-9_]*)\s*\.\s*$`)
+)
+
+// CallHierarchyItem is a procedure or trigger in a call hierarchy
+type CallHierarchyItem struct {
+	Name           string          `json:"name"`
+	Kind           int             `json:"kind"`
+	Detail         string          `json:"detail,omitempty"`
+	URI            string          `json:"uri"`
+	Range          Range           `json:"range"`
+	SelectionRange Range           `json:"selectionRange"`
+	Data           json.RawMessage `json:"data,omitempty"`
+}
+
+// CallHierarchyIncomingCall is a procedure or trigger calling the item
+type CallHierarchyIncomingCall struct {
+	From       CallHierarchyItem `json:"from"`
+	FromRanges []Range           `json:"fromRanges"`
+}
+
+// CallHierarchyOutgoingCall is a procedure or trigger the item calls
+type CallHierarchyOutgoingCall struct {
+	To         CallHierarchyItem `json:"to"`
+	FromRanges []Range           `json:"fromRanges"`
+}
+
+// CallHierarchyHandler handles textDocument/prepareCallHierarchy,
+// callHierarchy/incomingCalls and callHierarchy/outgoingCalls
+type CallHierarchyHandler struct{}
+
+func (h *CallHierarchyHandler) ShouldHandle(method string) bool {
+	return method == "textDocument/prepareCallHierarchy" ||
+		method == "callHierarchy/incomingCalls" ||
+		method == "callHierarchy/outgoingCalls"
+}
+
+func (h *CallHierarchyHandler) Handle(msg *Message, w WrapperInterface) (*Message, *Message) {
+	if msg.Method == "textDocument/prepareCallHierarchy" {
+		return h.prepare(msg, w)
+	}
+
+	var params struct {
+		Item CallHierarchyItem `json:"item"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil || params.Item.URI == "" {
+		w.Log("Failed to parse %s params: %v", msg.Method, err)
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "Invalid parameters")
+	}
+
+	filePath, err := FileURIToPath(params.Item.URI)
+	if err != nil {
+		w.Log("Failed to convert URI: %v", err)
+		return nil, NewErrorResponse(msg.ID, InternalError, "Invalid file URI")
+	}
+
+	// Ensure the file is opened
+	if err := w.EnsureFileOpened(filePath); err != nil {
+		w.Log("Failed to open file: %v", err)
+		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	}
+
+	// Ensure project is initialized, or degrade to the file alone
+	if errResp := ensureProjectForRequest(msg, filePath, w); errResp != nil {
+		return nil, errResp
+	}
+
+	var calls interface{}
+	if msg.Method == "callHierarchy/incomingCalls" {
+		incoming, errResp := h.incomingCalls(msg, params.Item, filePath, w)
+		if errResp != nil {
+			return nil, errResp
+		}
+		w.Log("Synthesized %d incoming call(s) of %s", len(incoming), params.Item.Name)
+		calls = incoming
+	} else {
+		outgoing := h.outgoingCalls(params.Item, filePath, w)
+		w.Log("Synthesized %d outgoing call(s) of %s", len(outgoing), params.Item.Name)
+		calls = outgoing
+	}
+
+	data, err := json.Marshal(calls)
+	if err != nil {
+		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	}
+	return newResultMessage(msg.ID, markProvenance(data, msg.Method, provenanceCallHierarchy, w))
+}
+
+// prepare handles textDocument/prepareCallHierarchy
+func (h *CallHierarchyHandler) prepare(msg *Message, w WrapperInterface) (*Message, *Message) {
+	var params TextDocumentPositionParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		w.Log("Failed to parse prepareCallHierarchy params: %v", err)
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "Invalid parameters")
+	}
+
+	filePath, err := FileURIToPath(params.TextDocument.URI)
+	if err != nil {
+		w.Log("Failed to convert URI: %v", err)
+		return nil, NewErrorResponse(msg.ID, InternalError, "Invalid file URI")
+	}
+
+	// Ensure the file is opened
+	if err := w.EnsureFileOpened(filePath); err != nil {
+		w.Log("Failed to open file: %v", err)
+		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	}
+
+	// Ensure project is initialized, or degrade to the file alone
+	if errResp := ensureProjectForRequest(msg, filePath, w); errResp != nil {
+		return nil, errResp
+	}
+
+	// A declaration at the position, or the definition of the identifier there
+	item, ok := callableAt(params.TextDocument.URI, filePath, params.Position.Line)
+	if !ok {
+		method, definitionParams := definitionRequest(params, w)
+		response, err := w.SendRequestToLSP(method, definitionParams)
+		if err != nil {
+			w.Log("Failed to send definition request: %v", err)
+			return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+		}
+		if response.Error == nil {
+			item, ok = callableAtDefinition(response.Result)
+		}
+	}
+	if !ok {
+		w.Log("prepareCallHierarchy: no procedure or trigger at %d:%d", params.Position.Line, params.Position.Character)
+		return newResultMessage(msg.ID, nil)
+	}
+
+	data, err := json.Marshal([]CallHierarchyItem{item})
+	if err != nil {
+		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	}
+	return newResultMessage(msg.ID, markProvenance(data, msg.Method, provenanceCallHierarchy, w))
+}
+
+// incomingCalls groups the references to an item by the procedure or
+// trigger containing them
+func (h *CallHierarchyHandler) incomingCalls(msg *Message, item CallHierarchyItem, filePath string, w WrapperInterface) ([]CallHierarchyIncomingCall, *Message) {
+	var params struct {
+		TextDocument TextDocumentIdentifier `json:"textDocument"`
+		Position     Position               `json:"position"`
+		Context      struct {
+			IncludeDeclaration bool `json:"includeDeclaration"`
+		} `json:"context"`
+	}
+	params.TextDocument.URI = item.URI
+	params.Position = item.SelectionRange.Start
+
+	progress := w.BeginProgress("Finding callers of " + item.Name)
+	defer progress.End("")
+	response, err := w.SendRequestToLSP("textDocument/references", params)
+	if err != nil {
+		w.Log("Failed to send references request: %v", err)
+		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	}
+	if response.Error != nil {
+		return nil, &Message{
+			JSONRPC: "2.0",
+			ID:      msg.ID,
+			Error:   response.Error,
+		}
+	}
+	var locations []Location
+	json.Unmarshal(response.Result, &locations)
+
+	outlines := make(map[string]alOutline)
+	sources := make(map[string][]string)
+	byCaller := make(map[string]*CallHierarchyIncomingCall)
+	var keys []string
+	for _, loc := range locations {
+		path, err := FileURIToPath(loc.URI)
+		if err != nil {
+			continue
+		}
+		// The declaration itself is not a call
+		if path == filePath && loc.Range.Start.Line == item.SelectionRange.Start.Line {
+			continue
+		}
+		outline, ok := outlines[path]
+		if !ok {
+			outline = parseOutline(path)
+			outlines[path] = outline
+			sources[path] = readSourceLines(path)
+		}
+		// Code only runs in procedures and triggers; other references are not calls
+		member, ok := outline.memberAt(loc.Range.Start.Line)
+		if !ok {
+			continue
+		}
+		key := fmt.Sprintf("%s:%d", loc.URI, member.startLine)
+		call := byCaller[key]
+		if call == nil {
+			call = &CallHierarchyIncomingCall{From: callHierarchyItem(loc.URI, outline, member, sources[path])}
+			byCaller[key] = call
+			keys = append(keys, key)
+		}
+		call.FromRanges = append(call.FromRanges, loc.Range)
+	}
+
+	calls := make([]CallHierarchyIncomingCall, 0, len(keys))
+	for _, key := range keys {
+		calls = append(calls, *byCaller[key])
+	}
+	sort.Slice(calls, func(i, j int) bool {
+		return callItemLess(calls[i].From, calls[j].From)
+	})
+	return calls, nil
+}
+
+// outgoingCalls finds the calls in an item's body by resolving the
+// identifiers that look like calls
+func (h *CallHierarchyHandler) outgoingCalls(item CallHierarchyItem, filePath string, w WrapperInterface) []CallHierarchyOutgoingCall {
+	outline := parseOutline(filePath)
+	member, ok := outline.memberAt(item.SelectionRange.Start.Line)
+	if !ok {
+		return []CallHierarchyOutgoingCall{}
+	}
+	lines := readSourceLines(filePath)
+
+	// The body starts at begin, after the parameters and local variables
+	body := -1
+	for line := member.startLine; line <= member.endLine && line < len(lines); line++ {
+		if beginPattern.MatchString(maskALNonCode(lines[line])) {
+			body = line
+			break
+		}
+	}
+	if body < 0 {
+		return []CallHierarchyOutgoingCall{}
+	}
+
+	progress := w.BeginProgress("Finding calls made by " + item.Name)
+	defer progress.End("")
+
+	resolved := make(map[string]*CallHierarchyItem)
+	byCallee := make(map[string]*CallHierarchyOutgoingCall)
+	var keys []string
+	lookups := 0
+	for line := body; line <= member.endLine && line < len(lines); line++ {
+		progress.Report(fmt.Sprintf("line %d", line+1), (line-body)*100/(member.endLine-body+1))
+		text := lines[line]
+		code := maskALNonCode(text)
+		for _, loc := range identifierPattern.FindAllStringIndex(code, -1) {
+			name := text[loc[0]:loc[1]]
+			if !looksLikeCall(code, loc[0], loc[1]) || renameKeywords[strings.ToLower(name)] {
+				continue
+			}
+
+			// The same qualified name in one body calls the same procedure
+			lookupKey := strings.ToLower(name)
+			if m := qualifierPattern.FindStringSubmatch(code[:loc[0]]); m != nil {
+				lookupKey = strings.ToLower(m[1]) + "." + lookupKey
+			}
+			callee, seen := resolved[lookupKey]
+			if !seen {
+				if lookups >= maxOutgoingLookups {
+					continue
+				}
+				lookups++
+				callee = resolveCallee(item.URI, Position{Line: line, Character: utf16Length(text[:loc[0]])}, w)
+				resolved[lookupKey] = callee
+			}
+			if callee == nil {
+				continue
+			}
+
+			start := Position{Line: line, Character: utf16Length(text[:loc[0]])}
+			fromRange := Range{Start: start, End: Position{Line: line, Character: start.Character + utf16Length(name)}}
+			key := fmt.Sprintf("%s:%d", callee.URI, callee.SelectionRange.Start.Line)
+			call := byCallee[key]
+			if call == nil {
+				call = &CallHierarchyOutgoingCall{To: *callee}
+				byCallee[key] = call
+				keys = append(keys, key)
+			}
+			call.FromRanges = append(call.FromRanges, fromRange)
+		}
+	}
+	if lookups >= maxOutgoingLookups {
+		w.Log("Outgoing calls of %s: stopped resolving after %d lookups", item.Name, maxOutgoingLookups)
+	}
+
+	calls := make([]CallHierarchyOutgoingCall, 0, len(keys))
+	for _, key := range keys {
+		calls = append(calls, *byCallee[key])
+	}
+	sort.Slice(calls, func(i, j int) bool {
+		return callItemLess(calls[i].To, calls[j].To)
+	})
+	return calls
+}
+
+// looksLikeCall reports whether the identifier at [start, end) of a masked
+// line is followed by "(" or ";", or is a member access
+func looksLikeCall(code string, start int, end int) bool {
+	rest := strings.TrimLeft(code[end:], " \t")
+	if strings.HasPrefix(rest, "(") || strings.HasPrefix(rest, ";") {
+		return true
+	}
+	return strings.HasSuffix(strings.TrimRight(code[:start], " \t"), ".") && !strings.HasPrefix(rest, ":=")
+}
+
+// resolveCallee looks up the definition of an identifier and returns the
+// procedure or trigger it is, or nil
+func resolveCallee(uri string, pos Position, w WrapperInterface) *CallHierarchyItem {
+	params := TextDocumentPositionParams{TextDocument: TextDocumentIdentifier{URI: uri}, Position: pos}
+	method, definitionParams := definitionRequest(params, w)
+	response, err := w.SendRequestToLSP(method, definitionParams)
+	if err != nil || response.Error != nil {
+		return nil
+	}
+	item, ok := callableAtDefinition(response.Result)
+	if !ok {
+		return nil
+	}
+	return &item
+}
+
+// callableAtDefinition returns the procedure or trigger declared at the
+// first location of a definition result
+func callableAtDefinition(result json.RawMessage) (CallHierarchyItem, bool) {
+	uri, line, ok := firstDefinitionLocation(result)
+	if !ok {
+		return CallHierarchyItem{}, false
+	}
+	path, err := FileURIToPath(uri)
+	if err != nil {
+		return CallHierarchyItem{}, false
+	}
+	return callableAt(uri, path, line)
+}
+
+// callableAt returns the procedure or trigger declared at a line of a file
+func callableAt(uri string, path string, line int) (CallHierarchyItem, bool) {
+	outline := parseOutline(path)
+	for _, member := range outline.members {
+		if member.startLine == line {
+			return callHierarchyItem(uri, outline, member, readSourceLines(path)), true
+		}
+	}
+	return CallHierarchyItem{}, false
+}
+
+// memberAt returns the procedure or trigger containing a line
+func (o alOutline) memberAt(line int) (alMember, bool) {
+	var found alMember
+	ok := false
+	for _, member := range o.members {
+		if member.startLine <= line && line <= member.endLine {
+			found, ok = member, true
+		}
+	}
+	return found, ok
+}
+
+// callHierarchyItem describes a procedure or trigger for the call hierarchy
+func callHierarchyItem(uri string, outline alOutline, member alMember, lines []string) CallHierarchyItem {
+	item := CallHierarchyItem{
+		Name: member.name,
+		Kind: symbolKindMethod,
+		URI:  uri,
+	}
+	if member.kind == "trigger" {
+		item.Kind = symbolKindEvent
+	}
+	if obj, ok := outline.objectAt(member.startLine); ok {
+		item.Detail = obj.DisplayName()
+	}
+
+	item.Range.Start = Position{Line: member.startLine}
+	item.Range.End = Position{Line: member.endLine}
+	if member.endLine < len(lines) {
+		item.Range.End.Character = utf16Length(lines[member.endLine])
+	}
+	item.SelectionRange = Range{Start: item.Range.Start, End: item.Range.Start}
+	if member.startLine < len(lines) {
+		declaration := lines[member.startLine]
+		if m := memberDeclPattern.FindStringSubmatchIndex(maskALNonCode(declaration)); m != nil {
+			start := Position{Line: member.startLine, Character: utf16Length(declaration[:m[4]])}
+			end := Position{Line: member.startLine, Character: utf16Length(declaration[:m[5]])}
+			item.SelectionRange = Range{Start: start, End: end}
+		}
+	}
+	return item
+}
+
+// callItemLess orders call hierarchy items by file and line
+func callItemLess(a CallHierarchyItem, b CallHierarchyItem) bool {
+	if a.URI != b.URI {
+		return a.URI < b.URI
+	}
+	return a.SelectionRange.Start.Line < b.SelectionRange.Start.Line
+}
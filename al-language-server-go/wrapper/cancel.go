@@ -0,0 +1,62 @@
+package wrapper
+
+import (
+	"time"
+)
+
+// abandonedRequestTTL is how long a timed-out request is remembered to
+// recognize its late response
+const abandonedRequestTTL = 10 * time.Minute
+
+// abandonedRequest is a request the wrapper stopped waiting for
+type abandonedRequest struct {
+	method string
+	span   string
+	at     time.Time
+}
+
+// CancelParams represents $/cancelRequest parameters
+type CancelParams struct {
+	ID int `json:"id"`
+}
+
+// abandonRequest records a timed-out request and asks the AL server to stop
+// working on it, so the server is not left busy with work nobody waits for
+func (w *ALLSPWrapper) abandonRequest(span string, id int, method string) {
+	now := time.Now()
+	w.pendingMu.Lock()
+	for oldID, req := range w.abandonedReqs {
+		if now.Sub(req.at) > abandonedRequestTTL {
+			delete(w.abandonedReqs, oldID)
+		}
+	}
+	w.abandonedReqs[id] = abandonedRequest{method: method, span: span, at: now}
+	w.pendingMu.Unlock()
+
+	if err := w.sendNotification(span, "$/cancelRequest", CancelParams{ID: id}); err != nil {
+		w.logTagged(span, "Failed to cancel AL LSP request id=%d: %v", id, err)
+	}
+}
+
+// handleUnmatchedResponse logs a response nobody is waiting for: usually the
+// late answer (or cancellation acknowledgement) of an abandoned request
+func (w *ALLSPWrapper) handleUnmatchedResponse(msg *Message) {
+	id := msg.GetIDInt()
+	w.pendingMu.Lock()
+	req, ok := w.abandonedReqs[id]
+	delete(w.abandonedReqs, id)
+	w.pendingMu.Unlock()
+
+	if !ok {
+		w.Log("Dropping unexpected response from AL LSP: id=%d", id)
+		return
+	}
+	outcome := "completed"
+	if msg.Error != nil && msg.Error.Code == RequestCancelled {
+		outcome = "cancelled"
+	} else if msg.Error != nil {
+		outcome = "failed: " + msg.Error.Message
+	}
+	w.logTagged(req.span, "Late response from AL LSP for abandoned request: method=%s id=%d %s after %s",
+		req.method, id, outcome, time.Since(req.at).Round(time.Millisecond))
+}
@@ -0,0 +1,115 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AL extension versions differ in which al/* custom methods they implement.
+// Right after initialization the wrapper sends each custom method it relies
+// on a harmless request; a method answered with MethodNotFound is recorded as
+// unsupported and handlers take their standard-LSP path instead of failing on
+// every request. Methods that answer with any other error, or do not answer
+// in time, are assumed to be supported.
+
+// capabilityProbeTimeout bounds each startup probe
+const capabilityProbeTimeout = 5 * time.Second
+
+// capabilityProbeURI is a document that does not exist, so probes do no real work
+const capabilityProbeURI = "file:///al-lsp-wrapper-probe.al"
+
+// alMethodProbes are the custom methods the wrapper relies on, with params
+// that are valid but cheap to answer
+var alMethodProbes = []struct {
+	method string
+	params interface{}
+}{
+	{"al/gotodefinition", ALGotoDefinitionParams{
+		TextDocumentPositionParams: TextDocumentPositionParams{TextDocument: TextDocumentIdentifier{URI: capabilityProbeURI}},
+	}},
+	{"al/symbolSearch", ALSymbolSearchParams{Filter: "AlLspWrapperCapabilityProbe"}},
+	{"al/hasProjectClosureLoadedRequest", nil},
+}
+
+// probeALMethods finds out which al/* methods the running AL server supports
+func (w *ALLSPWrapper) probeALMethods(scope WrapperInterface) {
+	start := time.Now()
+	supported := make(map[string]bool, len(alMethodProbes))
+	for _, probe := range alMethodProbes {
+		resp, err := scope.SendRequestToLSPWithTimeout(probe.method, probe.params, capabilityProbeTimeout)
+		switch {
+		case err != nil:
+			scope.Log("Capability probe for %s inconclusive (%v); assuming supported", probe.method, err)
+			supported[probe.method] = true
+		case resp.Error != nil && resp.Error.Code == MethodNotFound:
+			scope.Log("AL server does not support %s; using fallbacks", probe.method)
+			supported[probe.method] = false
+		default:
+			supported[probe.method] = true
+		}
+		if probe.method == "al/symbolSearch" && err == nil && resp.Error == nil {
+			scope.Log("al/symbolSearch result shape: %s", jsonShape(resp.Result))
+		}
+	}
+
+	// Probe errors say nothing about the health of the server
+	w.resetCircuits()
+
+	w.capMu.Lock()
+	w.alMethods = supported
+	w.capMu.Unlock()
+	w.selfTest.update(func(r *SelfTestReport) { r.ALMethods = supported })
+	w.selfTest.phase("probeALMethods", start, nil)
+}
+
+// SupportsALMethod reports whether the AL server implements a custom method.
+// Methods that were not probed, or not yet, are assumed to be supported.
+func (w *ALLSPWrapper) SupportsALMethod(method string) bool {
+	w.capMu.Lock()
+	defer w.capMu.Unlock()
+	supported, probed := w.alMethods[method]
+	return supported || !probed
+}
+
+// jsonShape names the top-level JSON type of a result, for logging
+func jsonShape(data json.RawMessage) string {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return "invalid"
+	}
+	switch v.(type) {
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	case nil:
+		return "null"
+	default:
+		return "scalar"
+	}
+}
+
+// normalizeSymbolSearchResult returns an al/symbolSearch result as a symbol
+// array. Some AL server versions wrap the array in an object; the array is
+// taken from its only array-valued property.
+func normalizeSymbolSearchResult(result json.RawMessage) json.RawMessage {
+	var wrapped map[string]json.RawMessage
+	if err := json.Unmarshal(result, &wrapped); err != nil {
+		return result
+	}
+	var found json.RawMessage
+	for _, value := range wrapped {
+		var items []json.RawMessage
+		if json.Unmarshal(value, &items) != nil {
+			continue
+		}
+		if found != nil {
+			return result
+		}
+		found = value
+	}
+	if found == nil {
+		return json.RawMessage("[]")
+	}
+	return found
+}
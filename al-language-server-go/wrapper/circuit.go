@@ -0,0 +1,153 @@
+package wrapper
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// A method the AL server keeps failing (al/symbolSearch timing out on a
+// broken project, say) would otherwise cost the full request timeout on
+// every call. After CircuitBreaker.Threshold consecutive failures the
+// method's circuit opens: requests fail immediately with ErrCircuitOpen
+// until the cooldown has passed, then a single request is let through to
+// probe whether the server has recovered. Only requests the server did not
+// answer (the write failed or the request timed out) are failures; an error
+// response, such as invalid params for one document, shows the server works.
+
+// ErrCircuitOpen is returned for requests to a method whose circuit is open
+var ErrCircuitOpen = errors.New("circuit open")
+
+// circuitExemptMethods are never short-circuited: the session cannot work
+// without them, and activating or loading a project may take longer than any
+// request timeout
+var circuitExemptMethods = map[string]bool{
+	"initialize":                        true,
+	"shutdown":                          true,
+	"al/setActiveWorkspace":             true,
+	"al/hasProjectClosureLoadedRequest": true,
+}
+
+// circuit tracks consecutive failures of one AL server method
+type circuit struct {
+	failures  int
+	openUntil time.Time
+	lastError string
+	trips     int
+}
+
+// CircuitStatus describes the circuit of one AL server method
+type CircuitStatus struct {
+	Method              string     `json:"method"`
+	Open                bool       `json:"open"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	OpenUntil           *time.Time `json:"openUntil,omitempty"`
+	LastError           string     `json:"lastError,omitempty"`
+	Trips               int        `json:"trips"`
+}
+
+// checkCircuit returns an error wrapping ErrCircuitOpen if requests to
+// method are currently short-circuited
+func (w *ALLSPWrapper) checkCircuit(method string) error {
+	if w.Config().CircuitBreaker.Threshold <= 0 || circuitExemptMethods[method] {
+		return nil
+	}
+	w.circuitMu.Lock()
+	defer w.circuitMu.Unlock()
+	c := w.circuits[method]
+	if c == nil || c.openUntil.IsZero() {
+		return nil
+	}
+	if remaining := time.Until(c.openUntil); remaining > 0 {
+		return fmt.Errorf("%w: %s failed %d times in a row (last: %s); retrying in %s",
+			ErrCircuitOpen, method, c.failures, c.lastError, remaining.Round(time.Second))
+	}
+	// Cooldown over: let this request probe the server, and only this one
+	c.openUntil = time.Now().Add(w.circuitCooldown())
+	return nil
+}
+
+// recordOutcome updates the circuit of method after a request was sent.
+// failure is the transport error or timeout of the request, nil if the
+// server answered it, even with an error.
+func (w *ALLSPWrapper) recordOutcome(span string, method string, failure error) {
+	if w.Config().CircuitBreaker.Threshold <= 0 || circuitExemptMethods[method] {
+		return
+	}
+	w.circuitMu.Lock()
+	defer w.circuitMu.Unlock()
+	c := w.circuits[method]
+	if failure == nil {
+		if c != nil && c.failures > 0 {
+			if !c.openUntil.IsZero() {
+				w.logTagged(span, "Circuit for %s closed: AL LSP answered again", method)
+			}
+			c.failures = 0
+			c.openUntil = time.Time{}
+		}
+		return
+	}
+
+	if c == nil {
+		c = &circuit{}
+		w.circuits[method] = c
+	}
+	c.failures++
+	c.lastError = failure.Error()
+	if c.failures >= w.Config().CircuitBreaker.Threshold {
+		if c.openUntil.IsZero() {
+			c.trips++
+			w.logTagged(span, "Circuit for %s opened after %d consecutive failures (last: %s); short-circuiting for %s",
+				method, c.failures, c.lastError, w.circuitCooldown())
+		}
+		c.openUntil = time.Now().Add(w.circuitCooldown())
+	}
+}
+
+// requestFailure returns the error a response counts as in the error log, or
+// nil if the request succeeded. Cancellations are not failures.
+func requestFailure(resp *Message, err error) error {
+	if err != nil {
+		return err
+	}
+	if resp.Error != nil && resp.Error.Code != RequestCancelled {
+		return fmt.Errorf("error %d: %s", resp.Error.Code, resp.Error.Message)
+	}
+	return nil
+}
+
+// circuitCooldown returns how long an open circuit short-circuits requests
+func (w *ALLSPWrapper) circuitCooldown() time.Duration {
+	return time.Duration(max(1, w.Config().CircuitBreaker.CooldownSeconds)) * time.Second
+}
+
+// resetCircuits closes every circuit, e.g. after the AL server was restarted
+func (w *ALLSPWrapper) resetCircuits() {
+	w.circuitMu.Lock()
+	defer w.circuitMu.Unlock()
+	w.circuits = make(map[string]*circuit)
+}
+
+// CircuitStatuses returns the circuit of every method that has failed
+func (w *ALLSPWrapper) CircuitStatuses() []CircuitStatus {
+	w.circuitMu.Lock()
+	defer w.circuitMu.Unlock()
+	statuses := make([]CircuitStatus, 0, len(w.circuits))
+	for method, c := range w.circuits {
+		status := CircuitStatus{
+			Method:              method,
+			Open:                time.Now().Before(c.openUntil),
+			ConsecutiveFailures: c.failures,
+			LastError:           c.lastError,
+			Trips:               c.trips,
+		}
+		if status.Open {
+			openUntil := c.openUntil
+			status.OpenUntil = &openUntil
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Method < statuses[j].Method })
+	return statuses
+}
@@ -0,0 +1,224 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// maxStoredCodeActions is how many code actions' data the handler keeps for
+// codeAction/resolve
+const maxStoredCodeActions = 1000
+
+// codeActionRef replaces the data of a code action sent to the client. The
+// AL server's data is kept by the wrapper, as clients may not preserve data
+// they do not understand, and restored when the action is resolved.
+type codeActionRef struct {
+	ID int64 `json:"alWrapperCodeAction"`
+}
+
+// storedCodeAction is the AL server's data of a code action and the document
+// it was computed for
+type storedCodeAction struct {
+	data json.RawMessage
+	uri  string
+}
+
+// CodeActionHandler handles textDocument/codeAction and codeAction/resolve
+type CodeActionHandler struct {
+	mu      sync.Mutex
+	nextID  int64
+	actions map[int64]storedCodeAction
+	// commands records the commands the returned actions reference, which
+	// workspace/executeCommand may then forward
+	commands *commandSet
+}
+
+// NewCodeActionHandler creates a code action handler recording the commands
+// of the actions it returns in commands
+func NewCodeActionHandler(commands *commandSet) *CodeActionHandler {
+	return &CodeActionHandler{actions: make(map[int64]storedCodeAction), commands: commands}
+}
+
+func (h *CodeActionHandler) ShouldHandle(method string) bool {
+	return method == "textDocument/codeAction" || method == "codeAction/resolve"
+}
+
+func (h *CodeActionHandler) Handle(msg *Message, w WrapperInterface) (*Message, *Message) {
+	if msg.Method == "codeAction/resolve" {
+		return h.resolve(msg, w)
+	}
+
+	var params struct {
+		TextDocument TextDocumentIdentifier `json:"textDocument"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		w.Log("Failed to parse codeAction params: %v", err)
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "Invalid parameters")
+	}
+
+	filePath, err := FileURIToPath(params.TextDocument.URI)
+	if err != nil {
+		w.Log("Failed to convert URI: %v", err)
+		return nil, NewErrorResponse(msg.ID, InternalError, "Invalid file URI")
+	}
+
+	// Ensure the file is opened
+	if err := w.EnsureFileOpened(filePath); err != nil {
+		w.Log("Failed to open file: %v", err)
+		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	}
+
+	// Ensure project is initialized, or degrade to the file alone
+	if errResp := ensureProjectForRequest(msg, filePath, w); errResp != nil {
+		return nil, errResp
+	}
+
+	// Forward to AL LSP with the original params, which carry the diagnostics context
+	response, err := w.SendRequestToLSP("textDocument/codeAction", msg.Params)
+	if err != nil {
+		w.Log("Failed to send codeAction request: %v", err)
+		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	}
+
+	if response.Error != nil {
+		return nil, &Message{
+			JSONRPC: "2.0",
+			ID:      msg.ID,
+			Error:   response.Error,
+		}
+	}
+
+	known := map[string]string{NormalizePath(filePath): params.TextDocument.URI}
+	result := h.mapActions(response.Result, params.TextDocument.URI, known)
+	w.AuditResult("textDocument/codeAction", result)
+
+	return &Message{
+		JSONRPC: "2.0",
+		ID:      msg.ID,
+		Result:  result,
+	}, nil
+}
+
+// mapActions normalizes the edit URIs of code actions and replaces their data
+// with a reference to the stored original
+func (h *CodeActionHandler) mapActions(result json.RawMessage, uri string, known map[string]string) json.RawMessage {
+	var actions []map[string]json.RawMessage
+	if err := json.Unmarshal(result, &actions); err != nil {
+		return result
+	}
+	for _, action := range actions {
+		h.recordCommand(action)
+		if edit, ok := action["edit"]; ok {
+			action["edit"] = normalizeEditURIs(edit, known)
+		}
+		if data, ok := action["data"]; ok && string(data) != "null" {
+			action["data"], _ = json.Marshal(codeActionRef{ID: h.store(data, uri)})
+		}
+	}
+	data, err := json.Marshal(actions)
+	if err != nil {
+		return result
+	}
+	return data
+}
+
+// recordCommand records the command a code action, or a bare Command in a
+// code action result, references
+func (h *CodeActionHandler) recordCommand(action map[string]json.RawMessage) {
+	if h.commands == nil {
+		return
+	}
+	var name string
+	if json.Unmarshal(action["command"], &name) == nil && name != "" {
+		h.commands.add(name)
+		return
+	}
+	var command ExecuteCommandParams
+	if json.Unmarshal(action["command"], &command) == nil && command.Command != "" {
+		h.commands.add(command.Command)
+	}
+}
+
+// store keeps a code action's data and returns its reference ID
+func (h *CodeActionHandler) store(data json.RawMessage, uri string) int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.nextID++
+	h.actions[h.nextID] = storedCodeAction{data: data, uri: uri}
+	delete(h.actions, h.nextID-maxStoredCodeActions)
+	return h.nextID
+}
+
+// lookup returns the stored data of a code action reference
+func (h *CodeActionHandler) lookup(id int64) (storedCodeAction, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	stored, ok := h.actions[id]
+	return stored, ok
+}
+
+// resolve restores the AL server's data of a code action and forwards
+// codeAction/resolve
+func (h *CodeActionHandler) resolve(msg *Message, w WrapperInterface) (*Message, *Message) {
+	var action map[string]json.RawMessage
+	if err := json.Unmarshal(msg.Params, &action); err != nil || action == nil {
+		w.Log("Failed to parse codeAction/resolve params: %v", err)
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "Invalid parameters")
+	}
+
+	var ref codeActionRef
+	var known map[string]string
+	if json.Unmarshal(action["data"], &ref) == nil && ref.ID != 0 {
+		stored, ok := h.lookup(ref.ID)
+		if !ok {
+			return nil, NewErrorResponse(msg.ID, InvalidParams, "Code action expired; request code actions again")
+		}
+		action["data"] = stored.data
+
+		// The document may have been closed since the actions were computed
+		if filePath, err := FileURIToPath(stored.uri); err == nil {
+			if err := w.EnsureFileOpened(filePath); err != nil {
+				w.Log("Failed to open file: %v", err)
+				return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+			}
+			known = map[string]string{NormalizePath(filePath): stored.uri}
+		}
+	}
+
+	response, err := w.SendRequestToLSP("codeAction/resolve", action)
+	if err != nil {
+		w.Log("Failed to send codeAction/resolve request: %v", err)
+		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	}
+
+	if response.Error != nil {
+		return nil, &Message{
+			JSONRPC: "2.0",
+			ID:      msg.ID,
+			Error:   response.Error,
+		}
+	}
+
+	result := response.Result
+	var resolved map[string]json.RawMessage
+	if json.Unmarshal(result, &resolved) == nil && resolved != nil {
+		h.recordCommand(resolved)
+		if edit, ok := resolved["edit"]; ok {
+			resolved["edit"] = normalizeEditURIs(edit, known)
+		}
+		// Keep the reference, so the client can resolve the action again
+		if ref.ID != 0 {
+			resolved["data"], _ = json.Marshal(ref)
+		}
+		if data, err := json.Marshal(resolved); err == nil {
+			result = data
+		}
+	}
+	w.AuditResult("codeAction/resolve", result)
+
+	return &Message{
+		JSONRPC: "2.0",
+		ID:      msg.ID,
+		Result:  result,
+	}, nil
+}
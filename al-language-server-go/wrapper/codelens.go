@@ -0,0 +1,54 @@
+package wrapper
+
+import (
+	"encoding/json"
+)
+
+// CodeLensHandler handles textDocument/codeLens and codeLens/resolve. Lenses
+// such as reference counts are resolved by the AL server from their data,
+// so params and results are forwarded as raw JSON and the data reaches the
+// server byte for byte as it produced it.
+type CodeLensHandler struct{}
+
+func (h *CodeLensHandler) ShouldHandle(method string) bool {
+	return method == "textDocument/codeLens" || method == "codeLens/resolve"
+}
+
+func (h *CodeLensHandler) Handle(msg *Message, w WrapperInterface) (*Message, *Message) {
+	if msg.Method == "codeLens/resolve" {
+		return h.resolve(msg, w)
+	}
+
+	return forwardDocumentRequest(msg, w)
+}
+
+// resolve forwards codeLens/resolve with the lens exactly as the client sent it
+func (h *CodeLensHandler) resolve(msg *Message, w WrapperInterface) (*Message, *Message) {
+	var lens struct {
+		Range *Range `json:"range"`
+	}
+	if err := json.Unmarshal(msg.Params, &lens); err != nil || lens.Range == nil {
+		w.Log("Failed to parse codeLens/resolve params: %v", err)
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "Invalid parameters")
+	}
+
+	response, err := w.SendRequestToLSP("codeLens/resolve", msg.Params)
+	if err != nil {
+		w.Log("Failed to send codeLens/resolve request: %v", err)
+		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	}
+
+	if response.Error != nil {
+		return nil, &Message{
+			JSONRPC: "2.0",
+			ID:      msg.ID,
+			Error:   response.Error,
+		}
+	}
+
+	return &Message{
+		JSONRPC: "2.0",
+		ID:      msg.ID,
+		Result:  response.Result,
+	}, nil
+}
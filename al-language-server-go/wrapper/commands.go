@@ -0,0 +1,185 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Commands the wrapper does not implement are forwarded to the AL server only
+// if they are in executeCommand.allowedCommands or, with
+// executeCommand.allowCodeActionCommands, a code action the AL server returned
+// in this session referenced them. Anything else is refused, so a client
+// cannot make the AL server run arbitrary commands.
+
+// ExecuteCommandParams represents workspace/executeCommand parameters
+type ExecuteCommandParams struct {
+	Command   string            `json:"command"`
+	Arguments []json.RawMessage `json:"arguments,omitempty"`
+}
+
+// CommandFunc implements a workspace/executeCommand command inside the wrapper.
+// It follows the Handler convention of returning either a response or an error response.
+type CommandFunc func(msg *Message, args []json.RawMessage, w WrapperInterface) (*Message, *Message)
+
+// commandSet is a concurrency-safe set of command names
+type commandSet struct {
+	mu    sync.Mutex
+	names map[string]bool
+}
+
+func newCommandSet() *commandSet {
+	return &commandSet{names: make(map[string]bool)}
+}
+
+func (s *commandSet) add(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.names[name] = true
+}
+
+func (s *commandSet) contains(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.names[name]
+}
+
+// ExecuteCommandHandler handles workspace/executeCommand: commands
+// implemented by the wrapper itself, and allowed AL server commands
+type ExecuteCommandHandler struct {
+	commands map[string]CommandFunc
+	// codeActionCommands are the commands of code actions returned to the client
+	codeActionCommands *commandSet
+}
+
+// NewExecuteCommandHandler creates the handler with all built-in wrapper
+// commands; codeActionCommands are the commands seen in code action results
+func NewExecuteCommandHandler(codeActionCommands *commandSet) *ExecuteCommandHandler {
+	return &ExecuteCommandHandler{
+		codeActionCommands: codeActionCommands,
+		commands: map[string]CommandFunc{
+			PublishCommand:            publishCommand,
+			DownloadSymbolsCommand:    downloadSymbolsCommand,
+			ApplyWorkspaceEditCommand: applyWorkspaceEditCommand,
+			FindObjectsByIDCommand:    findObjectsByIDCommand,
+			TableFieldsCommand:        tableFieldsCommand,
+			PageControlsCommand:       pageControlsCommand,
+			EventSurfaceCommand:       eventSurfaceCommand,
+			ObsoleteReferencesCommand: obsoleteReferencesCommand,
+			SearchPackagesCommand:     searchPackagesCommand,
+			SuggestFileNamesCommand:   suggestFileNamesCommand,
+			BuildCommand:              buildCommand,
+			ProjectStatisticsCommand:  projectStatisticsCommand,
+		},
+	}
+}
+
+// Commands returns the names of the commands implemented by the wrapper
+func (h *ExecuteCommandHandler) Commands() []string {
+	names := make([]string, 0, len(h.commands))
+	for name := range h.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (h *ExecuteCommandHandler) ShouldHandle(method string) bool {
+	return method == "workspace/executeCommand"
+}
+
+func (h *ExecuteCommandHandler) Handle(msg *Message, w WrapperInterface) (*Message, *Message) {
+	var params ExecuteCommandParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		w.Log("Failed to parse executeCommand params: %v", err)
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "Invalid parameters")
+	}
+
+	if command, ok := h.commands[params.Command]; ok {
+		w.Log("Executing wrapper command: %s", params.Command)
+		progress := w.BeginProgress(params.Command)
+		defer progress.End("")
+		return command(msg, params.Arguments, w)
+	}
+
+	cfg := w.Config().ExecuteCommand
+	if !h.allowed(params.Command, cfg) {
+		w.Log("Refusing to forward command %s: not allowed", params.Command)
+		allowed := "none"
+		if len(cfg.AllowedCommands) > 0 {
+			allowed = strings.Join(cfg.AllowedCommands, ", ")
+		}
+		return nil, NewErrorResponse(msg.ID, InvalidParams,
+			"Unknown command: "+params.Command+"; AL server commands must be in executeCommand.allowedCommands ("+allowed+")")
+	}
+
+	// Forward to AL LSP
+	w.Log("Forwarding command to AL LSP: %s", params.Command)
+	response, err := w.SendRequestToLSP("workspace/executeCommand", params)
+	if err != nil {
+		w.Log("Failed to send executeCommand request: %v", err)
+		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	}
+
+	if response.Error != nil {
+		return nil, &Message{
+			JSONRPC: "2.0",
+			ID:      msg.ID,
+			Error:   response.Error,
+		}
+	}
+
+	return &Message{
+		JSONRPC: "2.0",
+		ID:      msg.ID,
+		Result:  response.Result,
+	}, nil
+}
+
+// allowed reports whether an AL server command may be forwarded
+func (h *ExecuteCommandHandler) allowed(command string, cfg ExecuteCommandConfig) bool {
+	for _, name := range cfg.AllowedCommands {
+		if name == command {
+			return true
+		}
+	}
+	return cfg.AllowCodeActionCommands && h.codeActionCommands != nil && h.codeActionCommands.contains(command)
+}
+
+// decodeCommandArgs decodes the first command argument into v.
+// Missing arguments leave v untouched.
+func decodeCommandArgs(args []json.RawMessage, v interface{}) error {
+	if len(args) == 0 || string(args[0]) == "null" {
+		return nil
+	}
+	return json.Unmarshal(args[0], v)
+}
+
+// resolveCommandProject maps an optional file/folder URI or path argument to an
+// AL project root, falling back to the active project
+func resolveCommandProject(target string, w WrapperInterface) string {
+	if target != "" {
+		path, err := FileURIToPath(target)
+		if err == nil {
+			if info, statErr := os.Stat(path); statErr == nil && info.IsDir() {
+				path = filepath.Join(path, "app.json")
+			}
+			if root := GetProjectRoot(path); root != "" {
+				return NormalizePath(root)
+			}
+		}
+	}
+	return w.ActiveProject()
+}
+
+// newResultMessage builds a successful response, turning marshal failures into an error response
+func newResultMessage(id *json.RawMessage, result interface{}) (*Message, *Message) {
+	resp, err := NewResponse(id, result)
+	if err != nil {
+		return nil, NewErrorResponse(id, InternalError, err.Error())
+	}
+	return resp, nil
+}
@@ -0,0 +1,660 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// userOnlySettings are the settings only the user config file may set. The
+// workspace config file is committed with a repository and the client sends
+// initializationOptions on the workspace's behalf, so a cloned repository
+// could otherwise turn on deploying to a server, choose a program for the
+// wrapper to run or widen the AL server commands the client may run.
+var userOnlySettings = []string{
+	"publish.enabled",
+	"build.compilerPath",
+	"build.arguments",
+	"executeCommand.allowedCommands",
+}
+
+// Config holds user-tunable wrapper settings.
+// Settings are layered: built-in defaults, the user config file, the
+// workspace config file and finally the client's initializationOptions.
+// The settings in userOnlySettings are only taken from the user config file.
+type Config struct {
+	// Handlers switches the wrapper's handling of methods off: a method set
+	// to false is forwarded to the AL server unchanged
+	Handlers map[string]bool `json:"handlers"`
+	// Publish controls the al.publish command
+	Publish PublishConfig `json:"publish"`
+	// Symbols controls downloading dependency symbols
+	Symbols SymbolsConfig `json:"symbols"`
+	// Diagnostics controls post-processing of forwarded publishDiagnostics
+	Diagnostics DiagnosticsConfig `json:"diagnostics"`
+	// WorkspaceSymbol controls workspace/symbol behavior
+	WorkspaceSymbol WorkspaceSymbolConfig `json:"workspaceSymbol"`
+	// Definition controls textDocument/definition results
+	Definition DefinitionConfig `json:"definition"`
+	// References controls post-processing of textDocument/references results
+	References ReferencesConfig `json:"references"`
+	// DocumentSymbol controls textDocument/documentSymbol results
+	DocumentSymbol DocumentSymbolConfig `json:"documentSymbol"`
+	// Hover controls normalization of hover content and offline hovers
+	Hover HoverConfig `json:"hover"`
+	// Completion controls textDocument/completion fallbacks
+	Completion CompletionConfig `json:"completion"`
+	// Dependencies controls annotating results with their dependency package
+	Dependencies DependenciesConfig `json:"dependencies"`
+	// Obsolete controls marking members marked Obsolete in results
+	Obsolete ObsoleteConfig `json:"obsolete"`
+	// WarmStart controls persisting and replaying workspace state across restarts
+	WarmStart WarmStartConfig `json:"warmStart"`
+	// Server controls how the AL server is started
+	Server ServerConfig `json:"server"`
+	// ProjectLoad controls waiting for and recovering AL project loads
+	ProjectLoad ProjectLoadConfig `json:"projectLoad"`
+	// DotNet controls the assembly probing paths of projects using DotNet types
+	DotNet DotNetConfig `json:"dotNet"`
+	// Build controls project builds with alc (al-wrapper.build)
+	Build BuildConfig `json:"build"`
+	// RuleSet controls the ruleset.json projects are analyzed with
+	RuleSet RuleSetConfig `json:"ruleSet"`
+	// CircuitBreaker controls short-circuiting AL server methods that keep failing
+	CircuitBreaker CircuitBreakerConfig `json:"circuitBreaker"`
+	// LatencyBudget controls answering slow requests with the results gathered so far
+	LatencyBudget LatencyBudgetConfig `json:"latencyBudget"`
+	// WorkspaceEdit controls applying WorkspaceEdits to disk
+	WorkspaceEdit WorkspaceEditConfig `json:"workspaceEdit"`
+	// Audit controls the audit log of applied and forwarded edits
+	Audit AuditConfig `json:"audit"`
+	// Idle controls stopping the AL server while no requests arrive
+	Idle IdleConfig `json:"idle"`
+	// Resources controls sampling the AL server's memory and CPU use
+	Resources ResourcesConfig `json:"resources"`
+	// Forward controls the al-wrapper/forward passthrough of al/* requests
+	Forward ForwardConfig `json:"forward"`
+	// ExecuteCommand controls forwarding workspace/executeCommand to the AL server
+	ExecuteCommand ExecuteCommandConfig `json:"executeCommand"`
+	// Validation controls checking messages against the LSP specification
+	Validation ValidationConfig `json:"validation"`
+	// Provenance controls tagging results the wrapper produced itself
+	Provenance ProvenanceConfig `json:"provenance"`
+	// Errors controls the details added to error responses
+	Errors ErrorsConfig `json:"errors"`
+
+	// sources lists where settings were loaded from, lowest precedence first
+	sources []string
+}
+
+// PublishConfig controls deployment through the al.publish command
+type PublishConfig struct {
+	// Enabled must be set explicitly in the user config file; publishing
+	// deploys to a live sandbox
+	Enabled bool `json:"enabled"`
+	// Configuration selects a launch.json entry by name (first AL entry if empty)
+	Configuration string `json:"configuration"`
+	// TimeoutSeconds bounds how long to wait for the AL server to publish
+	TimeoutSeconds int `json:"timeoutSeconds"`
+}
+
+// SymbolsConfig controls downloading dependency symbols (al.downloadSymbols)
+type SymbolsConfig struct {
+	// Configuration selects a launch.json entry by name (first AL entry if empty)
+	Configuration string `json:"configuration"`
+	// AutoDownload downloads the symbols once per project when the AL server
+	// reports a dependency package it cannot load (AL1022)
+	AutoDownload bool `json:"autoDownload"`
+	// TimeoutSeconds bounds how long to wait for the AL server to download
+	TimeoutSeconds int `json:"timeoutSeconds"`
+}
+
+// DiagnosticsConfig controls how diagnostics are rewritten before reaching the client,
+// for teams that cannot change the project's ruleset.json
+type DiagnosticsConfig struct {
+	// Suppress drops diagnostics with these rule IDs (e.g. "AA0021")
+	Suppress []string `json:"suppress"`
+	// Severity overrides the severity per rule ID: "error", "warning", "info" or "hint"
+	Severity map[string]string `json:"severity"`
+	// WarningsAsInfo downgrades all warnings without an explicit override to information
+	WarningsAsInfo bool `json:"warningsAsInfo"`
+	// CoalesceMillis batches bursts of publishDiagnostics, keeping the newest per file (0 disables batching)
+	CoalesceMillis int `json:"coalesceMillis"`
+	// MaxPerSecond caps forwarded publishDiagnostics notifications (0 disables the cap)
+	MaxPerSecond int `json:"maxPerSecond"`
+	// PullTimeoutSeconds is how long a textDocument/diagnostic request waits
+	// for the AL server to publish the first diagnostics of a file
+	PullTimeoutSeconds int `json:"pullTimeoutSeconds"`
+	// DuplicateObjects warns about objects of the same type sharing an ID or
+	// a name across the workspace's projects
+	DuplicateObjects bool `json:"duplicateObjects"`
+}
+
+// WorkspaceSymbolConfig controls workspace/symbol behavior
+type WorkspaceSymbolConfig struct {
+	// EmptyQueryOverview answers an empty query with the active project's
+	// top-level objects instead of an error
+	EmptyQueryOverview bool `json:"emptyQueryOverview"`
+	// MaxResults caps the number of symbols returned (0 disables the cap)
+	MaxResults int `json:"maxResults"`
+	// Suggestions answers a query without matches with the closest names
+	// from the wrapper's symbol index ("did you mean")
+	Suggestions bool `json:"suggestions"`
+	// Rank sorts results by how well they match the query: exact, prefix,
+	// word boundary, substring, then fuzzy matches, objects before members
+	Rank bool `json:"rank"`
+	// PathQueries turns a file path query (src/Customer.Table.al) into the
+	// object name it declares (Customer)
+	PathQueries bool `json:"pathQueries"`
+	// SymbolSearchFallback asks al/symbolSearch when workspace/symbol finds nothing
+	SymbolSearchFallback bool `json:"symbolSearchFallback"`
+}
+
+// DefinitionConfig controls textDocument/definition results
+type DefinitionConfig struct {
+	// RankCandidates orders multiple candidates (overloads, events) by how well
+	// their parameters fit the call's arguments
+	RankCandidates bool `json:"rankCandidates"`
+	// HoverFallback looks an empty definition up by the hovered symbol's name
+	// in the file's document symbols
+	HoverFallback bool `json:"hoverFallback"`
+}
+
+// ReferencesConfig controls post-processing of textDocument/references results
+type ReferencesConfig struct {
+	// IncludeContainer adds the containing object and procedure to each location
+	IncludeContainer bool `json:"includeContainer"`
+	// MaxResults caps the number of locations returned (0 disables the cap)
+	MaxResults int `json:"maxResults"`
+	// TextFallback searches the workspace's .al files for the identifier when
+	// the AL server cannot answer or finds nothing
+	TextFallback bool `json:"textFallback"`
+	// Dependents queries the workspace projects depending on the file's
+	// project too: "merge" (always), "fallback" (when the project has no
+	// references) or "off" (default). Each dependent project is initialized
+	// and activated for its query, which holds up other requests.
+	Dependents string `json:"dependents"`
+	// Packages searches the sources in the dependency packages for the
+	// identifier too, and adds the matches from extracted files
+	Packages bool `json:"packages"`
+}
+
+// DocumentSymbolConfig controls textDocument/documentSymbol results
+type DocumentSymbolConfig struct {
+	// MaxDepth drops nested symbols below this many levels (0 disables the cap)
+	MaxDepth int `json:"maxDepth"`
+	// Cache answers repeated requests for an unchanged file from the last result
+	Cache bool `json:"cache"`
+}
+
+// HoverConfig controls normalization of hover content and offline hovers
+type HoverConfig struct {
+	// Normalize strips HTML and XML-doc markup and collapses whitespace
+	Normalize bool `json:"normalize"`
+	// MaxLength caps the hover text in bytes, with an ellipsis (0 disables the cap)
+	MaxLength int `json:"maxLength"`
+	// OfflineDocs answers empty hovers over AL keywords and built-in methods
+	// from the bundled language reference
+	OfflineDocs bool `json:"offlineDocs"`
+	// Context appends the object type and ID, source file and owning app of
+	// the hovered symbol's definition (costs one definition lookup per hover)
+	Context bool `json:"context"`
+	// LocalFallback answers hovers the AL server leaves empty with the
+	// enclosing object and procedure, parsed from the file
+	LocalFallback bool `json:"localFallback"`
+}
+
+// CompletionConfig controls textDocument/completion fallbacks
+type CompletionConfig struct {
+	// Snippets offers the bundled AL snippets (ttable, tpage, tcodeunit, ...)
+	// where the AL server has no completion items
+	Snippets bool `json:"snippets"`
+}
+
+// DependenciesConfig controls annotating results that point into dependency
+// packages (.app files in the package cache)
+type DependenciesConfig struct {
+	// AnnotateDefinitions adds a definedIn property naming the app to
+	// definition locations in dependencies
+	AnnotateDefinitions bool `json:"annotateDefinitions"`
+	// AnnotateHover appends the app, publisher and version to hovers over
+	// symbols from dependencies (costs one definition lookup per hover)
+	AnnotateHover bool `json:"annotateHover"`
+	// ExtractSources rewrites definition locations inside packages to files
+	// extracted from the package, or stubs generated from its symbols
+	ExtractSources bool `json:"extractSources"`
+}
+
+// ObsoleteConfig controls marking members marked Obsolete in results
+type ObsoleteConfig struct {
+	// Annotate tags obsolete symbols as deprecated in documentSymbol and
+	// workspace/symbol results, and appends their obsolete state, reason and
+	// tag to hovers (hovers cost one definition lookup)
+	Annotate bool `json:"annotate"`
+}
+
+// WarmStartConfig controls persisting and replaying workspace state across restarts
+type WarmStartConfig struct {
+	// Enabled snapshots the workspace state on shutdown and initializes the
+	// saved projects and symbol index when the same workspace starts again
+	Enabled bool `json:"enabled"`
+	// RestoreSession also reopens the saved documents at their versions and
+	// reactivates the saved active project
+	RestoreSession bool `json:"restoreSession"`
+}
+
+// ServerConfig controls how the AL server is started
+type ServerConfig struct {
+	// Trace is the initial trace level given to the AL server: "off",
+	// "messages" or "verbose". The client can change it with $/setTrace.
+	Trace string `json:"trace"`
+}
+
+// ProjectLoadConfig controls waiting for and recovering AL project loads
+type ProjectLoadConfig struct {
+	// TimeoutSeconds bounds how long to wait for a project to report it has loaded
+	TimeoutSeconds int `json:"timeoutSeconds"`
+	// AutoRecover re-initializes a project that did not load with code analysis disabled
+	AutoRecover bool `json:"autoRecover"`
+}
+
+// BuildConfig controls project builds with alc (al-wrapper.build)
+type BuildConfig struct {
+	// CompilerPath overrides the alc of the AL extension; user config file only
+	CompilerPath string `json:"compilerPath"`
+	// Arguments are passed to alc after the wrapper's, e.g. "/analyzer:...";
+	// user config file only
+	Arguments []string `json:"arguments"`
+	// TimeoutSeconds bounds how long a build may take
+	TimeoutSeconds int `json:"timeoutSeconds"`
+}
+
+// RuleSetConfig controls the ruleset.json projects are analyzed with
+type RuleSetConfig struct {
+	// Path is the ruleset of every project, relative to the project; it
+	// takes precedence over al.ruleSetPath in .vscode/settings.json
+	Path string `json:"path"`
+	// Discover uses a *.ruleset.json found in the project folder or above it
+	// when no ruleset is configured
+	Discover bool `json:"discover"`
+}
+
+// DotNetConfig controls the assembly probing paths of projects using DotNet types
+type DotNetConfig struct {
+	// ProbingPaths are extra assembly folders, e.g. the Add-ins folder of a
+	// service tier; relative paths are resolved against the project
+	ProbingPaths []string `json:"probingPaths"`
+	// Discover adds the service tier and .NET runtime folders found on this
+	// machine for projects declaring DotNet types
+	Discover bool `json:"discover"`
+}
+
+// CircuitBreakerConfig controls short-circuiting AL server methods that keep failing
+type CircuitBreakerConfig struct {
+	// Threshold is how many consecutive timeouts or transport failures of a
+	// method open its circuit (0 disables the circuit breaker)
+	Threshold int `json:"threshold"`
+	// CooldownSeconds is how long an open circuit fails requests immediately
+	// before one request is let through to probe the server again
+	CooldownSeconds int `json:"cooldownSeconds"`
+}
+
+// LatencyBudgetConfig controls answering slow requests with the results
+// the AL server streamed so far
+type LatencyBudgetConfig struct {
+	// Methods maps a method to its soft budget in milliseconds. When it runs
+	// out, the streamed results are returned and the log says they are
+	// partial. Applies to textDocument/references and workspace/symbol; a
+	// missing method or 0 waits for the full response.
+	Methods map[string]int `json:"methods"`
+}
+
+// WorkspaceEditConfig controls applying WorkspaceEdits to disk
+type WorkspaceEditConfig struct {
+	// ApplyOnDisk applies the AL server's workspace/applyEdit requests to disk
+	// when the client does not support workspace/applyEdit
+	ApplyOnDisk bool `json:"applyOnDisk"`
+	// Backup keeps the copies of the existing files an edit changes in the data
+	// directory; without it they are removed once the edit is written
+	Backup bool `json:"backup"`
+	// CheckDrift refuses a rename whose files changed since the AL server
+	// computed its edit
+	CheckDrift bool `json:"checkDrift"`
+}
+
+// AuditConfig controls the audit log of applied and forwarded edits
+type AuditConfig struct {
+	// Enabled records every edit the wrapper applies or passes to the client
+	Enabled bool `json:"enabled"`
+}
+
+// IdleConfig controls stopping the AL server while no requests arrive
+type IdleConfig struct {
+	// ShutdownMinutes stops the AL server after this many minutes without
+	// client messages, reclaiming its memory; the next message starts it again
+	// and replays the session (0 keeps it running)
+	ShutdownMinutes int `json:"shutdownMinutes"`
+}
+
+// ResourcesConfig controls sampling the AL server's memory and CPU use
+type ResourcesConfig struct {
+	// SampleSeconds is how often the AL server is sampled (0 disables sampling)
+	SampleSeconds int `json:"sampleSeconds"`
+	// WarnMemoryMB warns the user when the AL server uses this much memory (0 never warns)
+	WarnMemoryMB int `json:"warnMemoryMB"`
+	// WarnCPUPercent warns the user when the AL server's CPU use between two
+	// samples reaches this percentage of one core (0 never warns)
+	WarnCPUPercent int `json:"warnCpuPercent"`
+}
+
+// ForwardConfig controls the al-wrapper/forward passthrough of al/* requests
+type ForwardConfig struct {
+	// AllowedMethods are the al/* methods al-wrapper/forward sends to the AL server
+	AllowedMethods []string `json:"allowedMethods"`
+}
+
+// ExecuteCommandConfig controls which workspace/executeCommand commands not
+// implemented by the wrapper are forwarded to the AL server
+type ExecuteCommandConfig struct {
+	// AllowedCommands are the AL server commands forwarded to it; user config
+	// file only
+	AllowedCommands []string `json:"allowedCommands"`
+	// AllowCodeActionCommands also forwards the commands of code actions the
+	// AL server returned in this session
+	AllowCodeActionCommands bool `json:"allowCodeActionCommands"`
+}
+
+// ValidationConfig controls checking messages against the LSP specification
+type ValidationConfig struct {
+	// Strict checks every message between the client, the wrapper and the AL
+	// server, logging and reporting the violations found
+	Strict bool `json:"strict"`
+}
+
+// ProvenanceConfig controls tagging results the wrapper produced itself
+type ProvenanceConfig struct {
+	// Annotate adds a provenance property to results that did not come from
+	// the AL server's answer to the request; they are always logged
+	Annotate bool `json:"annotate"`
+}
+
+// ErrorsConfig controls the details added to error responses
+type ErrorsConfig struct {
+	// LogExcerptLines adds up to this many of the request's last log lines,
+	// sanitized, and the log path to the data of InternalError responses
+	// (0 disables the excerpt)
+	LogExcerptLines int `json:"logExcerptLines"`
+}
+
+// DefaultConfig returns the built-in configuration
+func DefaultConfig() *Config {
+	return &Config{
+		Publish: PublishConfig{
+			Enabled:        false,
+			TimeoutSeconds: 300,
+		},
+		Symbols: SymbolsConfig{
+			TimeoutSeconds: 300,
+		},
+		Diagnostics: DiagnosticsConfig{
+			CoalesceMillis:     200,
+			MaxPerSecond:       100,
+			PullTimeoutSeconds: 10,
+			DuplicateObjects:   true,
+		},
+		WorkspaceSymbol: WorkspaceSymbolConfig{
+			EmptyQueryOverview:   true,
+			MaxResults:           200,
+			Suggestions:          true,
+			Rank:                 true,
+			PathQueries:          true,
+			SymbolSearchFallback: true,
+		},
+		Definition: DefinitionConfig{
+			RankCandidates: true,
+			HoverFallback:  true,
+		},
+		References: ReferencesConfig{
+			MaxResults: 500,
+			Dependents: "off",
+		},
+		DocumentSymbol: DocumentSymbolConfig{
+			Cache: true,
+		},
+		Hover: HoverConfig{
+			Normalize:     true,
+			MaxLength:     2000,
+			OfflineDocs:   true,
+			LocalFallback: true,
+		},
+		Completion: CompletionConfig{
+			Snippets: true,
+		},
+		Dependencies: DependenciesConfig{
+			AnnotateDefinitions: true,
+			ExtractSources:      true,
+		},
+		WarmStart: WarmStartConfig{
+			Enabled: true,
+		},
+		Server: ServerConfig{
+			Trace: "off",
+		},
+		ProjectLoad: ProjectLoadConfig{
+			TimeoutSeconds: 5,
+			AutoRecover:    true,
+		},
+		Build: BuildConfig{
+			TimeoutSeconds: 600,
+		},
+		RuleSet: RuleSetConfig{
+			Discover: true,
+		},
+		DotNet: DotNetConfig{
+			Discover: true,
+		},
+		CircuitBreaker: CircuitBreakerConfig{
+			Threshold:       3,
+			CooldownSeconds: 60,
+		},
+		LatencyBudget: LatencyBudgetConfig{
+			Methods: map[string]int{
+				"textDocument/references": 3000,
+				"workspace/symbol":        3000,
+			},
+		},
+		WorkspaceEdit: WorkspaceEditConfig{
+			ApplyOnDisk: true,
+			Backup:      true,
+			CheckDrift:  true,
+		},
+		Audit: AuditConfig{
+			Enabled: true,
+		},
+		Resources: ResourcesConfig{
+			SampleSeconds:  60,
+			WarnMemoryMB:   4096,
+			WarnCPUPercent: 200,
+		},
+		Forward: ForwardConfig{
+			AllowedMethods: []string{
+				"al/gotodefinition",
+				"al/symbolSearch",
+				"al/hasProjectClosureLoadedRequest",
+			},
+		},
+		ExecuteCommand: ExecuteCommandConfig{
+			AllowCodeActionCommands: true,
+		},
+		sources: []string{"defaults"},
+	}
+}
+
+// Sources returns where settings were loaded from, lowest precedence first
+func (c *Config) Sources() []string {
+	return c.sources
+}
+
+// ApplyJSON overlays settings from a JSON (or JSON with comments) document.
+// Only keys present in the document change the current values.
+func (c *Config) ApplyJSON(data []byte, source string) error {
+	if err := json.Unmarshal(StripJSONComments(data), c); err != nil {
+		return fmt.Errorf("invalid config in %s: %w", source, err)
+	}
+	c.sources = append(c.sources, source)
+	return nil
+}
+
+// applyWorkspaceJSON overlays settings from a source other than the user
+// config file, leaving out the user-only settings. Those it sets are reported
+// in the returned error.
+func (c *Config) applyWorkspaceJSON(data []byte, source string) error {
+	var sections map[string]json.RawMessage
+	if err := json.Unmarshal(StripJSONComments(data), &sections); err != nil {
+		return fmt.Errorf("invalid config in %s: %w", source, err)
+	}
+
+	var errs []error
+	for _, setting := range userOnlySettings {
+		section, key, _ := strings.Cut(setting, ".")
+		var values map[string]json.RawMessage
+		if json.Unmarshal(sections[section], &values) != nil {
+			continue
+		}
+		if _, ok := values[key]; !ok {
+			continue
+		}
+		delete(values, key)
+		sections[section], _ = json.Marshal(values)
+		errs = append(errs, fmt.Errorf("%s in %s ignored: only the user config file may set it", setting, source))
+	}
+
+	data, err := json.Marshal(sections)
+	if err != nil {
+		return err
+	}
+	return errors.Join(append(errs, c.ApplyJSON(data, source))...)
+}
+
+// isUserOnlySetting reports whether a section.key setting may only be set in
+// the user config file
+func isUserOnlySetting(setting string) bool {
+	for _, s := range userOnlySettings {
+		if s == setting {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyInitializationOptions overlays settings sent by the client in
+// initialize, except the user-only settings
+func (c *Config) ApplyInitializationOptions(options map[string]any) error {
+	if len(options) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(options)
+	if err != nil {
+		return err
+	}
+	return c.applyWorkspaceJSON(data, "initializationOptions")
+}
+
+// GetConfigPaths returns the config files consulted for a workspace,
+// lowest precedence first
+func GetConfigPaths(workspaceRoot string) []string {
+	var paths []string
+	if userPath := GetUserConfigPath(); userPath != "" {
+		paths = append(paths, userPath)
+	}
+	if workspaceRoot != "" {
+		paths = append(paths, filepath.Join(workspaceRoot, ".claude", "al-lsp.json"))
+	}
+	return paths
+}
+
+// LoadConfig builds the effective configuration for a workspace.
+// Invalid files are reported in the returned error but do not prevent the
+// remaining sources from loading.
+func LoadConfig(workspaceRoot string) (*Config, error) {
+	cfg := DefaultConfig()
+	var errs []error
+
+	userPath := GetUserConfigPath()
+	for _, path := range GetConfigPaths(workspaceRoot) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		apply := cfg.applyWorkspaceJSON
+		if path == userPath {
+			apply = cfg.ApplyJSON
+		}
+		if err := apply(data, path); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return cfg, errors.Join(errs...)
+}
+
+// StripJSONComments removes // and /* */ comments and trailing commas so that
+// VS Code style JSONC files (launch.json, settings.json) can be parsed
+func StripJSONComments(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	inString := false
+
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+
+		if inString {
+			out = append(out, c)
+			if c == '\\' && i+1 < len(data) {
+				i++
+				out = append(out, data[i])
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+
+		switch {
+		case c == '"':
+			inString = true
+			out = append(out, c)
+		case c == '/' && i+1 < len(data) && data[i+1] == '/':
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+			if i < len(data) {
+				out = append(out, '\n')
+			}
+		case c == '/' && i+1 < len(data) && data[i+1] == '*':
+			i += 2
+			for i+1 < len(data) && !(data[i] == '*' && data[i+1] == '/') {
+				i++
+			}
+			i++
+		case c == ']' || c == '}':
+			// Drop a trailing comma before the closing bracket
+			j := len(out) - 1
+			for j >= 0 && (out[j] == ' ' || out[j] == '\t' || out[j] == '\n' || out[j] == '\r') {
+				j--
+			}
+			if j >= 0 && out[j] == ',' {
+				out = append(out[:j], out[j+1:]...)
+			}
+			out = append(out, c)
+		default:
+			out = append(out, c)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,55 @@
+package wrapper
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeUserConfig points the user config file at a temporary directory and
+// writes data to it
+func writeUserConfig(t *testing.T, data string) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("APPDATA", filepath.Join(home, "AppData"))
+	path := GetUserConfigPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWorkspaceCannotWidenAllowedCommands(t *testing.T) {
+	writeUserConfig(t, `{"executeCommand": {"allowedCommands": ["al.user"]}}`)
+	workspace := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(workspace, ".claude"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(workspace, ".claude", "al-lsp.json"),
+		[]byte(`{"executeCommand": {"allowedCommands": ["al.workspace"], "allowCodeActionCommands": false}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(workspace)
+	if err == nil {
+		t.Error("LoadConfig did not warn about the ignored workspace setting")
+	}
+	if err := cfg.ApplyInitializationOptions(map[string]any{
+		"executeCommand": map[string]any{"allowedCommands": []string{"al.client"}},
+	}); err == nil {
+		t.Error("ApplyInitializationOptions did not warn about the ignored setting")
+	}
+
+	if want := []string{"al.user"}; !reflect.DeepEqual(cfg.ExecuteCommand.AllowedCommands, want) {
+		t.Errorf("allowedCommands = %q, want %q", cfg.ExecuteCommand.AllowedCommands, want)
+	}
+	// Other settings of the section still apply
+	if cfg.ExecuteCommand.AllowCodeActionCommands {
+		t.Error("allowCodeActionCommands from the workspace config was not applied")
+	}
+}
@@ -0,0 +1,142 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// When a file's project cannot be initialized (no app.json, an invalid
+// app.json, or a project that never finishes loading, e.g. missing symbols),
+// handlers degrade by method:
+//
+//   - single-file methods (hover, documentSymbol, completion, signatureHelp,
+//     formatting, codeAction, codeLens, documentHighlight, foldingRange,
+//     selectionRange, linkedEditingRange, documentLink, semanticTokens,
+//     diagnostic) are still forwarded, as the AL server answers them from
+//     the opened document alone
+//   - all other methods (definition, references, rename, commands) need the
+//     project's symbols and fail with RequestFailed, saying why the project
+//     could not be initialized
+//
+// This replaces empty results that looked like "nothing found".
+
+// singleFileMethods are answered from the opened document when its project
+// cannot be initialized
+var singleFileMethods = map[string]bool{
+	"textDocument/hover":                true,
+	"textDocument/documentSymbol":       true,
+	"textDocument/completion":           true,
+	"textDocument/signatureHelp":        true,
+	"textDocument/formatting":           true,
+	"textDocument/codeAction":           true,
+	"textDocument/codeLens":             true,
+	"textDocument/documentHighlight":    true,
+	"textDocument/foldingRange":         true,
+	"textDocument/selectionRange":       true,
+	"textDocument/linkedEditingRange":   true,
+	"textDocument/documentLink":         true,
+	"textDocument/diagnostic":           true,
+	"textDocument/semanticTokens/full":  true,
+	"textDocument/semanticTokens/range": true,
+}
+
+// ProjectInitError reports why the project of a file could not be initialized
+type ProjectInitError struct {
+	// Project is the project root, empty when no app.json was found
+	Project string
+	File    string
+	Reason  string
+}
+
+func (e *ProjectInitError) Error() string {
+	if e.Project == "" {
+		return fmt.Sprintf("no AL project for %s: %s", e.File, e.Reason)
+	}
+	return fmt.Sprintf("AL project %s could not be initialized: %s", e.Project, e.Reason)
+}
+
+// checkProjectManifest verifies that a project's app.json can be read
+func checkProjectManifest(projectRoot string, filePath string) error {
+	data, err := os.ReadFile(filepath.Join(projectRoot, "app.json"))
+	if err != nil {
+		return &ProjectInitError{Project: projectRoot, File: filePath, Reason: "app.json cannot be read: " + err.Error()}
+	}
+	var manifest map[string]interface{}
+	if err := json.Unmarshal(StripJSONComments(data), &manifest); err != nil {
+		return &ProjectInitError{Project: projectRoot, File: filePath, Reason: "app.json is not valid JSON: " + err.Error()}
+	}
+	return nil
+}
+
+// projectLoadFailure returns an error if a project's last load did not complete
+func (w *ALLSPWrapper) projectLoadFailure(projectRoot string, filePath string) error {
+	w.loadMu.Lock()
+	status := w.projectLoads[projectRoot]
+	w.loadMu.Unlock()
+	if status == nil || status.Loaded {
+		return nil
+	}
+	reason := "the project did not finish loading"
+	if status.SuspectedCause != "" {
+		reason += " (suspected cause: " + status.SuspectedCause + ")"
+	}
+	return &ProjectInitError{Project: projectRoot, File: filePath, Reason: reason}
+}
+
+// ensureProjectForRequest initializes the project of a request's file. It
+// returns nil when the request can proceed, possibly degraded to the file
+// alone, and otherwise the error response for the request.
+func ensureProjectForRequest(msg *Message, filePath string, w WrapperInterface) *Message {
+	err := w.EnsureProjectInitialized(filePath)
+	if err == nil {
+		return nil
+	}
+
+	var initErr *ProjectInitError
+	if !errors.As(err, &initErr) {
+		w.Log("Failed to initialize project: %v", err)
+		return NewErrorResponse(msg.ID, InternalError, err.Error())
+	}
+	if singleFileMethods[msg.Method] {
+		w.Log("Answering %s from %s alone: %v", msg.Method, filepath.Base(filePath), err)
+		return nil
+	}
+
+	w.Log("Failed %s: %v", msg.Method, err)
+	resp := NewErrorResponse(msg.ID, RequestFailed, fmt.Sprintf(
+		"%s needs the AL project's symbols, but %s. Single-file requests (%s) still work.",
+		describeRequest(msg), initErr.Error(), strings.Join(singleFileMethodNames(), ", ")))
+	resp.Error.Data, _ = json.Marshal(map[string]string{
+		"project": initErr.Project,
+		"file":    initErr.File,
+		"reason":  initErr.Reason,
+	})
+	return resp
+}
+
+// describeRequest names a request for error messages: its method, or the
+// command of workspace/executeCommand
+func describeRequest(msg *Message) string {
+	if msg.Method == "workspace/executeCommand" {
+		var params ExecuteCommandParams
+		if json.Unmarshal(msg.Params, &params) == nil && params.Command != "" {
+			return params.Command
+		}
+	}
+	return msg.Method
+}
+
+// singleFileMethodNames returns the short names of the single-file methods, sorted
+func singleFileMethodNames() []string {
+	names := make([]string, 0, len(singleFileMethods))
+	for method := range singleFileMethods {
+		names = append(names, strings.TrimPrefix(method, "textDocument/"))
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,277 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/SShadowS/claude-code-lsps/al-language-server-go/internal/project"
+)
+
+// In a workspace of several apps where A depends on B, references to a
+// symbol of B are only found in the project the AL server has active. The
+// wrapper reads the app.json files of the workspace to know which projects
+// can reference a project's symbols (those declaring it as a dependency,
+// directly or through a dependency with propagateDependencies), and with
+// references.dependents queries each of them too:
+//
+//   - "merge" asks every dependent project and merges the results with the
+//     queried project's; processReferences removes the duplicates
+//   - "fallback" asks the dependent projects only when the queried project
+//     has no references
+//   - "off" (default) asks the queried project alone, as each dependent
+//     project must be initialized and activated for its query
+//
+// The dependent projects are queried concurrently, but the AL server has one
+// active workspace, so the queries of different projects run one at a time,
+// each with its project active (see projectstate.go).
+//
+// The same dependencies shape the settings a project is activated with: its
+// activeWorkspaceClosure lists the workspace projects it depends on, and a
+// project activated while a project depending on it is active gets that
+// project as its dependencyParentWorkspacePath, so the AL server resolves
+// references between local apps from their sources, without compiled symbols.
+// Its expectedProjectReferenceDefinitions name the workspace apps it declares
+// as dependencies, as a VS Code multi-root workspace sets up project references.
+
+// workspaceApps reads the app.json of every project of a workspace, skipping
+// unreadable ones
+func workspaceApps(workspaceRoot string, projectRoot string) map[string]*project.App {
+	apps := make(map[string]*project.App)
+	for _, root := range workspaceProjects(workspaceRoot, projectRoot) {
+		if app, err := readProjectApp(root); err == nil {
+			apps[root] = app
+		}
+	}
+	return apps
+}
+
+// dependentProjects returns the workspace projects that can reference the
+// symbols of a project: those depending on it, and those depending on a
+// dependent that propagates its dependencies. The result is sorted.
+func dependentProjects(workspaceRoot string, projectRoot string) []string {
+	apps := workspaceApps(workspaceRoot, projectRoot)
+	target, ok := apps[projectRoot]
+	if !ok {
+		return nil
+	}
+
+	var dependents []string
+	found := map[string]bool{projectRoot: true}
+	// sources are the apps whose symbols a dependent sees: the target, and
+	// the dependents propagating it
+	sources := []*project.App{target}
+	for len(sources) > 0 {
+		source := sources[0]
+		sources = sources[1:]
+		for _, root := range sortedProjectRoots(apps) {
+			app := apps[root]
+			if found[root] || !app.DependsOn(source) {
+				continue
+			}
+			found[root] = true
+			dependents = append(dependents, root)
+			if app.PropagateDependencies {
+				sources = append(sources, app)
+			}
+		}
+	}
+	sort.Strings(dependents)
+	return dependents
+}
+
+// sortedProjectRoots returns the project roots of an app map, sorted
+func sortedProjectRoots(apps map[string]*project.App) []string {
+	roots := make([]string, 0, len(apps))
+	for root := range apps {
+		roots = append(roots, root)
+	}
+	sort.Strings(roots)
+	return roots
+}
+
+// dependencyClosure returns a project and the workspace projects it depends
+// on, directly or indirectly, sorted
+func dependencyClosure(apps map[string]*project.App, projectRoot string) []string {
+	closure := []string{projectRoot}
+	found := map[string]bool{projectRoot: true}
+	for i := 0; i < len(closure); i++ {
+		app, ok := apps[closure[i]]
+		if !ok {
+			continue
+		}
+		for _, root := range sortedProjectRoots(apps) {
+			if !found[root] && app.DependsOn(apps[root]) {
+				found[root] = true
+				closure = append(closure, root)
+			}
+		}
+	}
+	sort.Strings(closure)
+	return closure
+}
+
+// projectReferenceDefinitions returns the workspace apps a project declares as
+// dependencies, in the order of its app.json
+func projectReferenceDefinitions(apps map[string]*project.App, projectRoot string) []ProjectReferenceDefinition {
+	definitions := []ProjectReferenceDefinition{}
+	app, ok := apps[projectRoot]
+	if !ok {
+		return definitions
+	}
+	for _, dep := range app.Dependencies {
+		for _, root := range sortedProjectRoots(apps) {
+			if root == projectRoot || !dep.RefersTo(apps[root]) {
+				continue
+			}
+			other := apps[root]
+			definitions = append(definitions, ProjectReferenceDefinition{
+				AppID:     other.ID,
+				Name:      other.Name,
+				Publisher: other.Publisher,
+				Version:   other.Version,
+			})
+			break
+		}
+	}
+	return definitions
+}
+
+// workspaceSettings returns the settings a project is activated with, with
+// its assembly probing paths (see assemblyprobing.go) and ruleset (see
+// ruleset.go). When
+// the active project depends on it, the active project is its dependency
+// parent and the closure is the parent's, so the AL server resolves the
+// parent's references into the project from its sources; otherwise the
+// closure is the project and the workspace projects it depends on. The
+// project references are the workspace apps the project depends on directly.
+func (w *ALLSPWrapper) workspaceSettings(scope WrapperInterface, projectRoot string) *WorkspaceSettings {
+	settings := NewWorkspaceSettings(projectRoot)
+	settings.ALResourceConfigurationSettings.AssemblyProbingPaths = assemblyProbingPaths(projectRoot, w.Config().DotNet)
+	if probing := settings.ALResourceConfigurationSettings.AssemblyProbingPaths; len(probing) > 1 {
+		scope.Log("Assembly probing paths of %s: %s", projectRoot, strings.Join(probing, ", "))
+	}
+	if path, source := ruleSetPath(projectRoot, w.WorkspaceRoot(), w.Config().RuleSet, scope.Log); path != "" {
+		settings.ALResourceConfigurationSettings.RuleSetPath = &path
+		scope.Log("Ruleset of %s (%s): %s", projectRoot, source, path)
+	}
+	apps := workspaceApps(w.WorkspaceRoot(), projectRoot)
+	if len(apps) < 2 {
+		return settings
+	}
+
+	closureRoot := projectRoot
+	if active := w.ActiveProject(); active != "" && active != projectRoot && containsString(dependencyClosure(apps, active), projectRoot) {
+		parent := active
+		settings.DependencyParentWorkspacePath = &parent
+		closureRoot = parent
+	}
+	settings.ActiveWorkspaceClosure = dependencyClosure(apps, closureRoot)
+	settings.ExpectedProjectReferenceDefinitions = projectReferenceDefinitions(apps, projectRoot)
+	if settings.DependencyParentWorkspacePath != nil || len(settings.ActiveWorkspaceClosure) > 1 {
+		parent := "none"
+		if settings.DependencyParentWorkspacePath != nil {
+			parent = *settings.DependencyParentWorkspacePath
+		}
+		scope.Log("Workspace closure of %s: %s (dependency parent: %s, %d project reference(s))",
+			projectRoot, strings.Join(settings.ActiveWorkspaceClosure, ", "), parent,
+			len(settings.ExpectedProjectReferenceDefinitions))
+	}
+	return settings
+}
+
+// activeWorkspaceParams returns the al/setActiveWorkspace params of a project
+func (w *ALLSPWrapper) activeWorkspaceParams(scope WrapperInterface, projectRoot string) *ActiveWorkspaceParams {
+	params := NewActiveWorkspaceParams(projectRoot)
+	params.Settings = w.workspaceSettings(scope, projectRoot)
+	return params
+}
+
+// SendRequestInProject sends a request to the AL LSP with a project active
+func (w *ALLSPWrapper) SendRequestInProject(projectRoot string, method string, params interface{}) (*Message, error) {
+	return w.sendProjectRequest("", projectRoot, method, params, defaultRequestTimeout)
+}
+
+// SendRequestInProject sends a request to the AL LSP with a project active
+func (s *requestScope) SendRequestInProject(projectRoot string, method string, params interface{}) (*Message, error) {
+	if s.progress != nil {
+		params = s.progress.withTokens(method, params)
+	}
+	return s.sendProjectRequest(s.newSpan(), projectRoot, method, params, defaultRequestTimeout)
+}
+
+// activateProject sends al/setActiveWorkspace for a project that is not
+// active. The caller holds activationMu.
+func (w *ALLSPWrapper) activateProject(scope WrapperInterface, projectRoot string) error {
+	if w.ActiveProject() == projectRoot {
+		return nil
+	}
+	if _, err := scope.SendRequestToLSP("al/setActiveWorkspace", w.activeWorkspaceParams(scope, projectRoot)); err != nil {
+		return err
+	}
+	w.setActiveProject(projectRoot)
+	return nil
+}
+
+// dependentReferences asks the projects depending on a file's project for
+// the references at a position, and returns their locations
+func dependentReferences(filePath string, params interface{}, w WrapperInterface) []Location {
+	projectRoot := GetProjectRoot(filePath)
+	if projectRoot == "" {
+		return nil
+	}
+	projectRoot = NormalizePath(projectRoot)
+	dependents := dependentProjects(w.WorkspaceRoot(), projectRoot)
+	if len(dependents) == 0 {
+		return nil
+	}
+	w.Log("Searching %d dependent project(s) of %s for references: %s",
+		len(dependents), filepath.Base(projectRoot), strings.Join(dependents, ", "))
+
+	results := make([][]Location, len(dependents))
+	var wg sync.WaitGroup
+	for i, root := range dependents {
+		wg.Add(1)
+		go func(i int, root string) {
+			defer wg.Done()
+			if err := w.EnsureProjectInitialized(filepath.Join(root, "app.json")); err != nil {
+				w.Log("Skipping references in %s: %v", root, err)
+				return
+			}
+			response, err := w.SendRequestInProject(root, "textDocument/references", params)
+			if err != nil {
+				w.Log("Failed to find references in %s: %v", root, err)
+				return
+			}
+			if response.Error != nil {
+				w.Log("Failed to find references in %s: %s", root, response.Error.Message)
+				return
+			}
+			json.Unmarshal(response.Result, &results[i])
+			w.Log("Found %d reference(s) in %s", len(results[i]), root)
+		}(i, root)
+	}
+	wg.Wait()
+
+	var locations []Location
+	for _, result := range results {
+		locations = append(locations, result...)
+	}
+	return locations
+}
+
+// mergeReferences appends locations to a references result
+func mergeReferences(result json.RawMessage, locations []Location) json.RawMessage {
+	if len(locations) == 0 {
+		return result
+	}
+	var merged []Location
+	json.Unmarshal(result, &merged)
+	data, err := json.Marshal(append(merged, locations...))
+	if err != nil {
+		return result
+	}
+	return data
+}
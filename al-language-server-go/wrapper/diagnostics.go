@@ -0,0 +1,424 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LSP diagnostic severities
+const (
+	SeverityError       = 1
+	SeverityWarning     = 2
+	SeverityInformation = 3
+	SeverityHint        = 4
+)
+
+// PublishDiagnosticsParams represents textDocument/publishDiagnostics parameters
+type PublishDiagnosticsParams struct {
+	URI         string       `json:"uri"`
+	Version     *int         `json:"version,omitempty"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+// Diagnostic represents an LSP diagnostic
+type Diagnostic struct {
+	Range              Range            `json:"range"`
+	Severity           int              `json:"severity,omitempty"`
+	Code               json.RawMessage  `json:"code,omitempty"`
+	CodeDescription    *CodeDescription `json:"codeDescription,omitempty"`
+	Source             string           `json:"source,omitempty"`
+	Message            string           `json:"message"`
+	Tags               []int            `json:"tags,omitempty"`
+	RelatedInformation json.RawMessage  `json:"relatedInformation,omitempty"`
+	Data               json.RawMessage  `json:"data,omitempty"`
+}
+
+// CodeDescription links a diagnostic code to its documentation
+type CodeDescription struct {
+	Href string `json:"href"`
+}
+
+// ruleDocPrefixes maps rule ID prefixes to their documentation URL templates
+var ruleDocPrefixes = []struct {
+	prefix string
+	url    string
+}{
+	{"PTE", "https://learn.microsoft.com/dynamics365/business-central/dev-itpro/developer/analyzers/pertenantextensioncop-%s"},
+	{"AA", "https://learn.microsoft.com/dynamics365/business-central/dev-itpro/developer/analyzers/codecop-%s"},
+	{"AS", "https://learn.microsoft.com/dynamics365/business-central/dev-itpro/developer/analyzers/appsourcecop-%s"},
+	{"AW", "https://learn.microsoft.com/dynamics365/business-central/dev-itpro/developer/analyzers/uicop-%s"},
+	{"AL", "https://learn.microsoft.com/dynamics365/business-central/dev-itpro/developer/diagnostics/diagnostic-%s"},
+	{"LC", "https://github.com/StefanMaron/BusinessCentral.LinterCop/wiki/%s"},
+}
+
+// RuleDocumentationURL returns the documentation page for an AL compiler or
+// analyzer rule ID, or "" if the rule family is unknown
+func RuleDocumentationURL(ruleID string) string {
+	id := strings.ToUpper(ruleID)
+	for _, family := range ruleDocPrefixes {
+		if !strings.HasPrefix(id, family.prefix) {
+			continue
+		}
+		digits := id[len(family.prefix):]
+		if digits == "" || strings.Trim(digits, "0123456789") != "" {
+			return ""
+		}
+		if family.prefix == "LC" {
+			return fmt.Sprintf(family.url, id)
+		}
+		return fmt.Sprintf(family.url, strings.ToLower(id))
+	}
+	return ""
+}
+
+// addCodeDescriptions links each diagnostic to its rule documentation
+func addCodeDescriptions(diagnostics []Diagnostic) {
+	for i := range diagnostics {
+		if diagnostics[i].CodeDescription != nil {
+			continue
+		}
+		if href := RuleDocumentationURL(diagnostics[i].RuleID()); href != "" {
+			diagnostics[i].CodeDescription = &CodeDescription{Href: href}
+		}
+	}
+}
+
+// RuleID returns the diagnostic code (e.g. "AA0021") as an upper-case string
+func (d *Diagnostic) RuleID() string {
+	if len(d.Code) == 0 {
+		return ""
+	}
+
+	var s string
+	if err := json.Unmarshal(d.Code, &s); err == nil {
+		return strings.ToUpper(s)
+	}
+	var n int
+	if err := json.Unmarshal(d.Code, &n); err == nil {
+		return strconv.Itoa(n)
+	}
+	// Some servers send {"value": "...", "target": "..."}
+	var obj struct {
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(d.Code, &obj); err == nil && len(obj.Value) > 0 {
+		inner := Diagnostic{Code: obj.Value}
+		return inner.RuleID()
+	}
+	return ""
+}
+
+// parseSeverity maps a config severity name to an LSP severity (0 if unknown)
+func parseSeverity(name string) int {
+	switch strings.ToLower(name) {
+	case "error":
+		return SeverityError
+	case "warning":
+		return SeverityWarning
+	case "info", "information":
+		return SeverityInformation
+	case "hint":
+		return SeverityHint
+	}
+	return 0
+}
+
+// SeverityName returns the config name of an LSP severity
+func SeverityName(severity int) string {
+	switch severity {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	case SeverityInformation:
+		return "info"
+	}
+	return "hint"
+}
+
+// ApplyDiagnosticRules suppresses and re-levels diagnostics according to config,
+// mirroring what #pragma warning and ruleset.json actions would do
+func ApplyDiagnosticRules(diagnostics []Diagnostic, cfg DiagnosticsConfig) []Diagnostic {
+	if len(cfg.Suppress) == 0 && len(cfg.Severity) == 0 && !cfg.WarningsAsInfo {
+		return diagnostics
+	}
+
+	suppressed := make(map[string]bool, len(cfg.Suppress))
+	for _, id := range cfg.Suppress {
+		suppressed[strings.ToUpper(id)] = true
+	}
+	overrides := make(map[string]int, len(cfg.Severity))
+	for id, name := range cfg.Severity {
+		if severity := parseSeverity(name); severity != 0 {
+			overrides[strings.ToUpper(id)] = severity
+		}
+	}
+
+	result := make([]Diagnostic, 0, len(diagnostics))
+	for _, diag := range diagnostics {
+		id := diag.RuleID()
+		if suppressed[id] {
+			continue
+		}
+		if severity, ok := overrides[id]; ok {
+			diag.Severity = severity
+		} else if cfg.WarningsAsInfo && diag.Severity == SeverityWarning {
+			diag.Severity = SeverityInformation
+		}
+		result = append(result, diag)
+	}
+	return result
+}
+
+// processDiagnostics applies the configured diagnostic rules to a
+// publishDiagnostics notification and queues it for forwarding
+func (w *ALLSPWrapper) processDiagnostics(msg *Message) {
+	var params PublishDiagnosticsParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		w.Log("Failed to parse publishDiagnostics params: %v", err)
+		w.writeToClient(msg)
+		return
+	}
+
+	before := len(params.Diagnostics)
+	params.Diagnostics = ApplyDiagnosticRules(params.Diagnostics, w.Config().Diagnostics)
+	if dropped := before - len(params.Diagnostics); dropped > 0 {
+		w.Log("Suppressed %d diagnostic(s) for %s", dropped, params.URI)
+	}
+	addCodeDescriptions(params.Diagnostics)
+
+	w.diagnostics.recordPublished(&params)
+	w.autoDownloadSymbols(&params)
+	if path, err := FileURIToPath(params.URI); err == nil {
+		params.Diagnostics = w.withWrapperDiagnostics(NormalizePath(path), params.Diagnostics)
+	}
+	w.queueDiagnostics(&params)
+}
+
+// diagnosticsQueue coalesces, deduplicates and rate-limits publishDiagnostics.
+// During project load the AL server can publish thousands of notifications;
+// only the newest set per URI is kept and forwarded in batches.
+type diagnosticsQueue struct {
+	mu          sync.Mutex
+	pending     map[string]*PublishDiagnosticsParams
+	lastSent    map[string]string
+	lastVersion map[string]int
+	tokens      float64
+	lastRefill  time.Time
+	timer       *time.Timer
+
+	// published holds the newest processed diagnostics per file path, for
+	// pull diagnostics; publishedSignal is closed when it changes
+	published       map[string][]Diagnostic
+	publishedSignal chan struct{}
+	// publishedURIs are the URIs the AL server published each file under
+	publishedURIs map[string]string
+}
+
+func newDiagnosticsQueue() *diagnosticsQueue {
+	return &diagnosticsQueue{
+		pending:         make(map[string]*PublishDiagnosticsParams),
+		lastSent:        make(map[string]string),
+		lastVersion:     make(map[string]int),
+		published:       make(map[string][]Diagnostic),
+		publishedSignal: make(chan struct{}),
+		publishedURIs:   make(map[string]string),
+	}
+}
+
+// recordPublished keeps the newest diagnostics of a file and wakes the pull
+// diagnostics requests waiting for them
+func (q *diagnosticsQueue) recordPublished(params *PublishDiagnosticsParams) {
+	path, err := FileURIToPath(params.URI)
+	if err != nil {
+		return
+	}
+	q.mu.Lock()
+	q.published[NormalizePath(path)] = params.Diagnostics
+	q.publishedURIs[NormalizePath(path)] = params.URI
+	close(q.publishedSignal)
+	q.publishedSignal = make(chan struct{})
+	q.mu.Unlock()
+}
+
+// withWrapperDiagnostics returns a file's diagnostics with the wrapper's own
+// added: duplicate object warnings and the diagnostics of the last build
+func (w *ALLSPWrapper) withWrapperDiagnostics(path string, diagnostics []Diagnostic) []Diagnostic {
+	return w.withBuildDiagnostics(path, w.withDuplicateDiagnostics(path, diagnostics))
+}
+
+// FileDiagnostics returns the diagnostics the AL server last published for a
+// file with the wrapper's duplicate object warnings and build diagnostics,
+// waiting up to timeout for the first set
+func (w *ALLSPWrapper) FileDiagnostics(filePath string, timeout time.Duration) ([]Diagnostic, bool) {
+	path := NormalizePath(filePath)
+	q := w.diagnostics
+	deadline := time.After(timeout)
+	for {
+		q.mu.Lock()
+		diagnostics, ok := q.published[path]
+		signal := q.publishedSignal
+		q.mu.Unlock()
+		if ok {
+			return w.withWrapperDiagnostics(path, diagnostics), true
+		}
+		select {
+		case <-signal:
+		case <-deadline:
+			return nil, false
+		}
+	}
+}
+
+// queueDiagnostics schedules a processed publishDiagnostics notification for forwarding
+func (w *ALLSPWrapper) queueDiagnostics(params *PublishDiagnosticsParams) {
+	cfg := w.Config().Diagnostics
+	q := w.diagnostics
+
+	q.mu.Lock()
+	if params.Version != nil {
+		if last, ok := q.lastVersion[params.URI]; ok && *params.Version < last {
+			q.mu.Unlock()
+			w.Log("Dropping stale diagnostics for %s (version %d < %d)", params.URI, *params.Version, last)
+			return
+		}
+		q.lastVersion[params.URI] = *params.Version
+	}
+	q.pending[params.URI] = params
+
+	if cfg.CoalesceMillis <= 0 {
+		q.mu.Unlock()
+		w.flushDiagnostics()
+		return
+	}
+	if q.timer == nil {
+		q.timer = time.AfterFunc(time.Duration(cfg.CoalesceMillis)*time.Millisecond, w.flushDiagnostics)
+	}
+	q.mu.Unlock()
+}
+
+// flushDiagnostics forwards pending diagnostics within the configured rate
+// budget. Updates over the budget stay pending, for a flush when the bucket
+// has refilled; a newer set for the same file replaces them meanwhile.
+func (w *ALLSPWrapper) flushDiagnostics() {
+	cfg := w.Config().Diagnostics
+	q := w.diagnostics
+
+	q.mu.Lock()
+	q.timer = nil
+
+	// Skip sets identical to what the client already has
+	var batch []*PublishDiagnosticsParams
+	for uri, params := range q.pending {
+		last, known := q.lastSent[uri]
+		if !known && len(params.Diagnostics) == 0 {
+			// Clearing a file the client never saw diagnostics for is a no-op
+			continue
+		}
+		if fingerprint := diagnosticsFingerprint(params.Diagnostics); last != fingerprint {
+			batch = append(batch, params)
+		}
+	}
+	q.pending = make(map[string]*PublishDiagnosticsParams)
+
+	// Files with errors first, then clears of stale diagnostics, then the rest
+	rank := func(params *PublishDiagnosticsParams) int {
+		switch {
+		case countSeverity(params.Diagnostics, SeverityError) > 0:
+			return 0
+		case len(params.Diagnostics) == 0:
+			return 1
+		}
+		return 2
+	}
+	sort.Slice(batch, func(i, j int) bool {
+		if ri, rj := rank(batch[i]), rank(batch[j]); ri != rj {
+			return ri < rj
+		}
+		if len(batch[i].Diagnostics) != len(batch[j].Diagnostics) {
+			return len(batch[i].Diagnostics) > len(batch[j].Diagnostics)
+		}
+		return batch[i].URI < batch[j].URI
+	})
+
+	// Token bucket: refill MaxPerSecond tokens per second, capped at one second's worth
+	now := time.Now()
+	if cfg.MaxPerSecond > 0 {
+		if q.lastRefill.IsZero() {
+			q.tokens = float64(cfg.MaxPerSecond)
+		} else {
+			q.tokens += now.Sub(q.lastRefill).Seconds() * float64(cfg.MaxPerSecond)
+			if q.tokens > float64(cfg.MaxPerSecond) {
+				q.tokens = float64(cfg.MaxPerSecond)
+			}
+		}
+		q.lastRefill = now
+	}
+
+	var send []*PublishDiagnosticsParams
+	deferred := 0
+	for _, params := range batch {
+		if cfg.MaxPerSecond > 0 {
+			if q.tokens < 1 {
+				q.pending[params.URI] = params
+				deferred++
+				continue
+			}
+			q.tokens--
+		}
+		q.lastSent[params.URI] = diagnosticsFingerprint(params.Diagnostics)
+		send = append(send, params)
+	}
+	if deferred > 0 && q.timer == nil {
+		refill := time.Duration((1 - q.tokens) / float64(cfg.MaxPerSecond) * float64(time.Second))
+		q.timer = time.AfterFunc(refill, w.flushDiagnostics)
+	}
+	q.mu.Unlock()
+
+	for _, params := range send {
+		msg, err := NewNotification("textDocument/publishDiagnostics", params)
+		if err != nil {
+			continue
+		}
+		if err := w.writeToClient(msg); err != nil {
+			w.Log("Error forwarding diagnostics: %v", err)
+		}
+	}
+
+	if deferred > 0 {
+		w.Log("Diagnostics rate limit reached: forwarded %d, deferred %d file update(s)", len(send), deferred)
+		summary := LogMessageParams{
+			Type: MessageTypeWarning,
+			Message: fmt.Sprintf("AL LSP wrapper: delayed diagnostics for %d file(s) to stay under %d updates/s. "+
+				"They are sent as the rate allows.", deferred, cfg.MaxPerSecond),
+		}
+		if msg, err := NewNotification("window/logMessage", summary); err == nil {
+			w.writeToClient(msg)
+		}
+	}
+}
+
+// diagnosticsFingerprint identifies a diagnostics set for deduplication
+func diagnosticsFingerprint(diagnostics []Diagnostic) string {
+	data, err := json.Marshal(diagnostics)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// countSeverity counts diagnostics of the given severity
+func countSeverity(diagnostics []Diagnostic, severity int) int {
+	count := 0
+	for _, diag := range diagnostics {
+		if diag.Severity == severity {
+			count++
+		}
+	}
+	return count
+}
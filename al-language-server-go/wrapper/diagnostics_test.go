@@ -0,0 +1,49 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestRateLimitedDiagnosticsAreDelivered(t *testing.T) {
+	w, _, client := newTestWrapper()
+	cfg := DefaultConfig()
+	cfg.Diagnostics.CoalesceMillis = 0
+	cfg.Diagnostics.MaxPerSecond = 2
+	w.config = cfg
+
+	uris := []string{"file:///app/A.Table.al", "file:///app/B.Table.al", "file:///app/C.Table.al"}
+	for _, uri := range uris {
+		w.queueDiagnostics(&PublishDiagnosticsParams{
+			URI:         uri,
+			Diagnostics: []Diagnostic{{Severity: SeverityError, Message: "error in " + uri}},
+		})
+	}
+
+	delivered := func() map[string]bool {
+		published := make(map[string]bool)
+		for _, msg := range client.messages(t) {
+			if msg.Method != "textDocument/publishDiagnostics" {
+				continue
+			}
+			var params PublishDiagnosticsParams
+			if err := json.Unmarshal(msg.Params, &params); err != nil {
+				t.Fatal(err)
+			}
+			published[params.URI] = true
+		}
+		return published
+	}
+
+	if got := len(delivered()); got != 2 {
+		t.Fatalf("%d file(s) delivered at once, want 2 within the budget", got)
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for len(delivered()) < len(uris) {
+		if time.Now().After(deadline) {
+			t.Fatalf("rate-limited update never delivered: got %v", delivered())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
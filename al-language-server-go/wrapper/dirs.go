@@ -0,0 +1,120 @@
+package wrapper
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// appDirName is the per-user directory name for wrapper state, caches and config
+const appDirName = "al-lsp-wrapper"
+
+// homeSubdir returns ~/<rel>, or "" if the home directory is unknown
+func homeSubdir(rel string) string {
+	home, err := os.UserHomeDir()
+	if err != nil || home == "" {
+		return ""
+	}
+	return filepath.Join(home, rel)
+}
+
+// xdgDir returns $envVar if it is an absolute path, else ~/<fallback>.
+// Relative values are invalid per the XDG base directory spec and are ignored.
+func xdgDir(envVar string, fallback string) string {
+	if dir := os.Getenv(envVar); dir != "" && filepath.IsAbs(dir) {
+		return dir
+	}
+	return homeSubdir(fallback)
+}
+
+// GetStateDir returns the directory for logs and other persistent state:
+// $XDG_STATE_HOME/al-lsp-wrapper on Linux, ~/Library/Logs/al-lsp-wrapper on
+// macOS and the temp directory on Windows
+func GetStateDir() string {
+	var base string
+	switch runtime.GOOS {
+	case "windows":
+		return windowsTempDir()
+	case "darwin":
+		base = homeSubdir(filepath.Join("Library", "Logs"))
+	default:
+		base = xdgDir("XDG_STATE_HOME", filepath.Join(".local", "state"))
+	}
+	if base == "" {
+		return os.TempDir()
+	}
+	return filepath.Join(base, appDirName)
+}
+
+// GetCacheDir returns the directory for symbol and other rebuildable caches:
+// $XDG_CACHE_HOME/al-lsp-wrapper on Linux, ~/Library/Caches/al-lsp-wrapper on
+// macOS and %LOCALAPPDATA%\al-lsp-wrapper on Windows
+func GetCacheDir() string {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), appDirName+"-cache")
+	}
+	return filepath.Join(base, appDirName)
+}
+
+// GetDataDir returns the directory for data the wrapper manages, such as AL
+// extensions installed by the install subcommand: $XDG_DATA_HOME/al-lsp-wrapper
+// on Linux, ~/Library/Application Support/al-lsp-wrapper on macOS and
+// %LOCALAPPDATA%\al-lsp-wrapper on Windows
+func GetDataDir() string {
+	var base string
+	switch runtime.GOOS {
+	case "windows":
+		base = os.Getenv("LOCALAPPDATA")
+	case "darwin":
+		base = homeSubdir(filepath.Join("Library", "Application Support"))
+	default:
+		base = xdgDir("XDG_DATA_HOME", filepath.Join(".local", "share"))
+	}
+	if base == "" {
+		return filepath.Join(os.TempDir(), appDirName+"-data")
+	}
+	return filepath.Join(base, appDirName)
+}
+
+// GetUserConfigDir returns the directory holding the user config file:
+// $XDG_CONFIG_HOME/al-lsp-wrapper on Linux, ~/Library/Application Support/al-lsp-wrapper
+// on macOS and %APPDATA%\al-lsp-wrapper on Windows
+func GetUserConfigDir() string {
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(base, appDirName)
+}
+
+// GetUserConfigPath returns the user config file. The platform config
+// directory is preferred; the legacy ~/.claude/al-lsp.json is used when only
+// it exists, so existing setups keep working.
+func GetUserConfigPath() string {
+	var preferred string
+	if dir := GetUserConfigDir(); dir != "" {
+		preferred = filepath.Join(dir, "config.json")
+		if _, err := os.Stat(preferred); err == nil {
+			return preferred
+		}
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		legacy := filepath.Join(home, ".claude", "al-lsp.json")
+		if _, err := os.Stat(legacy); err == nil || preferred == "" {
+			return legacy
+		}
+	}
+	return preferred
+}
+
+// windowsTempDir returns the user's temp directory on Windows
+func windowsTempDir() string {
+	if dir := os.Getenv("TEMP"); dir != "" {
+		return dir
+	}
+	if dir := os.Getenv("TMP"); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.Getenv("USERPROFILE"), "AppData", "Local", "Temp")
+}
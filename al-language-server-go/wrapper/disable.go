@@ -0,0 +1,71 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The wrapper can be switched off per workspace without uninstalling the
+// plugin. A disabled wrapper answers initialize with empty capabilities,
+// does not start (or stops) the AL server and ignores everything else.
+
+const (
+	// disableEnvVar disables the wrapper when set to 1, true or yes
+	disableEnvVar = "AL_LSP_DISABLED"
+	// disableMarker disables the wrapper for the workspace containing it
+	disableMarker = ".claude/al-lsp.disabled"
+)
+
+// DisabledReason returns why the wrapper is disabled for a workspace, or ""
+// if it is enabled. The environment variable applies to every workspace.
+func DisabledReason(workspaceRoot string) string {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv(disableEnvVar))) {
+	case "1", "true", "yes":
+		return disableEnvVar + " is set"
+	}
+	if workspaceRoot == "" {
+		return ""
+	}
+	marker := filepath.Join(workspaceRoot, filepath.FromSlash(disableMarker))
+	if _, err := os.Stat(marker); err == nil {
+		return marker + " exists"
+	}
+	return ""
+}
+
+// disable switches the wrapper off for the rest of the session and stops
+// the AL server if it is running
+func (w *ALLSPWrapper) disable(scope WrapperInterface, reason string) {
+	scope.Log("Wrapper disabled for this workspace (%s); nothing is passed to the AL server", reason)
+	w.disabled.Store(true)
+	w.stopServer()
+}
+
+// handleDisabled answers a client message while the wrapper is disabled
+func (w *ALLSPWrapper) handleDisabled(scope *requestScope, msg *Message) (*Message, error) {
+	switch msg.Method {
+	case "initialize":
+		result, err := json.Marshal(map[string]interface{}{
+			"capabilities": map[string]interface{}{},
+			"serverInfo":   map[string]string{"name": "al-lsp-wrapper (disabled)", "version": Version},
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &Message{JSONRPC: "2.0", ID: msg.ID, Result: result}, nil
+	case "al-wrapper/status":
+		return NewResponse(msg.ID, w.Status())
+	case "shutdown":
+		return &Message{JSONRPC: "2.0", ID: msg.ID, Result: json.RawMessage("null")}, nil
+	case "exit":
+		os.Exit(0)
+	}
+
+	if msg.IsRequest() {
+		scope.Log("Ignoring %s: wrapper is disabled for this workspace", msg.Method)
+		return NewErrorResponse(msg.ID, MethodNotFound, "AL language server is disabled for this workspace"), nil
+	}
+	return nil, nil
+}
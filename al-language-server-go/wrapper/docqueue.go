@@ -0,0 +1,65 @@
+package wrapper
+
+import "encoding/json"
+
+// Messages about one document are handled in the order the client sent them,
+// even though requests are handled concurrently: a hover sent before a
+// didChange must be answered for the text it was computed on, and a
+// didChange must not overtake the request before it. Each document with
+// messages in flight has a FIFO queue, drained by one goroutine; messages
+// for other documents and messages without a document are not held up.
+
+// documentQueue is the FIFO of messages for one document
+type documentQueue struct {
+	items []func()
+}
+
+// documentURI returns the textDocument.uri of a message, or "" if it has none
+func documentURI(msg *Message) string {
+	if len(msg.Params) == 0 {
+		return ""
+	}
+	var params struct {
+		TextDocument struct {
+			URI string `json:"uri"`
+		} `json:"textDocument"`
+	}
+	if json.Unmarshal(msg.Params, &params) != nil {
+		return ""
+	}
+	return params.TextDocument.URI
+}
+
+// enqueueDocumentMessage runs serve after every earlier message for the same
+// document, without blocking the caller
+func (w *ALLSPWrapper) enqueueDocumentMessage(uri string, serve func()) {
+	w.beginInflight()
+	w.queueMu.Lock()
+	defer w.queueMu.Unlock()
+	if queue, ok := w.docQueues[uri]; ok {
+		queue.items = append(queue.items, serve)
+		return
+	}
+	queue := &documentQueue{items: []func(){serve}}
+	w.docQueues[uri] = queue
+	go w.drainDocumentQueue(uri, queue)
+}
+
+// drainDocumentQueue runs a document's queued messages in order and removes
+// the queue once it is empty
+func (w *ALLSPWrapper) drainDocumentQueue(uri string, queue *documentQueue) {
+	for {
+		w.queueMu.Lock()
+		if len(queue.items) == 0 {
+			delete(w.docQueues, uri)
+			w.queueMu.Unlock()
+			return
+		}
+		serve := queue.items[0]
+		queue.items = queue.items[1:]
+		w.queueMu.Unlock()
+
+		serve()
+		w.endInflight()
+	}
+}
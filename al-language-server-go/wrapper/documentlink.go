@@ -0,0 +1,241 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// textDocument/documentLink is forwarded to the AL server, and the links are
+// completed with the references to other AL objects in the file: Page 21 and
+// Record Customer in declarations, Page::"Customer Card", Database::Customer,
+// Codeunit.Run(80), RunObject, SourceTable, TableRelation and extends. Each
+// reference to an object declared in the workspace's projects links to its
+// declaration (file URI with a #L<line> fragment). Links of the AL server
+// whose target is not a file in the workspace are pointed at the declaration
+// of the object they cover, if there is one. References to dependency objects
+// are not linked, as their sources are not on disk.
+
+// DocumentLink is a link in a document
+type DocumentLink struct {
+	Range   Range           `json:"range"`
+	Target  string          `json:"target,omitempty"`
+	Tooltip string          `json:"tooltip,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// alObjectName matches an object name or ID, quoted or not
+const alObjectName = `("(?:[^"]|"")+"|[A-Za-z_][A-Za-z0-9_]*|\d+)`
+
+// objectReferencePatterns match object references in masked code: group 1
+// is the object type, unless typ is set, and group 2 the name or ID
+var objectReferencePatterns = []struct {
+	pattern *regexp.Regexp
+	typ     string
+}{
+	// Page::"Customer Card", Database::Customer, Codeunit::"Sales-Post"
+	{regexp.MustCompile(`(?i)\b(page|report|codeunit|xmlport|query|database|enum|interface)\s*::\s*` + alObjectName), ""},
+	// Page.Run(21), Report.RunModal(50100)
+	{regexp.MustCompile(`(?i)\b(page|report|codeunit|xmlport|query)\s*\.\s*run(?:modal)?\s*\(\s*(\d+)`), ""},
+	// RunObject = page "Customer Card"
+	{regexp.MustCompile(`(?i)\brunobject\s*=\s*(page|report|codeunit|xmlport|query)\s+` + alObjectName), ""},
+	// Cust: Record Customer, CustCard: Page 21
+	{regexp.MustCompile(`(?i):\s*(record|page|report|codeunit|xmlport|query|enum|interface|testpage|testrequestpage)\s+` + alObjectName), ""},
+	// SourceTable = Customer, TableRelation = Customer."No."
+	{regexp.MustCompile(`(?i)\b(sourcetable|tablerelation)\s*=\s*` + alObjectName), "table"},
+}
+
+// referenceObjectTypes maps the words introducing a reference to object types
+var referenceObjectTypes = map[string]string{
+	"record":          "table",
+	"database":        "table",
+	"testpage":        "page",
+	"testrequestpage": "page",
+}
+
+// DocumentLinkHandler handles textDocument/documentLink
+type DocumentLinkHandler struct{}
+
+func (h *DocumentLinkHandler) ShouldHandle(method string) bool {
+	return method == "textDocument/documentLink"
+}
+
+func (h *DocumentLinkHandler) Handle(msg *Message, w WrapperInterface) (*Message, *Message) {
+	var params struct {
+		TextDocument TextDocumentIdentifier `json:"textDocument"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		w.Log("Failed to parse documentLink params: %v", err)
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "Invalid parameters")
+	}
+
+	filePath, err := FileURIToPath(params.TextDocument.URI)
+	if err != nil {
+		w.Log("Failed to convert URI: %v", err)
+		return nil, NewErrorResponse(msg.ID, InternalError, "Invalid file URI")
+	}
+
+	// Ensure the file is opened
+	if err := w.EnsureFileOpened(filePath); err != nil {
+		w.Log("Failed to open file: %v", err)
+		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	}
+
+	// Ensure project is initialized, or degrade to the file alone
+	if errResp := ensureProjectForRequest(msg, filePath, w); errResp != nil {
+		return nil, errResp
+	}
+
+	// Forward to AL LSP; a server without document links leaves them to the wrapper
+	response, err := w.SendRequestToLSP("textDocument/documentLink", params)
+	if err != nil {
+		w.Log("Failed to send documentLink request: %v", err)
+		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	}
+	if response.Error != nil && response.Error.Code != MethodNotFound {
+		return nil, &Message{
+			JSONRPC: "2.0",
+			ID:      msg.ID,
+			Error:   response.Error,
+		}
+	}
+	var serverLinks []DocumentLink
+	if response.Error == nil {
+		json.Unmarshal(response.Result, &serverLinks)
+	}
+
+	index := buildTypeIndex(w, filePath)
+	references := objectReferences(filePath)
+
+	// Server links to targets outside the workspace's files are pointed at
+	// the declaration of the object they cover
+	links := []json.RawMessage{}
+	linked := make(map[Range]bool)
+	resolved := 0
+	for _, link := range serverLinks {
+		if !strings.HasPrefix(link.Target, "file:") {
+			for _, ref := range references {
+				if ref.Range != link.Range {
+					continue
+				}
+				if obj, ok := ref.resolve(index); ok {
+					link.Target = objectLinkTarget(obj)
+					link.Tooltip = obj.DisplayName()
+					resolved++
+				}
+			}
+		}
+		linked[link.Range] = true
+		if data, err := json.Marshal(link); err == nil {
+			links = append(links, data)
+		}
+	}
+
+	// Links to the objects referenced in the file
+	var objectLinks []DocumentLink
+	for _, ref := range references {
+		if linked[ref.Range] {
+			continue
+		}
+		if obj, ok := ref.resolve(index); ok {
+			linked[ref.Range] = true
+			objectLinks = append(objectLinks, DocumentLink{Range: ref.Range, Target: objectLinkTarget(obj), Tooltip: obj.DisplayName()})
+		}
+	}
+	w.Log("Document links of %s: %d from the AL server (%d resolved), %d to workspace objects",
+		filePath, len(serverLinks), resolved, len(objectLinks))
+	if len(objectLinks) > 0 {
+		data, err := json.Marshal(objectLinks)
+		if err != nil {
+			return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+		}
+		var marked []json.RawMessage
+		json.Unmarshal(markProvenance(data, msg.Method, provenanceObjectLinks, w), &marked)
+		links = append(links, marked...)
+	}
+	return newResultMessage(msg.ID, links)
+}
+
+// objectReference is a reference to an AL object in a file
+type objectReference struct {
+	// Type is the object type, e.g. "page"
+	Type string
+	// Name is the unquoted name, or the ID
+	Name  string
+	Range Range
+}
+
+// resolve returns the workspace object a reference refers to
+func (r objectReference) resolve(index typeIndex) (ALObject, bool) {
+	id, err := strconv.Atoi(r.Name)
+	for _, obj := range index.objects {
+		if obj.Type != r.Type {
+			continue
+		}
+		if (err == nil && obj.ID == id) || (err != nil && strings.EqualFold(obj.Name, r.Name)) {
+			return obj, true
+		}
+	}
+	return ALObject{}, false
+}
+
+// objectLinkTarget is the URI of an object's declaration
+func objectLinkTarget(obj ALObject) string {
+	return fmt.Sprintf("%s#L%d", PathToFileURI(obj.Path), obj.Line+1)
+}
+
+// objectReferences returns the object references in the code of a file
+func objectReferences(path string) []objectReference {
+	var references []objectReference
+	inComment := false
+	for line, text := range readSourceLines(path) {
+		code := text
+		if inComment {
+			end := strings.Index(code, "*/")
+			if end < 0 {
+				continue
+			}
+			code = strings.Repeat(" ", end+2) + code[end+2:]
+		}
+		_, inComment = stripALComments(code, false)
+		code = maskALNonCode(code)
+
+		for _, p := range objectReferencePatterns {
+			for _, m := range p.pattern.FindAllStringSubmatchIndex(code, -1) {
+				typ := p.typ
+				if typ == "" {
+					typ = strings.ToLower(code[m[2]:m[3]])
+					if mapped, ok := referenceObjectTypes[typ]; ok {
+						typ = mapped
+					}
+				}
+				start, end := m[4], m[5]
+				references = append(references, objectReference{
+					Type: typ,
+					Name: unquoteALName(text[start:end]),
+					Range: Range{
+						Start: Position{Line: line, Character: utf16Length(text[:start])},
+						End:   Position{Line: line, Character: utf16Length(text[:end])},
+					},
+				})
+			}
+		}
+
+		// tableextension 50100 "My Ext" extends Customer
+		if m := objectDeclPattern.FindStringSubmatchIndex(code); m != nil && m[8] >= 0 {
+			if base, ok := extensionBaseTypes[strings.ToLower(code[m[2]:m[3]])]; ok {
+				references = append(references, objectReference{
+					Type: base,
+					Name: unquoteALName(text[m[8]:m[9]]),
+					Range: Range{
+						Start: Position{Line: line, Character: utf16Length(text[:m[8]])},
+						End:   Position{Line: line, Character: utf16Length(text[:m[9]])},
+					},
+				})
+			}
+		}
+	}
+	return references
+}
@@ -0,0 +1,167 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Symbols of a project's dependencies are downloaded from the server in
+// launch.json into the package cache (.alpackages) by the AL server's
+// al/downloadSymbols request, which VS Code sends from its "AL: Download
+// symbols" command. The al.downloadSymbols command sends it with the
+// project's launch configuration, and with symbols.autoDownload the wrapper
+// sends it once per project when the AL server reports packages it cannot
+// load (AL1022). The AL server's own prompts for credentials reach the client
+// like any other server request.
+
+// DownloadSymbolsCommand downloads the symbols of a project's dependencies
+const DownloadSymbolsCommand = "al.downloadSymbols"
+
+// missingPackageRule is the AL diagnostic for a dependency whose symbol
+// package is not in the package cache
+const missingPackageRule = "AL1022"
+
+// DownloadSymbolsCommandArgs represents the optional argument object of al.downloadSymbols
+type DownloadSymbolsCommandArgs struct {
+	// Project is a file or folder URI/path inside the project
+	Project string `json:"project"`
+	// Configuration overrides the configured launch.json entry name
+	Configuration string `json:"configuration"`
+}
+
+// ALDownloadSymbolsParams represents parameters for al/downloadSymbols
+type ALDownloadSymbolsParams struct {
+	Configuration json.RawMessage `json:"configuration"`
+	WorkspacePath string          `json:"workspacePath"`
+}
+
+// DownloadSymbolsResult is returned to the client after a download
+type DownloadSymbolsResult struct {
+	Success       bool   `json:"success"`
+	Project       string `json:"project"`
+	Configuration string `json:"configuration"`
+	// Packages counts the symbol packages in the project's package caches
+	// after the download; Added names those that were not there before
+	Packages int             `json:"packages"`
+	Added    []string        `json:"added"`
+	Result   json.RawMessage `json:"result,omitempty"`
+}
+
+func downloadSymbolsCommand(msg *Message, args []json.RawMessage, w WrapperInterface) (*Message, *Message) {
+	var cmdArgs DownloadSymbolsCommandArgs
+	if err := decodeCommandArgs(args, &cmdArgs); err != nil {
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "Invalid al.downloadSymbols arguments: "+err.Error())
+	}
+
+	projectRoot := resolveCommandProject(cmdArgs.Project, w)
+	if projectRoot == "" {
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "No AL project found to download symbols for")
+	}
+	if errResp := ensureProjectForRequest(msg, filepath.Join(projectRoot, "app.json"), w); errResp != nil {
+		return nil, errResp
+	}
+
+	result, rpcErr := downloadSymbols(projectRoot, cmdArgs.Configuration, w)
+	if rpcErr != nil {
+		return nil, &Message{JSONRPC: "2.0", ID: msg.ID, Error: rpcErr}
+	}
+	return newResultMessage(msg.ID, result)
+}
+
+// downloadSymbols asks the AL server to download the symbols of a project's
+// dependencies with a launch configuration (the configured one if name is
+// empty)
+func downloadSymbols(projectRoot string, name string, w WrapperInterface) (*DownloadSymbolsResult, *RPCError) {
+	cfg := w.Config().Symbols
+	if name == "" {
+		name = cfg.Configuration
+	}
+	launch, err := SelectLaunchConfiguration(projectRoot, name)
+	if err != nil {
+		w.Log("Failed to select launch configuration: %v", err)
+		return nil, &RPCError{Code: InvalidParams, Message: err.Error()}
+	}
+
+	before := make(map[string]bool)
+	for _, app := range w.DependencyPackages(projectRoot) {
+		before[app.Path] = true
+	}
+
+	w.Log("Downloading symbols for %s using launch configuration %q", projectRoot, launch.Name)
+	params := ALDownloadSymbolsParams{Configuration: launch.Raw, WorkspacePath: projectRoot}
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	response, err := w.SendRequestToLSPWithTimeout("al/downloadSymbols", params, timeout)
+	if err != nil {
+		w.Log("Failed to send downloadSymbols request: %v", err)
+		return nil, &RPCError{Code: InternalError, Message: err.Error()}
+	}
+	if response.Error != nil {
+		w.Log("Symbol download failed: %s", response.Error.Message)
+		return nil, response.Error
+	}
+
+	result := &DownloadSymbolsResult{
+		Success:       true,
+		Project:       projectRoot,
+		Configuration: launch.Name,
+		Added:         []string{},
+		Result:        response.Result,
+	}
+	apps := w.DependencyPackages(projectRoot)
+	result.Packages = len(apps)
+	for _, app := range apps {
+		if !before[app.Path] {
+			result.Added = append(result.Added, filepath.Base(app.Path))
+		}
+	}
+	sort.Strings(result.Added)
+	w.Log("Downloaded symbols for %s: %d package(s), %d new", projectRoot, result.Packages, len(result.Added))
+	return result, nil
+}
+
+// autoDownloadSymbols downloads the symbols of the project of a file whose
+// diagnostics report a missing package, once per project and session
+func (w *ALLSPWrapper) autoDownloadSymbols(params *PublishDiagnosticsParams) {
+	if !w.Config().Symbols.AutoDownload {
+		return
+	}
+	missing := false
+	for i := range params.Diagnostics {
+		missing = missing || params.Diagnostics[i].RuleID() == missingPackageRule
+	}
+	if !missing {
+		return
+	}
+	path, err := FileURIToPath(params.URI)
+	if err != nil {
+		return
+	}
+	projectRoot := GetProjectRoot(path)
+	if projectRoot == "" {
+		return
+	}
+	projectRoot = NormalizePath(projectRoot)
+
+	w.loadMu.Lock()
+	attempted := w.symbolDownloads[projectRoot]
+	w.symbolDownloads[projectRoot] = true
+	w.loadMu.Unlock()
+	if attempted {
+		return
+	}
+
+	go func() {
+		result, rpcErr := downloadSymbols(projectRoot, "", w)
+		if rpcErr != nil {
+			w.notifyClient(MessageTypeWarning, fmt.Sprintf(
+				"AL LSP wrapper: %s has dependencies without symbols, and downloading them failed: %s",
+				projectRoot, rpcErr.Message))
+			return
+		}
+		w.notifyClient(MessageTypeInfo, fmt.Sprintf(
+			"AL LSP wrapper: downloaded symbols for %s (%d new package(s)).", projectRoot, len(result.Added)))
+	}()
+}
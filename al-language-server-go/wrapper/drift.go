@@ -0,0 +1,184 @@
+package wrapper
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// The AL server computes a rename's WorkspaceEdit against the text it has for
+// each document. When a file changed on disk without the server being told
+// (a tool writing it directly, a git checkout), the edit's ranges no longer
+// fit, and applying it corrupts the file or renames only some of the uses.
+// The wrapper keeps a hash of the text the AL server has for every open
+// document, re-reads the edit's files before passing a rename on, and refuses
+// the rename with ContentModified when one has drifted. A document the client
+// has open is checked against the text the client last synced, since its
+// unsaved edits are expected to differ from disk; only documents the client
+// has not opened are checked against disk. Documents the wrapper opened
+// itself are sent to the server again, so a retry succeeds; documents the
+// client opened are the client's to bring up to date.
+
+// serverDocument is what the wrapper knows of the text the AL server has for
+// an open document
+type serverDocument struct {
+	// hash is the SHA-256 of the text, "" once incremental changes made it unknown
+	hash string
+	// byWrapper is set for documents the wrapper opened from disk
+	byWrapper bool
+}
+
+// contentHash returns the hash of a document's text
+func contentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// trackServerContent updates the known text of a document from a didOpen or
+// didChange the client sent; docMu must be held
+func (w *ALLSPWrapper) trackServerContent(path string, msg *Message) {
+	var params struct {
+		TextDocument struct {
+			Text string `json:"text"`
+		} `json:"textDocument"`
+		ContentChanges []struct {
+			Range *Range `json:"range"`
+			Text  string `json:"text"`
+		} `json:"contentChanges"`
+	}
+	if json.Unmarshal(msg.Params, &params) != nil {
+		delete(w.serverDocs, path)
+		return
+	}
+
+	if msg.Method == "textDocument/didOpen" {
+		w.serverDocs[path] = serverDocument{hash: contentHash([]byte(params.TextDocument.Text))}
+		return
+	}
+	doc := w.serverDocs[path]
+	for _, change := range params.ContentChanges {
+		if change.Range == nil {
+			doc.hash = contentHash([]byte(change.Text))
+		} else {
+			doc.hash = ""
+		}
+	}
+	doc.byWrapper = false
+	w.serverDocs[path] = doc
+}
+
+// editedDocument is a document a WorkspaceEdit changes, with the version it
+// was computed for if the edit says
+type editedDocument struct {
+	uri     string
+	version *int
+}
+
+// editedDocuments lists the documents whose text a WorkspaceEdit changes
+func editedDocuments(edit *WorkspaceEdit) []editedDocument {
+	var documents []editedDocument
+	for uri := range edit.Changes {
+		documents = append(documents, editedDocument{uri: uri})
+	}
+	for _, raw := range edit.DocumentChanges {
+		var change documentChange
+		if json.Unmarshal(raw, &change) == nil && change.Kind == "" {
+			documents = append(documents, editedDocument{uri: change.TextDocument.URI, version: change.TextDocument.Version})
+		}
+	}
+	return documents
+}
+
+// SyncedDocuments returns the hash of the text the client last synced for
+// each document it has open
+func (w *ALLSPWrapper) SyncedDocuments() map[string]string {
+	w.docMu.Lock()
+	defer w.docMu.Unlock()
+	synced := make(map[string]string)
+	for path, doc := range w.serverDocs {
+		if !doc.byWrapper && doc.hash != "" {
+			synced[path] = doc.hash
+		}
+	}
+	return synced
+}
+
+// CheckEditDrift verifies the files of a WorkspaceEdit still hold the text
+// the AL server computed it against; synced is what SyncedDocuments returned
+// when the request was sent
+func (w *ALLSPWrapper) CheckEditDrift(edit *WorkspaceEdit, synced map[string]string) error {
+	return w.checkEditDrift(w, edit, synced)
+}
+
+// checkEditDrift compares each file an edit changes with what the AL server
+// has: the open version, then for documents the client has open the text it
+// last synced, and for the others the content on disk. The drifted documents
+// the wrapper opened are resent.
+func (w *ALLSPWrapper) checkEditDrift(scope WrapperInterface, edit *WorkspaceEdit, synced map[string]string) error {
+	var drifted []string
+	for _, document := range editedDocuments(edit) {
+		path, err := editPath(document.uri)
+		if err != nil {
+			continue
+		}
+		version, open := w.openedVersion(path)
+		if document.version != nil && open && version != *document.version {
+			drifted = append(drifted, fmt.Sprintf("%s (open at version %d, the edit is for version %d)", path, version, *document.version))
+			continue
+		}
+
+		w.docMu.Lock()
+		doc, known := w.serverDocs[path]
+		w.docMu.Unlock()
+		if !known || doc.hash == "" {
+			continue
+		}
+		if !doc.byWrapper {
+			// The client's unsaved edits differ from disk; only a change it
+			// synced since the request was sent makes the edit stale
+			if computedOn, ok := synced[path]; ok && computedOn != doc.hash {
+				drifted = append(drifted, path+" (edited in the client since the AL server computed the edit)")
+			}
+			continue
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			drifted = append(drifted, fmt.Sprintf("%s (cannot be read: %v)", path, err))
+			continue
+		}
+		if contentHash(content) == doc.hash {
+			continue
+		}
+		drifted = append(drifted, path+" (changed on disk since the AL server read it)")
+		w.resendDocument(scope, path, content)
+	}
+
+	if len(drifted) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d file(s) changed since the edit was computed: %s", len(drifted), strings.Join(drifted, "; "))
+}
+
+// resendDocument sends the AL server the current content of a document the
+// wrapper opened
+func (w *ALLSPWrapper) resendDocument(scope WrapperInterface, path string, content []byte) {
+	w.docMu.Lock()
+	version, open := w.openedFiles[path]
+	if !open {
+		w.docMu.Unlock()
+		return
+	}
+	version++
+	w.openedFiles[path] = version
+	w.serverDocs[path] = serverDocument{hash: contentHash(content), byWrapper: true}
+	w.docMu.Unlock()
+
+	scope.Log("Sending the AL server the current content of %s (version %d)", path, version)
+	scope.SendNotificationToLSP("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": PathToFileURI(path), "version": version},
+		"contentChanges": []map[string]string{{"text": string(content)}},
+	})
+}
@@ -0,0 +1,76 @@
+package wrapper
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// clientNotification builds a client notification
+func clientNotification(t *testing.T, method string, params interface{}) *Message {
+	t.Helper()
+	msg, err := NewNotification(method, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestEditDriftOpenDocument(t *testing.T) {
+	w, _, _ := newTestWrapper()
+	path := filepath.Join(NormalizePath(t.TempDir()), "Customer.Table.al")
+	if err := os.WriteFile(path, []byte("table 50100 Customer {}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	uri := PathToFileURI(path)
+	edit := &WorkspaceEdit{Changes: map[string][]TextEdit{uri: {}}}
+
+	// The client has unsaved edits, so its text differs from disk
+	w.trackDocument(w, clientNotification(t, "textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri, "languageId": "al", "version": 1, "text": "table 50100 Cust {}"},
+	}))
+	synced := w.SyncedDocuments()
+	if err := w.CheckEditDrift(edit, synced); err != nil {
+		t.Errorf("unsaved edits reported as drift: %v", err)
+	}
+
+	// A change synced after the rename was sent makes its edit stale
+	w.trackDocument(w, clientNotification(t, "textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": uri, "version": 2},
+		"contentChanges": []map[string]string{{"text": "table 50100 Cust2 {}"}},
+	}))
+	err := w.CheckEditDrift(edit, synced)
+	if err == nil || !strings.Contains(err.Error(), "edited in the client") {
+		t.Errorf("CheckEditDrift after a client change = %v, want drift", err)
+	}
+}
+
+func TestEditDriftClosedDocument(t *testing.T) {
+	w, server, _ := newTestWrapper()
+	path := filepath.Join(NormalizePath(t.TempDir()), "Customer.Table.al")
+	if err := os.WriteFile(path, []byte("table 50100 Customer {}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.EnsureFileOpened(path); err != nil {
+		t.Fatal(err)
+	}
+	edit := &WorkspaceEdit{Changes: map[string][]TextEdit{PathToFileURI(path): {}}}
+	synced := w.SyncedDocuments()
+	if err := w.CheckEditDrift(edit, synced); err != nil {
+		t.Errorf("unchanged file reported as drift: %v", err)
+	}
+
+	// The file the wrapper opened changed on disk behind the AL server's back
+	if err := os.WriteFile(path, []byte("table 50100 Cust {}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	err := w.CheckEditDrift(edit, synced)
+	if err == nil || !strings.Contains(err.Error(), "changed on disk") {
+		t.Errorf("CheckEditDrift after a disk change = %v, want drift", err)
+	}
+	sent := server.messages(t)
+	if last := sent[len(sent)-1]; last.Method != "textDocument/didChange" {
+		t.Errorf("last message to the AL server = %s, want the file's current content", last.Method)
+	}
+}
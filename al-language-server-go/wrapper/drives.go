@@ -0,0 +1,105 @@
+package wrapper
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// On Windows the same file can have two paths: Z:\App\Customer.Table.al on a
+// mapped network drive is \\server\share\App\Customer.Table.al, and on a
+// SUBST drive S:\App is C:\src\App. The AL server may answer with the UNC or
+// substituted path for files the client sent by drive letter, which opened
+// the file twice and returned URIs the client did not know. The wrapper uses
+// the drive letter form throughout: FileURIToPath, PathToFileURI and
+// NormalizePath map paths through canonicalDrivePath, and the file URIs in
+// the AL server's messages are rewritten as they are read.
+
+// driveMapping is a drive letter standing for another path: a mapped network
+// drive (Z: for \\server\share) or a SUBST drive (S: for C:\src)
+type driveMapping struct {
+	drive  string
+	target string
+}
+
+var (
+	driveMappingsOnce sync.Once
+	driveMappingList  []driveMapping
+)
+
+// driveMappings returns the drive mappings of this session, read once, the
+// longest target first so nested targets map to the innermost drive
+func driveMappings() []driveMapping {
+	driveMappingsOnce.Do(func() {
+		driveMappingList = loadDriveMappings()
+		sort.SliceStable(driveMappingList, func(i, j int) bool {
+			return len(driveMappingList[i].target) > len(driveMappingList[j].target)
+		})
+	})
+	return driveMappingList
+}
+
+// mapDrivePath returns the drive letter form of a path under a drive
+// mapping's target, false if no mapping applies
+func mapDrivePath(path string) (string, bool) {
+	for _, m := range driveMappings() {
+		if len(path) < len(m.target) || !strings.EqualFold(path[:len(m.target)], m.target) {
+			continue
+		}
+		rest := path[len(m.target):]
+		if rest == "" {
+			return m.drive + `\`, true
+		}
+		if rest[0] == '\\' || rest[0] == '/' {
+			return m.drive + rest, true
+		}
+	}
+	return path, false
+}
+
+// canonicalDrivePath returns the drive letter form of a path on a mapped
+// network drive or SUBST drive, other paths unchanged
+func canonicalDrivePath(path string) string {
+	mapped, _ := mapDrivePath(path)
+	return mapped
+}
+
+// canonicalFileURI returns the drive letter form of a file URI, or the URI
+// unchanged if no drive mapping applies
+func canonicalFileURI(uri string) string {
+	path, err := fileURIPath(uri)
+	if err != nil {
+		return uri
+	}
+	if mapped, ok := mapDrivePath(path); ok {
+		return PathToFileURI(mapped)
+	}
+	return uri
+}
+
+// canonicalFileURIs rewrites the file URIs in a JSON value to their drive
+// letter form. Without drive mappings the value is returned as is.
+func canonicalFileURIs(data json.RawMessage) json.RawMessage {
+	if len(data) == 0 || len(driveMappings()) == 0 || !bytes.Contains(data, []byte(`"file:`)) {
+		return data
+	}
+	var out []byte
+	rest := []byte(data)
+	for {
+		start := bytes.Index(rest, []byte(`"file:`))
+		if start < 0 {
+			break
+		}
+		end := bytes.IndexByte(rest[start+1:], '"')
+		if end < 0 {
+			break
+		}
+		uri := string(rest[start+1 : start+1+end])
+		out = append(out, rest[:start+1]...)
+		out = append(out, canonicalFileURI(uri)...)
+		rest = rest[start+1+end:]
+	}
+	return append(out, rest...)
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package wrapper
+
+// loadDriveMappings returns no mappings: drive letters exist only on Windows
+func loadDriveMappings() []driveMapping {
+	return nil
+}
@@ -0,0 +1,80 @@
+//go:build windows
+
+package wrapper
+
+import (
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	mpr                   = syscall.NewLazyDLL("mpr.dll")
+	procWNetGetConnection = mpr.NewProc("WNetGetConnectionW")
+	procGetLogicalDrives  = kernel32.NewProc("GetLogicalDrives")
+	procQueryDosDevice    = kernel32.NewProc("QueryDosDeviceW")
+)
+
+const errorMoreData = 234
+
+// loadDriveMappings returns the mapped network drives and SUBST drives of
+// this session
+func loadDriveMappings() []driveMapping {
+	mask, _, _ := procGetLogicalDrives.Call()
+	var mappings []driveMapping
+	for i := 0; i < 26; i++ {
+		if mask&(1<<uint(i)) == 0 {
+			continue
+		}
+		drive := string(rune('A'+i)) + ":"
+		if target := networkDriveTarget(drive); target != "" {
+			mappings = append(mappings, driveMapping{drive: drive, target: target})
+		} else if target := substDriveTarget(drive); target != "" {
+			mappings = append(mappings, driveMapping{drive: drive, target: target})
+		}
+	}
+	return mappings
+}
+
+// networkDriveTarget returns the share a network drive is mapped to
+// (\\server\share), or "" if the drive is not a network drive
+func networkDriveTarget(drive string) string {
+	name, err := syscall.UTF16PtrFromString(drive)
+	if err != nil {
+		return ""
+	}
+	buf := make([]uint16, syscall.MAX_PATH)
+	size := uint32(len(buf))
+	ret, _, _ := procWNetGetConnection.Call(uintptr(unsafe.Pointer(name)), uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&size)))
+	if ret == errorMoreData {
+		buf = make([]uint16, size)
+		ret, _, _ = procWNetGetConnection.Call(uintptr(unsafe.Pointer(name)), uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&size)))
+	}
+	if ret != 0 {
+		return ""
+	}
+	return strings.TrimRight(syscall.UTF16ToString(buf), `\`)
+}
+
+// substDriveTarget returns the folder a SUBST drive stands for, or "" if the
+// drive is not a SUBST drive. Its DOS device target is \??\C:\src, or
+// \??\UNC\server\share\src for a folder on a share.
+func substDriveTarget(drive string) string {
+	name, err := syscall.UTF16PtrFromString(drive)
+	if err != nil {
+		return ""
+	}
+	buf := make([]uint16, 1024)
+	n, _, _ := procQueryDosDevice.Call(uintptr(unsafe.Pointer(name)), uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)))
+	if n == 0 {
+		return ""
+	}
+	target, ok := strings.CutPrefix(syscall.UTF16ToString(buf), `\??\`)
+	if !ok {
+		return ""
+	}
+	if share, ok := strings.CutPrefix(target, `UNC\`); ok {
+		target = `\\` + share
+	}
+	return strings.TrimRight(normalizeDriveLetter(target), `\`)
+}
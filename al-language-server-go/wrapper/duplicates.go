@@ -0,0 +1,263 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Two objects of the same type with the same ID or name make the AL server
+// behave confusingly: definitions land on either of them and one object's
+// members go missing, and when the two live in different projects of the
+// workspace nothing reports the clash until the apps are deployed together.
+// After a project loads, and whenever the client saves or creates AL files,
+// the wrapper looks for duplicates in the symbol indexes of the workspace's
+// projects and adds a warning on each clashing declaration to the AL
+// server's diagnostics of the file (diagnostics.duplicateObjects).
+
+// duplicateCheckDelay debounces the check after bursts of file changes
+const duplicateCheckDelay = 500 * time.Millisecond
+
+// Diagnostic codes of duplicate objects
+const (
+	duplicateObjectIDCode   = "duplicateObjectId"
+	duplicateObjectNameCode = "duplicateObjectName"
+)
+
+// DiagnosticRelatedInformation points a diagnostic at a related location
+type DiagnosticRelatedInformation struct {
+	Location Location `json:"location"`
+	Message  string   `json:"message"`
+}
+
+// duplicateChecker holds the duplicate object diagnostics of the workspace
+type duplicateChecker struct {
+	// check serializes checks, so an older result never replaces a newer one
+	check sync.Mutex
+	mu    sync.Mutex
+	timer *time.Timer
+	// diagnostics are the diagnostics last published per file path
+	diagnostics map[string][]Diagnostic
+}
+
+func newDuplicateChecker() *duplicateChecker {
+	return &duplicateChecker{diagnostics: make(map[string][]Diagnostic)}
+}
+
+// findDuplicateObjects returns a warning for each object sharing its type
+// and ID, or its type and name, with another object, by file path
+func findDuplicateObjects(objects []IndexedSymbol, workspaceRoot string) map[string][]Diagnostic {
+	groups := make(map[string][]IndexedSymbol)
+	for _, o := range objects {
+		if o.Type == "" || o.Type == "dotnet" {
+			continue
+		}
+		if o.ID > 0 {
+			key := o.Type + "|id|" + strconv.Itoa(o.ID)
+			groups[key] = append(groups[key], o)
+		}
+		key := o.Type + "|name|" + strings.ToLower(o.Name)
+		groups[key] = append(groups[key], o)
+	}
+	keys := make([]string, 0, len(groups))
+	for key, group := range groups {
+		if len(group) > 1 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	diagnostics := make(map[string][]Diagnostic)
+	for _, key := range keys {
+		group := groups[key]
+		byID := strings.Contains(key, "|id|")
+		for i, o := range group {
+			var others []string
+			var related []DiagnosticRelatedInformation
+			for j, other := range group {
+				if j == i {
+					continue
+				}
+				declared := fmt.Sprintf("%s in %s", objectSymbolName(other), workspaceRelative(other.Path, workspaceRoot))
+				others = append(others, declared)
+				pos := Position{Line: other.Line}
+				related = append(related, DiagnosticRelatedInformation{
+					Location: Location{URI: PathToFileURI(other.Path), Range: Range{Start: pos, End: pos}},
+					Message:  "Also declared as " + objectSymbolName(other),
+				})
+			}
+			code := duplicateObjectNameCode
+			message := fmt.Sprintf("Duplicate %s name %s: also used by %s", o.Type, quoteALName(o.Name), strings.Join(others, "; "))
+			if byID {
+				code = duplicateObjectIDCode
+				message = fmt.Sprintf("Duplicate %s ID %d: also used by %s", o.Type, o.ID, strings.Join(others, "; "))
+			}
+			codeJSON, _ := json.Marshal(code)
+			relatedJSON, _ := json.Marshal(related)
+			path := NormalizePath(o.Path)
+			diagnostics[path] = append(diagnostics[path], Diagnostic{
+				Range:              Range{Start: Position{Line: o.Line}, End: Position{Line: o.Line + 1}},
+				Severity:           SeverityWarning,
+				Code:               codeJSON,
+				Source:             appDirName,
+				Message:            message,
+				RelatedInformation: relatedJSON,
+			})
+		}
+	}
+	for _, list := range diagnostics {
+		sort.SliceStable(list, func(i, j int) bool { return list[i].Range.Start.Line < list[j].Range.Start.Line })
+	}
+	return diagnostics
+}
+
+// objectSymbolName renders an indexed object as AL declares it
+func objectSymbolName(o IndexedSymbol) string {
+	return ALObject{Type: o.Type, ID: o.ID, Name: o.Name}.DisplayName()
+}
+
+// workspaceRelative returns a path relative to the workspace root, with
+// forward slashes, or the path itself outside the workspace
+func workspaceRelative(path string, workspaceRoot string) string {
+	if workspaceRoot != "" {
+		if rel, err := filepath.Rel(workspaceRoot, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return path
+}
+
+// scheduleDuplicateCheck runs the duplicate check shortly after a client
+// notification that changes AL files on disk
+func (w *ALLSPWrapper) scheduleDuplicateCheck(msg *Message) {
+	switch msg.Method {
+	case "textDocument/didSave":
+		if !strings.EqualFold(filepath.Ext(documentURI(msg)), ".al") {
+			return
+		}
+	case "workspace/didChangeWatchedFiles":
+		var params DidChangeWatchedFilesParams
+		if json.Unmarshal(msg.Params, &params) != nil {
+			return
+		}
+		changed := false
+		for _, change := range params.Changes {
+			changed = changed || strings.EqualFold(filepath.Ext(change.URI), ".al")
+		}
+		if !changed {
+			return
+		}
+	default:
+		return
+	}
+	if !w.Config().Diagnostics.DuplicateObjects {
+		return
+	}
+
+	c := w.duplicates
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	c.timer = time.AfterFunc(duplicateCheckDelay, func() { w.checkDuplicateObjects(w) })
+}
+
+// checkDuplicateObjects looks for duplicate objects in the workspace's
+// projects and republishes the diagnostics of the files whose duplicate
+// warnings changed
+func (w *ALLSPWrapper) checkDuplicateObjects(scope WrapperInterface) {
+	if !w.Config().Diagnostics.DuplicateObjects {
+		return
+	}
+	w.duplicates.check.Lock()
+	defer w.duplicates.check.Unlock()
+
+	workspaceRoot := w.WorkspaceRoot()
+	// Nested projects are indexed with their parent too
+	seen := make(map[string]bool)
+	var objects []IndexedSymbol
+	for _, root := range workspaceProjects(workspaceRoot, w.ActiveProject()) {
+		for _, symbol := range w.symbols.symbols(root) {
+			key := symbol.Path + "|" + strconv.Itoa(symbol.Line)
+			if symbol.Type != "" && !seen[key] {
+				seen[key] = true
+				objects = append(objects, symbol)
+			}
+		}
+	}
+	found := findDuplicateObjects(objects, workspaceRoot)
+	for path, diagnostics := range found {
+		// diagnostics.suppress and diagnostics.severity apply by code
+		if diagnostics = ApplyDiagnosticRules(diagnostics, w.Config().Diagnostics); len(diagnostics) > 0 {
+			found[path] = diagnostics
+		} else {
+			delete(found, path)
+		}
+	}
+
+	c := w.duplicates
+	c.mu.Lock()
+	var changed []string
+	for path, diagnostics := range found {
+		if diagnosticsFingerprint(diagnostics) != diagnosticsFingerprint(c.diagnostics[path]) {
+			changed = append(changed, path)
+		}
+	}
+	for path := range c.diagnostics {
+		if _, ok := found[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	c.diagnostics = found
+	c.mu.Unlock()
+
+	if len(changed) == 0 {
+		return
+	}
+	scope.Log("Duplicate objects: %d file(s) with duplicates, %d file(s) to republish", len(found), len(changed))
+	sort.Strings(changed)
+	for _, path := range changed {
+		w.republishDiagnostics(path)
+	}
+}
+
+// duplicateDiagnostics returns the duplicate object warnings of a file
+func (w *ALLSPWrapper) duplicateDiagnostics(path string) []Diagnostic {
+	w.duplicates.mu.Lock()
+	defer w.duplicates.mu.Unlock()
+	return w.duplicates.diagnostics[path]
+}
+
+// withDuplicateDiagnostics returns a file's diagnostics with its duplicate
+// object warnings added
+func (w *ALLSPWrapper) withDuplicateDiagnostics(path string, diagnostics []Diagnostic) []Diagnostic {
+	duplicates := w.duplicateDiagnostics(path)
+	if len(duplicates) == 0 {
+		return diagnostics
+	}
+	return append(append([]Diagnostic{}, diagnostics...), duplicates...)
+}
+
+// republishDiagnostics queues the AL server's last diagnostics of a file
+// with the wrapper's current duplicate warnings and build diagnostics
+func (w *ALLSPWrapper) republishDiagnostics(path string) {
+	q := w.diagnostics
+	q.mu.Lock()
+	diagnostics := q.published[path]
+	uri, ok := q.publishedURIs[path]
+	q.mu.Unlock()
+	if !ok {
+		uri = PathToFileURI(path)
+	}
+	diagnostics = w.withWrapperDiagnostics(path, diagnostics)
+	if diagnostics == nil {
+		diagnostics = []Diagnostic{}
+	}
+	w.queueDiagnostics(&PublishDiagnosticsParams{URI: uri, Diagnostics: diagnostics})
+}
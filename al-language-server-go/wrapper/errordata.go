@@ -0,0 +1,81 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// When a request fails with InternalError, the reason is usually in the
+// wrapper log a few lines above the response, and the log is a temp file the
+// user has to find first. With errors.logExcerptLines, the error's data
+// carries the request's last log lines, sanitized like a support bundle, and
+// the log path:
+//
+//	"data": {"log": ["12:01:02.345 [req-7.1] Timeout waiting for AL LSP: ..."], "logFile": "~/..."}
+
+// logTailLines is how many recent log lines are kept for error excerpts
+const logTailLines = 500
+
+// loggedLine is a recent log line and the correlation tag it was logged with
+type loggedLine struct {
+	tag  string
+	text string
+}
+
+// ErrorLogExcerpt is the error.data of a failed request
+type ErrorLogExcerpt struct {
+	Log     []string `json:"log"`
+	LogFile string   `json:"logFile,omitempty"`
+}
+
+// recordLogLine keeps a bounded tail of log lines; logMu must be held
+func (w *ALLSPWrapper) recordLogLine(tag string, timestamp time.Time, msg string) {
+	text := timestamp.Format("15:04:05.000") + " "
+	if tag != "" {
+		text += "[" + tag + "] "
+	}
+	w.logTail = append(w.logTail, loggedLine{tag: tag, text: text + msg})
+	if len(w.logTail) > logTailLines {
+		w.logTail = w.logTail[len(w.logTail)-logTailLines:]
+	}
+}
+
+// requestLogLines returns up to max of the last log lines of a request: those
+// tagged with its correlation ID or one of its spans
+func (w *ALLSPWrapper) requestLogLines(correlationID string, max int) []string {
+	w.logMu.Lock()
+	defer w.logMu.Unlock()
+	var lines []string
+	for i := len(w.logTail) - 1; i >= 0 && len(lines) < max; i-- {
+		line := w.logTail[i]
+		if line.tag == correlationID || strings.HasPrefix(line.tag, correlationID+".") {
+			lines = append(lines, sanitizeText(line.text))
+		}
+	}
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+	return lines
+}
+
+// attachLogExcerpt adds the request's last log lines to an InternalError
+// response without data of its own
+func (w *ALLSPWrapper) attachLogExcerpt(scope *requestScope, response *Message) {
+	if response == nil || response.Error == nil || response.Error.Code != InternalError || len(response.Error.Data) > 0 {
+		return
+	}
+	max := w.Config().Errors.LogExcerptLines
+	if max <= 0 {
+		return
+	}
+	lines := w.requestLogLines(scope.correlationID, max)
+	if len(lines) == 0 {
+		return
+	}
+	excerpt := ErrorLogExcerpt{Log: lines}
+	if path := GetLogPath(); path != "" {
+		excerpt.LogFile = sanitizeText(path)
+	}
+	response.Error.Data, _ = json.Marshal(excerpt)
+}
@@ -0,0 +1,364 @@
+package wrapper
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EventSurfaceCommand lists the event publishers and subscribers declared in
+// an object or across the workspace
+const EventSurfaceCommand = "al-wrapper.eventSurface"
+
+// eventAttributePattern matches an event publisher or subscriber attribute
+var eventAttributePattern = regexp.MustCompile(`(?i)^\s*\[\s*(IntegrationEvent|BusinessEvent|InternalEvent|EventSubscriber)\s*\(`)
+
+// EventSurfaceArgs is the optional argument object of al-wrapper.eventSurface.
+// The argument may also be the object's name or ID itself.
+type EventSurfaceArgs struct {
+	// Object restricts the report to an object (name, quoted or not, or ID):
+	// its publishers, its subscribers and the subscribers to its events
+	Object string `json:"object"`
+	// Project is a file or folder URI/path inside the project to report on
+	// when the workspace has no root (defaults to the active project)
+	Project string `json:"project"`
+}
+
+// EventPublisher is a procedure declared as an event
+type EventPublisher struct {
+	// Kind is IntegrationEvent, BusinessEvent or InternalEvent
+	Kind string `json:"kind"`
+	// Object is the declaring object, e.g. `codeunit 50100 "Sales Events"`
+	Object    string `json:"object"`
+	Name      string `json:"name"`
+	Signature string `json:"signature"`
+	URI       string `json:"uri"`
+	Line      int    `json:"line"`
+	// Subscribers are the workspace's subscribers to this event
+	Subscribers []EventLocation `json:"subscribers"`
+}
+
+// EventSubscriber is a procedure subscribed to an event
+type EventSubscriber struct {
+	Object    string `json:"object"`
+	Name      string `json:"name"`
+	Signature string `json:"signature"`
+	URI       string `json:"uri"`
+	Line      int    `json:"line"`
+	// TargetType and Target identify the publishing object, e.g. "codeunit"
+	// and "Sales-Post" (or its ID)
+	TargetType string `json:"targetType"`
+	Target     string `json:"target"`
+	Event      string `json:"event"`
+	// Element is the table field or page control of trigger events
+	Element string `json:"element,omitempty"`
+	// Resolved reports whether the publisher was found in the workspace
+	Resolved bool `json:"resolved"`
+}
+
+// EventLocation locates a subscriber of a publisher
+type EventLocation struct {
+	Object string `json:"object"`
+	Name   string `json:"name"`
+	URI    string `json:"uri"`
+	Line   int    `json:"line"`
+}
+
+// EventSurfaceResult is returned by al-wrapper.eventSurface
+type EventSurfaceResult struct {
+	Publishers  []EventPublisher  `json:"publishers"`
+	Subscribers []EventSubscriber `json:"subscribers"`
+}
+
+// declaredEvent is an event publisher or subscriber read from a file
+type declaredEvent struct {
+	attribute string
+	// args are the attribute's arguments, as written
+	args      []string
+	object    ALObject
+	name      string
+	signature string
+	line      int
+}
+
+// parseEventFile reads the event publishers and subscribers declared in an AL file
+func parseEventFile(path string) []declaredEvent {
+	objects := parseObjectFile(path)
+	if len(objects) == 0 {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	var events []declaredEvent
+	var attributes []declaredEvent
+	object := -1
+	inComment := false
+	for line, text := range lines {
+		for object+1 < len(objects) && objects[object+1].Line <= line {
+			object++
+			attributes = nil
+		}
+		code, stillInComment := stripALComments(text, inComment)
+		inComment = stillInComment
+		if object < 0 || strings.TrimSpace(code) == "" {
+			continue
+		}
+
+		// Attribute arguments hold 'strings', which stripALComments removes
+		if m := eventAttributePattern.FindStringSubmatch(text); m != nil {
+			event := declaredEvent{attribute: m[1], line: line}
+			if inner, ok := enclosedList(text[strings.Index(text, "("):]); ok {
+				event.args = splitTopLevel(inner, ',')
+			}
+			attributes = append(attributes, event)
+			continue
+		}
+		if strings.HasPrefix(strings.TrimSpace(code), "[") {
+			// Other attributes, e.g. [Obsolete(...)], may sit between
+			continue
+		}
+		if m := memberDeclPattern.FindStringSubmatch(code); m != nil && strings.EqualFold(m[1], "procedure") {
+			for _, event := range attributes {
+				event.object = objects[object]
+				event.name = unquoteALName(m[2])
+				event.signature = procedureSignature(lines, line)
+				event.line = line
+				events = append(events, event)
+			}
+		}
+		attributes = nil
+	}
+	return events
+}
+
+// procedureSignature returns the declaration of the procedure at a line, from
+// "procedure" through its return type, on one line
+func procedureSignature(lines []string, line int) string {
+	var parts []string
+	for i := line; i < len(lines) && i < line+callSiteLines; i++ {
+		parts = append(parts, strings.TrimSpace(lines[i]))
+	}
+	text := strings.Join(parts, " ")
+	text = text[strings.Index(strings.ToLower(text), "procedure"):]
+
+	open := strings.Index(text, "(")
+	if open < 0 {
+		return text
+	}
+	inner, ok := enclosedList(text[open:])
+	if !ok {
+		return text
+	}
+	end := open + len(inner) + 2
+	signature := text[:end]
+
+	// Return type: "(): Boolean" or "() Result: Boolean", up to ";" or the body
+	rest := text[end:]
+	if cut := strings.Index(rest, ";"); cut >= 0 {
+		rest = rest[:cut]
+	}
+	for _, keyword := range []string{" var", " begin"} {
+		if cut := strings.Index(strings.ToLower(rest), keyword); cut >= 0 {
+			rest = rest[:cut]
+		}
+	}
+	if rest = strings.TrimSpace(rest); strings.HasPrefix(rest, ":") {
+		signature += rest
+	} else if strings.Contains(rest, ":") {
+		signature += " " + rest
+	}
+	return signature
+}
+
+// subscriberTarget returns the publishing object type, the object (name or
+// ID), the event and the element of an EventSubscriber attribute
+func subscriberTarget(args []string) (string, string, string, string) {
+	unquoteString := func(s string) string {
+		s = strings.TrimSpace(s)
+		if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+			return strings.ReplaceAll(s[1:len(s)-1], "''", "'")
+		}
+		return s
+	}
+	var typ, target, event, element string
+	if len(args) > 0 {
+		_, after, _ := strings.Cut(args[0], "::")
+		typ = strings.ToLower(strings.TrimSpace(after))
+	}
+	if len(args) > 1 {
+		target = args[1]
+		if _, after, found := strings.Cut(target, "::"); found {
+			target = after
+		}
+		target = unquoteALName(strings.TrimSpace(target))
+	}
+	if len(args) > 2 {
+		event = unquoteString(args[2])
+	}
+	if len(args) > 3 {
+		element = unquoteString(args[3])
+	}
+	return typ, target, event, element
+}
+
+// eventTargetType maps an ObjectType:: value to an object type; table
+// events are published by ObjectType::Table
+func eventTargetType(typ string) string {
+	if typ == "database" {
+		return "table"
+	}
+	return typ
+}
+
+// FindEventSurface reports the event publishers and subscribers of the
+// workspace's source files, only those related to object if it is not empty
+func FindEventSurface(workspaceRoot string, project string, object string) EventSurfaceResult {
+	var events []declaredEvent
+	for _, root := range workspaceProjects(workspaceRoot, project) {
+		objects, _ := ScanProjectObjects(root)
+		files := make(map[string]bool)
+		for _, o := range objects {
+			if !files[o.Path] {
+				files[o.Path] = true
+				events = append(events, parseEventFile(o.Path)...)
+			}
+		}
+	}
+
+	isObject := func(o ALObject) bool {
+		if id, err := strconv.Atoi(object); err == nil {
+			return o.ID == id
+		}
+		return strings.EqualFold(o.Name, unquoteALName(object))
+	}
+
+	result := EventSurfaceResult{Publishers: []EventPublisher{}, Subscribers: []EventSubscriber{}}
+	publishers := make(map[string]int)
+	var publisherObjects []ALObject
+	for _, event := range events {
+		if event.attribute == "EventSubscriber" {
+			continue
+		}
+		result.Publishers = append(result.Publishers, EventPublisher{
+			Kind:        event.attribute,
+			Object:      event.object.DisplayName(),
+			Name:        event.name,
+			Signature:   event.signature,
+			URI:         PathToFileURI(event.object.Path),
+			Line:        event.line,
+			Subscribers: []EventLocation{},
+		})
+		publisherObjects = append(publisherObjects, event.object)
+		index := len(result.Publishers) - 1
+		for _, key := range []string{event.object.Name, strconv.Itoa(event.object.ID)} {
+			publishers[event.object.Type+"|"+strings.ToLower(key)+"|"+strings.ToLower(event.name)] = index
+		}
+	}
+
+	subscriberObjects := make([]ALObject, 0, len(events))
+	for _, event := range events {
+		if event.attribute != "EventSubscriber" {
+			continue
+		}
+		typ, target, name, element := subscriberTarget(event.args)
+		subscriber := EventSubscriber{
+			Object:     event.object.DisplayName(),
+			Name:       event.name,
+			Signature:  event.signature,
+			URI:        PathToFileURI(event.object.Path),
+			Line:       event.line,
+			TargetType: eventTargetType(typ),
+			Target:     target,
+			Event:      name,
+			Element:    element,
+		}
+		key := subscriber.TargetType + "|" + strings.ToLower(target) + "|" + strings.ToLower(name)
+		if index, ok := publishers[key]; ok {
+			subscriber.Resolved = true
+			result.Publishers[index].Subscribers = append(result.Publishers[index].Subscribers, EventLocation{
+				Object: subscriber.Object, Name: subscriber.Name, URI: subscriber.URI, Line: subscriber.Line,
+			})
+		}
+		result.Subscribers = append(result.Subscribers, subscriber)
+		subscriberObjects = append(subscriberObjects, event.object)
+	}
+
+	if object != "" {
+		var publishersOf []EventPublisher
+		for i, publisher := range result.Publishers {
+			if isObject(publisherObjects[i]) {
+				publishersOf = append(publishersOf, publisher)
+			}
+		}
+		subscribersOf := []EventSubscriber{}
+		for i, subscriber := range result.Subscribers {
+			targetsObject := strings.EqualFold(subscriber.Target, unquoteALName(object))
+			if isObject(subscriberObjects[i]) || targetsObject {
+				subscribersOf = append(subscribersOf, subscriber)
+			}
+		}
+		result.Publishers = append([]EventPublisher{}, publishersOf...)
+		result.Subscribers = subscribersOf
+	}
+
+	sort.SliceStable(result.Subscribers, func(i, j int) bool {
+		a, b := result.Subscribers[i], result.Subscribers[j]
+		if a.TargetType != b.TargetType {
+			return a.TargetType < b.TargetType
+		}
+		if !strings.EqualFold(a.Target, b.Target) {
+			return strings.ToLower(a.Target) < strings.ToLower(b.Target)
+		}
+		return strings.ToLower(a.Event) < strings.ToLower(b.Event)
+	})
+	return result
+}
+
+// decodeEventSurfaceArgs accepts the argument object or a bare object name or ID
+func decodeEventSurfaceArgs(args []json.RawMessage) (EventSurfaceArgs, error) {
+	var cmdArgs EventSurfaceArgs
+	if len(args) == 0 || string(args[0]) == "null" {
+		return cmdArgs, nil
+	}
+	var number int
+	if json.Unmarshal(args[0], &number) == nil {
+		cmdArgs.Object = strconv.Itoa(number)
+		return cmdArgs, nil
+	}
+	if json.Unmarshal(args[0], &cmdArgs.Object) == nil {
+		return cmdArgs, nil
+	}
+	err := decodeCommandArgs(args, &cmdArgs)
+	return cmdArgs, err
+}
+
+func eventSurfaceCommand(msg *Message, args []json.RawMessage, w WrapperInterface) (*Message, *Message) {
+	cmdArgs, err := decodeEventSurfaceArgs(args)
+	if err != nil {
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "Invalid "+EventSurfaceCommand+" arguments: "+err.Error())
+	}
+
+	project := resolveCommandProject(cmdArgs.Project, w)
+	if project == "" && w.WorkspaceRoot() == "" {
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "No AL project found to search")
+	}
+
+	result := FindEventSurface(w.WorkspaceRoot(), project, strings.TrimSpace(cmdArgs.Object))
+	w.Log("Found %d event publisher(s) and %d subscriber(s)", len(result.Publishers), len(result.Subscribers))
+	return newResultMessage(msg.ID, result)
+}
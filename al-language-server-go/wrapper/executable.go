@@ -0,0 +1,191 @@
+package wrapper
+
+import (
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/SShadowS/claude-code-lsps/al-language-server-go/internal/hostarch"
+)
+
+// ExecutableSelection describes which EditorServices binary was chosen and why
+type ExecutableSelection struct {
+	// Path is the selected executable (the conventional path if none was found)
+	Path string `json:"path"`
+	// Arch is the binary's architecture ("amd64", "arm64", "universal", or "" if unknown)
+	Arch string `json:"arch"`
+	// Emulated is true if the binary will run under emulation (e.g. Rosetta 2)
+	Emulated bool `json:"emulated"`
+	// Advice explains problems with the selection, if any
+	Advice string `json:"advice,omitempty"`
+	// Probed lists the candidate paths that were checked, in order
+	Probed []string `json:"probed"`
+}
+
+// platformBinDir returns the extension's bin subdirectory name for an OS
+func platformBinDir(goos string) string {
+	switch goos {
+	case "linux":
+		return "linux"
+	case "darwin":
+		return "darwin"
+	}
+	return "win32"
+}
+
+// platformExecutableName returns the EditorServices host file name for an OS
+func platformExecutableName(goos string) string {
+	if goos == "linux" || goos == "darwin" {
+		return "Microsoft.Dynamics.Nav.EditorServices.Host"
+	}
+	return "Microsoft.Dynamics.Nav.EditorServices.Host.exe"
+}
+
+// extensionArchName maps a GOARCH to the name AL extensions use in directory names
+func extensionArchName(goarch string) string {
+	switch goarch {
+	case "amd64":
+		return "x64"
+	case "arm64":
+		return "arm64"
+	case "386":
+		return "x86"
+	}
+	return goarch
+}
+
+// executableCandidates lists the layouts AL extensions have shipped, preferred first:
+// bin/<platform>-<arch>/, bin/<platform>/<arch>/ and the flat bin/<platform>/
+func executableCandidates(extensionPath, goos, goarch string) []string {
+	binDir := platformBinDir(goos)
+	exe := platformExecutableName(goos)
+
+	arches := []string{goarch}
+	if goarch == "arm64" {
+		// x64 binaries can still run under emulation
+		arches = append(arches, "amd64")
+	}
+
+	var candidates []string
+	for _, arch := range arches {
+		name := extensionArchName(arch)
+		candidates = append(candidates,
+			filepath.Join(extensionPath, "bin", binDir+"-"+name, exe),
+			filepath.Join(extensionPath, "bin", binDir, name, exe),
+		)
+	}
+	return append(candidates, filepath.Join(extensionPath, "bin", binDir, exe))
+}
+
+// SelectALLSPExecutable probes the extension's directory layout and picks the
+// EditorServices binary best suited to this machine's OS and architecture.
+// The native architecture is used, so an x64 wrapper running emulated on
+// Windows ARM64 still prefers a native arm64 EditorServices binary.
+func SelectALLSPExecutable(extensionPath string) ExecutableSelection {
+	arch := hostarch.Native()
+	candidates := executableCandidates(extensionPath, runtime.GOOS, arch)
+	sel := ExecutableSelection{Probed: candidates}
+
+	// Take the first native binary, else the first one that runs at all
+	found := false
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err != nil || info.IsDir() {
+			continue
+		}
+		binArch := binaryArch(candidate)
+		emulated, advice := archAdvice(runtime.GOOS, arch, binArch)
+		if !found || (sel.Emulated && !emulated) {
+			sel.Path, sel.Arch, sel.Emulated, sel.Advice = candidate, binArch, emulated, advice
+			found = true
+		}
+		if !emulated {
+			break
+		}
+	}
+	if found {
+		return sel
+	}
+
+	// Nothing found: report the conventional flat path so errors stay familiar
+	sel.Path = candidates[len(candidates)-1]
+	sel.Advice = fmt.Sprintf("no EditorServices binary found for %s/%s in %s",
+		runtime.GOOS, arch, filepath.Join(extensionPath, "bin"))
+	return sel
+}
+
+// archAdvice decides whether a binary of binArch runs emulated on goos/goarch
+// and what the user should know about it
+func archAdvice(goos, goarch, binArch string) (emulated bool, advice string) {
+	if binArch == "" || binArch == "universal" || binArch == goarch {
+		return false, ""
+	}
+
+	if goarch == "arm64" && binArch == "amd64" {
+		switch goos {
+		case "darwin":
+			if _, err := os.Stat("/Library/Apple/usr/libexec/oah/libRosettaRuntime"); err != nil {
+				return true, "the AL extension only ships an x64 EditorServices binary; " +
+					"install Rosetta 2 with: softwareupdate --install-rosetta --agree-to-license"
+			}
+			return true, "running the x64 EditorServices binary under Rosetta 2"
+		case "linux":
+			return true, "the AL extension only ships an x64 EditorServices binary; " +
+				"it needs x86-64 emulation (qemu-user with binfmt_misc) on linux/arm64"
+		case "windows":
+			return true, "the AL extension has no native arm64 EditorServices binary; " +
+				"running the x64 binary under Windows x64 emulation"
+		}
+	}
+
+	return false, fmt.Sprintf("EditorServices binary is %s but this machine is %s/%s", binArch, goos, goarch)
+}
+
+// binaryArch inspects an executable's header and returns its GOARCH-style
+// architecture, "universal" for multi-arch Mach-O files, or "" if unknown
+func binaryArch(path string) string {
+	if f, err := elf.Open(path); err == nil {
+		defer f.Close()
+		switch f.Machine {
+		case elf.EM_X86_64:
+			return "amd64"
+		case elf.EM_AARCH64:
+			return "arm64"
+		}
+		return strings.ToLower(strings.TrimPrefix(f.Machine.String(), "EM_"))
+	}
+
+	if f, err := macho.OpenFat(path); err == nil {
+		f.Close()
+		return "universal"
+	}
+
+	if f, err := macho.Open(path); err == nil {
+		defer f.Close()
+		switch f.Cpu {
+		case macho.CpuAmd64:
+			return "amd64"
+		case macho.CpuArm64:
+			return "arm64"
+		}
+		return ""
+	}
+
+	if f, err := pe.Open(path); err == nil {
+		defer f.Close()
+		switch f.Machine {
+		case pe.IMAGE_FILE_MACHINE_AMD64:
+			return "amd64"
+		case pe.IMAGE_FILE_MACHINE_ARM64:
+			return "arm64"
+		case pe.IMAGE_FILE_MACHINE_I386:
+			return "386"
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,188 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// AL's file naming convention is <ObjectName>.<FullTypeName>.al: the object
+// name without spaces or other characters outside A-Z, a-z and 0-9, and the
+// object type's short name, e.g. CustomerCard.Page.al or
+// SalesHeaderExt.TableExt.al. al-wrapper.suggestFileNames checks a project's
+// files against their object declarations and returns the renames, as a
+// WorkspaceEdit of rename file operations that al-wrapper.applyWorkspaceEdit
+// or the client can apply. Names are compared ignoring case, since a rename
+// that only changes case fails on the file systems of Windows and macOS.
+
+// SuggestFileNamesCommand lists the files of a project whose names do not
+// follow the object naming convention
+const SuggestFileNamesCommand = "al-wrapper.suggestFileNames"
+
+// fileTypeNames are the type parts of conventional file names by object type
+var fileTypeNames = map[string]string{
+	"table":                  "Table",
+	"tableextension":         "TableExt",
+	"page":                   "Page",
+	"pageextension":          "PageExt",
+	"pagecustomization":      "PageCustomization",
+	"codeunit":               "Codeunit",
+	"report":                 "Report",
+	"reportextension":        "ReportExt",
+	"query":                  "Query",
+	"xmlport":                "XmlPort",
+	"enum":                   "Enum",
+	"enumextension":          "EnumExt",
+	"interface":              "Interface",
+	"permissionset":          "PermissionSet",
+	"permissionsetextension": "PermissionSetExt",
+	"profile":                "Profile",
+	"profileextension":       "ProfileExt",
+	"controladdin":           "ControlAddIn",
+	"entitlement":            "Entitlement",
+}
+
+// SuggestFileNamesArgs represents the optional argument object of al-wrapper.suggestFileNames
+type SuggestFileNamesArgs struct {
+	// Project is a file or folder URI/path inside the project
+	Project string `json:"project"`
+}
+
+// FileNameSuggestion is a file whose name does not match the object it declares
+type FileNameSuggestion struct {
+	URI string `json:"uri"`
+	// Object is the declaration, e.g. page 21 "Customer Card"
+	Object    string `json:"object"`
+	Name      string `json:"name"`
+	Suggested string `json:"suggested"`
+	NewURI    string `json:"newUri"`
+	// Conflict explains why the rename is left out of the edit
+	Conflict string `json:"conflict,omitempty"`
+}
+
+// SkippedFile is a file the convention cannot name
+type SkippedFile struct {
+	URI    string `json:"uri"`
+	Reason string `json:"reason"`
+}
+
+// SuggestFileNamesResult is returned by al-wrapper.suggestFileNames
+type SuggestFileNamesResult struct {
+	Project string `json:"project"`
+	// Checked counts the project's .al files
+	Checked     int                  `json:"checked"`
+	Suggestions []FileNameSuggestion `json:"suggestions"`
+	Skipped     []SkippedFile        `json:"skipped"`
+	// Edit renames the files of the suggestions without conflicts
+	Edit WorkspaceEdit `json:"edit"`
+}
+
+// renameFileOperation is a RenameFile entry of WorkspaceEdit.DocumentChanges
+type renameFileOperation struct {
+	Kind   string `json:"kind"`
+	OldURI string `json:"oldUri"`
+	NewURI string `json:"newUri"`
+}
+
+// conventionalFileName returns the file name AL's convention gives an
+// object's file, or "" for objects it does not cover
+func conventionalFileName(o ALObject) string {
+	typeName, ok := fileTypeNames[o.Type]
+	if !ok {
+		return ""
+	}
+	var name strings.Builder
+	for _, r := range o.Name {
+		if r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			name.WriteRune(r)
+		}
+	}
+	if name.Len() == 0 {
+		return ""
+	}
+	return name.String() + "." + typeName + ".al"
+}
+
+// SuggestFileNames checks the names of a project's .al files against the
+// objects they declare
+func SuggestFileNames(projectRoot string) SuggestFileNamesResult {
+	result := SuggestFileNamesResult{
+		Project:     projectRoot,
+		Suggestions: []FileNameSuggestion{},
+		Skipped:     []SkippedFile{},
+	}
+	objects, _ := ScanProjectObjects(projectRoot)
+	byFile := make(map[string][]ALObject)
+	for _, o := range objects {
+		byFile[o.Path] = append(byFile[o.Path], o)
+	}
+
+	files := alSourceFiles(projectRoot)
+	result.Checked = len(files)
+
+	// A name belongs to the file that has it, then to the first file it is
+	// suggested for
+	claimed := make(map[string]string)
+	for _, path := range files {
+		claimed[strings.ToLower(path)] = path
+	}
+	for _, path := range files {
+		uri := PathToFileURI(path)
+		declared := byFile[path]
+		if len(declared) != 1 {
+			reason := "declares no object"
+			if len(declared) > 1 {
+				reason = fmt.Sprintf("declares %d objects", len(declared))
+			}
+			result.Skipped = append(result.Skipped, SkippedFile{URI: uri, Reason: reason})
+			continue
+		}
+		o := declared[0]
+		suggested := conventionalFileName(o)
+		if suggested == "" {
+			result.Skipped = append(result.Skipped, SkippedFile{URI: uri, Reason: "no naming convention for " + o.DisplayName()})
+			continue
+		}
+		name := filepath.Base(path)
+		if strings.EqualFold(name, suggested) {
+			continue
+		}
+
+		newPath := filepath.Join(filepath.Dir(path), suggested)
+		suggestion := FileNameSuggestion{
+			URI:       uri,
+			Object:    o.DisplayName(),
+			Name:      name,
+			Suggested: suggested,
+			NewURI:    PathToFileURI(newPath),
+		}
+		if owner, ok := claimed[strings.ToLower(newPath)]; ok {
+			suggestion.Conflict = "a file with this name exists"
+			if !strings.EqualFold(owner, newPath) {
+				suggestion.Conflict = "also suggested for " + filepath.Base(owner)
+			}
+		} else {
+			claimed[strings.ToLower(newPath)] = path
+			change, _ := json.Marshal(renameFileOperation{Kind: "rename", OldURI: uri, NewURI: suggestion.NewURI})
+			result.Edit.DocumentChanges = append(result.Edit.DocumentChanges, change)
+		}
+		result.Suggestions = append(result.Suggestions, suggestion)
+	}
+	return result
+}
+
+func suggestFileNamesCommand(msg *Message, args []json.RawMessage, w WrapperInterface) (*Message, *Message) {
+	var cmdArgs SuggestFileNamesArgs
+	if err := decodeCommandArgs(args, &cmdArgs); err != nil {
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "Invalid "+SuggestFileNamesCommand+" arguments: "+err.Error())
+	}
+	projectRoot := resolveCommandProject(cmdArgs.Project, w)
+	if projectRoot == "" {
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "No AL project found to check")
+	}
+
+	result := SuggestFileNames(projectRoot)
+	w.Log("Checked %d file name(s) in %s: %d rename(s) suggested", result.Checked, projectRoot, len(result.Suggestions))
+	return newResultMessage(msg.ID, result)
+}
@@ -0,0 +1,105 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// al-wrapper/forward sends a raw al/* request to the AL server, for features
+// the wrapper does not wrap yet. Only methods in forward.allowedMethods are
+// forwarded. The list can come from the workspace, so methods that change the
+// wrapper's view of the server (al/setActiveWorkspace) or deploy (al/publish)
+// are refused even when listed (forwardDeniedMethods).
+// A textDocument in the params is opened, and its project initialized, first.
+
+// ForwardParams are the params of al-wrapper/forward
+type ForwardParams struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// ForwardHandler handles al-wrapper/forward
+type ForwardHandler struct{}
+
+func (h *ForwardHandler) ShouldHandle(method string) bool {
+	return method == "al-wrapper/forward"
+}
+
+func (h *ForwardHandler) Handle(msg *Message, w WrapperInterface) (*Message, *Message) {
+	var params ForwardParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil || params.Method == "" {
+		w.Log("Failed to parse al-wrapper/forward params: %v", err)
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "Invalid parameters: expected {method, params}")
+	}
+
+	if !forwardAllowed(params.Method, w.Config().Forward.AllowedMethods) {
+		w.Log("Refusing to forward %s: not in forward.allowedMethods", params.Method)
+		return nil, NewErrorResponse(msg.ID, InvalidParams, fmt.Sprintf(
+			"%s is not forwarded; allowed methods (forward.allowedMethods): %s",
+			params.Method, strings.Join(w.Config().Forward.AllowedMethods, ", ")))
+	}
+	if !w.SupportsALMethod(params.Method) {
+		return nil, NewErrorResponse(msg.ID, MethodNotFound,
+			"Method not supported by AL Language Server: "+params.Method)
+	}
+
+	// Open the document the request is about, if any
+	if uri := documentURI(&Message{Params: params.Params}); uri != "" {
+		filePath, err := FileURIToPath(uri)
+		if err != nil {
+			w.Log("Failed to convert URI: %v", err)
+			return nil, NewErrorResponse(msg.ID, InternalError, "Invalid file URI")
+		}
+		if err := w.EnsureFileOpened(filePath); err != nil {
+			w.Log("Failed to open file: %v", err)
+			return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+		}
+		if errResp := ensureProjectForRequest(msg, filePath, w); errResp != nil {
+			return nil, errResp
+		}
+	}
+
+	var forwardParams interface{}
+	if len(params.Params) > 0 {
+		forwardParams = params.Params
+	}
+	response, err := w.SendRequestToLSP(params.Method, forwardParams)
+	if err != nil {
+		w.Log("Failed to forward %s: %v", params.Method, err)
+		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	}
+
+	if response.Error != nil {
+		return nil, &Message{
+			JSONRPC: "2.0",
+			ID:      msg.ID,
+			Error:   response.Error,
+		}
+	}
+
+	return &Message{
+		JSONRPC: "2.0",
+		ID:      msg.ID,
+		Result:  response.Result,
+	}, nil
+}
+
+// forwardDeniedMethods are never forwarded, whatever forward.allowedMethods says
+var forwardDeniedMethods = map[string]bool{
+	"al/publish":            true,
+	"al/setActiveWorkspace": true,
+}
+
+// forwardAllowed reports whether an al/* method may be forwarded
+func forwardAllowed(method string, allowed []string) bool {
+	if !strings.HasPrefix(method, "al/") || forwardDeniedMethods[method] {
+		return false
+	}
+	for _, m := range allowed {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,22 @@
+package wrapper
+
+import "testing"
+
+func TestForwardAllowed(t *testing.T) {
+	allowed := []string{"al/symbolSearch", "al/publish", "al/setActiveWorkspace", "textDocument/hover"}
+	tests := []struct {
+		method string
+		want   bool
+	}{
+		{"al/symbolSearch", true},
+		{"al/gotodefinition", false},
+		{"al/publish", false},
+		{"al/setActiveWorkspace", false},
+		{"textDocument/hover", false},
+	}
+	for _, tt := range tests {
+		if got := forwardAllowed(tt.method, allowed); got != tt.want {
+			t.Errorf("forwardAllowed(%q) = %v, want %v", tt.method, got, tt.want)
+		}
+	}
+}
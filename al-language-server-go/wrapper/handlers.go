@@ -2,8 +2,13 @@ package wrapper
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"regexp"
 	"strings"
+	"time"
+
+	"github.com/SShadowS/claude-code-lsps/al-language-server-go/internal/project"
 )
 
 // TextDocumentPositionParams represents LSP text document position parameters
@@ -53,6 +58,7 @@ type Range struct {
 // HoverResponse represents an LSP hover response
 type HoverResponse struct {
 	Contents MarkupContent `json:"contents"`
+	Range    *Range        `json:"range,omitempty"`
 }
 
 // MarkupContent represents LSP markup content
@@ -72,9 +78,10 @@ type DocumentSymbol struct {
 
 // SymbolInformation represents an LSP symbol information (flat format)
 type SymbolInformation struct {
-	Name     string   `json:"name"`
-	Kind     int      `json:"kind"`
-	Location Location `json:"location"`
+	Name          string   `json:"name"`
+	Kind          int      `json:"kind"`
+	Location      Location `json:"location"`
+	ContainerName string   `json:"containerName,omitempty"`
 }
 
 // Handler interface for method handlers
@@ -98,9 +105,102 @@ type WrapperInterface interface {
 	// SendRequestToLSP sends a request to the AL LSP and waits for response
 	SendRequestToLSP(method string, params interface{}) (*Message, error)
 
+	// SendRequestToLSPWithTimeout sends a request with a non-default response timeout
+	SendRequestToLSPWithTimeout(method string, params interface{}, timeout time.Duration) (*Message, error)
+
+	// SendRequestToLSPWithBudget sends a request within its method's latency
+	// budget and reports whether the response is partial
+	SendRequestToLSPWithBudget(method string, params interface{}) (*Message, bool, error)
+
 	// SendNotificationToLSP sends a notification to the AL LSP
 	SendNotificationToLSP(method string, params interface{}) error
 
+	// Config returns the effective wrapper configuration
+	Config() *Config
+
+	// ClientCapabilities returns the capabilities the client sent in initialize
+	ClientCapabilities() ClientCapabilities
+
+	// ActiveProject returns the root of the most recently activated AL project
+	ActiveProject() string
+
+	// ProjectSymbols returns the wrapper's own symbol index of a project
+	ProjectSymbols(projectRoot string) []IndexedSymbol
+
+	// DependencyPackages returns the manifests of a project's dependency packages
+	DependencyPackages(projectRoot string) []AppManifest
+
+	// DependencyObjects returns the objects declared by a dependency package
+	DependencyObjects(app AppManifest) []AppObject
+
+	// CachedDocumentSymbols returns the cached documentSymbol result for a
+	// file, if the file and its document version are unchanged
+	CachedDocumentSymbols(filePath string) (json.RawMessage, bool)
+
+	// CacheDocumentSymbols caches the documentSymbol result for a file
+	CacheDocumentSymbols(filePath string, result json.RawMessage)
+
+	// ProjectApp returns the parsed app.json of a project, shared with other
+	// callers and not to be modified
+	ProjectApp(projectRoot string) (*project.App, error)
+
+	// DependencySource returns a file holding an object of a dependency
+	// package: its source, or a stub generated from its symbols (generated)
+	DependencySource(app AppManifest, object AppObject) (path string, generated bool, err error)
+
+	// SymbolStore returns the symbols of dependency packages
+	SymbolStore() *SymbolStore
+
+	// BuildProject compiles a project with alc and publishes its diagnostics
+	BuildProject(projectRoot string) (*BuildResult, error)
+
+	// WorkspaceRoot returns the root folder of the client's workspace
+	WorkspaceRoot() string
+
+	// SendRequestInProject sends a request to the AL LSP with an initialized
+	// project active
+	SendRequestInProject(projectRoot string, method string, params interface{}) (*Message, error)
+
+	// FileDiagnostics returns the diagnostics the AL server last published
+	// for a file with the wrapper's own, waiting up to timeout for the first set
+	FileDiagnostics(filePath string, timeout time.Duration) ([]Diagnostic, bool)
+
+	// ProjectDiagnostics returns the diagnostics last published for the
+	// files of a project, by file path
+	ProjectDiagnostics(projectRoot string) map[string][]Diagnostic
+
+	// SelfTest returns the startup self-test report
+	SelfTest() SelfTestReport
+
+	// ApplyWorkspaceEdit applies a WorkspaceEdit to disk and updates the AL LSP;
+	// source names what produced the edit, for the audit log
+	ApplyWorkspaceEdit(edit *WorkspaceEdit, source string) (*AppliedEdit, error)
+
+	// AuditResult records the edits in a result forwarded to the client
+	AuditResult(method string, result json.RawMessage)
+
+	// SyncedDocuments returns the hash of the text the client last synced for
+	// each document it has open
+	SyncedDocuments() map[string]string
+
+	// CheckEditDrift verifies the files of a WorkspaceEdit still hold the
+	// text the AL server computed it against; synced is what SyncedDocuments
+	// returned when the request was sent
+	CheckEditDrift(edit *WorkspaceEdit, synced map[string]string) error
+
+	// BeginProgress starts reporting the progress of work the wrapper does
+	// itself on the client's workDoneToken; nil if there is none to report on
+	BeginProgress(title string) *WorkDoneProgress
+
+	// Status returns the live wrapper health report
+	Status() WrapperStatus
+
+	// SupportsALMethod reports whether the AL server implements an al/* method
+	SupportsALMethod(method string) bool
+
+	// LogToClient sends a message to the client's log (window/logMessage)
+	LogToClient(messageType int, message string)
+
 	// Log logs a message
 	Log(format string, args ...interface{})
 }
@@ -131,18 +231,17 @@ func (h *DefinitionHandler) Handle(msg *Message, w WrapperInterface) (*Message,
 		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
 	}
 
-	// Ensure project is initialized
-	if err := w.EnsureProjectInitialized(filePath); err != nil {
-		w.Log("Failed to initialize project: %v", err)
-		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	// Ensure project is initialized, or degrade to the file alone
+	if errResp := ensureProjectForRequest(msg, filePath, w); errResp != nil {
+		return nil, errResp
 	}
 
-	// Transform to AL-specific command
-	alParams := ALGotoDefinitionParams{
-		TextDocumentPositionParams: params,
+	definitionMethod, definitionParams := definitionRequest(params, w)
+	response, err := w.SendRequestToLSP(definitionMethod, definitionParams)
+	if errors.Is(err, ErrCircuitOpen) {
+		// Go straight to the documentSymbol fallback below
+		response, err = &Message{Result: json.RawMessage("null")}, nil
 	}
-
-	response, err := w.SendRequestToLSP("al/gotodefinition", alParams)
 	if err != nil {
 		w.Log("Failed to send definition request: %v", err)
 		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
@@ -158,7 +257,7 @@ func (h *DefinitionHandler) Handle(msg *Message, w WrapperInterface) (*Message,
 	}
 
 	// Check if result is empty - try fallback using documentSymbol
-	if isEmptyDefinitionResult(response.Result) {
+	if isEmptyDefinitionResult(response.Result) && w.Config().Definition.HoverFallback {
 		w.Log("Definition result empty, trying documentSymbol fallback")
 
 		// Get symbol name via hover
@@ -182,7 +281,7 @@ func (h *DefinitionHandler) Handle(msg *Message, w WrapperInterface) (*Message,
 						return &Message{
 							JSONRPC: "2.0",
 							ID:      msg.ID,
-							Result:  locationJSON,
+							Result:  markProvenance(locationJSON, msg.Method, provenanceDocumentSymbol, w),
 						}, nil
 					}
 				}
@@ -190,13 +289,44 @@ func (h *DefinitionHandler) Handle(msg *Message, w WrapperInterface) (*Message,
 		}
 	}
 
+	result := response.Result
+	if w.Config().Definition.RankCandidates {
+		result = rankDefinitionCandidates(result, filePath, params.Position, w)
+	}
+	if w.Config().Dependencies.AnnotateDefinitions {
+		root := NormalizePath(GetProjectRoot(filePath))
+		result, _ = annotateDefinitionResult(result, root, w.DependencyPackages(root))
+	}
+	if w.Config().Dependencies.ExtractSources {
+		result = extractDefinitionSources(result, filePath, params.Position, w)
+	}
 	return &Message{
 		JSONRPC: "2.0",
 		ID:      msg.ID,
-		Result:  response.Result,
+		Result:  result,
 	}, nil
 }
 
+// DeclarationHandler handles textDocument/declaration exactly like
+// textDocument/definition: AL has no separate declarations, and clients that
+// ask for the declaration expect the same location
+type DeclarationHandler struct {
+	DefinitionHandler
+}
+
+func (h *DeclarationHandler) ShouldHandle(method string) bool {
+	return method == "textDocument/declaration"
+}
+
+// definitionRequest returns the AL server request for a definition lookup:
+// al/gotodefinition, or the standard request if the server lacks it
+func definitionRequest(params TextDocumentPositionParams, w WrapperInterface) (string, interface{}) {
+	if !w.SupportsALMethod("al/gotodefinition") {
+		return "textDocument/definition", params
+	}
+	return "al/gotodefinition", ALGotoDefinitionParams{TextDocumentPositionParams: params}
+}
+
 // isEmptyDefinitionResult checks if a definition result is empty (null or empty array)
 func isEmptyDefinitionResult(result json.RawMessage) bool {
 	if result == nil || len(result) == 0 {
@@ -339,10 +469,9 @@ func (h *HoverHandler) Handle(msg *Message, w WrapperInterface) (*Message, *Mess
 		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
 	}
 
-	// Ensure project is initialized
-	if err := w.EnsureProjectInitialized(filePath); err != nil {
-		w.Log("Failed to initialize project: %v", err)
-		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	// Ensure project is initialized, or degrade to the file alone
+	if errResp := ensureProjectForRequest(msg, filePath, w); errResp != nil {
+		return nil, errResp
 	}
 
 	// Forward to AL LSP
@@ -360,13 +489,69 @@ func (h *HoverHandler) Handle(msg *Message, w WrapperInterface) (*Message, *Mess
 		}
 	}
 
+	cfg := w.Config()
+	if cfg.Hover.OfflineDocs && isEmptyHover(response.Result) {
+		if hover, ok := keywordHover(filePath, params.Position); ok {
+			return newResultMessage(msg.ID, markProvenance(hover, msg.Method, provenanceKeywordDocs, w))
+		}
+	}
+	if cfg.Hover.LocalFallback && isEmptyHover(response.Result) {
+		if hover, ok := localHover(filePath, params.Position); ok {
+			return newResultMessage(msg.ID, markProvenance(hover, msg.Method, provenanceLocalParse, w))
+		}
+	}
+	result := normalizeHoverResult(response.Result, cfg.Hover)
+	if (cfg.Dependencies.AnnotateHover || cfg.Obsolete.Annotate || cfg.Hover.Context) && !isEmptyDefinitionResult(result) {
+		definition, app := h.definitionOf(params, filePath, w)
+		note := ""
+		if cfg.Hover.Context {
+			note = hoverContextNote(definition, app, w)
+		}
+		if note != "" {
+			// The context names the app too
+			result = appendHoverNote(result, note)
+		} else if app != nil && cfg.Dependencies.AnnotateHover {
+			result = appendHoverNote(result, "*Defined"+strings.TrimPrefix(app.DefinedIn(), "defined")+"*")
+		}
+		if cfg.Obsolete.Annotate {
+			info := obsoleteForDefinition(definition)
+			if info == nil && app != nil {
+				info = packageObjectObsolete(definition, *app, w)
+			}
+			if info != nil {
+				result = appendHoverNote(result, "**"+info.String()+"**")
+			}
+		}
+	}
 	return &Message{
 		JSONRPC: "2.0",
 		ID:      msg.ID,
-		Result:  response.Result,
+		Result:  result,
 	}, nil
 }
 
+// dependencyTimeout bounds the definition lookup behind hover annotations
+const dependencyTimeout = 2 * time.Second
+
+// definitionOf looks up the definition of the symbol at a position for hover
+// annotations. It returns the definition result, and the dependency package
+// defining the symbol or nil if it is defined in the project or cannot be
+// determined.
+func (h *HoverHandler) definitionOf(params TextDocumentPositionParams, filePath string, w WrapperInterface) (json.RawMessage, *AppManifest) {
+	root := NormalizePath(GetProjectRoot(filePath))
+	apps := w.DependencyPackages(root)
+	if len(apps) == 0 && !w.Config().Obsolete.Annotate && !w.Config().Hover.Context {
+		return nil, nil
+	}
+	method, definitionParams := definitionRequest(params, w)
+	response, err := w.SendRequestToLSPWithTimeout(method, definitionParams, dependencyTimeout)
+	if err != nil || response.Error != nil {
+		return nil, nil
+	}
+	_, app := annotateDefinitionResult(response.Result, root, apps)
+	return response.Result, app
+}
+
 // DocumentSymbolHandler handles textDocument/documentSymbol
 type DocumentSymbolHandler struct{}
 
@@ -395,31 +580,49 @@ func (h *DocumentSymbolHandler) Handle(msg *Message, w WrapperInterface) (*Messa
 		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
 	}
 
-	// Ensure project is initialized
-	if err := w.EnsureProjectInitialized(filePath); err != nil {
-		w.Log("Failed to initialize project: %v", err)
-		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	cache := w.Config().DocumentSymbol.Cache
+	result, cached := json.RawMessage(nil), false
+	if cache {
+		result, cached = w.CachedDocumentSymbols(filePath)
 	}
+	if cached {
+		w.Log("Answering documentSymbol from cache: %s", filePath)
+	} else {
+		// Ensure project is initialized, or degrade to the file alone
+		if errResp := ensureProjectForRequest(msg, filePath, w); errResp != nil {
+			return nil, errResp
+		}
 
-	// Forward to AL LSP
-	response, err := w.SendRequestToLSP("textDocument/documentSymbol", params)
-	if err != nil {
-		w.Log("Failed to send documentSymbol request: %v", err)
-		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
-	}
+		// Forward to AL LSP
+		response, err := w.SendRequestToLSP("textDocument/documentSymbol", params)
+		if err != nil {
+			w.Log("Failed to send documentSymbol request: %v", err)
+			return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+		}
 
-	if response.Error != nil {
-		return nil, &Message{
-			JSONRPC: "2.0",
-			ID:      msg.ID,
-			Error:   response.Error,
+		if response.Error != nil {
+			return nil, &Message{
+				JSONRPC: "2.0",
+				ID:      msg.ID,
+				Error:   response.Error,
+			}
+		}
+
+		result = response.Result
+		if cache && !isEmptyResult(result) {
+			w.CacheDocumentSymbols(filePath, result)
 		}
 	}
 
+	result = limitDocumentSymbolDepth(result, w.Config().DocumentSymbol.MaxDepth, w)
+	if w.Config().Obsolete.Annotate {
+		result = annotateObsoleteSymbols(result, params.TextDocument.URI)
+	}
+
 	return &Message{
 		JSONRPC: "2.0",
 		ID:      msg.ID,
-		Result:  response.Result,
+		Result:  result,
 	}, nil
 }
 
@@ -431,6 +634,15 @@ func (h *WorkspaceSymbolHandler) ShouldHandle(method string) bool {
 }
 
 func (h *WorkspaceSymbolHandler) Handle(msg *Message, w WrapperInterface) (*Message, *Message) {
+	response, errResponse := h.search(msg, w)
+	if response != nil && w.Config().Obsolete.Annotate {
+		response.Result = annotateObsoleteSymbols(response.Result, "")
+	}
+	return response, errResponse
+}
+
+// search answers a workspace/symbol request
+func (h *WorkspaceSymbolHandler) search(msg *Message, w WrapperInterface) (*Message, *Message) {
 	var params WorkspaceSymbolParams
 	if err := json.Unmarshal(msg.Params, &params); err != nil {
 		w.Log("Failed to parse workspaceSymbol params: %v", err)
@@ -442,42 +654,60 @@ func (h *WorkspaceSymbolHandler) Handle(msg *Message, w WrapperInterface) (*Mess
 	// Check for empty query
 	if strings.TrimSpace(query) == "" {
 		w.Log("Empty workspace/symbol query")
+		if w.Config().WorkspaceSymbol.EmptyQueryOverview && w.ActiveProject() != "" {
+			return h.projectOverview(msg, w)
+		}
 		return nil, NewErrorResponse(msg.ID, InvalidParams,
 			"AL Language Server requires a non-empty query for workspace/symbol. "+
 				"Please provide a symbol name to search for.")
 	}
 
-	// Workaround: Claude Code sometimes sends file paths instead of symbol names
-	if strings.Contains(query, "/") || strings.Contains(query, "\\") {
-		query = ExtractSymbolFromPath(query)
-		w.Log("Extracted symbol from path: %s", query)
+	if pattern, ok := strings.CutPrefix(strings.TrimSpace(query), regexQueryPrefix); ok {
+		return h.regexSearch(msg, pattern, w)
+	}
+
+	// Normalize quoting, Object.Member compounds and file names
+	cfg := w.Config().WorkspaceSymbol
+	q := parseSymbolQuery(query, cfg.PathQueries)
+	if q.Name != query {
+		w.Log("Normalized symbol query %q to name=%q container=%q glob=%t", query, q.Name, q.Container, q.Pattern != nil)
 	}
 
 	// First try standard workspace/symbol
-	response, err := w.SendRequestToLSP("workspace/symbol", WorkspaceSymbolParams{Query: query})
-	if err != nil {
+	response, partial, err := w.SendRequestToLSPWithBudget("workspace/symbol", WorkspaceSymbolParams{Query: q.Name})
+	if err != nil && !errors.Is(err, ErrCircuitOpen) {
 		w.Log("Failed to send workspace/symbol request: %v", err)
 		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
 	}
 
 	// Check if we got results
-	if response.Result != nil {
-		var results []interface{}
-		if err := json.Unmarshal(response.Result, &results); err == nil && len(results) > 0 {
+	if err == nil && response.Error == nil {
+		if result := q.filter(response.Result); !isEmptyResult(result) {
+			result = limitWorkspaceSymbols(h.rank(result, q, w), cfg.MaxResults, w)
+			if partial {
+				logPartialResult(result, "workspace/symbol", w)
+			}
 			return &Message{
 				JSONRPC: "2.0",
 				ID:      msg.ID,
-				Result:  response.Result,
+				Result:  result,
 			}, nil
 		}
 	}
 
-	// Fallback to al/symbolSearch
-	w.Log("Falling back to al/symbolSearch for query: %s", query)
-	response, err = w.SendRequestToLSP("al/symbolSearch", ALSymbolSearchParams{Filter: query})
-	if err != nil {
-		w.Log("Failed to send al/symbolSearch request: %v", err)
-		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	// Fallback to al/symbolSearch; without it (unsupported or short-circuited)
+	// the wrapper index below is the last resort
+	response = &Message{Result: json.RawMessage("[]")}
+	if cfg.SymbolSearchFallback && w.SupportsALMethod("al/symbolSearch") {
+		w.Log("Falling back to al/symbolSearch for query: %s", q.Name)
+		response, err = w.SendRequestToLSP("al/symbolSearch", ALSymbolSearchParams{Filter: q.Name})
+		if errors.Is(err, ErrCircuitOpen) {
+			response, err = &Message{Result: json.RawMessage("[]")}, nil
+		}
+		if err != nil {
+			w.Log("Failed to send al/symbolSearch request: %v", err)
+			return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+		}
 	}
 
 	if response.Error != nil {
@@ -488,10 +718,136 @@ func (h *WorkspaceSymbolHandler) Handle(msg *Message, w WrapperInterface) (*Mess
 		}
 	}
 
+	result := q.filter(normalizeSymbolSearchResult(response.Result))
+	if !isEmptyResult(result) {
+		return &Message{
+			JSONRPC: "2.0",
+			ID:      msg.ID,
+			Result:  markProvenance(limitWorkspaceSymbols(h.rank(result, q, w), cfg.MaxResults, w), msg.Method, provenanceSymbolSearch, w),
+		}, nil
+	}
+
+	// Neither server search matched: try the wrapper's own index, then suggestions
+	if matches := q.matchIndex(w.ProjectSymbols(w.ActiveProject())); len(matches) > 0 {
+		w.Log("Found %d symbol(s) for %q in the wrapper index", len(matches), query)
+		if data, err := json.Marshal(matches); err == nil {
+			return &Message{
+				JSONRPC: "2.0",
+				ID:      msg.ID,
+				Result:  markProvenance(limitWorkspaceSymbols(h.rank(data, q, w), cfg.MaxResults, w), msg.Method, provenanceSymbolIndex, w),
+			}, nil
+		}
+	}
+
+	if cfg.Suggestions && q.Pattern == nil {
+		if suggestions := h.suggestions(q.Name, w); suggestions != nil {
+			return &Message{
+				JSONRPC: "2.0",
+				ID:      msg.ID,
+				Result:  markProvenance(suggestions, msg.Method, provenanceSuggestions, w),
+			}, nil
+		}
+	}
+
 	return &Message{
 		JSONRPC: "2.0",
 		ID:      msg.ID,
-		Result:  response.Result,
+		Result:  result,
+	}, nil
+}
+
+// rank sorts results by how well they match the query, if workspaceSymbol.rank is on
+func (h *WorkspaceSymbolHandler) rank(result json.RawMessage, q symbolQuery, w WrapperInterface) json.RawMessage {
+	if !w.Config().WorkspaceSymbol.Rank {
+		return result
+	}
+	return rankWorkspaceSymbols(result, q.Name)
+}
+
+// regexSearch answers a "re:" query from the wrapper's project symbol index,
+// which the AL server has no equivalent for
+func (h *WorkspaceSymbolHandler) regexSearch(msg *Message, pattern string, w WrapperInterface) (*Message, *Message) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		w.Log("Invalid regex symbol query %q: %v", pattern, err)
+		return nil, NewErrorResponse(msg.ID, InvalidParams, fmt.Sprintf("Invalid regular expression in %q query: %v", regexQueryPrefix, err))
+	}
+
+	project := w.ActiveProject()
+	if project == "" {
+		return nil, NewErrorResponse(msg.ID, InvalidParams,
+			"Regular expression symbol queries search the active project; open an AL file first.")
+	}
+
+	matches := matchSymbolsRegexp(re, w.ProjectSymbols(project))
+	w.Log("Regex symbol query %q matched %d symbol(s)", pattern, len(matches))
+
+	data, err := json.Marshal(matches)
+	if err != nil {
+		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	}
+	return &Message{
+		JSONRPC: "2.0",
+		ID:      msg.ID,
+		Result:  markProvenance(limitWorkspaceSymbols(data, w.Config().WorkspaceSymbol.MaxResults, w), msg.Method, provenanceSymbolIndex, w),
+	}, nil
+}
+
+// maxSuggestions is how many "did you mean" results a failed search returns
+const maxSuggestions = 5
+
+// suggestions returns the nearest indexed symbols for a query that matched
+// nothing, marked as suggestions in their containerName, or nil if none are close
+func (h *WorkspaceSymbolHandler) suggestions(query string, w WrapperInterface) json.RawMessage {
+	matches := suggestSymbols(query, w.ProjectSymbols(w.ActiveProject()), maxSuggestions)
+	if len(matches) == 0 {
+		return nil
+	}
+
+	names := make([]string, len(matches))
+	results := make([]SymbolInformation, len(matches))
+	for i, match := range matches {
+		names[i] = match.Name
+		results[i] = match.SymbolInformation()
+		note := fmt.Sprintf("did you mean? (no match for %q)", query)
+		if match.Container != "" {
+			note += " in " + match.Container
+		}
+		results[i].ContainerName = note
+	}
+	w.Log("No symbols for %q, suggesting: %s", query, strings.Join(names, ", "))
+
+	data, err := json.Marshal(results)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// isEmptyResult reports whether a result is null or an empty array
+func isEmptyResult(result json.RawMessage) bool {
+	var items []json.RawMessage
+	return len(result) == 0 || string(result) == "null" || (json.Unmarshal(result, &items) == nil && len(items) == 0)
+}
+
+// projectOverview answers an empty query with the active project's top-level objects
+func (h *WorkspaceSymbolHandler) projectOverview(msg *Message, w WrapperInterface) (*Message, *Message) {
+	root := w.ActiveProject()
+	objects, err := ScanProjectObjects(root)
+	if err != nil {
+		w.Log("Failed to scan project objects in %s: %v", root, err)
+		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	}
+	w.Log("Returning overview of %d objects in %s", len(objects), root)
+
+	result, err := json.Marshal(objectSymbols(objects))
+	if err != nil {
+		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	}
+	return &Message{
+		JSONRPC: "2.0",
+		ID:      msg.ID,
+		Result:  markProvenance(limitWorkspaceSymbols(result, w.Config().WorkspaceSymbol.MaxResults, w), msg.Method, provenanceProjectScan, w),
 	}, nil
 }
 
@@ -527,16 +883,114 @@ func (h *ReferencesHandler) Handle(msg *Message, w WrapperInterface) (*Message,
 		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
 	}
 
-	// Ensure project is initialized
-	if err := w.EnsureProjectInitialized(filePath); err != nil {
-		w.Log("Failed to initialize project: %v", err)
-		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	// Without the AL server's answer, optionally search the workspace's text
+	textFallback := func(reason string) *Message {
+		if !w.Config().References.TextFallback {
+			return nil
+		}
+		result, ok := textReferences(filePath, params.Position, params.Context.IncludeDeclaration, w)
+		if !ok {
+			return nil
+		}
+		w.Log("References fall back to a text search: %s", reason)
+		result = processReferences(result, w.Config().References, w)
+		return &Message{
+			JSONRPC: "2.0",
+			ID:      msg.ID,
+			Result:  markProvenance(result, msg.Method, provenanceTextualMatch, w),
+		}
 	}
 
-	// Forward to AL LSP
-	response, err := w.SendRequestToLSP("textDocument/references", params)
+	// Ensure project is initialized, or degrade to the file alone
+	if errResp := ensureProjectForRequest(msg, filePath, w); errResp != nil {
+		if resp := textFallback("the AL project is not loaded"); resp != nil {
+			return resp, nil
+		}
+		return nil, errResp
+	}
+
+	// Forward to AL LSP, within the latency budget
+	response, partial, err := w.SendRequestToLSPWithBudget("textDocument/references", params)
 	if err != nil {
 		w.Log("Failed to send references request: %v", err)
+		if resp := textFallback(err.Error()); resp != nil {
+			return resp, nil
+		}
+		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	}
+
+	if response.Error != nil {
+		if resp := textFallback(response.Error.Message); resp != nil {
+			return resp, nil
+		}
+		return nil, &Message{
+			JSONRPC: "2.0",
+			ID:      msg.ID,
+			Error:   response.Error,
+		}
+	}
+	// Projects depending on this one may reference the symbol too
+	result := response.Result
+	dependents := w.Config().References.Dependents
+	if !partial && (dependents == "merge" || (dependents == "fallback" && isEmptyResult(result))) {
+		result = mergeReferences(result, dependentReferences(filePath, params, w))
+	}
+	// Dependency packages with sources may use the symbol as well
+	if cfg := w.Config().References; !partial && cfg.Packages {
+		result = mergeReferences(result, packageReferences(filePath, params.Position, params.Context.IncludeDeclaration, cfg.MaxResults, w))
+	}
+
+	if !partial && isEmptyResult(result) {
+		if resp := textFallback("the AL server found none"); resp != nil {
+			return resp, nil
+		}
+	}
+
+	result = processReferences(result, w.Config().References, w)
+	if partial {
+		logPartialResult(result, "textDocument/references", w)
+	}
+
+	return &Message{
+		JSONRPC: "2.0",
+		ID:      msg.ID,
+		Result:  result,
+	}, nil
+}
+
+// forwardDocumentRequest forwards a textDocument/* request to the AL server
+// with the client's params unchanged, so fields the wrapper does not read
+// (contexts, options, work done tokens) reach the server. The document is
+// opened and its project initialized first.
+func forwardDocumentRequest(msg *Message, w WrapperInterface) (*Message, *Message) {
+	var params struct {
+		TextDocument TextDocumentIdentifier `json:"textDocument"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		w.Log("Failed to parse %s params: %v", msg.Method, err)
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "Invalid parameters")
+	}
+
+	filePath, err := FileURIToPath(params.TextDocument.URI)
+	if err != nil {
+		w.Log("Failed to convert URI: %v", err)
+		return nil, NewErrorResponse(msg.ID, InternalError, "Invalid file URI")
+	}
+
+	// Ensure the file is opened
+	if err := w.EnsureFileOpened(filePath); err != nil {
+		w.Log("Failed to open file: %v", err)
+		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	}
+
+	// Ensure project is initialized, or degrade to the file alone
+	if errResp := ensureProjectForRequest(msg, filePath, w); errResp != nil {
+		return nil, errResp
+	}
+
+	response, err := w.SendRequestToLSP(msg.Method, msg.Params)
+	if err != nil {
+		w.Log("Failed to send %s request: %v", msg.Method, err)
 		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
 	}
 
@@ -555,39 +1009,131 @@ func (h *ReferencesHandler) Handle(msg *Message, w WrapperInterface) (*Message,
 	}, nil
 }
 
-// UnsupportedMethodHandler handles methods that are not supported
-type UnsupportedMethodHandler struct {
-	methods map[string]bool
+// CompletionHandler handles textDocument/completion
+type CompletionHandler struct{}
+
+func (h *CompletionHandler) ShouldHandle(method string) bool {
+	return method == "textDocument/completion"
 }
 
-func NewUnsupportedMethodHandler() *UnsupportedMethodHandler {
-	return &UnsupportedMethodHandler{
-		methods: map[string]bool{
-			"textDocument/prepareCallHierarchy": true,
-			"callHierarchy/incomingCalls":       true,
-			"callHierarchy/outgoingCalls":       true,
-		},
+func (h *CompletionHandler) Handle(msg *Message, w WrapperInterface) (*Message, *Message) {
+	response, errResp := forwardDocumentRequest(msg, w)
+	if errResp != nil || !w.Config().Completion.Snippets || !isEmptyCompletion(response.Result) {
+		return response, errResp
+	}
+
+	// The AL server has nothing to offer here; fall back to the snippets
+	var params TextDocumentPositionParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return response, nil
 	}
+	filePath, err := FileURIToPath(params.TextDocument.URI)
+	if err != nil {
+		return response, nil
+	}
+	snippetSupport := w.ClientCapabilities().TextDocument.Completion.CompletionItem.SnippetSupport
+	if items, ok := snippetCompletions(filePath, params.Position, snippetSupport); ok {
+		return newResultMessage(msg.ID, markProvenance(items, msg.Method, provenanceSnippets, w))
+	}
+	return response, nil
+}
+
+// SignatureHelpHandler handles textDocument/signatureHelp
+type SignatureHelpHandler struct{}
+
+func (h *SignatureHelpHandler) ShouldHandle(method string) bool {
+	return method == "textDocument/signatureHelp"
+}
+
+func (h *SignatureHelpHandler) Handle(msg *Message, w WrapperInterface) (*Message, *Message) {
+	return forwardDocumentRequest(msg, w)
+}
+
+// FormattingHandler handles textDocument/formatting
+type FormattingHandler struct{}
+
+func (h *FormattingHandler) ShouldHandle(method string) bool {
+	return method == "textDocument/formatting"
+}
+
+func (h *FormattingHandler) Handle(msg *Message, w WrapperInterface) (*Message, *Message) {
+	return forwardDocumentRequest(msg, w)
+}
+
+// DocumentHighlightHandler handles textDocument/documentHighlight
+type DocumentHighlightHandler struct{}
+
+func (h *DocumentHighlightHandler) ShouldHandle(method string) bool {
+	return method == "textDocument/documentHighlight"
+}
+
+func (h *DocumentHighlightHandler) Handle(msg *Message, w WrapperInterface) (*Message, *Message) {
+	return forwardDocumentRequest(msg, w)
 }
 
-func (h *UnsupportedMethodHandler) ShouldHandle(method string) bool {
-	return h.methods[method]
+// FoldingRangeHandler handles textDocument/foldingRange
+type FoldingRangeHandler struct{}
+
+func (h *FoldingRangeHandler) ShouldHandle(method string) bool {
+	return method == "textDocument/foldingRange"
+}
+
+func (h *FoldingRangeHandler) Handle(msg *Message, w WrapperInterface) (*Message, *Message) {
+	return forwardDocumentRequest(msg, w)
+}
+
+// SelectionRangeHandler handles textDocument/selectionRange
+type SelectionRangeHandler struct{}
+
+func (h *SelectionRangeHandler) ShouldHandle(method string) bool {
+	return method == "textDocument/selectionRange"
+}
+
+func (h *SelectionRangeHandler) Handle(msg *Message, w WrapperInterface) (*Message, *Message) {
+	return forwardDocumentRequest(msg, w)
+}
+
+// LinkedEditingRangeHandler handles textDocument/linkedEditingRange
+type LinkedEditingRangeHandler struct{}
+
+func (h *LinkedEditingRangeHandler) ShouldHandle(method string) bool {
+	return method == "textDocument/linkedEditingRange"
 }
 
-func (h *UnsupportedMethodHandler) Handle(msg *Message, w WrapperInterface) (*Message, *Message) {
-	w.Log("Unsupported method: %s", msg.Method)
-	return nil, NewErrorResponse(msg.ID, MethodNotFound,
-		"Method not supported by AL Language Server: "+msg.Method)
+func (h *LinkedEditingRangeHandler) Handle(msg *Message, w WrapperInterface) (*Message, *Message) {
+	return forwardDocumentRequest(msg, w)
 }
 
 // GetDefaultHandlers returns the default set of handlers
 func GetDefaultHandlers() []Handler {
+	// Commands of the code actions returned may be executed through the AL server
+	codeActionCommands := newCommandSet()
 	return []Handler{
 		&DefinitionHandler{},
+		&DeclarationHandler{},
 		&HoverHandler{},
 		&DocumentSymbolHandler{},
 		&WorkspaceSymbolHandler{},
 		&ReferencesHandler{},
-		NewUnsupportedMethodHandler(),
+		&CompletionHandler{},
+		&SignatureHelpHandler{},
+		&RenameHandler{},
+		NewCodeActionHandler(codeActionCommands),
+		&CodeLensHandler{},
+		&FormattingHandler{},
+		&DocumentHighlightHandler{},
+		&FoldingRangeHandler{},
+		&SelectionRangeHandler{},
+		&LinkedEditingRangeHandler{},
+		&DocumentLinkHandler{},
+		&SemanticTokensHandler{},
+		&ImplementationHandler{},
+		&CallHierarchyHandler{},
+		&TypeHierarchyHandler{},
+		&DiagnosticHandler{},
+		NewExecuteCommandHandler(codeActionCommands),
+		&ForwardHandler{},
+		&SelfTestHandler{},
+		&StatusHandler{},
 	}
 }
@@ -0,0 +1,274 @@
+package wrapper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	// xmlDocReplacements turn XML documentation tags into markdown
+	xmlDocReplacements = []struct {
+		pattern *regexp.Regexp
+		replace string
+	}{
+		{regexp.MustCompile(`(?i)<param\s+name\s*=\s*"([^"]*)"\s*>`), "\n- `$1`: "},
+		{regexp.MustCompile(`(?i)<typeparam\s+name\s*=\s*"([^"]*)"\s*>`), "\n- `$1`: "},
+		{regexp.MustCompile(`(?i)<(?:see|seealso)\s+cref\s*=\s*"(?:[A-Z]:)?([^"]*)"\s*/?>`), "`$1`"},
+		{regexp.MustCompile(`(?i)<paramref\s+name\s*=\s*"([^"]*)"\s*/?>`), "`$1`"},
+		{regexp.MustCompile(`(?i)<returns>`), "\nReturns: "},
+		{regexp.MustCompile(`(?i)<remarks>`), "\n\n"},
+		{regexp.MustCompile(`(?i)<example>`), "\n\nExample: "},
+		{regexp.MustCompile(`(?i)</?(?:c|code)>`), "`"},
+		{regexp.MustCompile(`(?i)<br\s*/?>|</?para>|</?p>`), "\n"},
+	}
+	// htmlTagPattern matches any remaining HTML or XML tag
+	htmlTagPattern = regexp.MustCompile(`</?[A-Za-z][^<>]*>`)
+	// blankRunPattern matches runs of horizontal whitespace
+	blankRunPattern = regexp.MustCompile(`[ \t\x{00a0}]+`)
+	// blankLinesPattern matches more than one empty line
+	blankLinesPattern = regexp.MustCompile(`\n{3,}`)
+)
+
+// normalizeHoverResult rewrites a hover result so its text is compact,
+// markup-free markdown. Results of an unexpected shape are returned unchanged.
+func normalizeHoverResult(result json.RawMessage, cfg HoverConfig) json.RawMessage {
+	if !cfg.Normalize || len(result) == 0 || string(result) == "null" {
+		return result
+	}
+
+	var hover map[string]json.RawMessage
+	if err := json.Unmarshal(result, &hover); err != nil {
+		return result
+	}
+	contents, ok := hover["contents"]
+	if !ok {
+		return result
+	}
+
+	normalized, ok := normalizeHoverContents(contents, cfg.MaxLength)
+	if !ok {
+		return result
+	}
+	hover["contents"] = normalized
+
+	data, err := marshalUnescaped(hover)
+	if err != nil {
+		return result
+	}
+	return data
+}
+
+// marshalUnescaped marshals v without escaping <, > and &, which would only
+// make hover text harder to read
+func marshalUnescaped(v interface{}) (json.RawMessage, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// normalizeHoverContents converts MarkedString, MarkedString[] and
+// MarkupContent contents into a single normalized markdown MarkupContent
+func normalizeHoverContents(contents json.RawMessage, maxLength int) (json.RawMessage, bool) {
+	var parts []string
+
+	var markup MarkupContent
+	var list []json.RawMessage
+	switch {
+	case json.Unmarshal(contents, &markup) == nil && markup.Kind != "":
+		if markup.Kind == "plaintext" {
+			parts = append(parts, html.UnescapeString(markup.Value))
+		} else {
+			parts = append(parts, markup.Value)
+		}
+	case json.Unmarshal(contents, &list) == nil:
+		for _, item := range list {
+			part, ok := markedStringToMarkdown(item)
+			if !ok {
+				return nil, false
+			}
+			parts = append(parts, part)
+		}
+	default:
+		part, ok := markedStringToMarkdown(contents)
+		if !ok {
+			return nil, false
+		}
+		parts = append(parts, part)
+	}
+
+	value := NormalizeHoverMarkdown(strings.Join(parts, "\n\n"), maxLength)
+	data, err := marshalUnescaped(MarkupContent{Kind: "markdown", Value: value})
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// appendHoverNote adds a markdown paragraph to the contents of a hover result
+func appendHoverNote(result json.RawMessage, note string) json.RawMessage {
+	var hover map[string]json.RawMessage
+	if err := json.Unmarshal(result, &hover); err != nil || hover == nil {
+		return result
+	}
+
+	var contents interface{}
+	var markup MarkupContent
+	var list []json.RawMessage
+	var text string
+	switch raw := hover["contents"]; {
+	case json.Unmarshal(raw, &markup) == nil && markup.Kind != "":
+		markup.Value += "\n\n" + note
+		contents = markup
+	case json.Unmarshal(raw, &list) == nil:
+		contents = append(list, json.RawMessage(strconv.Quote(note)))
+	case json.Unmarshal(raw, &text) == nil:
+		contents = text + "\n\n" + note
+	default:
+		return result
+	}
+
+	data, err := marshalUnescaped(contents)
+	if err != nil {
+		return result
+	}
+	hover["contents"] = data
+	if data, err = marshalUnescaped(hover); err != nil {
+		return result
+	}
+	return data
+}
+
+// markedStringToMarkdown converts a MarkedString (string or {language, value}) to markdown
+func markedStringToMarkdown(raw json.RawMessage) (string, bool) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, true
+	}
+	var code struct {
+		Language string `json:"language"`
+		Value    string `json:"value"`
+	}
+	if err := json.Unmarshal(raw, &code); err == nil && code.Value != "" {
+		return "```" + code.Language + "\n" + code.Value + "\n```", true
+	}
+	return "", false
+}
+
+// NormalizeHoverMarkdown strips HTML and XML-doc markup, decodes entities and
+// collapses whitespace outside code fences, then caps the text at maxLength
+// bytes (0 for no cap), keeping an open code fence closed
+func NormalizeHoverMarkdown(text string, maxLength int) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	var b strings.Builder
+	segments := strings.Split(text, "```")
+	for i, segment := range segments {
+		if i > 0 {
+			b.WriteString("```")
+		}
+		if i%2 == 1 {
+			// Inside a code fence: keep as is apart from trailing blanks
+			b.WriteString(trimLineEnds(segment))
+			continue
+		}
+		b.WriteString(normalizeProse(segment))
+	}
+
+	normalized := strings.TrimSpace(blankLinesPattern.ReplaceAllString(b.String(), "\n\n"))
+	return truncateMarkdown(normalized, maxLength)
+}
+
+// normalizeProse cleans markdown text that is not inside a code fence
+func normalizeProse(text string) string {
+	for _, r := range xmlDocReplacements {
+		text = r.pattern.ReplaceAllString(text, r.replace)
+	}
+	text = htmlTagPattern.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+	text = blankRunPattern.ReplaceAllString(text, " ")
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// trimLineEnds removes trailing whitespace from each line
+func trimLineEnds(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// truncateMarkdown cuts text to maxLength bytes on a rune boundary, adds an
+// ellipsis and closes a code fence left open by the cut
+func truncateMarkdown(text string, maxLength int) string {
+	if maxLength <= 0 || len(text) <= maxLength {
+		return text
+	}
+
+	cut := maxLength
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	truncated := strings.TrimRight(text[:cut], " \t\n") + "…"
+	if strings.Count(truncated, "```")%2 == 1 {
+		truncated += "\n```"
+	}
+	return truncated
+}
+
+// hoverContextNote describes where the definition of a hovered symbol lives:
+// its object with type and ID, its source file and line, and the app owning
+// it, e.g. `**table 18 Customer** · src/Customer.Table.al:12 · app "Base" by
+// Pub v1.0.0.0`. app is the dependency package defining the symbol, nil for
+// the workspace. It returns "" if the definition is unknown.
+func hoverContextNote(definition json.RawMessage, app *AppManifest, w WrapperInterface) string {
+	uri, line, ok := firstDefinitionLocation(definition)
+	if !ok {
+		return ""
+	}
+
+	var parts []string
+	if app != nil {
+		if object, ok := packageLocationObject(uri, w.DependencyObjects(*app)); ok {
+			parts = append(parts, "**"+ALObject{Type: object.Type, ID: object.ID, Name: object.Name, Extends: object.Extends}.DisplayName()+"**")
+		}
+		parts = append(parts, filepath.Base(app.Path))
+		parts = append(parts, fmt.Sprintf("app %q by %s v%s", app.Name, app.Publisher, app.Version))
+		return strings.Join(parts, " · ")
+	}
+
+	path, err := FileURIToPath(uri)
+	if err != nil || !IsALFile(path) {
+		return ""
+	}
+	if object, ok := parseOutline(path).objectAt(line); ok {
+		parts = append(parts, "**"+object.DisplayName()+"**")
+	}
+	source := path
+	if rel, err := filepath.Rel(w.WorkspaceRoot(), path); err == nil && !strings.HasPrefix(rel, "..") {
+		source = filepath.ToSlash(rel)
+	}
+	parts = append(parts, fmt.Sprintf("%s:%d", source, line+1))
+	if projectRoot := GetProjectRoot(path); projectRoot != "" {
+		if app, err := readProjectApp(projectRoot); err == nil {
+			parts = append(parts, "app "+app.String())
+		}
+	}
+	return strings.Join(parts, " · ")
+}
@@ -0,0 +1,197 @@
+package wrapper
+
+import (
+	"bufio"
+	"time"
+)
+
+// The AL server holds 1-2 GB for big workspaces. With Idle.ShutdownMinutes
+// set, the wrapper stops it once no client message has arrived for that long
+// and nothing is in flight, keeping what it knows about the session (projects,
+// open documents, symbol index). The next client message starts a new server
+// and replays that state before the message is handled, as after an AL
+// extension update; documents are reopened from disk. The restart runs in the
+// background: client messages arriving meanwhile are held and handled in
+// order once the state is replayed, so reading from the client never stalls.
+// If the server cannot be started, the held requests are answered with the
+// error and the session ends.
+
+// idleCheckInterval is how often the idle time is checked
+const idleCheckInterval = time.Minute
+
+// idleExemptMethods are answered without starting a stopped server
+var idleExemptMethods = map[string]bool{
+	"exit":              true,
+	"shutdown":          true,
+	"$/cancelRequest":   true,
+	"$/setTrace":        true,
+	"al-wrapper/status": true,
+}
+
+// heldMessage is a client message held while the AL server is started again
+type heldMessage struct {
+	scope *requestScope
+	msg   *Message
+}
+
+// touchActivity records that a client message arrived
+func (w *ALLSPWrapper) touchActivity() {
+	w.lastActivity.Store(time.Now().UnixNano())
+}
+
+// superviseIdleTime stops the AL server each time it has been idle for the
+// configured period
+func (w *ALLSPWrapper) superviseIdleTime() {
+	ticker := time.NewTicker(idleCheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		w.stopIdleServer(time.Now())
+	}
+}
+
+// stopIdleServer stops the AL server if it has been idle long enough at now.
+// It reports whether the server was stopped.
+func (w *ALLSPWrapper) stopIdleServer(now time.Time) bool {
+	limit := time.Duration(w.Config().Idle.ShutdownMinutes) * time.Minute
+	if limit <= 0 || w.disabled.Load() {
+		return false
+	}
+
+	w.idleMu.Lock()
+	defer w.idleMu.Unlock()
+	idle := now.Sub(time.Unix(0, w.lastActivity.Load()))
+	if w.idleState != nil || idle < limit || !w.serverQuiet() {
+		return false
+	}
+
+	w.idleState = w.captureWarmState()
+	w.idleResumed = make(chan struct{})
+	w.idleResumeErr = nil
+	w.Log("AL LSP idle for %s: stopping it to reclaim memory (%d project(s), %d document(s) kept for the next request)",
+		idle.Round(time.Second), len(w.idleState.Projects), len(w.idleState.Documents))
+	w.stopServer()
+	return true
+}
+
+// serverQuiet reports whether the wrapper is initialized and has no work in
+// flight: no request waiting for the AL server, no queued document message
+// and no client request being handled, such as a build or workspace/symbol
+func (w *ALLSPWrapper) serverQuiet() bool {
+	w.initMu.Lock()
+	initialized := w.initialized
+	w.initMu.Unlock()
+	if !initialized {
+		return false
+	}
+
+	w.pendingMu.Lock()
+	pending := len(w.pendingReqs)
+	w.pendingMu.Unlock()
+	w.queueMu.Lock()
+	queued := len(w.docQueues)
+	w.queueMu.Unlock()
+	return pending == 0 && queued == 0 && w.inflightCount.Load() == 0
+}
+
+// serverIdleStopped reports whether the AL server is stopped for being idle
+func (w *ALLSPWrapper) serverIdleStopped() bool {
+	w.idleMu.Lock()
+	defer w.idleMu.Unlock()
+	return w.idleState != nil
+}
+
+// awaitIdleResume is called when reading from the AL server stops. If the
+// server read from stdout was stopped for being idle, it waits until a new
+// server is started and reports true, or returns the error starting it.
+func (w *ALLSPWrapper) awaitIdleResume(stdout *bufio.Reader) (bool, error) {
+	w.idleMu.Lock()
+	if w.idleState == nil {
+		w.idleMu.Unlock()
+		// The new server may already have been started
+		w.serverMu.Lock()
+		defer w.serverMu.Unlock()
+		return w.stdout != stdout, nil
+	}
+	resumed := w.idleResumed
+	w.idleMu.Unlock()
+
+	w.Log("AL LSP stopped for being idle; waiting for the next client message")
+	<-resumed
+	w.idleMu.Lock()
+	defer w.idleMu.Unlock()
+	if w.idleResumeErr != nil {
+		return false, w.idleResumeErr
+	}
+	return true, nil
+}
+
+// holdForIdleResume holds a client message while the AL server is stopped for
+// being idle, starting it again in the background for the first message held.
+// It reports whether the message was held.
+func (w *ALLSPWrapper) holdForIdleResume(scope *requestScope, msg *Message) bool {
+	if idleExemptMethods[msg.Method] {
+		return false
+	}
+
+	w.idleMu.Lock()
+	defer w.idleMu.Unlock()
+	if w.idleState == nil {
+		return false
+	}
+	w.idleHeld = append(w.idleHeld, heldMessage{scope: scope, msg: msg})
+	if len(w.idleHeld) == 1 {
+		scope.Log("Starting the AL LSP again for %s after it was stopped for being idle", msg.Method)
+		go w.resumeIdleServer(scope)
+	}
+	return true
+}
+
+// resumeIdleServer starts a new AL server after it was stopped for being idle,
+// replays the session state on it and handles the client messages held
+// meanwhile
+func (w *ALLSPWrapper) resumeIdleServer(scope WrapperInterface) {
+	start := time.Now()
+	w.idleMu.Lock()
+	state := w.idleState
+	w.idleMu.Unlock()
+
+	w.resetCircuits()
+	if err := w.startServer(); err != nil {
+		scope.Log("Failed to restart idle AL LSP: %v", err)
+		w.idleMu.Lock()
+		held := w.idleHeld
+		w.idleHeld = nil
+		w.idleResumeErr = err
+		close(w.idleResumed)
+		w.idleMu.Unlock()
+		for _, h := range held {
+			if h.msg.IsRequest() {
+				w.respond(h.scope, h.msg, NewErrorResponse(h.msg.ID, InternalError, "AL language server could not be restarted: "+err.Error()))
+			}
+		}
+		return
+	}
+	w.idleMu.Lock()
+	close(w.idleResumed)
+	w.idleMu.Unlock()
+
+	w.replayAfterRestart(state)
+	scope.Log("AL LSP resumed in %s", time.Since(start).Round(time.Millisecond))
+
+	// Messages are held until none are left, so they are handled in the
+	// order they arrived
+	for {
+		w.idleMu.Lock()
+		held := w.idleHeld
+		w.idleHeld = nil
+		if len(held) == 0 {
+			w.idleState = nil
+			w.idleMu.Unlock()
+			return
+		}
+		w.idleMu.Unlock()
+		for _, h := range held {
+			w.routeClientMessage(h.scope, h.msg)
+		}
+	}
+}
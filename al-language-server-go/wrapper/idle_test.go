@@ -0,0 +1,55 @@
+package wrapper
+
+import (
+	"testing"
+	"time"
+)
+
+// blockingHandler answers its method once released
+type blockingHandler struct {
+	method   string
+	started  chan struct{}
+	released chan struct{}
+}
+
+func (h *blockingHandler) ShouldHandle(method string) bool {
+	return method == h.method
+}
+
+func (h *blockingHandler) Handle(msg *Message, w WrapperInterface) (*Message, *Message) {
+	close(h.started)
+	<-h.released
+	return newResultMessage(msg.ID, []string{})
+}
+
+func TestInflightRequestBlocksIdleStop(t *testing.T) {
+	w, _, client := newTestWrapper()
+	cfg := DefaultConfig()
+	cfg.Idle.ShutdownMinutes = 1
+	w.config = cfg
+	w.initialized = true
+	w.touchActivity()
+
+	// workspace/symbol is not about a document, so no document queue holds it
+	handler := &blockingHandler{method: "workspace/symbol", started: make(chan struct{}), released: make(chan struct{})}
+	w.handlers = []Handler{handler}
+	w.routeClientMessage(w.newRequestScope(), testRequest(t, 1, "workspace/symbol", map[string]string{"query": "Customer"}))
+	<-handler.started
+
+	later := time.Now().Add(2 * time.Minute)
+	if w.stopIdleServer(later) {
+		t.Fatal("AL server stopped for being idle while a request was in flight")
+	}
+
+	close(handler.released)
+	deadline := time.Now().Add(2 * time.Second)
+	for len(client.messages(t)) == 0 || w.inflightCount.Load() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("request was not answered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !w.stopIdleServer(later) {
+		t.Error("AL server not stopped once the request was answered")
+	}
+}
@@ -0,0 +1,346 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FindObjectsByIDCommand lists the objects in the workspace and its
+// dependencies that occupy an object ID or ID range
+const FindObjectsByIDCommand = "al-wrapper.findObjectsById"
+
+// FindObjectsByIDArgs is the argument object of al-wrapper.findObjectsById.
+// The argument may also be the ID range itself, as a string or number.
+type FindObjectsByIDArgs struct {
+	// IDs is an object ID or range, e.g. "50100", "50100..50149" or "50100-50149"
+	IDs string `json:"ids"`
+	// Project is a file or folder URI/path inside the project whose
+	// dependencies are searched (defaults to the active project)
+	Project string `json:"project"`
+	// Type restricts the search to one object type, e.g. "table"
+	Type string `json:"type"`
+}
+
+// IDObject is an object occupying an ID of the searched range
+type IDObject struct {
+	Type string `json:"type"`
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	// Source is "workspace" for objects declared in the workspace's source
+	// files, or the dependency app declaring it
+	Source string `json:"source"`
+	// URI and Line (zero-based) locate declarations in the workspace
+	URI  string `json:"uri,omitempty"`
+	Line *int   `json:"line,omitempty"`
+}
+
+// FindObjectsByIDResult is returned by al-wrapper.findObjectsById
+type FindObjectsByIDResult struct {
+	From    int        `json:"from"`
+	To      int        `json:"to"`
+	Objects []IDObject `json:"objects"`
+	// Apps lists the dependencies whose declared ID ranges overlap the range,
+	// including ones without objects in it
+	Apps []AppManifest `json:"apps"`
+}
+
+// symbolReferenceObject is an object entry of an app's SymbolReference.json
+type symbolReferenceObject struct {
+	ID   int    `json:"Id"`
+	Name string `json:"Name"`
+	// TargetObject is the extended object of extension objects
+	TargetObject string `json:"TargetObject"`
+}
+
+// symbolReferenceNamespace holds the object lists of SymbolReference.json,
+// at the top level and in each namespace
+type symbolReferenceNamespace struct {
+	Tables                  []symbolReferenceObject    `json:"Tables"`
+	TableExtensions         []symbolReferenceObject    `json:"TableExtensions"`
+	Pages                   []symbolReferenceObject    `json:"Pages"`
+	PageExtensions          []symbolReferenceObject    `json:"PageExtensions"`
+	Codeunits               []symbolReferenceObject    `json:"Codeunits"`
+	Reports                 []symbolReferenceObject    `json:"Reports"`
+	ReportExtensions        []symbolReferenceObject    `json:"ReportExtensions"`
+	Queries                 []symbolReferenceObject    `json:"Queries"`
+	XmlPorts                []symbolReferenceObject    `json:"XmlPorts"`
+	EnumTypes               []symbolReferenceObject    `json:"EnumTypes"`
+	EnumExtensionTypes      []symbolReferenceObject    `json:"EnumExtensionTypes"`
+	PermissionSets          []symbolReferenceObject    `json:"PermissionSets"`
+	PermissionSetExtensions []symbolReferenceObject    `json:"PermissionSetExtensions"`
+	Namespaces              []symbolReferenceNamespace `json:"Namespaces"`
+}
+
+// AppObject is an object with an ID declared by a dependency app
+type AppObject struct {
+	Type string `json:"type"`
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	// Extends is the extended object's name for extension objects
+	Extends string `json:"extends,omitempty"`
+}
+
+// collect appends the namespace's objects, and those of nested namespaces
+func (n *symbolReferenceNamespace) collect(objects []AppObject) []AppObject {
+	lists := []struct {
+		typ     string
+		entries []symbolReferenceObject
+	}{
+		{"table", n.Tables}, {"tableextension", n.TableExtensions},
+		{"page", n.Pages}, {"pageextension", n.PageExtensions},
+		{"codeunit", n.Codeunits},
+		{"report", n.Reports}, {"reportextension", n.ReportExtensions},
+		{"query", n.Queries}, {"xmlport", n.XmlPorts},
+		{"enum", n.EnumTypes}, {"enumextension", n.EnumExtensionTypes},
+		{"permissionset", n.PermissionSets}, {"permissionsetextension", n.PermissionSetExtensions},
+	}
+	for _, list := range lists {
+		for _, entry := range list.entries {
+			objects = append(objects, AppObject{Type: list.typ, ID: entry.ID, Name: entry.Name, Extends: entry.TargetObject})
+		}
+	}
+	for i := range n.Namespaces {
+		objects = n.Namespaces[i].collect(objects)
+	}
+	return objects
+}
+
+// ReadAppObjects reads the objects declared by an .app file from its
+// SymbolReference.json
+func ReadAppObjects(path string) ([]AppObject, error) {
+	pkg, err := OpenAppFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer pkg.Close()
+
+	var symbols symbolReferenceNamespace
+	if err := pkg.decodeSymbols(&symbols); err != nil {
+		return nil, err
+	}
+	return symbols.collect([]AppObject{}), nil
+}
+
+// objects returns the objects of a package read by packages, reading its
+// SymbolReference.json on first use
+func (idx *packageIndex) objects(app AppManifest, logf func(format string, args ...interface{})) []AppObject {
+	idx.mu.Lock()
+	cached := idx.files[app.Path]
+	if cached != nil && cached.objects != nil {
+		idx.mu.Unlock()
+		return cached.objects
+	}
+	idx.mu.Unlock()
+
+	objects, err := ReadAppObjects(app.Path)
+	if err != nil {
+		logf("Skipping package objects: %v", err)
+		return nil
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if cached != nil && idx.files[app.Path] == cached {
+		cached.objects = objects
+	}
+	return objects
+}
+
+// parseIDRange parses "50100", "50100..50149" or "50100-50149"
+func parseIDRange(text string) (int, int, error) {
+	text = strings.TrimSpace(text)
+	fromText, toText, found := strings.Cut(text, "..")
+	if !found {
+		fromText, toText, found = strings.Cut(text, "-")
+	}
+	if !found {
+		toText = fromText
+	}
+	from, err := strconv.Atoi(strings.TrimSpace(fromText))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid object ID %q", fromText)
+	}
+	to, err := strconv.Atoi(strings.TrimSpace(toText))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid object ID %q", toText)
+	}
+	if from <= 0 || to < from {
+		return 0, 0, fmt.Errorf("invalid ID range %q", text)
+	}
+	return from, to, nil
+}
+
+// decodeFindObjectsByIDArgs accepts the argument object or a bare ID range
+func decodeFindObjectsByIDArgs(args []json.RawMessage) (FindObjectsByIDArgs, error) {
+	var cmdArgs FindObjectsByIDArgs
+	if len(args) == 0 || string(args[0]) == "null" {
+		return cmdArgs, fmt.Errorf("missing ID range")
+	}
+	var number int
+	if json.Unmarshal(args[0], &number) == nil {
+		cmdArgs.IDs = strconv.Itoa(number)
+		return cmdArgs, nil
+	}
+	if json.Unmarshal(args[0], &cmdArgs.IDs) == nil {
+		return cmdArgs, nil
+	}
+	err := decodeCommandArgs(args, &cmdArgs)
+	return cmdArgs, err
+}
+
+// workspaceProjects returns the AL projects (folders with app.json) under a
+// workspace root, or just the given project when there is no workspace root
+func workspaceProjects(workspaceRoot string, project string) []string {
+	if workspaceRoot == "" {
+		if project == "" {
+			return nil
+		}
+		return []string{project}
+	}
+	var roots []string
+	walkDir(workspaceRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if path != workspaceRoot && (strings.HasPrefix(name, ".") || name == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.EqualFold(d.Name(), "app.json") {
+			roots = append(roots, NormalizePath(filepath.Dir(path)))
+		}
+		return nil
+	})
+	if project != "" && !containsString(roots, project) {
+		roots = append(roots, project)
+	}
+	sort.Strings(roots)
+	return roots
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// idRangesOverlap reports whether an app declares IDs in from..to. Apps
+// without declared ranges may use any ID.
+func idRangesOverlap(app AppManifest, from, to int) bool {
+	if len(app.IDRanges) == 0 {
+		return true
+	}
+	for _, r := range app.IDRanges {
+		if r.From <= to && from <= r.To {
+			return true
+		}
+	}
+	return false
+}
+
+// FindObjectsByID lists the objects with an ID in from..to declared in the
+// workspace's source files and in the dependencies of project. objectType
+// restricts the search to one object type if it is not empty.
+func FindObjectsByID(workspaceRoot string, project string, from, to int, objectType string, w WrapperInterface) FindObjectsByIDResult {
+	result := FindObjectsByIDResult{From: from, To: to, Objects: []IDObject{}, Apps: []AppManifest{}}
+	matches := func(typ string, id int) bool {
+		return id >= from && id <= to && (objectType == "" || strings.EqualFold(typ, objectType))
+	}
+
+	for _, root := range workspaceProjects(workspaceRoot, project) {
+		objects, _ := ScanProjectObjects(root)
+		for i, o := range objects {
+			if matches(o.Type, o.ID) {
+				result.Objects = append(result.Objects, IDObject{
+					Type: o.Type, ID: o.ID, Name: o.Name, Source: "workspace",
+					URI: PathToFileURI(o.Path), Line: &objects[i].Line,
+				})
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, app := range w.DependencyPackages(project) {
+		// Packages are sorted newest first; older versions of an app are skipped
+		key := app.ID
+		if key == "" {
+			key = app.Path
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if !idRangesOverlap(app, from, to) {
+			continue
+		}
+		result.Apps = append(result.Apps, app)
+		for _, o := range w.DependencyObjects(app) {
+			if matches(o.Type, o.ID) {
+				result.Objects = append(result.Objects, IDObject{
+					Type: o.Type, ID: o.ID, Name: o.Name,
+					Source: fmt.Sprintf("%s by %s v%s", app.Name, app.Publisher, app.Version),
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(result.Objects, func(i, j int) bool {
+		a, b := result.Objects[i], result.Objects[j]
+		if a.ID != b.ID {
+			return a.ID < b.ID
+		}
+		return objectTypeOrder(a.Type) < objectTypeOrder(b.Type)
+	})
+	return result
+}
+
+// objectTypeOrder returns the presentation order of an object type
+func objectTypeOrder(typ string) int {
+	for i, t := range alObjectTypes {
+		if t == typ {
+			return i
+		}
+	}
+	return len(alObjectTypes)
+}
+
+// DependencyObjects returns the objects declared by a dependency package
+func (w *ALLSPWrapper) DependencyObjects(app AppManifest) []AppObject {
+	return w.packages.objects(app, w.Log)
+}
+
+// WorkspaceRoot returns the root folder of the client's workspace
+func (w *ALLSPWrapper) WorkspaceRoot() string {
+	return w.workspaceRoot
+}
+
+func findObjectsByIDCommand(msg *Message, args []json.RawMessage, w WrapperInterface) (*Message, *Message) {
+	cmdArgs, err := decodeFindObjectsByIDArgs(args)
+	if err != nil {
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "Invalid "+FindObjectsByIDCommand+" arguments: "+err.Error())
+	}
+	from, to, err := parseIDRange(cmdArgs.IDs)
+	if err != nil {
+		return nil, NewErrorResponse(msg.ID, InvalidParams, err.Error())
+	}
+
+	project := resolveCommandProject(cmdArgs.Project, w)
+	if project == "" && w.WorkspaceRoot() == "" {
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "No AL project found to search")
+	}
+
+	result := FindObjectsByID(w.WorkspaceRoot(), project, from, to, cmdArgs.Type, w)
+	w.Log("Found %d object(s) with IDs %d..%d", len(result.Objects), from, to)
+	return newResultMessage(msg.ID, result)
+}
@@ -0,0 +1,210 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// textDocument/implementation is forwarded to the AL server. When the server
+// does not implement it, or finds nothing, implementations of AL interfaces
+// are found from the project sources: the interface (or interface procedure)
+// at the position, or at its definition, is looked up in the implements
+// clauses of the project's codeunits and enums. For an interface the
+// implementing objects are returned, for an interface procedure the
+// procedures of the same name in the implementing codeunits.
+
+// implementsPattern matches the implements clause of an object declaration
+var implementsPattern = regexp.MustCompile(`(?i)\bimplements\s+(.+)$`)
+
+// ImplementationHandler handles textDocument/implementation
+type ImplementationHandler struct{}
+
+func (h *ImplementationHandler) ShouldHandle(method string) bool {
+	return method == "textDocument/implementation"
+}
+
+func (h *ImplementationHandler) Handle(msg *Message, w WrapperInterface) (*Message, *Message) {
+	var params TextDocumentPositionParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		w.Log("Failed to parse implementation params: %v", err)
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "Invalid parameters")
+	}
+
+	filePath, err := FileURIToPath(params.TextDocument.URI)
+	if err != nil {
+		w.Log("Failed to convert URI: %v", err)
+		return nil, NewErrorResponse(msg.ID, InternalError, "Invalid file URI")
+	}
+
+	// Ensure the file is opened
+	if err := w.EnsureFileOpened(filePath); err != nil {
+		w.Log("Failed to open file: %v", err)
+		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	}
+
+	// Ensure project is initialized, or degrade to the file alone
+	if errResp := ensureProjectForRequest(msg, filePath, w); errResp != nil {
+		return nil, errResp
+	}
+
+	// Forward to AL LSP
+	response, err := w.SendRequestToLSP("textDocument/implementation", params)
+	if err != nil {
+		w.Log("Failed to send implementation request: %v", err)
+		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	}
+
+	notImplemented := response.Error != nil && response.Error.Code == MethodNotFound
+	if response.Error != nil && !notImplemented {
+		return nil, &Message{
+			JSONRPC: "2.0",
+			ID:      msg.ID,
+			Error:   response.Error,
+		}
+	}
+	if !notImplemented && !isEmptyResult(response.Result) {
+		return &Message{
+			JSONRPC: "2.0",
+			ID:      msg.ID,
+			Result:  response.Result,
+		}, nil
+	}
+
+	// Fall back to the implements clauses in the project sources
+	locations := interfaceImplementations(params, filePath, w)
+	w.Log("Found %d interface implementation(s) in the project sources", len(locations))
+	data, err := json.Marshal(locations)
+	if err != nil {
+		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	}
+	return newResultMessage(msg.ID, markProvenance(data, msg.Method, provenanceImplementsClauses, w))
+}
+
+// interfaceImplementations finds the implementations of the interface or
+// interface procedure at a position, or at its definition
+func interfaceImplementations(params TextDocumentPositionParams, filePath string, w WrapperInterface) []Location {
+	iface, procedure, ok := interfaceAt(filePath, params.Position.Line)
+	if !ok {
+		method, definitionParams := definitionRequest(params, w)
+		response, err := w.SendRequestToLSP(method, definitionParams)
+		if err != nil || response.Error != nil {
+			return []Location{}
+		}
+		uri, line, found := firstDefinitionLocation(response.Result)
+		if !found {
+			return []Location{}
+		}
+		path, err := FileURIToPath(uri)
+		if err != nil {
+			return []Location{}
+		}
+		if iface, procedure, ok = interfaceAt(path, line); !ok {
+			return []Location{}
+		}
+	}
+	return findImplementations(w.ProjectSymbols(NormalizePath(GetProjectRoot(filePath))), iface, procedure)
+}
+
+// interfaceAt returns the interface declared in a file at a line, and the
+// name of the interface procedure declared there ("" on the interface itself)
+func interfaceAt(path string, line int) (string, string, bool) {
+	outline := parseOutline(path)
+	obj, ok := outline.objectAt(line)
+	if !ok || obj.Type != "interface" {
+		return "", "", false
+	}
+	if line == obj.Line {
+		return obj.Name, "", true
+	}
+	for _, member := range outline.members {
+		if member.kind == "procedure" && member.startLine <= line && line <= member.endLine {
+			return obj.Name, member.name, true
+		}
+	}
+	return "", "", false
+}
+
+// findImplementations returns the codeunits and enums implementing an
+// interface or, for a procedure, the procedures of the implementing codeunits
+func findImplementations(symbols []IndexedSymbol, iface string, procedure string) []Location {
+	objectsByPath := make(map[string][]IndexedSymbol)
+	methodsByPath := make(map[string][]IndexedSymbol)
+	for _, symbol := range symbols {
+		switch symbol.Kind {
+		case alObjectSymbolKinds["codeunit"], alObjectSymbolKinds["enum"]:
+			objectsByPath[symbol.Path] = append(objectsByPath[symbol.Path], symbol)
+		case symbolKindMethod:
+			methodsByPath[symbol.Path] = append(methodsByPath[symbol.Path], symbol)
+		}
+	}
+
+	locations := []Location{}
+	for path, objects := range objectsByPath {
+		lines := readSourceLines(path)
+		for _, obj := range objects {
+			if obj.Line >= len(lines) || !implementsInterface(lines[obj.Line], iface) {
+				continue
+			}
+			if procedure == "" {
+				locations = append(locations, obj.SymbolInformation().Location)
+				continue
+			}
+			if obj.Kind != alObjectSymbolKinds["codeunit"] {
+				continue
+			}
+			for _, method := range methodsByPath[path] {
+				if strings.EqualFold(method.Name, procedure) && objectOfLine(objects, method.Line) == obj.Line {
+					locations = append(locations, method.SymbolInformation().Location)
+				}
+			}
+		}
+	}
+	sort.Slice(locations, func(i, j int) bool {
+		if locations[i].URI != locations[j].URI {
+			return locations[i].URI < locations[j].URI
+		}
+		return locations[i].Range.Start.Line < locations[j].Range.Start.Line
+	})
+	return locations
+}
+
+// implementsInterface reports whether an object declaration line lists an
+// interface in its implements clause
+func implementsInterface(declaration string, iface string) bool {
+	code, _ := stripALComments(declaration, false)
+	m := implementsPattern.FindStringSubmatch(code)
+	if m == nil {
+		return false
+	}
+	clause, _, _ := strings.Cut(m[1], "{")
+	for _, name := range strings.Split(clause, ",") {
+		if strings.EqualFold(unquoteALName(strings.TrimSpace(name)), iface) {
+			return true
+		}
+	}
+	return false
+}
+
+// objectOfLine returns the declaration line of the object containing a line,
+// or -1
+func objectOfLine(objects []IndexedSymbol, line int) int {
+	found := -1
+	for _, obj := range objects {
+		if obj.Line <= line && obj.Line > found {
+			found = obj.Line
+		}
+	}
+	return found
+}
+
+// readSourceLines returns the lines of a source file, nil if it cannot be read
+func readSourceLines(path string) []string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	return strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+}
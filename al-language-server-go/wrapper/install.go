@@ -0,0 +1,396 @@
+package wrapper
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// The install subcommand makes the wrapper usable without VS Code: it
+// downloads the AL extension VSIX from the Visual Studio Marketplace and
+// extracts its language server into a wrapper-managed directory that
+// FindALExtension also searches.
+//
+// The wrapper does not check the Marketplace signature of the VSIX, and the
+// manifest inside it is only an identity claim. What makes a VSIX trusted is
+// its SHA-256: the caller has to give the expected hash, which is compared
+// with the file before anything is extracted and recorded in the installed
+// directory (installRecordFile).
+
+const (
+	// alExtensionPublisher and alExtensionName identify the AL extension on the Marketplace
+	alExtensionPublisher = "ms-dynamics-smb"
+	alExtensionName      = "al"
+	// marketplaceQueryURL answers extension metadata queries
+	marketplaceQueryURL = "https://marketplace.visualstudio.com/_apis/public/gallery/extensionquery"
+	// marketplaceDownloadURL serves a VSIX by publisher, extension and version
+	marketplaceDownloadURL = "https://marketplace.visualstudio.com/_apis/public/gallery/publishers/%s/vsextensions/%s/%s/vspackage"
+	// installLockTimeout bounds how long an install waits for a concurrent one
+	installLockTimeout = 30 * time.Second
+	// installRecordFile holds the SHA-256 of the VSIX an extension directory
+	// was installed from
+	installRecordFile = "vsix.sha256"
+)
+
+// extensionVersionPattern matches the X.Y.Z versions used in extension directory names
+var extensionVersionPattern = regexp.MustCompile(`^\d+\.\d+\.\d+$`)
+
+// InstallOptions selects what InstallALExtension installs
+type InstallOptions struct {
+	// Version is the AL extension version to install ("" for the latest)
+	Version string
+	// VSIXPath installs from a local VSIX file instead of downloading
+	VSIXPath string
+	// SHA256 is the expected hex SHA-256 of the VSIX (required)
+	SHA256 string
+	// Force replaces an existing installation of the same version
+	Force bool
+	// Progress receives progress messages (may be nil)
+	Progress func(format string, args ...interface{})
+}
+
+// InstallResult describes an installed AL extension
+type InstallResult struct {
+	Version string
+	Path    string
+	// SHA256 is the recorded SHA-256 of the VSIX the version was installed
+	// from ("" for an installation without a record)
+	SHA256 string
+	// AlreadyInstalled is set when the version was present and Force was not given
+	AlreadyInstalled bool
+}
+
+// GetManagedExtensionsDir returns the directory holding AL extensions
+// installed by the wrapper
+func GetManagedExtensionsDir() string {
+	return filepath.Join(GetDataDir(), "extensions")
+}
+
+// InstallALExtension downloads (or reads) an AL extension VSIX, checks its
+// SHA-256 against the expected one and extracts its language server into the
+// managed extensions directory
+func InstallALExtension(opts InstallOptions) (*InstallResult, error) {
+	progress := opts.Progress
+	if progress == nil {
+		progress = func(string, ...interface{}) {}
+	}
+
+	managedDir := GetManagedExtensionsDir()
+	release, err := AcquireCacheLock(managedDir, installLockTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	version := opts.Version
+	vsixPath := opts.VSIXPath
+	if vsixPath == "" {
+		if version == "" {
+			progress("Looking up the latest AL extension version...")
+			if version, err = latestALExtensionVersion(); err != nil {
+				return nil, err
+			}
+		}
+		if !extensionVersionPattern.MatchString(version) {
+			return nil, fmt.Errorf("invalid version %q: expected X.Y.Z", version)
+		}
+		if target := extensionDir(managedDir, version); !opts.Force && dirExists(target) {
+			return &InstallResult{Version: version, Path: target, SHA256: recordedSHA256(target), AlreadyInstalled: true}, nil
+		}
+
+		progress("Downloading AL extension %s...", version)
+		vsixPath = filepath.Join(managedDir, fmt.Sprintf(".download-%s-%d.vsix", version, os.Getpid()))
+		defer os.Remove(vsixPath)
+		if err := downloadVSIX(version, vsixPath); err != nil {
+			return nil, err
+		}
+	}
+
+	sum, err := fileSHA256(vsixPath)
+	if err != nil {
+		return nil, err
+	}
+	if opts.SHA256 == "" {
+		return nil, fmt.Errorf("the SHA-256 of the VSIX is %s; compare it with a hash from a source you trust "+
+			"and install again with --sha256 %s (the wrapper does not check the Marketplace signature)", sum, sum)
+	}
+	if !strings.EqualFold(opts.SHA256, sum) {
+		return nil, fmt.Errorf("SHA-256 mismatch for %s: got %s, expected %s", vsixPath, sum, opts.SHA256)
+	}
+
+	archive, err := zip.OpenReader(vsixPath)
+	if err != nil {
+		return nil, fmt.Errorf("not a valid VSIX: %w", err)
+	}
+	defer archive.Close()
+
+	manifestVersion, err := checkVSIXContents(&archive.Reader)
+	if err != nil {
+		return nil, err
+	}
+	if version != "" && manifestVersion != version {
+		return nil, fmt.Errorf("VSIX contains AL extension %s, expected %s", manifestVersion, version)
+	}
+	version = manifestVersion
+
+	target := extensionDir(managedDir, version)
+	if !opts.Force && dirExists(target) {
+		return &InstallResult{Version: version, Path: target, SHA256: recordedSHA256(target), AlreadyInstalled: true}, nil
+	}
+
+	progress("Extracting AL extension %s to %s...", version, target)
+	if err := extractVSIX(&archive.Reader, target, sum); err != nil {
+		return nil, err
+	}
+	return &InstallResult{Version: version, Path: target, SHA256: sum}, nil
+}
+
+// extensionDir returns the directory of an installed AL extension version,
+// named like the VS Code extension directory so FindALExtension recognizes it
+func extensionDir(managedDir, version string) string {
+	return filepath.Join(managedDir, alExtensionPublisher+"."+alExtensionName+"-"+version)
+}
+
+// dirExists reports whether path is an existing directory
+func dirExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// newInstallRequest creates a Marketplace request identifying the wrapper
+func newInstallRequest(method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "al-lsp-wrapper/"+Version)
+	return req, nil
+}
+
+// latestALExtensionVersion asks the Marketplace for the newest AL extension version
+func latestALExtensionVersion() (string, error) {
+	query := map[string]interface{}{
+		"filters": []interface{}{map[string]interface{}{
+			"criteria": []interface{}{map[string]interface{}{
+				"filterType": 7, // extension name
+				"value":      alExtensionPublisher + "." + alExtensionName,
+			}},
+		}},
+		"flags": 0x1 | 0x200, // include versions, latest version only
+	}
+	body, err := json.Marshal(query)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := newInstallRequest(http.MethodPost, marketplaceQueryURL, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json;api-version=3.0-preview.1")
+
+	resp, err := (&http.Client{Timeout: 30 * time.Second}).Do(req)
+	if err != nil {
+		return "", fmt.Errorf("Marketplace query failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Marketplace query failed: %s", resp.Status)
+	}
+
+	var result struct {
+		Results []struct {
+			Extensions []struct {
+				Versions []struct {
+					Version string `json:"version"`
+				} `json:"versions"`
+			} `json:"extensions"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("invalid Marketplace response: %w", err)
+	}
+	for _, r := range result.Results {
+		for _, ext := range r.Extensions {
+			for _, v := range ext.Versions {
+				if extensionVersionPattern.MatchString(v.Version) {
+					return v.Version, nil
+				}
+			}
+		}
+	}
+	return "", fmt.Errorf("the Marketplace returned no versions of %s.%s", alExtensionPublisher, alExtensionName)
+}
+
+// downloadVSIX downloads an AL extension version to dest
+func downloadVSIX(version, dest string) error {
+	url := fmt.Sprintf(marketplaceDownloadURL, alExtensionPublisher, alExtensionName, version)
+	req, err := newInstallRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := (&http.Client{Timeout: 10 * time.Minute}).Do(req)
+	if err != nil {
+		return fmt.Errorf("download failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download of AL extension %s failed: %s", version, resp.Status)
+	}
+
+	f, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		return fmt.Errorf("download failed: %w", err)
+	}
+	return f.Close()
+}
+
+// fileSHA256 returns the hex SHA-256 of a file
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// checkVSIXContents checks that a VSIX says it is the AL extension and ships
+// a language server for this platform, returning its version. This catches
+// the wrong file, not a forged one: the manifest is whatever the VSIX says.
+func checkVSIXContents(archive *zip.Reader) (string, error) {
+	var manifest struct {
+		Metadata struct {
+			Identity struct {
+				ID        string `xml:"Id,attr"`
+				Version   string `xml:"Version,attr"`
+				Publisher string `xml:"Publisher,attr"`
+			} `xml:"Identity"`
+		} `xml:"Metadata"`
+	}
+
+	found := false
+	hasServer := false
+	serverName := platformExecutableName(runtime.GOOS)
+	for _, f := range archive.File {
+		switch {
+		case f.Name == "extension.vsixmanifest":
+			rc, err := f.Open()
+			if err != nil {
+				return "", err
+			}
+			err = xml.NewDecoder(rc).Decode(&manifest)
+			rc.Close()
+			if err != nil {
+				return "", fmt.Errorf("invalid extension.vsixmanifest: %w", err)
+			}
+			found = true
+		case strings.HasPrefix(f.Name, "extension/bin/") && path.Base(f.Name) == serverName:
+			hasServer = true
+		}
+	}
+
+	identity := manifest.Metadata.Identity
+	if !found {
+		return "", fmt.Errorf("not a VSIX: extension.vsixmanifest is missing")
+	}
+	if !strings.EqualFold(identity.Publisher, alExtensionPublisher) || !strings.EqualFold(identity.ID, alExtensionName) {
+		return "", fmt.Errorf("VSIX is %s.%s, not the AL extension", identity.Publisher, identity.ID)
+	}
+	if !extensionVersionPattern.MatchString(identity.Version) {
+		return "", fmt.Errorf("VSIX has unexpected version %q", identity.Version)
+	}
+	if !hasServer {
+		return "", fmt.Errorf("AL extension %s has no %s for %s", identity.Version, serverName, runtime.GOOS)
+	}
+	return identity.Version, nil
+}
+
+// extractVSIX extracts the language server (extension/bin) and package.json
+// of a VSIX into target, with the VSIX's SHA-256 in installRecordFile,
+// replacing it atomically
+func extractVSIX(archive *zip.Reader, target string, sum string) error {
+	tmp := target + fmt.Sprintf(".tmp-%d", os.Getpid())
+	os.RemoveAll(tmp)
+	defer os.RemoveAll(tmp)
+
+	for _, f := range archive.File {
+		rel := strings.TrimPrefix(f.Name, "extension/")
+		if rel == f.Name || (rel != "package.json" && !strings.HasPrefix(rel, "bin/")) || strings.HasSuffix(rel, "/") {
+			continue
+		}
+		dest := filepath.Join(tmp, filepath.FromSlash(rel))
+		if !strings.HasPrefix(dest, tmp+string(filepath.Separator)) {
+			return fmt.Errorf("VSIX entry %q escapes the target directory", f.Name)
+		}
+		if err := extractZipFile(f, dest); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(filepath.Join(tmp, installRecordFile), []byte(sum+"\n"), 0644); err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(target); err != nil {
+		return err
+	}
+	return os.Rename(tmp, target)
+}
+
+// recordedSHA256 returns the SHA-256 recorded for an installed extension
+// directory, or "" if it has none
+func recordedSHA256(target string) string {
+	data, err := os.ReadFile(filepath.Join(target, installRecordFile))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// extractZipFile writes one archive entry to dest. Files under bin are made
+// executable, as VSIX archives do not carry Unix permissions.
+func extractZipFile(f *zip.File, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	// Reading to the end verifies the entry's CRC-32
+	if _, err := io.Copy(out, rc); err != nil {
+		out.Close()
+		return fmt.Errorf("extracting %s: %w", f.Name, err)
+	}
+	return out.Close()
+}
@@ -2,6 +2,7 @@ package wrapper
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -135,6 +136,54 @@ func NewErrorResponse(id *json.RawMessage, code int, message string) *Message {
 
 // ReadMessage reads a single LSP message from the reader
 func ReadMessage(reader *bufio.Reader) (*Message, error) {
+	content, err := readContent(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse JSON
+	var msg Message
+	if err := json.Unmarshal(content, &msg); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON-RPC message: %w", err)
+	}
+
+	return &msg, nil
+}
+
+// ReadMessages reads one LSP message from the reader, which is either a single
+// JSON-RPC message or a batch (an array of messages). Batch elements that are
+// not messages are returned as nil. batch reports whether it was a batch.
+func ReadMessages(reader *bufio.Reader) (msgs []*Message, batch bool, err error) {
+	content, err := readContent(reader)
+	if err != nil {
+		return nil, false, err
+	}
+
+	trimmed := bytes.TrimSpace(content)
+	if len(trimmed) == 0 || trimmed[0] != '[' {
+		var msg Message
+		if err := json.Unmarshal(content, &msg); err != nil {
+			return nil, false, fmt.Errorf("failed to parse JSON-RPC message: %w", err)
+		}
+		return []*Message{&msg}, false, nil
+	}
+
+	var elements []json.RawMessage
+	if err := json.Unmarshal(content, &elements); err != nil {
+		return nil, true, fmt.Errorf("failed to parse JSON-RPC batch: %w", err)
+	}
+	msgs = make([]*Message, len(elements))
+	for i, element := range elements {
+		var msg Message
+		if json.Unmarshal(element, &msg) == nil && (msg.Method != "" || msg.ID != nil) {
+			msgs[i] = &msg
+		}
+	}
+	return msgs, true, nil
+}
+
+// readContent reads the headers and content of one LSP message
+func readContent(reader *bufio.Reader) ([]byte, error) {
 	// Read headers until empty line
 	var contentLength int
 	for {
@@ -165,18 +214,10 @@ func ReadMessage(reader *bufio.Reader) (*Message, error) {
 
 	// Read the content
 	content := make([]byte, contentLength)
-	_, err := io.ReadFull(reader, content)
-	if err != nil {
+	if _, err := io.ReadFull(reader, content); err != nil {
 		return nil, err
 	}
-
-	// Parse JSON
-	var msg Message
-	if err := json.Unmarshal(content, &msg); err != nil {
-		return nil, fmt.Errorf("failed to parse JSON-RPC message: %w", err)
-	}
-
-	return &msg, nil
+	return content, nil
 }
 
 // WriteMessage writes a single LSP message to the writer
@@ -219,4 +260,20 @@ const (
 	ServerNotInitialized = -32002
 	UnknownErrorCode     = -32001
 	RequestCancelled     = -32800
+	ContentModified      = -32801
+	RequestFailed        = -32803
 )
+
+// LSP message types for window/showMessage and window/logMessage
+const (
+	MessageTypeError   = 1
+	MessageTypeWarning = 2
+	MessageTypeInfo    = 3
+	MessageTypeLog     = 4
+)
+
+// LogMessageParams represents window/logMessage and window/showMessage parameters
+type LogMessageParams struct {
+	Type    int    `json:"type"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,149 @@
+package wrapper
+
+import (
+	_ "embed"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+)
+
+// The AL server gives no hover for most keywords and often none for the
+// built-in methods of Record, Dialog and the other system types. When its
+// hover is empty and hover.offlineDocs is on, the wrapper answers from a small
+// language reference bundled into the binary (aldocs.json): the syntax and a
+// one-paragraph summary of the keyword, method, function or type under the
+// cursor. A method after a dot prefers the entry of the type named before the
+// dot (Page.Run, Codeunit.Run), and otherwise the Record method.
+
+//go:embed aldocs.json
+var alDocsData []byte
+
+// alDoc is an entry of the bundled AL language reference
+type alDoc struct {
+	Name string `json:"name"`
+	// Kind is "keyword", "method", "function" or "type"
+	Kind string `json:"kind"`
+	// On is the type declaring a method or function, e.g. Record or Dialog
+	On      string `json:"on,omitempty"`
+	Syntax  string `json:"syntax"`
+	Summary string `json:"summary"`
+}
+
+var (
+	alDocsOnce sync.Once
+	// alDocs maps lower-case names to their entries
+	alDocs map[string][]alDoc
+)
+
+// loadALDocs parses the bundled reference on first use
+func loadALDocs() map[string][]alDoc {
+	alDocsOnce.Do(func() {
+		var entries []alDoc
+		json.Unmarshal(alDocsData, &entries)
+		alDocs = make(map[string][]alDoc, len(entries))
+		for _, entry := range entries {
+			key := strings.ToLower(entry.Name)
+			alDocs[key] = append(alDocs[key], entry)
+		}
+	})
+	return alDocs
+}
+
+// lookupALDoc returns the entry for a name; qualifier is the identifier
+// before the dot of a member access, empty if there is none
+func lookupALDoc(name string, qualifier string) (alDoc, bool) {
+	entries := loadALDocs()[strings.ToLower(name)]
+	if len(entries) == 0 {
+		return alDoc{}, false
+	}
+	if qualifier != "" {
+		var best *alDoc
+		for i := range entries {
+			entry := &entries[i]
+			if entry.Kind != "method" && entry.Kind != "function" {
+				continue
+			}
+			if strings.EqualFold(entry.On, unquoteALName(qualifier)) {
+				return *entry, true
+			}
+			if best == nil || entry.On == "Record" {
+				best = entry
+			}
+		}
+		if best != nil {
+			return *best, true
+		}
+		return alDoc{}, false
+	}
+	for _, entry := range entries {
+		if entry.Kind != "method" {
+			return entry, true
+		}
+	}
+	return alDoc{}, false
+}
+
+// keywordHover returns a hover from the bundled reference for the word at a
+// position of a file, false if the reference has no entry for it
+func keywordHover(filePath string, pos Position) (json.RawMessage, bool) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, false
+	}
+	r, name, ok := wordAt(content, pos)
+	if !ok || strings.HasPrefix(name, `"`) {
+		return nil, false
+	}
+	doc, ok := lookupALDoc(name, wordQualifier(content, r.Start))
+	if !ok {
+		return nil, false
+	}
+
+	text := "```al\n" + doc.Syntax + "\n```\n" + doc.Summary
+	hover := HoverResponse{Contents: MarkupContent{Kind: "markdown", Value: text}, Range: &r}
+	data, err := marshalUnescaped(hover)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// wordQualifier returns the identifier before the dot in front of a position,
+// e.g. Rec for Rec.SetRange, or "" if no dot precedes it
+func wordQualifier(content []byte, start Position) string {
+	lineStart := positionOffset(content, Position{Line: start.Line})
+	prefix := strings.TrimRight(string(content[lineStart:positionOffset(content, start)]), " \t")
+	if !strings.HasSuffix(prefix, ".") {
+		return ""
+	}
+	prefix = strings.TrimRight(strings.TrimSuffix(prefix, "."), " \t")
+	matches := identifierPattern.FindAllStringIndex(prefix, -1)
+	if len(matches) == 0 || matches[len(matches)-1][1] != len(prefix) {
+		return ""
+	}
+	last := matches[len(matches)-1]
+	return prefix[last[0]:last[1]]
+}
+
+// isEmptyHover reports whether a hover result shows nothing
+func isEmptyHover(result json.RawMessage) bool {
+	if isEmptyDefinitionResult(result) {
+		return true
+	}
+	var hover struct {
+		Contents json.RawMessage `json:"contents"`
+	}
+	if json.Unmarshal(result, &hover) != nil {
+		return false
+	}
+	var text string
+	if json.Unmarshal(hover.Contents, &text) == nil {
+		return strings.TrimSpace(text) == ""
+	}
+	var markup MarkupContent
+	if json.Unmarshal(hover.Contents, &markup) == nil && markup.Kind != "" {
+		return strings.TrimSpace(markup.Value) == ""
+	}
+	return isEmptyDefinitionResult(hover.Contents)
+}
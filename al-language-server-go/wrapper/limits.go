@@ -0,0 +1,112 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Result limits keep responses on base-app-scale workspaces within what a
+// client can usefully ingest. Truncated results hold only real entries; a
+// window/logMessage tells the client the list was cut, and the wrapper log
+// says how much was left out and which setting controls it.
+
+// limitWorkspaceSymbols truncates a workspace/symbol result to maxResults entries
+func limitWorkspaceSymbols(result json.RawMessage, maxResults int, w WrapperInterface) json.RawMessage {
+	var symbols []json.RawMessage
+	if maxResults <= 0 || json.Unmarshal(result, &symbols) != nil || len(symbols) <= maxResults {
+		return result
+	}
+
+	w.Log("Truncating workspace/symbol result: %d of %d shown, %d left out (workspaceSymbol.maxResults = %d)",
+		maxResults, len(symbols), len(symbols)-maxResults, maxResults)
+	w.LogToClient(MessageTypeInfo, truncationMessage("workspace/symbol", maxResults, len(symbols), "workspaceSymbol.maxResults"))
+	data, err := json.Marshal(symbols[:maxResults])
+	if err != nil {
+		return result
+	}
+	return data
+}
+
+// limitReferences truncates sorted references to maxResults entries
+func limitReferences(refs []ReferenceLocation, maxResults int, w WrapperInterface) []ReferenceLocation {
+	if maxResults <= 0 || len(refs) <= maxResults {
+		return refs
+	}
+
+	w.Log("Truncating references result: %d of %d shown, %d left out (references.maxResults = %d)",
+		maxResults, len(refs), len(refs)-maxResults, maxResults)
+	w.LogToClient(MessageTypeInfo, truncationMessage("textDocument/references", maxResults, len(refs), "references.maxResults"))
+	return refs[:maxResults]
+}
+
+// truncationMessage tells the client a result list was cut
+func truncationMessage(method string, shown int, total int, setting string) string {
+	return fmt.Sprintf("AL LSP wrapper: %s result truncated to %d of %d entries (%s)", method, shown, total, setting)
+}
+
+// limitDocumentSymbolDepth removes DocumentSymbol children nested deeper than
+// maxDepth levels. A symbol whose children were removed says so in its detail.
+// Flat SymbolInformation results are returned unchanged.
+func limitDocumentSymbolDepth(result json.RawMessage, maxDepth int, w WrapperInterface) json.RawMessage {
+	var symbols []map[string]interface{}
+	if maxDepth <= 0 || json.Unmarshal(result, &symbols) != nil {
+		return result
+	}
+
+	hidden := pruneSymbolChildren(symbols, 1, maxDepth)
+	if hidden == 0 {
+		return result
+	}
+	w.Log("Truncated documentSymbol result at depth %d: %d nested symbol(s) hidden", maxDepth, hidden)
+
+	data, err := json.Marshal(symbols)
+	if err != nil {
+		return result
+	}
+	return data
+}
+
+// pruneSymbolChildren cuts children below maxDepth and returns how many symbols were removed
+func pruneSymbolChildren(symbols []map[string]interface{}, depth int, maxDepth int) int {
+	removed := 0
+	for _, symbol := range symbols {
+		children, _ := symbol["children"].([]interface{})
+		if len(children) == 0 {
+			continue
+		}
+
+		if depth < maxDepth {
+			nested := make([]map[string]interface{}, 0, len(children))
+			for _, child := range children {
+				if m, ok := child.(map[string]interface{}); ok {
+					nested = append(nested, m)
+				}
+			}
+			removed += pruneSymbolChildren(nested, depth+1, maxDepth)
+			continue
+		}
+
+		count := countSymbols(children)
+		removed += count
+		delete(symbol, "children")
+		note := fmt.Sprintf("(%d nested symbols not shown, documentSymbol.maxDepth = %d)", count, maxDepth)
+		if detail, _ := symbol["detail"].(string); detail != "" {
+			note = detail + " " + note
+		}
+		symbol["detail"] = note
+	}
+	return removed
+}
+
+// countSymbols counts symbols in a decoded DocumentSymbol tree
+func countSymbols(symbols []interface{}) int {
+	count := len(symbols)
+	for _, s := range symbols {
+		if m, ok := s.(map[string]interface{}); ok {
+			if children, ok := m["children"].([]interface{}); ok {
+				count += countSymbols(children)
+			}
+		}
+	}
+	return count
+}
@@ -0,0 +1,72 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// clientLogMessages returns the window/logMessage texts sent to the client
+func clientLogMessages(t *testing.T, client *syncBuffer) []string {
+	t.Helper()
+	var texts []string
+	for _, msg := range client.messages(t) {
+		if msg.Method != "window/logMessage" {
+			continue
+		}
+		var params LogMessageParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			t.Fatal(err)
+		}
+		texts = append(texts, params.Message)
+	}
+	return texts
+}
+
+func TestTruncatedResultsAreAnnounced(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   func(w WrapperInterface, max int) int
+		method  string
+		setting string
+	}{
+		{
+			name: "workspace/symbol",
+			limit: func(w WrapperInterface, max int) int {
+				var symbols []json.RawMessage
+				json.Unmarshal(limitWorkspaceSymbols(json.RawMessage(`[{"name":"A"},{"name":"B"},{"name":"C"}]`), max, w), &symbols)
+				return len(symbols)
+			},
+			method:  "workspace/symbol",
+			setting: "workspaceSymbol.maxResults",
+		},
+		{
+			name: "references",
+			limit: func(w WrapperInterface, max int) int {
+				return len(limitReferences(make([]ReferenceLocation, 3), max, w))
+			},
+			method:  "textDocument/references",
+			setting: "references.maxResults",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, _, client := newTestWrapper()
+			if got := tt.limit(w, 5); got != 3 {
+				t.Fatalf("untruncated result has %d entries, want 3", got)
+			}
+			if texts := clientLogMessages(t, client); len(texts) != 0 {
+				t.Fatalf("untruncated result announced: %q", texts)
+			}
+
+			if got := tt.limit(w, 2); got != 2 {
+				t.Fatalf("truncated result has %d entries, want 2", got)
+			}
+			texts := clientLogMessages(t, client)
+			if len(texts) != 1 || !strings.Contains(texts[0], tt.method) || !strings.Contains(texts[0], "2 of 3") ||
+				!strings.Contains(texts[0], tt.setting) {
+				t.Errorf("truncation messages = %q, want one naming %s, 2 of 3 and %s", texts, tt.method, tt.setting)
+			}
+		})
+	}
+}
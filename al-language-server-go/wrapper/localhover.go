@@ -0,0 +1,193 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// When the AL server answers a hover with nothing (the project has not
+// loaded, symbols are missing, or the position is in code it cannot bind),
+// hover.localFallback parses the file itself, as the documentSymbol fallback
+// does for definitions. The hover shows what a lightweight parse can tell:
+//
+//   - for a procedure, trigger or field of the file: its declaration
+//   - for a parameter or variable of the enclosing procedure, or a global of
+//     the object: its name and type
+//   - always: the enclosing object declaration and procedure signature
+//
+// Such hovers are tagged with the wrapper:localParse provenance.
+
+// variableDeclPattern matches a variable declaration line, Name: Type; or
+// A, B: Type; names are group 1 and the type group 2
+var variableDeclPattern = regexp.MustCompile(`^\s*((?:"(?:[^"]|"")+"|[A-Za-z_][A-Za-z0-9_]*)(?:\s*,\s*(?:"(?:[^"]|"")+"|[A-Za-z_][A-Za-z0-9_]*))*)\s*:\s*([^;]+);`)
+
+// localHover answers a hover from a local parse of the file, false if the
+// position is not on an identifier
+func localHover(filePath string, pos Position) (json.RawMessage, bool) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, false
+	}
+	r, name, ok := wordAt(content, pos)
+	if !ok {
+		return nil, false
+	}
+	name = unquoteALName(name)
+
+	lines := readSourceLines(filePath)
+	outline := parseOutline(filePath)
+	var enclosing *alMember
+	for i := range outline.members {
+		if m := &outline.members[i]; m.startLine <= pos.Line && pos.Line <= m.endLine {
+			enclosing = m
+		}
+	}
+
+	var symbol string
+	for _, m := range outline.members {
+		if strings.EqualFold(m.name, name) {
+			symbol = memberSignature(lines, m)
+			break
+		}
+	}
+	if symbol == "" {
+		for _, f := range outline.fields {
+			if strings.EqualFold(f.name, name) && f.startLine < len(lines) {
+				code, _ := stripALComments(lines[f.startLine], false)
+				symbol = strings.TrimSpace(code)
+				break
+			}
+		}
+	}
+	if symbol == "" {
+		symbol = localVariable(lines, outline, enclosing, name)
+	}
+
+	var context []string
+	if object, ok := outline.objectAt(pos.Line); ok {
+		context = append(context, object.DisplayName())
+	}
+	if enclosing != nil {
+		context = append(context, memberSignature(lines, *enclosing))
+	}
+	if symbol == "" && len(context) == 0 {
+		return nil, false
+	}
+
+	var text string
+	if symbol != "" {
+		text = "```al\n" + symbol + "\n```\n"
+	}
+	if len(context) > 0 {
+		text += "In:\n```al\n" + strings.Join(context, "\n") + "\n```"
+	}
+	hover := HoverResponse{Contents: MarkupContent{Kind: "markdown", Value: strings.TrimSpace(text)}, Range: &r}
+	data, err := marshalUnescaped(hover)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// memberSignature returns the declaration of a procedure or trigger, joined
+// onto one line when its parameters span several: the lines up to the
+// closing parenthesis and the return type after it
+func memberSignature(lines []string, m alMember) string {
+	var parts []string
+	depth, opened := 0, false
+	inComment := false
+	for i := m.startLine; i < len(lines) && i <= m.endLine; i++ {
+		var code string
+		code, inComment = stripALComments(lines[i], inComment)
+		code = strings.TrimSpace(code)
+		if code == "" {
+			continue
+		}
+		parts = append(parts, code)
+		depth += strings.Count(code, "(") - strings.Count(code, ")")
+		opened = opened || strings.Contains(code, "(")
+		if opened && depth <= 0 {
+			break
+		}
+	}
+	signature := strings.Join(parts, " ")
+	signature = strings.ReplaceAll(strings.ReplaceAll(signature, "( ", "("), " )", ")")
+	return strings.TrimSuffix(strings.TrimSpace(signature), ";")
+}
+
+// localVariable returns the declaration of a parameter or variable of the
+// enclosing member, or of a global of the file, as Name: Type
+func localVariable(lines []string, outline alOutline, enclosing *alMember, name string) string {
+	if enclosing != nil {
+		signature := memberSignature(lines, *enclosing)
+		if open, close := strings.Index(signature, "("), strings.LastIndex(signature, ")"); open >= 0 && close > open {
+			for _, param := range strings.Split(signature[open+1:close], ";") {
+				if decl := matchVariable(strings.TrimSpace(param)+";", name); decl != "" {
+					return decl
+				}
+			}
+		}
+		if decl := findVariable(lines, enclosing.startLine+1, enclosing.endLine, name); decl != "" {
+			return decl
+		}
+	}
+
+	// Globals are declared outside every member
+	inMember := make(map[int]bool)
+	for _, m := range outline.members {
+		for line := m.startLine; line <= m.endLine; line++ {
+			inMember[line] = true
+		}
+	}
+	for i := range lines {
+		if inMember[i] {
+			continue
+		}
+		if decl := findVariable(lines, i, i, name); decl != "" {
+			return decl
+		}
+	}
+	return ""
+}
+
+// findVariable returns the declaration of a variable on the lines from..to
+func findVariable(lines []string, from int, to int, name string) string {
+	inComment := false
+	for i := from; i <= to && i < len(lines); i++ {
+		var code string
+		code, inComment = stripALComments(lines[i], inComment)
+		if strings.EqualFold(strings.TrimSpace(code), "begin") {
+			return ""
+		}
+		if decl := matchVariable(code, name); decl != "" {
+			return decl
+		}
+	}
+	return ""
+}
+
+// matchVariable returns Name: Type if a declaration declares the name
+func matchVariable(code string, name string) string {
+	code = strings.TrimSpace(code)
+	isVar := false
+	if len(code) > 4 && strings.EqualFold(code[:4], "var ") {
+		code, isVar = strings.TrimSpace(code[4:]), true
+	}
+	m := variableDeclPattern.FindStringSubmatch(code)
+	if m == nil {
+		return ""
+	}
+	for _, declared := range strings.Split(m[1], ",") {
+		declared = strings.TrimSpace(declared)
+		if strings.EqualFold(unquoteALName(declared), name) {
+			decl := declared + ": " + strings.TrimSpace(m[2])
+			if isVar {
+				decl = "var " + decl
+			}
+			return decl
+		}
+	}
+	return ""
+}
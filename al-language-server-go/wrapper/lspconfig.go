@@ -0,0 +1,214 @@
+package wrapper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Claude Code starts the wrapper through the plugin's .lsp.json. The command
+// has to find the newest installed plugin version in Claude's plugin cache,
+// so the marketplace folder, plugin folder and binary name must all match the
+// actual install layout:
+//
+//	~/.claude/plugins/cache/<marketplace>/<plugin>/<version>/bin/<binary>
+
+// pluginMarketplace is the marketplace the platform plugins are published in
+const pluginMarketplace = "claude-code-lsps"
+
+// pluginPlatforms are the GOOS values with a platform plugin
+var pluginPlatforms = []string{"windows", "linux", "darwin"}
+
+// PluginName returns the platform plugin name, e.g. al-language-server-go-linux
+func PluginName(goos string) string {
+	return "al-language-server-go-" + goos
+}
+
+// WrapperBinaryName returns the wrapper binary name shipped in a platform plugin
+func WrapperBinaryName(goos string) string {
+	if goos == "windows" {
+		return "al-lsp-wrapper.exe"
+	}
+	return "al-lsp-wrapper"
+}
+
+// LSPServerConfig is one server entry of .lsp.json
+type LSPServerConfig struct {
+	Command               string            `json:"command"`
+	Args                  []string          `json:"args"`
+	ExtensionToLanguage   map[string]string `json:"extensionToLanguage"`
+	Transport             string            `json:"transport"`
+	InitializationOptions json.RawMessage   `json:"initializationOptions"`
+	Settings              json.RawMessage   `json:"settings"`
+	MaxRestarts           int               `json:"maxRestarts"`
+}
+
+// NewLSPServerConfig returns the .lsp.json entry that starts the newest
+// installed wrapper of the platform plugin for goos
+func NewLSPServerConfig(goos string) (*LSPServerConfig, error) {
+	cfg := &LSPServerConfig{
+		ExtensionToLanguage:   map[string]string{".al": "al", ".dal": "al"},
+		Transport:             "stdio",
+		InitializationOptions: json.RawMessage("{}"),
+		Settings:              json.RawMessage("{}"),
+		MaxRestarts:           3,
+	}
+	plugin := PluginName(goos)
+	binary := WrapperBinaryName(goos)
+
+	switch goos {
+	case "windows":
+		cache := `%USERPROFILE%\.claude\plugins\cache\` + pluginMarketplace + `\` + plugin
+		cfg.Command = "cmd"
+		cfg.Args = []string{
+			"/c",
+			`for /f "delims=" %d in ('dir /b /o-d "` + cache + `" 2^>nul ^| findstr /n "^" ^| findstr /b "1:"') do @for /f "tokens=1,* delims=:" %a in ("%d") do @"` + cache + `\%b\bin\` + binary + `"`,
+		}
+	case "linux", "darwin":
+		cache := `$HOME/.claude/plugins/cache/` + pluginMarketplace + `/` + plugin
+		cfg.Command = "bash"
+		cfg.Args = []string{
+			"-c",
+			`exe=$(ls -t "` + cache + `"/*/bin/` + binary + ` 2>/dev/null | head -1); [ -x "$exe" ] && exec "$exe" || { echo 'AL LSP wrapper not found' >&2; exit 1; }`,
+		}
+	default:
+		return nil, fmt.Errorf("no AL plugin for platform %q (supported: %s)", goos, strings.Join(pluginPlatforms, ", "))
+	}
+	return cfg, nil
+}
+
+// GenerateLSPConfig returns the .lsp.json content for the platform plugin for goos
+func GenerateLSPConfig(goos string) ([]byte, error) {
+	server, err := NewLSPServerConfig(goos)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(map[string]*LSPServerConfig{"al": server}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// LSPConfigIssue is a problem found in a .lsp.json
+type LSPConfigIssue struct {
+	// Severity is "error" for configurations that cannot work, else "warning"
+	Severity string
+	Message  string
+}
+
+// pluginCacheRefPattern finds plugin cache references in .lsp.json commands
+var pluginCacheRefPattern = regexp.MustCompile(`plugins[\\/]+cache[\\/]+([^\\/"']+)[\\/]+([^\\/"'*]+)`)
+
+// ValidateLSPConfig checks a .lsp.json for goos against the expected plugin
+// layout and against what is installed in Claude's plugin cache
+func ValidateLSPConfig(data []byte, goos string) []LSPConfigIssue {
+	var issues []LSPConfigIssue
+	errorf := func(format string, args ...interface{}) {
+		issues = append(issues, LSPConfigIssue{"error", fmt.Sprintf(format, args...)})
+	}
+	warnf := func(format string, args ...interface{}) {
+		issues = append(issues, LSPConfigIssue{"warning", fmt.Sprintf(format, args...)})
+	}
+
+	var servers map[string]LSPServerConfig
+	if err := json.Unmarshal(data, &servers); err != nil {
+		errorf("invalid JSON: %v", err)
+		return issues
+	}
+	server, ok := servers["al"]
+	if !ok {
+		errorf(`no "al" server entry`)
+		return issues
+	}
+
+	if server.Command == "" {
+		errorf("command is empty")
+	}
+	if server.Transport != "stdio" {
+		errorf("transport is %q, the wrapper only speaks stdio", server.Transport)
+	}
+	for _, ext := range []string{".al", ".dal"} {
+		if server.ExtensionToLanguage[ext] != "al" {
+			errorf(`extensionToLanguage does not map %s to "al"`, ext)
+		}
+	}
+
+	switch {
+	case goos == "windows" && server.Command == "bash":
+		errorf("command is bash, which Windows does not provide by default; use cmd")
+	case goos != "windows" && server.Command == "cmd":
+		errorf("command is cmd, which only exists on Windows; use bash")
+	}
+
+	commandLine := server.Command + " " + strings.Join(server.Args, " ")
+	binary := WrapperBinaryName(goos)
+	if !strings.Contains(commandLine, binary) {
+		errorf("command does not start %s, the wrapper binary for %s", binary, goos)
+	} else if goos != "windows" && strings.Contains(commandLine, binary+".exe") {
+		errorf("command starts %s.exe, which is the Windows binary", binary)
+	}
+
+	refs := pluginCacheRefPattern.FindAllStringSubmatch(commandLine, -1)
+	if len(refs) == 0 {
+		if filepath.IsAbs(server.Command) {
+			if _, err := os.Stat(server.Command); err != nil {
+				errorf("command %s does not exist", server.Command)
+			}
+		} else {
+			warnf("command does not reference the plugin cache; it will not follow plugin updates")
+		}
+		return issues
+	}
+
+	plugin := PluginName(goos)
+	seen := make(map[string]bool)
+	for _, ref := range refs {
+		marketplace, name := ref[1], ref[2]
+		if seen[marketplace+"/"+name] {
+			continue
+		}
+		seen[marketplace+"/"+name] = true
+		if marketplace != pluginMarketplace {
+			errorf("plugin cache folder is %s, expected %s", marketplace, pluginMarketplace)
+		}
+		if name != plugin {
+			errorf("plugin folder is %s, expected %s for %s", name, plugin, goos)
+		}
+	}
+
+	issues = append(issues, checkInstalledPlugin(goos)...)
+	return issues
+}
+
+// checkInstalledPlugin reports whether the platform plugin's wrapper binary
+// is present in Claude's plugin cache
+func checkInstalledPlugin(goos string) []LSPConfigIssue {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	pluginDir := filepath.Join(home, ".claude", "plugins", "cache", pluginMarketplace, PluginName(goos))
+	binaries, _ := filepath.Glob(filepath.Join(pluginDir, "*", "bin", WrapperBinaryName(goos)))
+	if len(binaries) == 0 {
+		return []LSPConfigIssue{{"warning", fmt.Sprintf("no installed wrapper found in %s (is the plugin installed?)", pluginDir)}}
+	}
+
+	var issues []LSPConfigIssue
+	if goos != "windows" {
+		for _, binary := range binaries {
+			if info, err := os.Stat(binary); err == nil && info.Mode()&0111 == 0 {
+				issues = append(issues, LSPConfigIssue{"error", fmt.Sprintf("%s is not executable", binary)})
+			}
+		}
+	}
+	return issues
+}
@@ -0,0 +1,259 @@
+package wrapper
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ALObject is a top-level AL object declared in a project's source files
+type ALObject struct {
+	// Type is the lower-case object type, e.g. "table" or "pageextension"
+	Type string `json:"type"`
+	// ID is the object ID (0 for types without IDs, like interfaces)
+	ID int `json:"id"`
+	// Name is the object name without quotes
+	Name string `json:"name"`
+	// Extends is the extended object's name for extension objects
+	Extends string `json:"extends,omitempty"`
+	// Path is the source file
+	Path string `json:"path"`
+	// Line is the zero-based line of the declaration
+	Line int `json:"line"`
+}
+
+// alObjectTypes lists AL object types in the order they are presented
+var alObjectTypes = []string{
+	"table", "tableextension", "page", "pageextension", "pagecustomization",
+	"codeunit", "report", "reportextension", "query", "xmlport",
+	"enum", "enumextension", "interface", "permissionset", "permissionsetextension",
+	"profile", "profileextension", "controladdin", "entitlement", "dotnet",
+}
+
+// objectDeclPattern matches an object declaration: type, optional ID, name, optional extends
+var objectDeclPattern = regexp.MustCompile(`(?i)^\s*(` + strings.Join(alObjectTypes, "|") +
+	`)\s+(?:(\d+)\s+)?("(?:[^"]|"")+"|[A-Za-z_][A-Za-z0-9_]*)(?:\s+extends\s+("(?:[^"]|"")+"|[A-Za-z_][A-Za-z0-9_]*))?`)
+
+// plainIdentifierPattern matches AL identifiers that need no double quotes
+var plainIdentifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// alObjectSymbolKinds maps object types to the LSP SymbolKind used for them
+var alObjectSymbolKinds = map[string]int{
+	"table":          23, // Struct
+	"tableextension": 23,
+	"codeunit":       5,  // Class
+	"enum":           10, // Enum
+	"enumextension":  10,
+	"interface":      11, // Interface
+}
+
+// SymbolKind returns the LSP SymbolKind for the object
+func (o ALObject) SymbolKind() int {
+	if kind, ok := alObjectSymbolKinds[o.Type]; ok {
+		return kind
+	}
+	return 19 // Object
+}
+
+// DisplayName renders the object the way AL declares it, e.g. tableextension 50100 "My Ext" extends Customer
+func (o ALObject) DisplayName() string {
+	name := quoteALName(o.Name)
+	display := fmt.Sprintf("%s %s", o.Type, name)
+	if o.ID > 0 {
+		display = fmt.Sprintf("%s %d %s", o.Type, o.ID, name)
+	}
+	if o.Extends != "" {
+		display += " extends " + quoteALName(o.Extends)
+	}
+	return display
+}
+
+// quoteALName double-quotes an AL identifier if it is not a plain identifier
+func quoteALName(name string) string {
+	if plainIdentifierPattern.MatchString(name) {
+		return name
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// ScanProjectObjects finds the objects declared in a project's .al files.
+// Dependency packages and VCS/tooling directories are skipped.
+func ScanProjectObjects(projectRoot string) ([]ALObject, error) {
+	var objects []ALObject
+
+	err := walkDir(projectRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if path != projectRoot && (strings.HasPrefix(name, ".") || name == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.EqualFold(filepath.Ext(path), ".al") {
+			objects = append(objects, parseObjectFile(path)...)
+		}
+		return nil
+	})
+
+	sortALObjects(objects)
+	return objects, err
+}
+
+// alSourceFiles returns the .al files of a project, sorted, skipping the
+// directories ScanProjectObjects skips
+func alSourceFiles(projectRoot string) []string {
+	var files []string
+	walkDir(projectRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if path != projectRoot && (strings.HasPrefix(name, ".") || name == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.EqualFold(filepath.Ext(path), ".al") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files
+}
+
+// parseObjectFile returns the object declarations in one AL file
+func parseObjectFile(path string) []ALObject {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var objects []ALObject
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	inComment := false
+	depth := 0
+
+	for line := 0; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if line == 0 {
+			text = strings.TrimPrefix(text, "\ufeff")
+		}
+		code, stillInComment := stripALComments(text, inComment)
+		inComment = stillInComment
+
+		// Objects are only declared outside of any braces
+		if depth == 0 {
+			if m := objectDeclPattern.FindStringSubmatch(code); m != nil {
+				id, _ := strconv.Atoi(m[2])
+				objects = append(objects, ALObject{
+					Type:    strings.ToLower(m[1]),
+					ID:      id,
+					Name:    unquoteALName(m[3]),
+					Extends: unquoteALName(m[4]),
+					Path:    path,
+					Line:    line,
+				})
+			}
+		}
+		depth += strings.Count(code, "{") - strings.Count(code, "}")
+		if depth < 0 {
+			depth = 0
+		}
+	}
+	return objects
+}
+
+// stripALComments removes // and /* */ comments and 'string' literals from a line
+// so braces inside them are not counted. "Quoted identifiers" are kept.
+func stripALComments(line string, inComment bool) (string, bool) {
+	var b strings.Builder
+	inString, inIdent := false, false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case inComment:
+			if c == '*' && i+1 < len(line) && line[i+1] == '/' {
+				inComment = false
+				i++
+			}
+		case inString:
+			if c == '\'' {
+				inString = false
+			}
+		case inIdent:
+			b.WriteByte(c)
+			if c == '"' {
+				inIdent = false
+			}
+		case c == '\'':
+			inString = true
+		case c == '"':
+			inIdent = true
+			b.WriteByte(c)
+		case c == '/' && i+1 < len(line) && line[i+1] == '/':
+			return b.String(), false
+		case c == '/' && i+1 < len(line) && line[i+1] == '*':
+			inComment = true
+			i++
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), inComment
+}
+
+// unquoteALName removes the double quotes from an AL identifier
+func unquoteALName(name string) string {
+	if len(name) >= 2 && name[0] == '"' && name[len(name)-1] == '"' {
+		return strings.ReplaceAll(name[1:len(name)-1], `""`, `"`)
+	}
+	return name
+}
+
+// sortALObjects orders objects by type (in alObjectTypes order), then ID, then name
+func sortALObjects(objects []ALObject) {
+	rank := make(map[string]int, len(alObjectTypes))
+	for i, t := range alObjectTypes {
+		rank[t] = i
+	}
+	sort.SliceStable(objects, func(i, j int) bool {
+		a, b := objects[i], objects[j]
+		if rank[a.Type] != rank[b.Type] {
+			return rank[a.Type] < rank[b.Type]
+		}
+		if a.ID != b.ID {
+			return a.ID < b.ID
+		}
+		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+	})
+}
+
+// objectSymbols converts objects into workspace/symbol results
+func objectSymbols(objects []ALObject) []SymbolInformation {
+	symbols := make([]SymbolInformation, 0, len(objects))
+	for _, obj := range objects {
+		pos := Position{Line: obj.Line, Character: 0}
+		symbols = append(symbols, SymbolInformation{
+			Name: obj.DisplayName(),
+			Kind: obj.SymbolKind(),
+			Location: Location{
+				URI:   PathToFileURI(obj.Path),
+				Range: Range{Start: pos, End: pos},
+			},
+		})
+	}
+	return symbols
+}
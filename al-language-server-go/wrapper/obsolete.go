@@ -0,0 +1,626 @@
+package wrapper
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Objects, fields and enum values are obsoleted with the ObsoleteState,
+// ObsoleteReason and ObsoleteTag properties, procedures with the
+// [Obsolete('reason', 'tag')] attribute. The wrapper reads these from source
+// files and from dependencies' SymbolReference.json to mark symbol results as
+// deprecated, note them in hovers, and list the obsolete members a project
+// still uses.
+
+// ObsoleteReferencesCommand lists the obsolete members referenced by a project
+const ObsoleteReferencesCommand = "al-wrapper.obsoleteReferences"
+
+// symbolTagDeprecated is the LSP SymbolTag of deprecated symbols
+const symbolTagDeprecated = 1
+
+var (
+	obsoleteStatePattern     = regexp.MustCompile(`(?i)^\s*ObsoleteState\s*=\s*([A-Za-z]+)\s*;`)
+	obsoleteReasonPattern    = regexp.MustCompile(`(?i)^\s*ObsoleteReason\s*=\s*'((?:[^']|'')*)'`)
+	obsoleteTagPattern       = regexp.MustCompile(`(?i)^\s*ObsoleteTag\s*=\s*'((?:[^']|'')*)'`)
+	obsoleteAttributePattern = regexp.MustCompile(`(?i)^\s*\[\s*Obsolete\s*(\(|\])`)
+	// enumValueDeclPattern matches enum values, value(0; Name)
+	enumValueDeclPattern = regexp.MustCompile(`(?i)^\s*value\s*\(\s*\d+\s*;\s*("(?:[^"]|"")+"|[A-Za-z_][A-Za-z0-9_]*)`)
+	// alTokenPattern matches identifiers, quoted identifiers and member access dots
+	alTokenPattern = regexp.MustCompile(`"(?:[^"]|"")+"|[A-Za-z_][A-Za-z0-9_]*|::|\.`)
+)
+
+// ObsoleteInfo is the obsolete state of a member
+type ObsoleteInfo struct {
+	// State is Pending, Removed or Moved; [Obsolete] attributes are Pending
+	State  string `json:"state"`
+	Reason string `json:"reason,omitempty"`
+	Tag    string `json:"tag,omitempty"`
+}
+
+// String describes the state for annotations, e.g.
+// `Obsolete (Pending, 24.0): Use "New Field" instead`
+func (o ObsoleteInfo) String() string {
+	text := "Obsolete (" + o.State
+	if o.Tag != "" {
+		text += ", " + o.Tag
+	}
+	text += ")"
+	if o.Reason != "" {
+		text += ": " + o.Reason
+	}
+	return text
+}
+
+// parseObsoleteFile returns the obsolete state of the objects, fields, enum
+// values and procedures declared in an AL file, by declaration line
+func parseObsoleteFile(path string) map[int]*ObsoleteInfo {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	type declScope struct {
+		line  int
+		depth int
+	}
+
+	infos := make(map[int]*ObsoleteInfo)
+	var stack []declScope
+	pendingDecl := -1 // declaration whose block has not opened yet
+	var attribute *ObsoleteInfo
+	depth := 0
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	inComment := false
+	for line := 0; scanner.Scan(); line++ {
+		text := scanner.Text()
+		code, stillInComment := stripALComments(text, inComment)
+		inComment = stillInComment
+		trimmed := strings.TrimSpace(code)
+		if trimmed == "" {
+			continue
+		}
+
+		// Property values are 'strings', which stripALComments removes
+		target := -1
+		if len(stack) > 0 && stack[len(stack)-1].depth == depth {
+			target = stack[len(stack)-1].line
+		}
+		switch {
+		case obsoleteAttributePattern.MatchString(text):
+			attribute = &ObsoleteInfo{State: "Pending"}
+			if m := obsoleteAttributePattern.FindStringSubmatchIndex(text); text[m[2]] == '(' {
+				if inner, ok := enclosedList(text[m[2]:]); ok {
+					args := splitTopLevel(inner, ',')
+					if len(args) > 0 {
+						attribute.Reason = unquoteALString(args[0])
+					}
+					if len(args) > 1 {
+						attribute.Tag = unquoteALString(args[1])
+					}
+				}
+			}
+			continue
+		case strings.HasPrefix(trimmed, "["):
+			// Other attributes may precede or follow [Obsolete]
+			continue
+		case depth == 0 && objectDeclPattern.MatchString(code),
+			fieldDeclPattern.MatchString(code) && strings.Count(code, ";") >= 2,
+			enumValueDeclPattern.MatchString(code):
+			pendingDecl = line
+		case memberDeclPattern.MatchString(code):
+			if attribute != nil {
+				infos[line] = attribute
+			}
+			pendingDecl = -1
+		case target >= 0 && obsoleteStatePattern.MatchString(code):
+			obsoleteAt(infos, target).State = obsoleteStatePattern.FindStringSubmatch(code)[1]
+		case target >= 0 && obsoleteReasonPattern.MatchString(text):
+			obsoleteAt(infos, target).Reason = unquoteALString("'" + obsoleteReasonPattern.FindStringSubmatch(text)[1] + "'")
+		case target >= 0 && obsoleteTagPattern.MatchString(text):
+			obsoleteAt(infos, target).Tag = unquoteALString("'" + obsoleteTagPattern.FindStringSubmatch(text)[1] + "'")
+		case !strings.HasPrefix(trimmed, "{"):
+			pendingDecl = -1
+		}
+		attribute = nil
+
+		for i := 0; i < len(code); i++ {
+			switch code[i] {
+			case '{':
+				depth++
+				if pendingDecl >= 0 {
+					stack = append(stack, declScope{line: pendingDecl, depth: depth})
+					pendingDecl = -1
+				}
+			case '}':
+				if len(stack) > 0 && stack[len(stack)-1].depth == depth {
+					stack = stack[:len(stack)-1]
+				}
+				if depth > 0 {
+					depth--
+				}
+			}
+		}
+	}
+
+	// Reason and tag alone do not obsolete a member
+	for line, info := range infos {
+		if info.State == "" || strings.EqualFold(info.State, "No") {
+			delete(infos, line)
+		}
+	}
+	return infos
+}
+
+// obsoleteAt returns the info of a declaration line, creating it
+func obsoleteAt(infos map[int]*ObsoleteInfo, line int) *ObsoleteInfo {
+	if infos[line] == nil {
+		infos[line] = &ObsoleteInfo{}
+	}
+	return infos[line]
+}
+
+// unquoteALString removes the single quotes from an AL string literal
+func unquoteALString(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'")
+	}
+	return s
+}
+
+// obsoleteForLocation returns the obsolete state of the declaration at a
+// location in a source file, or nil
+func obsoleteForLocation(uri string, line int, files map[string]map[int]*ObsoleteInfo) *ObsoleteInfo {
+	if !strings.HasPrefix(uri, "file://") {
+		return nil
+	}
+	path, err := FileURIToPath(uri)
+	if err != nil {
+		return nil
+	}
+	infos, ok := files[path]
+	if !ok {
+		infos = parseObsoleteFile(path)
+		files[path] = infos
+	}
+	return infos[line]
+}
+
+// obsoleteForDefinition returns the obsolete state of the first declaration
+// of a definition result in a source file, or nil
+func obsoleteForDefinition(result json.RawMessage) *ObsoleteInfo {
+	uri, line, ok := firstDefinitionLocation(result)
+	if !ok {
+		return nil
+	}
+	return obsoleteForLocation(uri, line, make(map[string]map[int]*ObsoleteInfo))
+}
+
+// packageObjectObsolete returns the obsolete state of the dependency package
+// object a definition result lies in, from the package's symbols, or nil.
+// Previews and generated stubs of package objects carry no Obsolete
+// properties to parse.
+func packageObjectObsolete(definition json.RawMessage, app AppManifest, w WrapperInterface) *ObsoleteInfo {
+	uri, _, ok := firstDefinitionLocation(definition)
+	if !ok {
+		return nil
+	}
+	object, ok := packageLocationObject(uri, w.DependencyObjects(app))
+	if !ok {
+		return nil
+	}
+	objects, err := w.SymbolStore().objects(app)
+	if err != nil {
+		return nil
+	}
+	if symbol := objects.find(object); symbol != nil {
+		return symbol.obsolete()
+	}
+	return nil
+}
+
+// firstDefinitionLocation returns the URI and line of the first location in a
+// definition result
+func firstDefinitionLocation(result json.RawMessage) (string, int, bool) {
+	if isEmptyDefinitionResult(result) {
+		return "", 0, false
+	}
+	// Location or LocationLink
+	type definitionLocation struct {
+		Location
+		TargetURI            string `json:"targetUri"`
+		TargetSelectionRange Range  `json:"targetSelectionRange"`
+	}
+	var locations []definitionLocation
+	if json.Unmarshal(result, &locations) != nil {
+		var location definitionLocation
+		if json.Unmarshal(result, &location) != nil {
+			return "", 0, false
+		}
+		locations = []definitionLocation{location}
+	}
+	if len(locations) == 0 {
+		return "", 0, false
+	}
+	if locations[0].URI == "" {
+		return locations[0].TargetURI, locations[0].TargetSelectionRange.Start.Line, true
+	}
+	return locations[0].URI, locations[0].Range.Start.Line, true
+}
+
+// markDeprecated tags a DocumentSymbol or SymbolInformation as deprecated
+// and adds the obsolete state to its detail (or container name)
+func markDeprecated(symbol map[string]json.RawMessage, info *ObsoleteInfo) {
+	symbol["tags"], _ = json.Marshal([]int{symbolTagDeprecated})
+	symbol["deprecated"] = json.RawMessage("true")
+	field := "detail"
+	if _, ok := symbol["location"]; ok {
+		field = "containerName"
+	}
+	var text string
+	json.Unmarshal(symbol[field], &text)
+	if text != "" {
+		text += " "
+	}
+	symbol[field], _ = json.Marshal(text + "[" + info.String() + "]")
+}
+
+// annotateObsoleteSymbols marks the obsolete symbols of a documentSymbol or
+// workspace/symbol result. uri is the document of DocumentSymbol results.
+func annotateObsoleteSymbols(result json.RawMessage, uri string) json.RawMessage {
+	var symbols []map[string]json.RawMessage
+	if err := json.Unmarshal(result, &symbols); err != nil || len(symbols) == 0 {
+		return result
+	}
+	files := make(map[string]map[int]*ObsoleteInfo)
+	changed := false
+
+	var walk func(symbols []map[string]json.RawMessage)
+	walk = func(symbols []map[string]json.RawMessage) {
+		for _, symbol := range symbols {
+			var location Location
+			if raw, ok := symbol["location"]; ok {
+				json.Unmarshal(raw, &location)
+			} else {
+				location.URI = uri
+				json.Unmarshal(symbol["selectionRange"], &location.Range)
+			}
+			if info := obsoleteForLocation(location.URI, location.Range.Start.Line, files); info != nil {
+				markDeprecated(symbol, info)
+				changed = true
+			}
+
+			var children []map[string]json.RawMessage
+			if json.Unmarshal(symbol["children"], &children) == nil && len(children) > 0 {
+				walk(children)
+				symbol["children"], _ = json.Marshal(children)
+			}
+		}
+	}
+	walk(symbols)
+	if !changed {
+		return result
+	}
+	data, err := json.Marshal(symbols)
+	if err != nil {
+		return result
+	}
+	return data
+}
+
+// ObsoleteMember is an obsolete object, field, enum value or procedure
+type ObsoleteMember struct {
+	// Kind is the object type, "field", "value" or "procedure"
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// Object is the declaring object for members, e.g. `table 18 Customer`
+	Object string `json:"object,omitempty"`
+	// Source is "workspace" or the dependency app declaring the member
+	Source   string       `json:"source"`
+	Obsolete ObsoleteInfo `json:"obsolete"`
+}
+
+// ObsoleteReference is a use of an obsolete member in a project's source
+type ObsoleteReference struct {
+	URI    string         `json:"uri"`
+	Line   int            `json:"line"`
+	Text   string         `json:"text"`
+	Member ObsoleteMember `json:"member"`
+}
+
+// ObsoleteReferencesResult is returned by al-wrapper.obsoleteReferences
+type ObsoleteReferencesResult struct {
+	Project string `json:"project"`
+	// Members are the obsolete members known in the workspace and dependencies
+	Members    int                 `json:"members"`
+	References []ObsoleteReference `json:"references"`
+}
+
+// symbolReferenceProperty is a property of a symbol in SymbolReference.json
+type symbolReferenceProperty struct {
+	Name  string `json:"Name"`
+	Value string `json:"Value"`
+}
+
+// symbolReferenceMember is an object, field, enum value or method in
+// SymbolReference.json, with what the obsolete scan and source stubs need
+type symbolReferenceMember struct {
+	Name       string                    `json:"Name"`
+	Properties []symbolReferenceProperty `json:"Properties"`
+	Attributes []struct {
+		Name      string `json:"Name"`
+		Arguments []struct {
+			Value string `json:"Value"`
+		} `json:"Arguments"`
+	} `json:"Attributes"`
+	Fields  []symbolReferenceMember `json:"Fields"`
+	Values  []symbolReferenceMember `json:"Values"`
+	Methods []symbolReferenceMember `json:"Methods"`
+	// ID distinguishes objects from members
+	ID int `json:"Id"`
+	// Types, parameters and ordinals are rendered in source stubs
+	TypeDefinition       *stubTypeDefinition `json:"TypeDefinition"`
+	ReturnTypeDefinition *stubTypeDefinition `json:"ReturnTypeDefinition"`
+	Parameters           []struct {
+		Name           string              `json:"Name"`
+		IsVar          bool                `json:"IsVar"`
+		TypeDefinition *stubTypeDefinition `json:"TypeDefinition"`
+	} `json:"Parameters"`
+	Ordinal int `json:"Ordinal"`
+}
+
+// obsolete returns the obsolete state of a SymbolReference.json symbol, or nil
+func (m *symbolReferenceMember) obsolete() *ObsoleteInfo {
+	info := &ObsoleteInfo{}
+	for _, p := range m.Properties {
+		switch strings.ToLower(p.Name) {
+		case "obsoletestate":
+			info.State = p.Value
+		case "obsoletereason":
+			info.Reason = p.Value
+		case "obsoletetag":
+			info.Tag = p.Value
+		}
+	}
+	for _, a := range m.Attributes {
+		if strings.EqualFold(a.Name, "Obsolete") {
+			info.State = "Pending"
+			if len(a.Arguments) > 0 {
+				info.Reason = a.Arguments[0].Value
+			}
+			if len(a.Arguments) > 1 {
+				info.Tag = a.Arguments[1].Value
+			}
+		}
+	}
+	if info.State == "" || strings.EqualFold(info.State, "No") {
+		return nil
+	}
+	return info
+}
+
+// symbolReferenceObjects holds the object lists of SymbolReference.json with
+// their members, at the top level and in each namespace. The obsolete scan
+// reads the base objects, the package search also the extensions.
+type symbolReferenceObjects struct {
+	Tables             []symbolReferenceMember  `json:"Tables"`
+	TableExtensions    []symbolReferenceMember  `json:"TableExtensions"`
+	Pages              []symbolReferenceMember  `json:"Pages"`
+	PageExtensions     []symbolReferenceMember  `json:"PageExtensions"`
+	Codeunits          []symbolReferenceMember  `json:"Codeunits"`
+	Reports            []symbolReferenceMember  `json:"Reports"`
+	ReportExtensions   []symbolReferenceMember  `json:"ReportExtensions"`
+	Queries            []symbolReferenceMember  `json:"Queries"`
+	XmlPorts           []symbolReferenceMember  `json:"XmlPorts"`
+	EnumTypes          []symbolReferenceMember  `json:"EnumTypes"`
+	EnumExtensionTypes []symbolReferenceMember  `json:"EnumExtensionTypes"`
+	Interfaces         []symbolReferenceMember  `json:"Interfaces"`
+	Namespaces         []symbolReferenceObjects `json:"Namespaces"`
+}
+
+// collect appends the obsolete objects and members of the namespace
+func (n *symbolReferenceObjects) collect(members []ObsoleteMember, appName string) []ObsoleteMember {
+	lists := []struct {
+		typ     string
+		entries []symbolReferenceMember
+	}{
+		{"table", n.Tables}, {"page", n.Pages}, {"codeunit", n.Codeunits},
+		{"report", n.Reports}, {"query", n.Queries}, {"xmlport", n.XmlPorts},
+		{"enum", n.EnumTypes}, {"interface", n.Interfaces},
+	}
+	for _, list := range lists {
+		for i := range list.entries {
+			entry := &list.entries[i]
+			object := ALObject{Type: list.typ, ID: entry.ID, Name: entry.Name}.DisplayName()
+			if info := entry.obsolete(); info != nil {
+				members = append(members, ObsoleteMember{Kind: list.typ, Name: entry.Name, Source: appName, Obsolete: *info})
+			}
+			children := []struct {
+				kind    string
+				entries []symbolReferenceMember
+			}{
+				{"field", entry.Fields}, {"value", entry.Values}, {"procedure", entry.Methods},
+			}
+			for _, child := range children {
+				for j := range child.entries {
+					if info := child.entries[j].obsolete(); info != nil {
+						members = append(members, ObsoleteMember{
+							Kind: child.kind, Name: child.entries[j].Name, Object: object, Source: appName, Obsolete: *info,
+						})
+					}
+				}
+			}
+		}
+	}
+	for i := range n.Namespaces {
+		members = n.Namespaces[i].collect(members, appName)
+	}
+	return members
+}
+
+// workspaceObsoleteMembers returns the obsolete members declared in the
+// source files of the workspace's projects
+func workspaceObsoleteMembers(roots []string) []ObsoleteMember {
+	var members []ObsoleteMember
+	for _, root := range roots {
+		objects, _ := ScanProjectObjects(root)
+		files := make(map[string]bool)
+		for _, o := range objects {
+			if files[o.Path] {
+				continue
+			}
+			files[o.Path] = true
+			infos := parseObsoleteFile(o.Path)
+			if len(infos) == 0 {
+				continue
+			}
+			outline := parseOutline(o.Path)
+			lines := readLines(o.Path)
+			for line, info := range infos {
+				member := ObsoleteMember{Source: "workspace", Obsolete: *info}
+				if object, ok := outline.objectAt(line); ok && object.Line == line {
+					member.Kind, member.Name = object.Type, object.Name
+				} else if line < len(lines) {
+					member.Kind, member.Name = declarationName(lines[line])
+					if ok {
+						member.Object = object.DisplayName()
+					}
+				}
+				if member.Name != "" {
+					members = append(members, member)
+				}
+			}
+		}
+	}
+	return members
+}
+
+// declarationName returns the kind and name of a field, enum value or
+// procedure declared on a line
+func declarationName(line string) (string, string) {
+	if m := enumValueDeclPattern.FindStringSubmatch(line); m != nil {
+		return "value", unquoteALName(m[1])
+	}
+	if m := memberDeclPattern.FindStringSubmatch(line); m != nil {
+		return strings.ToLower(m[1]), unquoteALName(m[2])
+	}
+	if m := fieldDeclPattern.FindStringSubmatch(line); m != nil {
+		return "field", unquoteALName(m[1])
+	}
+	return "", ""
+}
+
+// readLines returns the lines of a file
+func readLines(path string) []string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	return strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+}
+
+// objectReferenceKeywords precede object names in references, e.g.
+// Record Customer or Codeunit::"Sales-Post"
+var objectReferenceKeywords = map[string]bool{
+	"record": true, "page": true, "codeunit": true, "report": true, "query": true,
+	"xmlport": true, "enum": true, "interface": true, "database": true,
+}
+
+// FindObsoleteReferences lists the uses of obsolete members in a project's
+// source files. Uses are found by name: members after a "." (Rec."Old Field",
+// Mgt.OldProcedure), enum values after "::", and objects after a type keyword
+// (Record "Old Table", Codeunit::"Old Codeunit").
+func FindObsoleteReferences(workspaceRoot string, project string, w WrapperInterface) ObsoleteReferencesResult {
+	members := workspaceObsoleteMembers(workspaceProjects(workspaceRoot, project))
+	seen := make(map[string]bool)
+	for _, app := range w.DependencyPackages(project) {
+		key := app.ID
+		if key == "" {
+			key = app.Path
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		objects, err := w.SymbolStore().objects(app)
+		if err != nil {
+			w.Log("Skipping package obsolete members: %v", err)
+			continue
+		}
+		members = objects.collect(members, app.Name)
+	}
+
+	byName := make(map[string][]ObsoleteMember)
+	for _, m := range members {
+		byName[strings.ToLower(m.Name)] = append(byName[strings.ToLower(m.Name)], m)
+	}
+
+	result := ObsoleteReferencesResult{Project: project, Members: len(members), References: []ObsoleteReference{}}
+	objects, _ := ScanProjectObjects(project)
+	files := make(map[string]bool)
+	for _, o := range objects {
+		if files[o.Path] {
+			continue
+		}
+		files[o.Path] = true
+		inComment := false
+		for line, text := range readLines(o.Path) {
+			code, stillInComment := stripALComments(text, inComment)
+			inComment = stillInComment
+			tokens := alTokenPattern.FindAllString(code, -1)
+			for i := 1; i < len(tokens); i++ {
+				candidates := byName[strings.ToLower(unquoteALName(tokens[i]))]
+				if len(candidates) == 0 {
+					continue
+				}
+				previous := strings.ToLower(tokens[i-1])
+				for _, m := range candidates {
+					isObject := m.Object == ""
+					matched := previous == "." && (m.Kind == "field" || m.Kind == "procedure") ||
+						previous == "::" && (m.Kind == "value" || isObject) ||
+						isObject && objectReferenceKeywords[previous]
+					if matched {
+						result.References = append(result.References, ObsoleteReference{
+							URI: PathToFileURI(o.Path), Line: line, Text: strings.TrimSpace(text), Member: m,
+						})
+						break
+					}
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(result.References, func(i, j int) bool {
+		a, b := result.References[i], result.References[j]
+		if a.URI != b.URI {
+			return a.URI < b.URI
+		}
+		return a.Line < b.Line
+	})
+	return result
+}
+
+func obsoleteReferencesCommand(msg *Message, args []json.RawMessage, w WrapperInterface) (*Message, *Message) {
+	var cmdArgs struct {
+		// Project is a file or folder URI/path inside the project to check
+		Project string `json:"project"`
+	}
+	if err := decodeCommandArgs(args, &cmdArgs); err != nil {
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "Invalid "+ObsoleteReferencesCommand+" arguments: "+err.Error())
+	}
+	project := resolveCommandProject(cmdArgs.Project, w)
+	if project == "" {
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "No AL project found to check")
+	}
+
+	result := FindObsoleteReferences(w.WorkspaceRoot(), project, w)
+	w.Log("Found %d reference(s) to %d obsolete member(s) in %s", len(result.References), result.Members, project)
+	return newResultMessage(msg.ID, result)
+}
@@ -0,0 +1,297 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// The AL server answers go-to-definition on an overloaded procedure or an
+// event with every candidate declaration, in no particular order. The
+// wrapper reads the call at the cursor and each candidate's declaration and
+// puts the candidates whose parameter lists fit the call's arguments first.
+
+// callSiteLines is how many lines a call's argument list may span
+const callSiteLines = 20
+
+var (
+	// procedureDeclPattern matches a procedure declaration up to its parameter list
+	procedureDeclPattern  = regexp.MustCompile(`(?i)^\s*(?:(?:local|internal|protected)\s+)?procedure\s+("(?:[^"]|"")+"|[A-Za-z_][A-Za-z0-9_]*)\s*\(`)
+	integerLiteralPattern = regexp.MustCompile(`^-?\d+$`)
+	decimalLiteralPattern = regexp.MustCompile(`^-?\d+\.\d+$`)
+)
+
+// callSite is the procedure call at a definition request's position
+type callSite struct {
+	name string
+	// args are the argument expressions, or nil if the call has no argument list
+	args []string
+}
+
+// signatureParam is a parameter of a candidate declaration
+type signatureParam struct {
+	byRef bool
+	typ   string
+}
+
+// readCallSite returns the call at a position of an AL file, or false if the
+// position is not on an identifier
+func readCallSite(path string, pos Position) (callSite, bool) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return callSite{}, false
+	}
+	offset := positionOffset(content, pos)
+	text := string(content)
+
+	start, end := offset, offset
+	for start > 0 && isIdentifierByte(text[start-1]) {
+		start--
+	}
+	for end < len(text) && isIdentifierByte(text[end]) {
+		end++
+	}
+	if start == end {
+		return callSite{}, false
+	}
+	site := callSite{name: text[start:end]}
+
+	rest := strings.TrimLeft(text[end:], " \t")
+	if !strings.HasPrefix(rest, "(") {
+		return site, true
+	}
+	if lines := strings.SplitN(rest, "\n", callSiteLines+1); len(lines) > callSiteLines {
+		rest = strings.Join(lines[:callSiteLines], "\n")
+	}
+	if inner, ok := enclosedList(rest); ok {
+		site.args = append([]string{}, splitTopLevel(inner, ',')...)
+	}
+	return site, true
+}
+
+// readSignature returns the parameters of the procedure declared at a line of
+// an AL file, or false if no procedure is declared there
+func readSignature(path string, line int) ([]signatureParam, bool) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	lines := strings.Split(string(content), "\n")
+	if line < 0 || line >= len(lines) {
+		return nil, false
+	}
+	decl := procedureDeclPattern.FindStringIndex(lines[line])
+	if decl == nil {
+		return nil, false
+	}
+
+	last := min(line+callSiteLines, len(lines))
+	text := strings.Join(lines[line:last], "\n")[decl[1]-1:]
+	inner, ok := enclosedList(text)
+	if !ok {
+		return nil, false
+	}
+
+	var params []signatureParam
+	for _, part := range splitTopLevel(inner, ';') {
+		names, typ, _ := strings.Cut(part, ":")
+		names = strings.TrimSpace(names)
+		byRef := false
+		if rest, ok := cutKeyword(names, "var"); ok {
+			byRef, names = true, rest
+		}
+		// a, b: Integer declares two parameters
+		for range splitTopLevel(names, ',') {
+			params = append(params, signatureParam{byRef: byRef, typ: strings.ToLower(strings.TrimSpace(typ))})
+		}
+	}
+	return params, true
+}
+
+// enclosedList returns the text between the parenthesis text starts with and
+// its matching close, or false if it is not closed
+func enclosedList(text string) (string, bool) {
+	depth := 0
+	inString, inIdentifier := false, false
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case inString:
+			inString = c != '\''
+		case inIdentifier:
+			inIdentifier = c != '"'
+		case c == '\'':
+			inString = true
+		case c == '"':
+			inIdentifier = true
+		case c == '(' || c == '[':
+			depth++
+		case c == ')' || c == ']':
+			depth--
+			if depth == 0 {
+				return text[1:i], true
+			}
+		}
+	}
+	return "", false
+}
+
+// splitTopLevel splits text at separators outside parentheses, brackets,
+// string literals and quoted identifiers. Empty text has no parts.
+func splitTopLevel(text string, sep byte) []string {
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+	var parts []string
+	depth, last := 0, 0
+	inString, inIdentifier := false, false
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case inString:
+			inString = c != '\''
+		case inIdentifier:
+			inIdentifier = c != '"'
+		case c == '\'':
+			inString = true
+		case c == '"':
+			inIdentifier = true
+		case c == '(' || c == '[':
+			depth++
+		case c == ')' || c == ']':
+			depth--
+		case c == sep && depth == 0:
+			parts = append(parts, strings.TrimSpace(text[last:i]))
+			last = i + 1
+		}
+	}
+	return append(parts, strings.TrimSpace(text[last:]))
+}
+
+// cutKeyword removes a leading keyword followed by whitespace
+func cutKeyword(text string, keyword string) (string, bool) {
+	if len(text) > len(keyword) && strings.EqualFold(text[:len(keyword)], keyword) &&
+		(text[len(keyword)] == ' ' || text[len(keyword)] == '\t') {
+		return strings.TrimSpace(text[len(keyword):]), true
+	}
+	return text, false
+}
+
+func isIdentifierByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// literalType returns the AL types a literal argument fits, or nil if the
+// argument is not a literal
+func literalType(arg string) []string {
+	lower := strings.ToLower(arg)
+	switch {
+	case strings.HasPrefix(arg, "'"):
+		return []string{"text", "code", "label", "char", "guid"}
+	case lower == "true" || lower == "false":
+		return []string{"boolean"}
+	case integerLiteralPattern.MatchString(arg):
+		return []string{"integer", "biginteger", "decimal", "option", "char", "byte", "duration"}
+	case decimalLiteralPattern.MatchString(arg):
+		return []string{"decimal"}
+	}
+	return nil
+}
+
+// signatureScore rates how well a candidate's parameters fit a call's
+// arguments; higher is better
+func signatureScore(site callSite, params []signatureParam) int {
+	if site.args == nil {
+		return 0
+	}
+	score := 0
+	if len(site.args) == len(params) {
+		score += 10
+	} else {
+		diff := len(site.args) - len(params)
+		if diff < 0 {
+			diff = -diff
+		}
+		score -= 2 * diff
+	}
+	for i := 0; i < len(site.args) && i < len(params); i++ {
+		types := literalType(site.args[i])
+		if types == nil {
+			continue
+		}
+		if params[i].byRef {
+			// Literals cannot be passed by reference
+			score -= 3
+			continue
+		}
+		fits := false
+		for _, t := range types {
+			if strings.HasPrefix(params[i].typ, t) {
+				fits = true
+				break
+			}
+		}
+		if fits {
+			score += 2
+		} else {
+			score -= 3
+		}
+	}
+	return score
+}
+
+// rankDefinitionCandidates orders the locations of a multi-candidate
+// definition result by how well each declaration fits the call at the
+// request's position, best first. Candidates that cannot be read, such as
+// declarations in dependency packages, keep their relative order.
+func rankDefinitionCandidates(result json.RawMessage, filePath string, pos Position, w WrapperInterface) json.RawMessage {
+	var locations []map[string]json.RawMessage
+	if err := json.Unmarshal(result, &locations); err != nil || len(locations) < 2 {
+		return result
+	}
+	site, ok := readCallSite(filePath, pos)
+	if !ok || site.args == nil {
+		return result
+	}
+
+	scores := make([]int, len(locations))
+	for i, location := range locations {
+		var uri string
+		var r Range
+		if json.Unmarshal(location["uri"], &uri) == nil {
+			json.Unmarshal(location["range"], &r)
+		} else if json.Unmarshal(location["targetUri"], &uri) == nil {
+			// LocationLink
+			json.Unmarshal(location["targetSelectionRange"], &r)
+		}
+		path, err := FileURIToPath(uri)
+		if err != nil {
+			continue
+		}
+		if params, ok := readSignature(path, r.Start.Line); ok {
+			scores[i] = signatureScore(site, params)
+		}
+	}
+
+	order := make([]int, len(locations))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return scores[order[a]] > scores[order[b]] })
+	if sort.IntsAreSorted(order) {
+		return result
+	}
+
+	ranked := make([]map[string]json.RawMessage, len(locations))
+	for i, index := range order {
+		ranked[i] = locations[index]
+	}
+	data, err := json.Marshal(ranked)
+	if err != nil {
+		return result
+	}
+	w.Log("Ranked %d definition candidates for %s(%d arguments)", len(locations), site.name, len(site.args))
+	return data
+}
@@ -0,0 +1,216 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SearchPackagesCommand searches the symbol packages of a project's package
+// caches (.alpackages) for an object or member name
+const SearchPackagesCommand = "al-wrapper.searchPackages"
+
+// defaultPackageSearchResults caps the matches of a search without maxResults
+const defaultPackageSearchResults = 100
+
+// SearchPackagesArgs is the argument object of al-wrapper.searchPackages.
+// The argument may also be the name to search for itself.
+type SearchPackagesArgs struct {
+	// Query is the name, or part of it, of an object or member (quoted or not)
+	Query string `json:"query"`
+	// Project is a file or folder URI/path inside the project whose
+	// dependencies are searched (defaults to the active project)
+	Project string `json:"project"`
+	// Kind restricts the search to "object" or "member" names
+	Kind string `json:"kind"`
+	// MaxResults caps the matches returned (default 100)
+	MaxResults int `json:"maxResults"`
+}
+
+// PackageMatch is an object or member of a dependency package whose name
+// matches the query
+type PackageMatch struct {
+	// Kind is the object type, "field", "value", "procedure" or "event"
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// Object is the declaring object for members, e.g. `table 18 Customer`
+	Object string `json:"object,omitempty"`
+	// Source is the dependency app declaring it, e.g. `Base Application by Microsoft v24.0.16410.18056`
+	Source string `json:"source"`
+	// AppID is the declaring app's ID
+	AppID string `json:"appId,omitempty"`
+	// rank orders exact matches before prefix and substring matches
+	rank int
+}
+
+// SearchPackagesResult is returned by al-wrapper.searchPackages
+type SearchPackagesResult struct {
+	Query   string         `json:"query"`
+	Matches []PackageMatch `json:"matches"`
+	// Apps is the number of packages searched
+	Apps int `json:"apps"`
+	// Truncated is set when more matches were found than returned
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// eventAttributes mark the methods that are event publishers
+var eventAttributes = map[string]bool{"integrationevent": true, "businessevent": true, "internalevent": true}
+
+// packageNameRank ranks how a name matches a lower-case query: 0 exact,
+// 1 prefix, 2 substring, -1 no match
+func packageNameRank(name string, query string) int {
+	name = strings.ToLower(name)
+	switch {
+	case name == query:
+		return 0
+	case strings.HasPrefix(name, query):
+		return 1
+	case strings.Contains(name, query):
+		return 2
+	}
+	return -1
+}
+
+// search appends the objects and members of the namespace whose names match
+func (n *symbolReferenceObjects) search(matches []PackageMatch, query string, kind string, app AppManifest) []PackageMatch {
+	source := fmt.Sprintf("%s by %s v%s", app.Name, app.Publisher, app.Version)
+	lists := []struct {
+		typ     string
+		entries []symbolReferenceMember
+	}{
+		{"table", n.Tables}, {"tableextension", n.TableExtensions},
+		{"page", n.Pages}, {"pageextension", n.PageExtensions},
+		{"codeunit", n.Codeunits},
+		{"report", n.Reports}, {"reportextension", n.ReportExtensions},
+		{"query", n.Queries}, {"xmlport", n.XmlPorts},
+		{"enum", n.EnumTypes}, {"enumextension", n.EnumExtensionTypes},
+		{"interface", n.Interfaces},
+	}
+	for _, list := range lists {
+		for i := range list.entries {
+			entry := &list.entries[i]
+			if kind != "member" {
+				if rank := packageNameRank(entry.Name, query); rank >= 0 {
+					matches = append(matches, PackageMatch{Kind: list.typ, Name: entry.Name, Source: source, AppID: app.ID, rank: rank})
+				}
+			}
+			if kind == "object" {
+				continue
+			}
+			object := ALObject{Type: list.typ, ID: entry.ID, Name: entry.Name}.DisplayName()
+			children := []struct {
+				kind    string
+				entries []symbolReferenceMember
+			}{
+				{"field", entry.Fields}, {"value", entry.Values}, {"procedure", entry.Methods},
+			}
+			for _, child := range children {
+				for j := range child.entries {
+					member := &child.entries[j]
+					rank := packageNameRank(member.Name, query)
+					if rank < 0 {
+						continue
+					}
+					memberKind := child.kind
+					for _, attribute := range member.Attributes {
+						if eventAttributes[strings.ToLower(attribute.Name)] {
+							memberKind = "event"
+						}
+					}
+					matches = append(matches, PackageMatch{
+						Kind: memberKind, Name: member.Name, Object: object, Source: source, AppID: app.ID, rank: rank,
+					})
+				}
+			}
+		}
+	}
+	for i := range n.Namespaces {
+		matches = n.Namespaces[i].search(matches, query, kind, app)
+	}
+	return matches
+}
+
+// SearchPackages searches the dependency packages of a project for objects
+// and members whose names contain query, exact matches first
+func SearchPackages(project string, args SearchPackagesArgs, w WrapperInterface) SearchPackagesResult {
+	query := unquoteALName(strings.TrimSpace(args.Query))
+	result := SearchPackagesResult{Query: query, Matches: []PackageMatch{}}
+	lower := strings.ToLower(query)
+
+	seen := make(map[string]bool)
+	for _, app := range w.DependencyPackages(project) {
+		// Packages are sorted newest first; older versions of an app are skipped
+		key := app.ID
+		if key == "" {
+			key = app.Path
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		objects, err := w.SymbolStore().objects(app)
+		if err != nil {
+			w.Log("Skipping package in search: %v", err)
+			continue
+		}
+		result.Apps++
+		result.Matches = objects.search(result.Matches, lower, args.Kind, app)
+	}
+
+	sort.SliceStable(result.Matches, func(i, j int) bool {
+		a, b := result.Matches[i], result.Matches[j]
+		if a.rank != b.rank {
+			return a.rank < b.rank
+		}
+		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+	})
+	limit := args.MaxResults
+	if limit <= 0 {
+		limit = defaultPackageSearchResults
+	}
+	if len(result.Matches) > limit {
+		result.Matches = result.Matches[:limit]
+		result.Truncated = true
+	}
+	return result
+}
+
+// decodeSearchPackagesArgs accepts the argument object or a bare name
+func decodeSearchPackagesArgs(args []json.RawMessage) (SearchPackagesArgs, error) {
+	var cmdArgs SearchPackagesArgs
+	if len(args) == 0 || string(args[0]) == "null" {
+		return cmdArgs, fmt.Errorf("missing query")
+	}
+	if json.Unmarshal(args[0], &cmdArgs.Query) == nil {
+		return cmdArgs, nil
+	}
+	err := decodeCommandArgs(args, &cmdArgs)
+	return cmdArgs, err
+}
+
+func searchPackagesCommand(msg *Message, args []json.RawMessage, w WrapperInterface) (*Message, *Message) {
+	cmdArgs, err := decodeSearchPackagesArgs(args)
+	if err == nil && strings.TrimSpace(cmdArgs.Query) == "" {
+		err = fmt.Errorf("missing query")
+	}
+	if err == nil && cmdArgs.Kind != "" && cmdArgs.Kind != "object" && cmdArgs.Kind != "member" {
+		err = fmt.Errorf("kind must be \"object\" or \"member\", not %q", cmdArgs.Kind)
+	}
+	if err != nil {
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "Invalid "+SearchPackagesCommand+" arguments: "+err.Error())
+	}
+
+	project := resolveCommandProject(cmdArgs.Project, w)
+	if project == "" {
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "No AL project found to search")
+	}
+
+	start := time.Now()
+	result := SearchPackages(project, cmdArgs, w)
+	w.Log("Found %d match(es) of %q in %d package(s) in %s", len(result.Matches), result.Query, result.Apps,
+		time.Since(start).Round(time.Millisecond))
+	return newResultMessage(msg.ID, result)
+}
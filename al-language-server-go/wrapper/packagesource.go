@@ -0,0 +1,533 @@
+package wrapper
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A definition into a dependency points at a document the AL server shows
+// from the symbol package (an al-preview: URI or a path inside the .app),
+// which Claude cannot open. With dependencies.extractSources on, the wrapper
+// writes the object to a real file and rewrites the location to it:
+//
+//   - the object's source file, when the package includes its sources
+//   - else a stub generated from the package's SymbolReference.json, declaring
+//     the object's fields, values and procedures without bodies
+//
+// Files go to <temp>/al-lsp-wrapper-sources/<publisher>_<app>_<version>, once
+// per package version. Locations in extracted sources keep their range;
+// locations in stubs point at the declaration of the symbol that was looked
+// up, or of the object.
+//
+// The AL server finds references in the workspace only. With the opt-in
+// references.packages, the sources of the dependency packages are searched
+// for the identifier too, like references.textFallback searches the
+// workspace, and the files with matches are extracted the same way.
+
+// packageSources caches which entry of a package holds each object's source
+type packageSources struct {
+	mu sync.Mutex
+	// entries maps package paths to object keys to source entry names; a
+	// package without sources has an empty map
+	entries map[string]map[string]string
+	// files maps package paths and object keys to extracted or generated files
+	files map[string]packageSourceFile
+}
+
+// packageSourceFile is a file written for a package object
+type packageSourceFile struct {
+	path      string
+	generated bool
+}
+
+func newPackageSources() *packageSources {
+	return &packageSources{
+		entries: make(map[string]map[string]string),
+		files:   make(map[string]packageSourceFile),
+	}
+}
+
+// packageObjectKey identifies an object within a package by type and name
+func packageObjectKey(typ string, name string) string {
+	return strings.ToLower(typ) + " " + strings.ToLower(name)
+}
+
+// unsafeFileNameChars matches characters kept out of generated file names
+var unsafeFileNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// packageSourcesDir returns the directory the files of a package are written to
+func packageSourcesDir(app AppManifest) string {
+	dir := unsafeFileNameChars.ReplaceAllString(app.Publisher+"_"+app.Name+"_"+app.Version, "_")
+	return filepath.Join(os.TempDir(), appDirName+"-sources", dir)
+}
+
+// DependencySource returns a file holding an object of a dependency package:
+// its source extracted from the package, or a stub generated from its symbols
+// when the package has no source for it (generated is then true)
+func (w *ALLSPWrapper) DependencySource(app AppManifest, object AppObject) (string, bool, error) {
+	return w.sources.file(app, object, w.symbolStore, w.Log)
+}
+
+// file extracts or generates the file of a package object, once
+func (s *packageSources) file(app AppManifest, object AppObject, store *SymbolStore, logf func(format string, args ...interface{})) (string, bool, error) {
+	key := packageObjectKey(object.Type, object.Name)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if f, ok := s.files[app.Path+"|"+key]; ok {
+		if _, err := os.Stat(f.path); err == nil {
+			return f.path, f.generated, nil
+		}
+	}
+
+	entries, ok := s.entries[app.Path]
+	if !ok {
+		var err error
+		if entries, err = readPackageSourceEntries(app.Path); err != nil {
+			return "", false, err
+		}
+		s.entries[app.Path] = entries
+		logf("Indexed %d object source(s) in %s", len(entries), filepath.Base(app.Path))
+	}
+
+	var f packageSourceFile
+	var err error
+	if entry, ok := entries[key]; ok {
+		f.path, err = extractPackageEntry(app, entry)
+	} else {
+		f.path, err = writePackageStub(app, object, store)
+		f.generated = true
+	}
+	if err != nil {
+		return "", false, err
+	}
+	s.files[app.Path+"|"+key] = f
+	return f.path, f.generated, nil
+}
+
+// readPackageSourceEntries maps the objects declared by the .al files of a
+// package to their entry names
+func readPackageSourceEntries(appPath string) (map[string]string, error) {
+	pkg, err := OpenAppFile(appPath)
+	if err != nil {
+		return nil, err
+	}
+	defer pkg.Close()
+
+	entries := make(map[string]string)
+	for _, f := range pkg.Sources() {
+		rc, err := f.Open()
+		if err != nil {
+			continue
+		}
+		// The declaration is near the top; only that much is decompressed
+		scanner := bufio.NewScanner(rc)
+		for scanner.Scan() {
+			if m := objectDeclPattern.FindStringSubmatch(maskALNonCode(scanner.Text())); m != nil {
+				entries[packageObjectKey(m[1], unquoteALName(m[3]))] = f.Name
+				break
+			}
+		}
+		rc.Close()
+	}
+	return entries, nil
+}
+
+// packageEntryPath returns the file an entry of a package is extracted to
+func packageEntryPath(app AppManifest, entry string) (string, error) {
+	dir := packageSourcesDir(app)
+	target := filepath.Join(dir, filepath.FromSlash(entry))
+	if !isWithin(target, dir) {
+		return "", fmt.Errorf("invalid entry %q in %s", entry, filepath.Base(app.Path))
+	}
+	return target, nil
+}
+
+// extractPackageEntry writes an entry of a package to its sources directory
+func extractPackageEntry(app AppManifest, entry string) (string, error) {
+	target, err := packageEntryPath(app, entry)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(target); err == nil {
+		return target, nil
+	}
+
+	pkg, err := OpenAppFile(app.Path)
+	if err != nil {
+		return "", err
+	}
+	defer pkg.Close()
+	data, err := pkg.ReadEntry(entry)
+	if err != nil {
+		return "", err
+	}
+	return target, writePackageSourceFile(target, data)
+}
+
+// writePackageSourceFile writes a file through a temporary file, so a
+// concurrent reader never sees it half written
+func writePackageSourceFile(target string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	tmp := target + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, target)
+}
+
+// stubTypeDefinition is the type of a field, parameter or return value in
+// SymbolReference.json
+type stubTypeDefinition struct {
+	Name    string `json:"Name"`
+	Subtype *struct {
+		Name string `json:"Name"`
+	} `json:"Subtype"`
+}
+
+// String renders the type as AL declares it, e.g. Record Customer
+func (t *stubTypeDefinition) String() string {
+	if t == nil || t.Name == "" {
+		return ""
+	}
+	if t.Subtype != nil && t.Subtype.Name != "" {
+		return t.Name + " " + quoteALName(t.Subtype.Name)
+	}
+	return t.Name
+}
+
+// writePackageStub generates the stub of an object from the package's symbols
+func writePackageStub(app AppManifest, object AppObject, store *SymbolStore) (string, error) {
+	objects, err := store.objects(app)
+	if err != nil {
+		return "", err
+	}
+	symbol := objects.find(object)
+	if symbol == nil {
+		return "", fmt.Errorf("%s not found in %s", ALObject{Type: object.Type, ID: object.ID, Name: object.Name}.DisplayName(), filepath.Base(app.Path))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "// Generated from the symbols of %q by %s v%s, which include no source\n", app.Name, app.Publisher, app.Version)
+	fmt.Fprintf(&b, "// for this object. Procedure bodies are omitted.\n")
+	b.WriteString(ALObject{Type: object.Type, ID: symbol.ID, Name: symbol.Name, Extends: object.Extends}.DisplayName() + "\n{\n")
+	if len(symbol.Fields) > 0 {
+		b.WriteString("    fields\n    {\n")
+		for _, field := range symbol.Fields {
+			fmt.Fprintf(&b, "        field(%d; %s; %s) { }\n", field.ID, quoteALName(field.Name), field.TypeDefinition.String())
+		}
+		b.WriteString("    }\n")
+	}
+	for _, value := range symbol.Values {
+		fmt.Fprintf(&b, "    value(%d; %s) { }\n", value.Ordinal, quoteALName(value.Name))
+	}
+	for _, method := range symbol.Methods {
+		var params []string
+		for _, p := range method.Parameters {
+			param := quoteALName(p.Name) + ": " + p.TypeDefinition.String()
+			if p.IsVar {
+				param = "var " + param
+			}
+			params = append(params, param)
+		}
+		signature := fmt.Sprintf("    procedure %s(%s)", quoteALName(method.Name), strings.Join(params, "; "))
+		if returns := method.ReturnTypeDefinition.String(); returns != "" {
+			signature += ": " + returns
+		}
+		b.WriteString(signature + ";\n")
+	}
+	b.WriteString("}\n")
+
+	name := unsafeFileNameChars.ReplaceAllString(symbol.Name, "") + "." + strings.ToUpper(object.Type[:1]) + object.Type[1:] + ".stub.al"
+	target := filepath.Join(packageSourcesDir(app), name)
+	return target, writePackageSourceFile(target, []byte(b.String()))
+}
+
+// find returns the object of a type with an ID or name, searching namespaces
+func (n *symbolReferenceObjects) find(object AppObject) *symbolReferenceMember {
+	lists := map[string][]symbolReferenceMember{
+		"table": n.Tables, "tableextension": n.TableExtensions,
+		"page": n.Pages, "pageextension": n.PageExtensions,
+		"codeunit": n.Codeunits, "report": n.Reports, "reportextension": n.ReportExtensions,
+		"query": n.Queries, "xmlport": n.XmlPorts,
+		"enum": n.EnumTypes, "enumextension": n.EnumExtensionTypes, "interface": n.Interfaces,
+	}
+	entries := lists[object.Type]
+	for i := range entries {
+		if (object.ID > 0 && entries[i].ID == object.ID) || strings.EqualFold(entries[i].Name, object.Name) {
+			return &entries[i]
+		}
+	}
+	for i := range n.Namespaces {
+		if found := n.Namespaces[i].find(object); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// packageURISegment matches the object type and ID segments of a package
+// document URI, e.g. .../Table/18/Customer.dal
+var packageURISegment = regexp.MustCompile(`(?i)/(` + strings.Join(alObjectTypes, "|") + `)/(\d+)(?:/|$)`)
+
+// packageLocationObject returns the object of a dependency package a
+// location's URI names, by type and ID or by the document's name
+func packageLocationObject(uri string, objects []AppObject) (AppObject, bool) {
+	target := uri
+	if decoded, err := url.PathUnescape(uri); err == nil {
+		target = decoded
+	}
+	target = strings.ReplaceAll(target, "\\", "/")
+
+	if m := packageURISegment.FindStringSubmatch(target); m != nil {
+		id, _ := strconv.Atoi(m[2])
+		for _, object := range objects {
+			if strings.EqualFold(object.Type, m[1]) && object.ID == id {
+				return object, true
+			}
+		}
+	}
+
+	// Customer.dal, Customer.Table.dal or Customer.Table.al
+	stem := path.Base(target)
+	if i := strings.IndexAny(stem, "?#"); i >= 0 {
+		stem = stem[:i]
+	}
+	stem = strings.TrimSuffix(strings.TrimSuffix(stem, path.Ext(stem)), ".al")
+	typ := ""
+	if i := strings.LastIndex(stem, "."); i >= 0 && alObjectTypeNames[strings.ToLower(stem[i+1:])] {
+		stem, typ = stem[:i], strings.ToLower(stem[i+1:])
+	}
+	for _, object := range objects {
+		if (typ == "" || object.Type == typ) && compactSymbolName(object.Name) == compactSymbolName(stem) {
+			return object, true
+		}
+	}
+	return AppObject{}, false
+}
+
+// alObjectTypeNames is the set of alObjectTypes
+var alObjectTypeNames = func() map[string]bool {
+	names := make(map[string]bool)
+	for _, typ := range alObjectTypes {
+		names[typ] = true
+	}
+	return names
+}()
+
+// isPackageDocument reports whether a location's document cannot be opened
+// from disk: a non-file URI, or a file that does not exist
+func isPackageDocument(uri string) bool {
+	if !strings.HasPrefix(uri, "file:") {
+		return true
+	}
+	path, err := FileURIToPath(uri)
+	if err != nil {
+		return true
+	}
+	_, err = os.Stat(path)
+	return err != nil
+}
+
+// extractDefinitionSources rewrites the locations of a definition result that
+// point into dependency packages to files extracted or generated from the
+// packages. The name looked up at the position places locations in stubs.
+func extractDefinitionSources(result json.RawMessage, filePath string, pos Position, w WrapperInterface) json.RawMessage {
+	if isEmptyDefinitionResult(result) {
+		return result
+	}
+	projectRoot := NormalizePath(GetProjectRoot(filePath))
+	var locations []map[string]interface{}
+	single := false
+	if err := json.Unmarshal(result, &locations); err != nil {
+		var location map[string]interface{}
+		if err := json.Unmarshal(result, &location); err != nil || location == nil {
+			return result
+		}
+		locations, single = []map[string]interface{}{location}, true
+	}
+
+	var apps []AppManifest
+	changed := false
+	for _, location := range locations {
+		uriKey, rangeKeys := "uri", []string{"range"}
+		if _, ok := location["targetUri"]; ok {
+			// LocationLink
+			uriKey, rangeKeys = "targetUri", []string{"targetRange", "targetSelectionRange"}
+		}
+		uri, _ := location[uriKey].(string)
+		if uri == "" || !isPackageDocument(uri) {
+			continue
+		}
+		if apps == nil {
+			apps = w.DependencyPackages(projectRoot)
+		}
+		app := packageForLocation(uri, projectRoot, apps)
+		if app == nil {
+			continue
+		}
+		object, ok := packageLocationObject(uri, w.DependencyObjects(*app))
+		if !ok {
+			w.Log("No object of %s matches definition location %s", app.Name, uri)
+			continue
+		}
+		path, generated, err := w.DependencySource(*app, object)
+		if err != nil {
+			w.Log("Failed to extract the source of %s: %v", object.Name, err)
+			continue
+		}
+
+		location[uriKey] = PathToFileURI(path)
+		if generated {
+			var symbol string
+			if content, err := os.ReadFile(filePath); err == nil {
+				_, symbol, _ = wordAt(content, pos)
+			}
+			r := stubDeclarationRange(path, symbol)
+			for _, key := range rangeKeys {
+				location[key] = r
+			}
+		}
+		changed = true
+		w.Log("Definition in %s rewritten to %s", app.Name, path)
+	}
+	if !changed {
+		return result
+	}
+
+	var data []byte
+	var err error
+	if single {
+		data, err = json.Marshal(locations[0])
+	} else {
+		data, err = json.Marshal(locations)
+	}
+	if err != nil {
+		return result
+	}
+	return data
+}
+
+// packageReferences searches the sources of a file's dependency packages for
+// the identifier at a position. Files with matches are extracted; the search
+// stops once limit locations are found (0 for no limit).
+func packageReferences(filePath string, pos Position, includeDeclaration bool, limit int, w WrapperInterface) []Location {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil
+	}
+	_, name, ok := identifierAt(content, pos)
+	if !ok {
+		return nil
+	}
+	name = unquoteALName(name)
+	needle := []byte(strings.ToLower(name))
+
+	projectRoot := NormalizePath(GetProjectRoot(filePath))
+	apps := w.DependencyPackages(projectRoot)
+	progress := w.BeginProgress("Searching dependency packages for " + name)
+	defer progress.End("")
+
+	var locations []Location
+	seen := make(map[string]bool)
+	for i, app := range apps {
+		// Packages are sorted newest first; older versions of an app are skipped
+		key := app.ID
+		if key == "" {
+			key = app.Path
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		progress.Report(app.Name, i*100/len(apps))
+
+		found := 0
+		err := func() error {
+			pkg, err := OpenAppFile(app.Path)
+			if err != nil {
+				return err
+			}
+			defer pkg.Close()
+			for _, f := range pkg.Sources() {
+				if limit > 0 && len(locations) >= limit {
+					return nil
+				}
+				data, err := readZipEntry(f)
+				if err != nil || !bytes.Contains(bytes.ToLower(data), needle) {
+					continue
+				}
+				target, err := packageEntryPath(app, f.Name)
+				if err != nil {
+					continue
+				}
+				if _, err := os.Stat(target); err != nil {
+					if err := writePackageSourceFile(target, data); err != nil {
+						return err
+					}
+				}
+				matches := findIdentifier(target, name, includeDeclaration)
+				found += len(matches)
+				locations = append(locations, matches...)
+			}
+			return nil
+		}()
+		if err != nil {
+			w.Log("Skipping package in references: %v", err)
+		}
+		if found > 0 {
+			w.Log("Found %d textual reference(s) of %s in %s", found, name, app.Name)
+		}
+	}
+	return locations
+}
+
+// stubDeclarationRange returns the range of a symbol's name in the field,
+// value or procedure declaration of a stub, or of the object declaration
+func stubDeclarationRange(path string, symbol string) Range {
+	lines := readLines(path)
+	name := strings.Trim(symbol, `"`)
+	objectLine := 0
+	for i, line := range lines {
+		if objectDeclPattern.MatchString(line) {
+			objectLine = i
+			break
+		}
+	}
+	if name != "" {
+		for i, line := range lines {
+			trimmed := strings.TrimSpace(line)
+			var declared string
+			switch {
+			case strings.HasPrefix(trimmed, "field("), strings.HasPrefix(trimmed, "value("):
+				parts := strings.SplitN(trimmed[strings.Index(trimmed, "(")+1:], ";", 3)
+				if len(parts) > 1 {
+					declared = strings.TrimSuffix(strings.TrimSpace(parts[1]), ")")
+				}
+			case strings.HasPrefix(trimmed, "procedure "):
+				declared, _, _ = strings.Cut(strings.TrimPrefix(trimmed, "procedure "), "(")
+			}
+			if declared == "" || !strings.EqualFold(unquoteALName(declared), name) {
+				continue
+			}
+			start := strings.Index(line, declared)
+			return Range{
+				Start: Position{Line: i, Character: utf16Length(line[:start])},
+				End:   Position{Line: i, Character: utf16Length(line[:start+len(declared)])},
+			}
+		}
+	}
+	return Range{Start: Position{Line: objectLine}, End: Position{Line: objectLine}}
+}
@@ -0,0 +1,311 @@
+package wrapper
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// PageControlsCommand returns a page's source table and its layout control
+// tree, with the table fields the controls are bound to
+const PageControlsCommand = "al-wrapper.pageControls"
+
+var (
+	// pageControlPattern matches a layout control or extension anchor and its
+	// parenthesized arguments
+	pageControlPattern = regexp.MustCompile(`(?i)^\s*(area|group|repeater|cuegroup|grid|fixed|field|part|systempart|usercontrol|label|addfirst|addlast|addafter|addbefore|movefirst|movelast|moveafter|movebefore|modify)\s*\(`)
+	// layoutSectionPattern matches the start of a page's layout section
+	layoutSectionPattern = regexp.MustCompile(`(?i)^\s*layout\b`)
+	// pagePropertyPattern matches an object-level page property, Name = Value;
+	pagePropertyPattern = regexp.MustCompile(`(?i)^\s*(SourceTable|PageType)\s*=\s*(.+?)\s*;`)
+	// recFieldPattern matches a field expression bound to the source record,
+	// Rec."No.", Rec.Name, "No." or Name
+	recFieldPattern = regexp.MustCompile(`(?i)^(?:Rec\s*\.\s*)?("(?:[^"]|"")+"|[A-Za-z_][A-Za-z0-9_]*)$`)
+)
+
+// PageControlsArgs is the argument object of al-wrapper.pageControls. The
+// argument may also be the page's name or ID itself.
+type PageControlsArgs struct {
+	// Page is the page name (quoted or not) or ID
+	Page string `json:"page"`
+	// Project is a file or folder URI/path inside the project whose
+	// dependencies are searched for the source table (defaults to the active project)
+	Project string `json:"project"`
+}
+
+// PageControl is a node of a page's layout: an area, group, field, part, ...
+// or, in page extensions, an anchor such as addafter(Name)
+type PageControl struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// Expression is a field's source expression or a part's page
+	Expression string `json:"expression,omitempty"`
+	// Field is the source table field a field control is bound to
+	Field *TableField `json:"field,omitempty"`
+	// Line is the zero-based line of the declaration
+	Line     int            `json:"line"`
+	Children []*PageControl `json:"children,omitempty"`
+}
+
+// PageExtensionControls is the layout added or changed by a page extension
+type PageExtensionControls struct {
+	Extension string         `json:"extension"`
+	URI       string         `json:"uri"`
+	Controls  []*PageControl `json:"controls"`
+}
+
+// PageControlsResult is returned by al-wrapper.pageControls
+type PageControlsResult struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	PageType string `json:"pageType,omitempty"`
+	URI      string `json:"uri"`
+	// SourceTable is the table name as declared, unquoted
+	SourceTable string `json:"sourceTable,omitempty"`
+	// SourceTableID is 0 if the table could not be resolved
+	SourceTableID int                     `json:"sourceTableId,omitempty"`
+	Controls      []*PageControl          `json:"controls"`
+	Extensions    []PageExtensionControls `json:"extensions"`
+}
+
+// pageLayout is the parsed layout of one page or page extension
+type pageLayout struct {
+	object      ALObject
+	pageType    string
+	sourceTable string
+	controls    []*PageControl
+}
+
+// parsePageFile reads the layouts of the pages and page extensions declared
+// in an AL file. Actions are not part of the layout and are skipped.
+func parsePageFile(path string) []pageLayout {
+	objects := parseObjectFile(path)
+	if len(objects) == 0 {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	type openControl struct {
+		control *PageControl
+		depth   int
+	}
+
+	var layouts []pageLayout
+	var current *pageLayout
+	var stack []openControl
+	var pending *PageControl
+	next := 0
+	depth := 0
+	layoutDepth := 0 // depth of the layout block, 0 outside it
+	layoutPending := false
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	inComment := false
+	for line := 0; scanner.Scan(); line++ {
+		if next < len(objects) && objects[next].Line == line {
+			current = nil
+			if o := objects[next]; o.Type == "page" || o.Type == "pageextension" {
+				layouts = append(layouts, pageLayout{object: o})
+				current = &layouts[len(layouts)-1]
+			}
+			next++
+			stack, pending = nil, nil
+			layoutDepth, layoutPending = 0, false
+		}
+		code, stillInComment := stripALComments(scanner.Text(), inComment)
+		inComment = stillInComment
+
+		if current != nil {
+			switch {
+			case depth == 1 && layoutSectionPattern.MatchString(code):
+				layoutPending = true
+			case depth == 1:
+				if m := pagePropertyPattern.FindStringSubmatch(code); m != nil {
+					if strings.EqualFold(m[1], "SourceTable") {
+						current.sourceTable = unquoteALName(m[2])
+					} else {
+						current.pageType = m[2]
+					}
+				}
+			case layoutDepth > 0:
+				if m := pageControlPattern.FindStringSubmatch(code); m != nil {
+					pending = newPageControl(strings.ToLower(m[1]), code, line)
+					if len(stack) > 0 {
+						parent := stack[len(stack)-1].control
+						parent.Children = append(parent.Children, pending)
+					} else {
+						current.controls = append(current.controls, pending)
+					}
+				}
+			}
+		}
+
+		for i := 0; i < len(code); i++ {
+			switch code[i] {
+			case '{':
+				depth++
+				if layoutPending {
+					layoutDepth, layoutPending = depth, false
+				} else if pending != nil {
+					stack = append(stack, openControl{control: pending, depth: depth})
+					pending = nil
+				}
+			case '}':
+				if len(stack) > 0 && stack[len(stack)-1].depth == depth {
+					stack = stack[:len(stack)-1]
+				}
+				if depth == layoutDepth {
+					layoutDepth = 0
+				}
+				if depth > 0 {
+					depth--
+				}
+			}
+		}
+	}
+	return layouts
+}
+
+// newPageControl creates the control declared on a line
+func newPageControl(kind string, code string, line int) *PageControl {
+	control := &PageControl{Kind: kind, Line: line}
+	inner, ok := enclosedList(code[strings.Index(code, "("):])
+	if !ok {
+		return control
+	}
+	parts := splitTopLevel(inner, ';')
+	if len(parts) > 0 {
+		control.Name = unquoteALName(parts[0])
+	}
+	if len(parts) > 1 {
+		control.Expression = parts[1]
+	}
+	return control
+}
+
+// bindPageFields sets the source table field of field controls whose
+// expression refers to the source record
+func bindPageFields(controls []*PageControl, fields []TableField) {
+	byName := make(map[string]*TableField, len(fields))
+	for i := range fields {
+		byName[strings.ToLower(fields[i].Name)] = &fields[i]
+	}
+	for _, control := range controls {
+		if control.Kind == "field" {
+			if m := recFieldPattern.FindStringSubmatch(control.Expression); m != nil {
+				control.Field = byName[strings.ToLower(unquoteALName(m[1]))]
+			}
+		}
+		bindPageFields(control.Children, fields)
+	}
+}
+
+// FindPageControls returns the layout of a page declared in the workspace's
+// source files, with the page extensions of the workspace. It returns false
+// if no page has the given name or ID.
+func FindPageControls(workspaceRoot string, project string, page string, w WrapperInterface) (*PageControlsResult, bool) {
+	var layouts []pageLayout
+	for _, root := range workspaceProjects(workspaceRoot, project) {
+		objects, _ := ScanProjectObjects(root)
+		files := make(map[string]bool)
+		for _, o := range objects {
+			if (o.Type == "page" || o.Type == "pageextension") && !files[o.Path] {
+				files[o.Path] = true
+				layouts = append(layouts, parsePageFile(o.Path)...)
+			}
+		}
+	}
+
+	var base *pageLayout
+	for i := range layouts {
+		if isObjectNamed(layouts[i].object, "page", page) {
+			base = &layouts[i]
+			break
+		}
+	}
+	if base == nil {
+		return nil, false
+	}
+
+	result := &PageControlsResult{
+		ID:          base.object.ID,
+		Name:        base.object.Name,
+		PageType:    base.pageType,
+		URI:         PathToFileURI(base.object.Path),
+		SourceTable: base.sourceTable,
+		Controls:    base.controls,
+		Extensions:  []PageExtensionControls{},
+	}
+	if result.Controls == nil {
+		result.Controls = []*PageControl{}
+	}
+	for _, layout := range layouts {
+		if layout.object.Type == "pageextension" && strings.EqualFold(layout.object.Extends, base.object.Name) {
+			result.Extensions = append(result.Extensions, PageExtensionControls{
+				Extension: layout.object.DisplayName(),
+				URI:       PathToFileURI(layout.object.Path),
+				Controls:  layout.controls,
+			})
+		}
+	}
+
+	if base.sourceTable != "" {
+		if table, ok := FindTableFields(workspaceRoot, project, base.sourceTable, w); ok {
+			result.SourceTableID = table.ID
+			bindPageFields(result.Controls, table.Fields)
+			for _, extension := range result.Extensions {
+				bindPageFields(extension.Controls, table.Fields)
+			}
+		}
+	}
+	return result, true
+}
+
+// decodePageControlsArgs accepts the argument object or a bare page name or ID
+func decodePageControlsArgs(args []json.RawMessage) (PageControlsArgs, error) {
+	var cmdArgs PageControlsArgs
+	if len(args) == 0 || string(args[0]) == "null" {
+		return cmdArgs, fmt.Errorf("missing page")
+	}
+	var number int
+	if json.Unmarshal(args[0], &number) == nil {
+		cmdArgs.Page = strconv.Itoa(number)
+		return cmdArgs, nil
+	}
+	if json.Unmarshal(args[0], &cmdArgs.Page) == nil {
+		return cmdArgs, nil
+	}
+	err := decodeCommandArgs(args, &cmdArgs)
+	return cmdArgs, err
+}
+
+func pageControlsCommand(msg *Message, args []json.RawMessage, w WrapperInterface) (*Message, *Message) {
+	cmdArgs, err := decodePageControlsArgs(args)
+	if err == nil && strings.TrimSpace(cmdArgs.Page) == "" {
+		err = fmt.Errorf("missing page")
+	}
+	if err != nil {
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "Invalid "+PageControlsCommand+" arguments: "+err.Error())
+	}
+
+	project := resolveCommandProject(cmdArgs.Project, w)
+	if project == "" && w.WorkspaceRoot() == "" {
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "No AL project found to search")
+	}
+
+	result, ok := FindPageControls(w.WorkspaceRoot(), project, strings.TrimSpace(cmdArgs.Page), w)
+	if !ok {
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "Page not found in the workspace: "+cmdArgs.Page)
+	}
+	w.Log("Read layout of page %s (source table %q)", result.Name, result.SourceTable)
+	return newResultMessage(msg.ID, result)
+}
@@ -2,6 +2,7 @@ package wrapper
 
 import (
 	"fmt"
+	"io/fs"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -20,42 +21,44 @@ type alExtensionVersion struct {
 	patch   int
 }
 
-// FindALExtension locates the newest AL extension in VS Code extensions directory
+// FindALExtension locates the newest AL extension in the VS Code extensions
+// directory or the wrapper-managed extensions directory (see the install subcommand)
 func FindALExtension() (string, error) {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return "", fmt.Errorf("failed to get home directory: %w", err)
-	}
-
-	extensionsDir := filepath.Join(home, ".vscode", "extensions")
-	entries, err := os.ReadDir(extensionsDir)
-	if err != nil {
-		return "", fmt.Errorf("failed to read VS Code extensions directory: %w", err)
+	var searchDirs []string
+	if home, err := os.UserHomeDir(); err == nil {
+		searchDirs = append(searchDirs, filepath.Join(home, ".vscode", "extensions"))
 	}
+	searchDirs = append(searchDirs, GetManagedExtensionsDir())
 
 	// Find all AL extensions matching the pattern ms-dynamics-smb.al-*
 	pattern := regexp.MustCompile(`^ms-dynamics-smb\.al-(\d+)\.(\d+)\.(\d+)$`)
 	var alExtensions []alExtensionVersion
 
-	for _, entry := range entries {
-		if entry.IsDir() {
-			matches := pattern.FindStringSubmatch(entry.Name())
-			if matches != nil {
-				major, _ := strconv.Atoi(matches[1])
-				minor, _ := strconv.Atoi(matches[2])
-				patch, _ := strconv.Atoi(matches[3])
-				alExtensions = append(alExtensions, alExtensionVersion{
-					path:  filepath.Join(extensionsDir, entry.Name()),
-					major: major,
-					minor: minor,
-					patch: patch,
-				})
+	for _, extensionsDir := range searchDirs {
+		entries, err := os.ReadDir(extensionsDir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				matches := pattern.FindStringSubmatch(entry.Name())
+				if matches != nil {
+					major, _ := strconv.Atoi(matches[1])
+					minor, _ := strconv.Atoi(matches[2])
+					patch, _ := strconv.Atoi(matches[3])
+					alExtensions = append(alExtensions, alExtensionVersion{
+						path:  filepath.Join(extensionsDir, entry.Name()),
+						major: major,
+						minor: minor,
+						patch: patch,
+					})
+				}
 			}
 		}
 	}
 
 	if len(alExtensions) == 0 {
-		return "", fmt.Errorf("AL extension not found in %s", extensionsDir)
+		return "", fmt.Errorf("AL extension not found in %s (run `al-lsp-wrapper install` to download it)", strings.Join(searchDirs, " or "))
 	}
 
 	// Sort by version (newest first) using proper semver comparison
@@ -72,34 +75,41 @@ func FindALExtension() (string, error) {
 	return alExtensions[0].path, nil
 }
 
-// GetALLSPExecutable returns the path to the AL Language Server executable
-func GetALLSPExecutable(extensionPath string) string {
-	var binDir, executable string
-
-	switch runtime.GOOS {
-	case "windows":
-		binDir = "win32"
-		executable = "Microsoft.Dynamics.Nav.EditorServices.Host.exe"
-	case "linux":
-		binDir = "linux"
-		executable = "Microsoft.Dynamics.Nav.EditorServices.Host"
-	case "darwin":
-		binDir = "darwin"
-		executable = "Microsoft.Dynamics.Nav.EditorServices.Host"
-	default:
-		binDir = "win32"
-		executable = "Microsoft.Dynamics.Nav.EditorServices.Host.exe"
+// ALExtensionVersion returns the version part of an AL extension directory
+// (e.g. "17.0.1998613" for ms-dynamics-smb.al-17.0.1998613), or "" if unknown
+func ALExtensionVersion(extensionPath string) string {
+	base := filepath.Base(extensionPath)
+	if !strings.HasPrefix(base, "ms-dynamics-smb.al-") {
+		return ""
 	}
+	return strings.TrimPrefix(base, "ms-dynamics-smb.al-")
+}
 
-	return filepath.Join(extensionPath, "bin", binDir, executable)
+// GetALLSPExecutable returns the path to the AL Language Server executable
+func GetALLSPExecutable(extensionPath string) string {
+	return SelectALLSPExecutable(extensionPath).Path
 }
 
-// FileURIToPath converts a file:// URI to a local file path
+// FileURIToPath converts a file:// URI to a local file path.
+// The path is decoded exactly once, so names with spaces, dashes, unicode or
+// a literal percent sign (C:\Users\Name\OneDrive - Company\Übersicht 100%)
+// survive the round trip through PathToFileURI. VS Code's escaped drive colon
+// (file:///c%3A/...) is accepted too. On Windows, paths on a mapped network
+// drive or SUBST drive are returned with the drive letter (see drives.go).
 func FileURIToPath(uri string) (string, error) {
 	if !strings.HasPrefix(uri, "file://") {
 		return uri, nil // Return as-is if not a file URI
 	}
+	path, err := fileURIPath(uri)
+	if err != nil {
+		return "", err
+	}
+	return canonicalDrivePath(path), nil
+}
 
+// fileURIPath converts a file:// URI to the path it names, as is
+func fileURIPath(uri string) (string, error) {
+	// url.Parse decodes the path (%20 for spaces, etc.)
 	parsed, err := url.Parse(uri)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse URI: %w", err)
@@ -107,61 +117,107 @@ func FileURIToPath(uri string) (string, error) {
 
 	path := parsed.Path
 
-	// On Windows, file URIs look like file:///C:/path
-	// url.Parse gives us /C:/path, we need C:/path
-	if runtime.GOOS == "windows" && len(path) >= 3 && path[0] == '/' && path[2] == ':' {
-		path = path[1:]
-	}
-
-	// URL decode the path (handles %20 for spaces, etc.)
-	decoded, err := url.PathUnescape(path)
-	if err != nil {
-		return "", fmt.Errorf("failed to decode path: %w", err)
+	if runtime.GOOS == "windows" {
+		// UNC paths have the server as host: file://server/share/path
+		if parsed.Host != "" && !strings.EqualFold(parsed.Host, "localhost") {
+			return `\\` + parsed.Host + filepath.FromSlash(path), nil
+		}
+		// On Windows, file URIs look like file:///C:/path
+		// url.Parse gives us /C:/path, we need C:/path
+		if len(path) >= 3 && path[0] == '/' && path[2] == ':' {
+			path = path[1:]
+		}
+		return normalizeDriveLetter(filepath.FromSlash(path)), nil
 	}
 
-	return decoded, nil
+	return path, nil
 }
 
-// PathToFileURI converts a local file path to a file:// URI
+// PathToFileURI converts a local file path to a file:// URI, percent-encoding
+// the characters of each segment that are not allowed in a URI path, e.g.
+// file:///C:/Users/Name/OneDrive%20-%20Company/App/Customer.Table.al
 func PathToFileURI(path string) string {
 	// Normalize path separators
-	path = filepath.ToSlash(path)
+	path = filepath.ToSlash(canonicalDrivePath(path))
+
+	// UNC paths have the server as host: file://server/share/path
+	if runtime.GOOS == "windows" && strings.HasPrefix(path, "//") {
+		host, share, _ := strings.Cut(path[2:], "/")
+		return (&url.URL{Scheme: "file", Host: host, Path: "/" + share}).String()
+	}
 
 	// On Windows, we need file:///C:/path
-	if runtime.GOOS == "windows" && len(path) >= 2 && path[1] == ':' {
-		return "file:///" + url.PathEscape(path)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
 	}
 
-	// On Unix, we need file:///path
-	return "file://" + url.PathEscape(path)
+	return (&url.URL{Scheme: "file", Path: path}).String()
 }
 
-// NormalizePath returns a normalized absolute path
+// NormalizePath returns a normalized absolute path. On Windows the drive
+// letter is upper-cased, as clients send c: and C: for the same folder, and
+// paths on a mapped network drive or SUBST drive use the drive letter.
+// Reparse points, such as OneDrive folders, are deliberately not resolved:
+// the path stays the one the user opened.
 func NormalizePath(path string) string {
 	absPath, err := filepath.Abs(path)
 	if err != nil {
 		return path
 	}
-	return filepath.Clean(absPath)
+	return canonicalDrivePath(normalizeDriveLetter(filepath.Clean(absPath)))
 }
 
-// GetLogPath returns the path for the log file
-func GetLogPath() string {
-	var tempDir string
-
-	if runtime.GOOS == "windows" {
-		tempDir = os.Getenv("TEMP")
-		if tempDir == "" {
-			tempDir = os.Getenv("TMP")
-		}
-		if tempDir == "" {
-			tempDir = filepath.Join(os.Getenv("USERPROFILE"), "AppData", "Local", "Temp")
-		}
-	} else {
-		tempDir = "/tmp"
+// normalizeDriveLetter upper-cases the drive letter of a Windows path
+func normalizeDriveLetter(path string) string {
+	if runtime.GOOS == "windows" && len(path) >= 2 && path[1] == ':' {
+		return strings.ToUpper(path[:1]) + path[1:]
 	}
+	return path
+}
 
-	return filepath.Join(tempDir, "al-lsp-wrapper-go.log")
+// walkDir is filepath.WalkDir, but also descends into directories reached
+// through links: OneDrive folders are reparse points on Windows, which
+// WalkDir reports as links and does not enter, so projects under
+// "OneDrive - Company" would have no files. A directory reached again through
+// another link is skipped, so link loops end.
+func walkDir(root string, fn fs.WalkDirFunc) error {
+	var followed []os.FileInfo
+	if info, err := os.Stat(root); err == nil {
+		followed = append(followed, info)
+	}
+	stopped := false
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			path = filepath.Clean(path)
+			if err != nil || path == filepath.Clean(dir) || d.Type()&fs.ModeSymlink == 0 {
+				err = fn(path, d, err)
+				stopped = stopped || err == filepath.SkipAll
+				return err
+			}
+			info, statErr := os.Stat(path)
+			if statErr != nil || !info.IsDir() {
+				err = fn(path, d, nil)
+				stopped = stopped || err == filepath.SkipAll
+				return err
+			}
+			for _, seen := range followed {
+				if os.SameFile(seen, info) {
+					return nil
+				}
+			}
+			followed = append(followed, info)
+			// A trailing separator makes WalkDir resolve the link it starts at
+			if err := walk(path + string(filepath.Separator)); err != nil || stopped {
+				if stopped {
+					return filepath.SkipAll
+				}
+				return err
+			}
+			return nil
+		})
+	}
+	return walk(root)
 }
 
 // ExtractSymbolFromPath extracts a symbol name from a file path
@@ -0,0 +1,227 @@
+package wrapper
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"testing"
+)
+
+func TestFileURIToPath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("POSIX paths")
+	}
+	tests := []struct {
+		name string
+		uri  string
+		want string
+	}{
+		{"plain", "file:///home/dev/App/Customer.Table.al", "/home/dev/App/Customer.Table.al"},
+		{"spaces", "file:///home/dev/My%20App/Customer%20Card.Page.al", "/home/dev/My App/Customer Card.Page.al"},
+		{"dashes", "file:///home/dev/claude-code-lsps/test-al-project/a-b.al", "/home/dev/claude-code-lsps/test-al-project/a-b.al"},
+		{"onedrive", "file:///home/dev/OneDrive%20-%20Company/App/src/Customer.Table.al", "/home/dev/OneDrive - Company/App/src/Customer.Table.al"},
+		{"unicode", "file:///home/dev/%C3%9Cbersicht/K%C3%B8b.Codeunit.al", "/home/dev/Übersicht/Køb.Codeunit.al"},
+		{"percent", "file:///home/dev/Sales%20100%25/a.al", "/home/dev/Sales 100%/a.al"},
+		{"hash", "file:///home/dev/App%20%231/a.al", "/home/dev/App #1/a.al"},
+		{"question mark", "file:///home/dev/Why%3F/a.al", "/home/dev/Why?/a.al"},
+		{"not a file URI", "untitled:Untitled-1", "untitled:Untitled-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FileURIToPath(tt.uri)
+			if err != nil {
+				t.Fatalf("FileURIToPath(%q) error: %v", tt.uri, err)
+			}
+			if got != tt.want {
+				t.Errorf("FileURIToPath(%q) = %q, want %q", tt.uri, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileURIToPathWindows(t *testing.T) {
+	if runtime.GOOS != "windows" {
+		t.Skip("Windows paths")
+	}
+	tests := []struct {
+		name string
+		uri  string
+		want string
+	}{
+		{"drive", "file:///C:/Users/Dev/App/a.al", `C:\Users\Dev\App\a.al`},
+		{"lower-case drive", "file:///c:/Users/Dev/App/a.al", `C:\Users\Dev\App\a.al`},
+		{"escaped colon", "file:///c%3A/Users/Dev/App/a.al", `C:\Users\Dev\App\a.al`},
+		{"onedrive", "file:///C:/Users/Dev/OneDrive%20-%20Company/App/a.al", `C:\Users\Dev\OneDrive - Company\App\a.al`},
+		{"unicode", "file:///C:/Users/Dev/%C3%9Cbersicht%20100%25/a.al", `C:\Users\Dev\Übersicht 100%\a.al`},
+		{"hash and question mark", "file:///C:/Users/Dev/App%20%231%3F/a.al", `C:\Users\Dev\App #1?\a.al`},
+		{"UNC", "file://server/share/App/a.al", `\\server\share\App\a.al`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FileURIToPath(tt.uri)
+			if err != nil {
+				t.Fatalf("FileURIToPath(%q) error: %v", tt.uri, err)
+			}
+			if got != tt.want {
+				t.Errorf("FileURIToPath(%q) = %q, want %q", tt.uri, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPathToFileURI(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("POSIX paths")
+	}
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"plain", "/home/dev/App/Customer.Table.al", "file:///home/dev/App/Customer.Table.al"},
+		{"spaces", "/home/dev/My App/Customer Card.Page.al", "file:///home/dev/My%20App/Customer%20Card.Page.al"},
+		{"dashes", "/home/dev/claude-code-lsps/a-b.al", "file:///home/dev/claude-code-lsps/a-b.al"},
+		{"onedrive", "/home/dev/OneDrive - Company/App/a.al", "file:///home/dev/OneDrive%20-%20Company/App/a.al"},
+		{"unicode", "/home/dev/Übersicht/Køb.Codeunit.al", "file:///home/dev/%C3%9Cbersicht/K%C3%B8b.Codeunit.al"},
+		{"percent", "/home/dev/Sales 100%/a.al", "file:///home/dev/Sales%20100%25/a.al"},
+		{"hash", "/home/dev/App #1/a.al", "file:///home/dev/App%20%231/a.al"},
+		{"question mark", "/home/dev/Why?/a.al", "file:///home/dev/Why%3F/a.al"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := PathToFileURI(tt.path)
+			if got != tt.want {
+				t.Errorf("PathToFileURI(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+			back, err := FileURIToPath(got)
+			if err != nil {
+				t.Fatalf("FileURIToPath(%q) error: %v", got, err)
+			}
+			if back != tt.path {
+				t.Errorf("round trip of %q = %q", tt.path, back)
+			}
+		})
+	}
+}
+
+func TestNormalizePath(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"relative", filepath.Join("App", "a.al"), filepath.Join(cwd, "App", "a.al")},
+		{"dot segments", filepath.Join("App", "src", "..", "a.al"), filepath.Join(cwd, "App", "a.al")},
+		{"trailing separator", filepath.Join("OneDrive - Company", "App") + string(filepath.Separator), filepath.Join(cwd, "OneDrive - Company", "App")},
+		{"unicode", filepath.Join("Übersicht 100%", "App #1?"), filepath.Join(cwd, "Übersicht 100%", "App #1?")},
+	}
+	if runtime.GOOS == "windows" {
+		tests = append(tests, struct {
+			name string
+			path string
+			want string
+		}{"lower-case drive", `c:\Users\Dev\App`, `C:\Users\Dev\App`})
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizePath(tt.path); got != tt.want {
+				t.Errorf("NormalizePath(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+// writeTestFile creates a file and its parent directories
+func writeTestFile(t *testing.T, path string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProjectWalk(t *testing.T) {
+	tests := []struct {
+		name string
+		dir  string
+	}{
+		{"plain", "App"},
+		{"spaces", "My App"},
+		{"dashes", "test-al-project"},
+		{"onedrive", filepath.Join("OneDrive - Company", "App")},
+		{"unicode", "Übersicht 100%"},
+		{"hash and question mark", "App #1?"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if runtime.GOOS == "windows" && tt.name == "hash and question mark" {
+				t.Skip("? is not allowed in Windows file names")
+			}
+			workspace := NormalizePath(t.TempDir())
+			project := filepath.Join(workspace, tt.dir)
+			writeTestFile(t, filepath.Join(project, "app.json"))
+			writeTestFile(t, filepath.Join(project, "src", "Customer.Table.al"))
+			writeTestFile(t, filepath.Join(project, ".alpackages", "Dependency.al"))
+
+			projects := workspaceProjects(workspace, "")
+			if len(projects) != 1 || projects[0] != project {
+				t.Errorf("workspaceProjects = %q, want [%q]", projects, project)
+			}
+			files := alSourceFiles(project)
+			want := filepath.Join(project, "src", "Customer.Table.al")
+			if len(files) != 1 || files[0] != want {
+				t.Errorf("alSourceFiles = %q, want [%q]", files, want)
+			}
+			if got := GetProjectRoot(want); got != project {
+				t.Errorf("GetProjectRoot(%q) = %q, want %q", want, got, project)
+			}
+		})
+	}
+}
+
+func TestProjectWalkFollowsLinks(t *testing.T) {
+	// OneDrive folders are reparse points, which WalkDir reports as links
+	workspace := NormalizePath(t.TempDir())
+	target := filepath.Join(t.TempDir(), "OneDrive - Company", "App")
+	writeTestFile(t, filepath.Join(target, "app.json"))
+	writeTestFile(t, filepath.Join(target, "src", "Customer.Table.al"))
+	link := filepath.Join(workspace, "App")
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("cannot create links: %v", err)
+	}
+	// A link back to the workspace must not loop
+	if err := os.Symlink(workspace, filepath.Join(target, "src", "loop")); err != nil {
+		t.Fatal(err)
+	}
+
+	projects := workspaceProjects(workspace, "")
+	if len(projects) != 1 || projects[0] != link {
+		t.Errorf("workspaceProjects = %q, want [%q]", projects, link)
+	}
+
+	var files []string
+	err := walkDir(workspace, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walkDir error: %v", err)
+	}
+	sort.Strings(files)
+	want := []string{
+		filepath.Join(link, "app.json"),
+		filepath.Join(link, "src", "Customer.Table.al"),
+	}
+	if len(files) != len(want) || files[0] != want[0] || files[1] != want[1] {
+		t.Errorf("walkDir files = %q, want %q", files, want)
+	}
+}
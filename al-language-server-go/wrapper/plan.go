@@ -0,0 +1,452 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SShadowS/claude-code-lsps/al-language-server-go/internal/project"
+)
+
+// al-lsp-wrapper plan <dir> prints what the wrapper would do for a workspace
+// without starting the AL server: the AL extension and binary it would run,
+// the settings sources in precedence order and the keys each one sets, the
+// AL projects it would initialize with their package caches, dependencies
+// and code analysis settings, and the warm state it would replay. It reads
+// the same files the wrapper reads on startup, so configuration issues show
+// up without a session.
+
+// InitPlan is what the wrapper would do on startup for a workspace
+type InitPlan struct {
+	WorkspaceDir string `json:"workspaceDir"`
+	// Disabled is why the wrapper is disabled for the workspace, if it is
+	Disabled         string `json:"disabled,omitempty"`
+	ExtensionPath    string `json:"extensionPath,omitempty"`
+	ExtensionVersion string `json:"extensionVersion,omitempty"`
+	ExtensionError   string `json:"extensionError,omitempty"`
+	Executable       string `json:"executable,omitempty"`
+	ExecutableExists bool   `json:"executableExists"`
+	ExecutableAdvice string `json:"executableAdvice,omitempty"`
+	// Settings are the settings sources, lowest precedence first
+	Settings []PlanSettingsSource `json:"settings"`
+	// Projects are the AL projects of the workspace
+	Projects []PlanProject `json:"projects"`
+	// WarmStart describes the saved state replayed on startup
+	WarmStart string `json:"warmStart"`
+}
+
+// PlanSettingsSource is a settings source and the keys it sets
+type PlanSettingsSource struct {
+	Source string `json:"source"`
+	// Status is "built in", "loaded", "not found", "invalid: ..." or, for
+	// initializationOptions, a note that the client sends them
+	Status string            `json:"status"`
+	Keys   []PlanSettingsKey `json:"keys,omitempty"`
+}
+
+// PlanSettingsKey is a setting (section.key) set by a source
+type PlanSettingsKey struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+	// OverriddenBy is the later source setting the key again
+	OverriddenBy string `json:"overriddenBy,omitempty"`
+	// Unknown is set for keys the wrapper does not have, which are ignored
+	Unknown bool `json:"unknown,omitempty"`
+	// UserOnly is set for keys only the user config file may set, which are
+	// ignored in other sources
+	UserOnly bool `json:"userOnly,omitempty"`
+}
+
+// PlanProject is an AL project of the workspace
+type PlanProject struct {
+	Root      string `json:"root"`
+	Name      string `json:"name,omitempty"`
+	Publisher string `json:"publisher,omitempty"`
+	Version   string `json:"version,omitempty"`
+	// Error is why the project cannot be initialized
+	Error string `json:"error,omitempty"`
+	// Startup is set for the project the AL server is initialized with;
+	// the others are initialized on the first request for one of their files
+	Startup bool `json:"startup"`
+	// WorkspaceClosure is the project and the workspace projects it depends on
+	WorkspaceClosure     []string         `json:"workspaceClosure"`
+	PackageCaches        []PlanPath       `json:"packageCaches"`
+	Dependencies         []PlanDependency `json:"dependencies"`
+	AssemblyProbingPaths []PlanPath       `json:"assemblyProbingPaths"`
+	CodeAnalysis         PlanCodeAnalysis `json:"codeAnalysis"`
+}
+
+// PlanPath is a directory the AL server is given, and what it holds
+type PlanPath struct {
+	Path   string `json:"path"`
+	Exists bool   `json:"exists"`
+	// Apps is the number of .app packages in a package cache
+	Apps int `json:"apps"`
+}
+
+// PlanDependency is a dependency of a project and the package satisfying it
+type PlanDependency struct {
+	Name      string `json:"name"`
+	Publisher string `json:"publisher"`
+	Version   string `json:"version"`
+	// Package is the .app found for the dependency, empty if it is missing
+	Package        string `json:"package,omitempty"`
+	PackageVersion string `json:"packageVersion,omitempty"`
+	// Source is the workspace project satisfying the dependency from its
+	// sources, if there is one
+	Source string `json:"source,omitempty"`
+	// Problem is why the dependency is not satisfied
+	Problem string `json:"problem,omitempty"`
+}
+
+// PlanCodeAnalysis are the code analysis settings a project is loaded with
+type PlanCodeAnalysis struct {
+	Enabled    bool     `json:"enabled"`
+	Background string   `json:"background"`
+	Analyzers  []string `json:"analyzers"`
+	RuleSet    string   `json:"ruleSet,omitempty"`
+}
+
+// BuildInitPlan works out what the wrapper would do for a workspace
+func BuildInitPlan(workspaceDir string) *InitPlan {
+	workspaceDir = NormalizePath(workspaceDir)
+	plan := &InitPlan{
+		WorkspaceDir: workspaceDir,
+		Disabled:     DisabledReason(workspaceDir),
+	}
+
+	if extensionPath, err := FindALExtension(); err != nil {
+		plan.ExtensionError = err.Error()
+	} else {
+		plan.ExtensionPath = extensionPath
+		plan.ExtensionVersion = ALExtensionVersion(extensionPath)
+		selection := SelectALLSPExecutable(extensionPath)
+		plan.Executable = selection.Path
+		plan.ExecutableAdvice = selection.Advice
+		_, statErr := os.Stat(selection.Path)
+		plan.ExecutableExists = statErr == nil
+	}
+
+	plan.Settings = planSettings(workspaceDir)
+
+	startup := ""
+	if appJSON := FindAppJSON(workspaceDir, 5); appJSON != "" {
+		startup = NormalizePath(filepath.Dir(appJSON))
+	}
+	cfg, _ := LoadConfig(workspaceDir)
+	apps := workspaceApps(workspaceDir, startup)
+	for _, root := range workspaceProjects(workspaceDir, startup) {
+		project := planProject(root, apps, cfg.DotNet)
+		if path, source := ruleSetPath(root, workspaceDir, cfg.RuleSet, func(string, ...interface{}) {}); path != "" {
+			project.CodeAnalysis.RuleSet = path + " (" + source + ")"
+		}
+		project.Startup = root == startup
+		project.WorkspaceClosure = dependencyClosure(apps, root)
+		plan.Projects = append(plan.Projects, project)
+	}
+
+	plan.WarmStart = planWarmStart(workspaceDir)
+	return plan
+}
+
+// planSettings lists the settings sources LoadConfig reads, and the client's
+// initializationOptions applied over them
+func planSettings(workspaceDir string) []PlanSettingsSource {
+	known := settingsKeys(mustMarshal(DefaultConfig()))
+	sources := []PlanSettingsSource{{Source: "defaults", Status: "built in"}}
+
+	for _, path := range GetConfigPaths(workspaceDir) {
+		source := PlanSettingsSource{Source: path, Status: "loaded"}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			source.Status = "not found"
+			if !os.IsNotExist(err) {
+				source.Status = "unreadable: " + err.Error()
+			}
+			sources = append(sources, source)
+			continue
+		}
+		if err := DefaultConfig().ApplyJSON(data, path); err != nil {
+			source.Status = "invalid: " + err.Error()
+		}
+		keys := settingsKeys(StripJSONComments(data))
+		for _, key := range sortedKeys(keys) {
+			_, isKnown := known[key]
+			userOnly := path != GetUserConfigPath() && isUserOnlySetting(key)
+			source.Keys = append(source.Keys, PlanSettingsKey{Key: key, Value: keys[key], Unknown: !isKnown, UserOnly: userOnly})
+		}
+		sources = append(sources, source)
+	}
+
+	// A key set again by a later source is overridden
+	for i := range sources {
+		for j := range sources[i].Keys {
+			for _, later := range sources[i+1:] {
+				for _, key := range later.Keys {
+					if key.Key == sources[i].Keys[j].Key && !key.UserOnly {
+						sources[i].Keys[j].OverriddenBy = later.Source
+					}
+				}
+			}
+		}
+	}
+
+	return append(sources, PlanSettingsSource{
+		Source: "initializationOptions",
+		Status: "sent by the client in initialize; overrides every file",
+	})
+}
+
+// settingsKeys returns the section.key settings of a config document
+func settingsKeys(data []byte) map[string]json.RawMessage {
+	var sections map[string]json.RawMessage
+	json.Unmarshal(data, &sections)
+	keys := make(map[string]json.RawMessage)
+	for section, value := range sections {
+		var values map[string]json.RawMessage
+		if json.Unmarshal(value, &values) != nil {
+			keys[section] = value
+			continue
+		}
+		for key, value := range values {
+			keys[section+"."+key] = value
+		}
+	}
+	return keys
+}
+
+// sortedKeys returns the keys of a map, sorted
+func sortedKeys(m map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// mustMarshal marshals a value that always marshals
+func mustMarshal(v interface{}) []byte {
+	data, _ := json.Marshal(v)
+	return data
+}
+
+// planProject reads what a project would be initialized with; apps are the
+// workspace's projects, which satisfy dependencies from their sources
+func planProject(root string, apps map[string]*project.App, dotNet DotNetConfig) PlanProject {
+	planned := PlanProject{Root: root}
+	if err := checkProjectManifest(root, filepath.Join(root, "app.json")); err != nil {
+		planned.Error = err.Error()
+	}
+	manifest := &project.App{}
+	if app, err := readProjectApp(root); err == nil {
+		manifest = app
+	}
+	planned.Name, planned.Publisher, planned.Version = manifest.Name, manifest.Publisher, manifest.Version
+
+	settings := NewWorkspaceSettings(root).ALResourceConfigurationSettings
+	var packages []AppManifest
+	for _, dir := range packageCacheDirs(root) {
+		cache := PlanPath{Path: dir}
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			cache.Exists = true
+			files, _ := filepath.Glob(filepath.Join(dir, "*.app"))
+			cache.Apps = len(files)
+			for _, file := range files {
+				if app, err := ReadAppManifest(file); err == nil {
+					packages = append(packages, *app)
+				}
+			}
+		}
+		planned.PackageCaches = append(planned.PackageCaches, cache)
+	}
+	for _, dir := range assemblyProbingPaths(root, dotNet) {
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(root, dir)
+		}
+		info, err := os.Stat(dir)
+		planned.AssemblyProbingPaths = append(planned.AssemblyProbingPaths, PlanPath{Path: filepath.Clean(dir), Exists: err == nil && info.IsDir()})
+	}
+	planned.CodeAnalysis = PlanCodeAnalysis{
+		Enabled:    settings.EnableCodeAnalysis,
+		Background: settings.BackgroundCodeAnalysis,
+		Analyzers:  settings.CodeAnalyzers,
+	}
+
+	// The platform and application versions are the Microsoft System and
+	// Application packages
+	var dependencies []PlanDependency
+	if manifest.Platform != "" {
+		dependencies = append(dependencies, PlanDependency{Name: "System", Publisher: "Microsoft", Version: manifest.Platform})
+	}
+	if manifest.Application != "" {
+		dependencies = append(dependencies, PlanDependency{Name: "Application", Publisher: "Microsoft", Version: manifest.Application})
+	}
+	for _, dep := range manifest.Dependencies {
+		dependencies = append(dependencies, PlanDependency{Name: dep.Name, Publisher: dep.Publisher, Version: dep.Version})
+	}
+	for i := range dependencies {
+		dep := &dependencies[i]
+		if source := workspaceDependency(*dep, apps); source != "" {
+			dep.Source = source
+			continue
+		}
+		resolveDependency(dep, packages)
+	}
+	planned.Dependencies = dependencies
+	return planned
+}
+
+// workspaceDependency returns the workspace project a dependency names, if any
+func workspaceDependency(dep PlanDependency, apps map[string]*project.App) string {
+	ref := project.Dependency{Name: dep.Name, Publisher: dep.Publisher}
+	for _, root := range sortedProjectRoots(apps) {
+		if ref.RefersTo(apps[root]) {
+			return root
+		}
+	}
+	return ""
+}
+
+// resolveDependency finds the newest package of a dependency in the package caches
+func resolveDependency(dep *PlanDependency, apps []AppManifest) {
+	var best *AppManifest
+	for i := range apps {
+		app := &apps[i]
+		if !strings.EqualFold(app.Name, dep.Name) || !strings.EqualFold(app.Publisher, dep.Publisher) {
+			continue
+		}
+		if best == nil || compareAppVersions(app.Version, best.Version) > 0 {
+			best = app
+		}
+	}
+	if best == nil {
+		dep.Problem = "no package in the package caches; download symbols"
+		return
+	}
+	dep.Package, dep.PackageVersion = best.Path, best.Version
+	if dep.Version != "" && compareAppVersions(best.Version, dep.Version) < 0 {
+		dep.Problem = fmt.Sprintf("package version %s is older than the required %s", best.Version, dep.Version)
+	}
+}
+
+// planWarmStart describes the saved state replayed for a workspace
+func planWarmStart(workspaceDir string) string {
+	cfg, _ := LoadConfig(workspaceDir)
+	if !cfg.WarmStart.Enabled {
+		return "disabled (warmStart.enabled is false)"
+	}
+	state, err := loadWarmState(workspaceDir)
+	if err != nil {
+		return "saved state unreadable: " + err.Error()
+	}
+	if state == nil {
+		return "no saved state; the symbol index is built from scratch"
+	}
+	return fmt.Sprintf("replays %d project(s) and the symbol index saved %s (%s)",
+		len(state.Projects), state.SavedAt.Format(time.RFC3339), warmStatePath(workspaceDir))
+}
+
+// Write prints the plan for humans
+func (p *InitPlan) Write(out io.Writer) {
+	fmt.Fprintf(out, "Workspace: %s\n", p.WorkspaceDir)
+	if p.Disabled != "" {
+		fmt.Fprintf(out, "The wrapper is DISABLED for this workspace: %s\n", p.Disabled)
+	}
+
+	fmt.Fprintln(out, "\nAL server")
+	if p.ExtensionError != "" {
+		fmt.Fprintf(out, "  extension:  not found: %s\n", p.ExtensionError)
+	} else {
+		fmt.Fprintf(out, "  extension:  %s (%s)\n", p.ExtensionPath, p.ExtensionVersion)
+		status := "found"
+		if !p.ExecutableExists {
+			status = "MISSING"
+		}
+		fmt.Fprintf(out, "  executable: %s (%s)\n", p.Executable, status)
+		if p.ExecutableAdvice != "" {
+			fmt.Fprintf(out, "              %s\n", p.ExecutableAdvice)
+		}
+	}
+
+	fmt.Fprintln(out, "\nSettings (lowest precedence first)")
+	for i, source := range p.Settings {
+		fmt.Fprintf(out, "  %d. %s: %s\n", i+1, source.Source, source.Status)
+		for _, key := range source.Keys {
+			note := ""
+			if key.Unknown {
+				note = "  (unknown setting, ignored)"
+			} else if key.UserOnly {
+				note = "  (ignored: only the user config file may set it)"
+			} else if key.OverriddenBy != "" {
+				note = "  (overridden by " + key.OverriddenBy + ")"
+			}
+			fmt.Fprintf(out, "       %s = %s%s\n", key.Key, key.Value, note)
+		}
+	}
+
+	fmt.Fprintf(out, "\nProjects (%d)\n", len(p.Projects))
+	if len(p.Projects) == 0 {
+		fmt.Fprintln(out, "  none: no app.json under the workspace; requests degrade to single files")
+	}
+	for _, project := range p.Projects {
+		fmt.Fprintf(out, "  %s\n", project.Root)
+		if project.Name != "" {
+			fmt.Fprintf(out, "    app:          %q by %s v%s\n", project.Name, project.Publisher, project.Version)
+		}
+		if project.Startup {
+			fmt.Fprintln(out, "    startup:      the AL server is initialized with this project")
+		} else {
+			fmt.Fprintln(out, "    startup:      initialized on the first request for one of its files")
+		}
+		if project.Error != "" {
+			fmt.Fprintf(out, "    ERROR:        %s\n", project.Error)
+		}
+		if len(project.WorkspaceClosure) > 1 {
+			fmt.Fprintf(out, "    closure:      %s\n", strings.Join(project.WorkspaceClosure, ", "))
+		}
+		for _, cache := range project.PackageCaches {
+			if cache.Exists {
+				fmt.Fprintf(out, "    packages:     %s (%d .app)\n", cache.Path, cache.Apps)
+			} else {
+				fmt.Fprintf(out, "    packages:     %s (missing)\n", cache.Path)
+			}
+		}
+		for _, dep := range project.Dependencies {
+			status := "found " + filepath.Base(dep.Package) + " v" + dep.PackageVersion
+			if dep.Source != "" {
+				status = "workspace project " + dep.Source
+			} else if dep.Problem != "" {
+				status = dep.Problem
+			}
+			fmt.Fprintf(out, "    dependency:   %q by %s %s: %s\n", dep.Name, dep.Publisher, dep.Version, status)
+		}
+		for _, path := range project.AssemblyProbingPaths {
+			status := ""
+			if !path.Exists {
+				status = " (missing)"
+			}
+			fmt.Fprintf(out, "    assemblies:   %s%s\n", path.Path, status)
+		}
+		analysis := "off"
+		if project.CodeAnalysis.Enabled {
+			analysis = "on, background " + project.CodeAnalysis.Background
+		}
+		analyzers := "none"
+		if len(project.CodeAnalysis.Analyzers) > 0 {
+			analyzers = strings.Join(project.CodeAnalysis.Analyzers, ", ")
+		}
+		ruleSet := "none"
+		if project.CodeAnalysis.RuleSet != "" {
+			ruleSet = project.CodeAnalysis.RuleSet
+		}
+		fmt.Fprintf(out, "    analysis:     %s; analyzers: %s; ruleset: %s\n", analysis, analyzers, ruleSet)
+	}
+
+	fmt.Fprintf(out, "\nWarm start: %s\n", p.WarmStart)
+}
@@ -0,0 +1,226 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// Handlers parse a request's params into their own types, which drops the
+// client's workDoneToken and partialResultToken before the request reaches
+// the AL server. The scope of a client request remembers both tokens and
+// puts them back on the request that answers it:
+//
+//   - the workDoneToken goes to the first request sent for the client's
+//     method (al/gotodefinition for definition), so the AL server's progress
+//     reaches the client. A token may carry one begin/end sequence, so each
+//     token is handed out once, to the server or to the wrapper.
+//   - the partialResultToken goes only to requests whose results the wrapper
+//     passes on unchanged; results the wrapper rewrites (sorted references,
+//     mapped code actions) are returned whole in the response instead
+//
+// The AL server's $/progress for client tokens is forwarded to the client.
+// When the wrapper answers a request itself (call hierarchy, the textual
+// references fallback, wrapper commands) it reports progress on the
+// workDoneToken the server did not get.
+
+// answeringMethods are the AL server methods a client method is answered
+// with besides itself
+var answeringMethods = map[string][]string{
+	"textDocument/definition":  {"al/gotodefinition"},
+	"textDocument/declaration": {"al/gotodefinition", "textDocument/definition"},
+}
+
+// partialResultMethods are handled by handlers that pass the AL server's
+// results on unchanged, so streamed results may go straight to the client.
+// Requests no handler handles are passed on unchanged too.
+var partialResultMethods = map[string]bool{
+	"textDocument/documentHighlight":    true,
+	"textDocument/foldingRange":         true,
+	"textDocument/selectionRange":       true,
+	"textDocument/codeLens":             true,
+	"textDocument/semanticTokens/full":  true,
+	"textDocument/semanticTokens/range": true,
+}
+
+// clientProgress holds the progress tokens of a client request
+type clientProgress struct {
+	method        string
+	workDone      json.RawMessage
+	partialResult json.RawMessage
+	// passThrough is set when no handler rewrites the method's results
+	passThrough bool
+
+	mu sync.Mutex
+	// workDoneTaken is set once the workDoneToken was handed out
+	workDoneTaken bool
+}
+
+// newClientProgress returns the progress tokens of a client request, nil if
+// it has none
+func newClientProgress(msg *Message, passThrough bool) *clientProgress {
+	var params struct {
+		WorkDoneToken      json.RawMessage `json:"workDoneToken"`
+		PartialResultToken json.RawMessage `json:"partialResultToken"`
+	}
+	if !msg.IsRequest() || json.Unmarshal(msg.Params, &params) != nil {
+		return nil
+	}
+	if isProgressToken(params.WorkDoneToken) || isProgressToken(params.PartialResultToken) {
+		progress := &clientProgress{method: msg.Method, passThrough: passThrough}
+		if isProgressToken(params.WorkDoneToken) {
+			progress.workDone = params.WorkDoneToken
+		}
+		if isProgressToken(params.PartialResultToken) {
+			progress.partialResult = params.PartialResultToken
+		}
+		return progress
+	}
+	return nil
+}
+
+// isProgressToken reports whether a token is set (an integer or string)
+func isProgressToken(token json.RawMessage) bool {
+	return len(token) > 0 && string(token) != "null"
+}
+
+// answers reports whether a request to the AL server answers the client request
+func (p *clientProgress) answers(method string) bool {
+	if method == p.method {
+		return true
+	}
+	for _, m := range answeringMethods[p.method] {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// takeWorkDone returns the workDoneToken if it was not handed out yet
+func (p *clientProgress) takeWorkDone() (json.RawMessage, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.workDone == nil || p.workDoneTaken {
+		return nil, false
+	}
+	p.workDoneTaken = true
+	return p.workDone, true
+}
+
+// withTokens returns request params with the client's progress tokens as
+// they apply to a request to the AL server: set on the request answering the
+// client request, removed from any other
+func (p *clientProgress) withTokens(method string, params interface{}) interface{} {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return params
+	}
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(data, &fields) != nil || fields == nil {
+		return params
+	}
+
+	_, hadWorkDone := fields["workDoneToken"]
+	_, hadPartial := fields["partialResultToken"]
+	delete(fields, "workDoneToken")
+	delete(fields, "partialResultToken")
+	changed := hadWorkDone || hadPartial
+	if p.answers(method) {
+		if token, ok := p.takeWorkDone(); ok {
+			fields["workDoneToken"] = token
+			changed = true
+		}
+		if p.partialResult != nil && (p.passThrough || partialResultMethods[p.method]) {
+			fields["partialResultToken"] = p.partialResult
+			changed = true
+		}
+	}
+	if !changed {
+		return params
+	}
+	return fields
+}
+
+// WorkDoneProgress reports the progress of work the wrapper does itself on
+// the client's workDoneToken. A nil WorkDoneProgress reports nothing.
+type WorkDoneProgress struct {
+	w     *ALLSPWrapper
+	token json.RawMessage
+	// percentage is the last percentage reported
+	percentage int
+}
+
+// workDoneProgressValue is the value of a $/progress notification
+type workDoneProgressValue struct {
+	Kind        string `json:"kind"`
+	Title       string `json:"title,omitempty"`
+	Cancellable *bool  `json:"cancellable,omitempty"`
+	Message     string `json:"message,omitempty"`
+	Percentage  *int   `json:"percentage,omitempty"`
+}
+
+// send writes a $/progress notification to the client
+func (p *WorkDoneProgress) send(value workDoneProgressValue) {
+	params := struct {
+		Token json.RawMessage       `json:"token"`
+		Value workDoneProgressValue `json:"value"`
+	}{Token: p.token, Value: value}
+	msg, err := NewNotification("$/progress", params)
+	if err != nil {
+		return
+	}
+	if err := p.w.writeToClient(msg); err != nil {
+		p.w.Log("Error sending progress: %v", err)
+	}
+}
+
+// Report reports a step of the work, with its percentage done (0-100).
+// Steps that do not advance the percentage are not sent.
+func (p *WorkDoneProgress) Report(message string, percentage int) {
+	if p == nil {
+		return
+	}
+	if percentage > 100 {
+		percentage = 100
+	}
+	if percentage <= p.percentage {
+		return
+	}
+	p.percentage = percentage
+	p.send(workDoneProgressValue{Kind: "report", Message: message, Percentage: &percentage})
+}
+
+// End reports that the work is done
+func (p *WorkDoneProgress) End(message string) {
+	if p == nil {
+		return
+	}
+	p.send(workDoneProgressValue{Kind: "end", Message: message})
+}
+
+// BeginProgress starts reporting progress on the workDoneToken of the client
+// request, if it has one the AL server was not given. It returns nil if the
+// client cannot be told.
+func (s *requestScope) BeginProgress(title string) *WorkDoneProgress {
+	if s.progress == nil {
+		return nil
+	}
+	token, ok := s.progress.takeWorkDone()
+	if !ok {
+		return nil
+	}
+	progress := &WorkDoneProgress{w: s.ALLSPWrapper, token: token}
+	cancellable, percentage := false, 0
+	progress.send(workDoneProgressValue{Kind: "begin", Title: title, Cancellable: &cancellable, Percentage: &percentage})
+	return progress
+}
+
+// BeginProgress reports nothing outside a client request
+func (w *ALLSPWrapper) BeginProgress(title string) *WorkDoneProgress {
+	return nil
+}
+
+// hasHandler reports whether a handler handles a method
+func (w *ALLSPWrapper) hasHandler(method string) bool {
+	return w.handlerFor(method) != nil
+}
@@ -47,10 +47,19 @@ type WorkspaceSettings struct {
 	ALResourceConfigurationSettings   ALResourceConfigurationSettings `json:"alResourceConfigurationSettings"`
 	SetActiveWorkspace                bool                          `json:"setActiveWorkspace"`
 	DependencyParentWorkspacePath     *string                       `json:"dependencyParentWorkspacePath"`
-	ExpectedProjectReferenceDefinitions []string                    `json:"expectedProjectReferenceDefinitions"`
+	ExpectedProjectReferenceDefinitions []ProjectReferenceDefinition `json:"expectedProjectReferenceDefinitions"`
 	ActiveWorkspaceClosure            []string                      `json:"activeWorkspaceClosure"`
 }
 
+// ProjectReferenceDefinition identifies a workspace app that a project
+// references as a dependency
+type ProjectReferenceDefinition struct {
+	AppID     string `json:"appId"`
+	Name      string `json:"name"`
+	Publisher string `json:"publisher"`
+	Version   string `json:"version"`
+}
+
 // ALResourceConfigurationSettings represents AL-specific settings
 type ALResourceConfigurationSettings struct {
 	AssemblyProbingPaths     []string `json:"assemblyProbingPaths"`
@@ -83,7 +92,7 @@ func NewWorkspaceSettings(projectRoot string) *WorkspaceSettings {
 		},
 		SetActiveWorkspace:                true,
 		DependencyParentWorkspacePath:     nil,
-		ExpectedProjectReferenceDefinitions: []string{},
+		ExpectedProjectReferenceDefinitions: []ProjectReferenceDefinition{},
 		ActiveWorkspaceClosure:            []string{projectRoot},
 	}
 }
@@ -202,8 +211,10 @@ type TextDocumentCapabilities struct {
 	Formatting         DynamicRegistration        `json:"formatting,omitempty"`
 	RangeFormatting    DynamicRegistration        `json:"rangeFormatting,omitempty"`
 	OnTypeFormatting   DynamicRegistration        `json:"onTypeFormatting,omitempty"`
-	Rename             DynamicRegistration        `json:"rename,omitempty"`
+	Rename             RenameCapability           `json:"rename,omitempty"`
 	DocumentLink       DynamicRegistration        `json:"documentLink,omitempty"`
+	SemanticTokens     SemanticTokensCapability   `json:"semanticTokens,omitempty"`
+	LinkedEditingRange DynamicRegistration        `json:"linkedEditingRange,omitempty"`
 	PublishDiagnostics PublishDiagnosticsCapability `json:"publishDiagnostics,omitempty"`
 }
 
@@ -226,6 +237,26 @@ type CompletionItemCapability struct {
 	SnippetSupport bool `json:"snippetSupport,omitempty"`
 }
 
+// RenameCapability represents rename capabilities
+type RenameCapability struct {
+	DynamicRegistration bool `json:"dynamicRegistration,omitempty"`
+	PrepareSupport      bool `json:"prepareSupport,omitempty"`
+}
+
+// SemanticTokensCapability represents semantic tokens capabilities
+type SemanticTokensCapability struct {
+	Requests       SemanticTokensRequests `json:"requests"`
+	TokenTypes     []string               `json:"tokenTypes"`
+	TokenModifiers []string               `json:"tokenModifiers"`
+	Formats        []string               `json:"formats"`
+}
+
+// SemanticTokensRequests represents the semantic token requests a client sends
+type SemanticTokensRequests struct {
+	Range bool `json:"range,omitempty"`
+	Full  bool `json:"full,omitempty"`
+}
+
 // PublishDiagnosticsCapability represents publish diagnostics capabilities
 type PublishDiagnosticsCapability struct {
 	RelatedInformation bool `json:"relatedInformation,omitempty"`
@@ -295,8 +326,23 @@ func NewInitializeParams(workspaceRoot string) *InitializeParams {
 				Formatting:        DynamicRegistration{DynamicRegistration: true},
 				RangeFormatting:   DynamicRegistration{DynamicRegistration: true},
 				OnTypeFormatting:  DynamicRegistration{DynamicRegistration: true},
-				Rename:            DynamicRegistration{DynamicRegistration: true},
+				Rename:            RenameCapability{DynamicRegistration: true, PrepareSupport: true},
 				DocumentLink:      DynamicRegistration{DynamicRegistration: true},
+				SemanticTokens: SemanticTokensCapability{
+					Requests: SemanticTokensRequests{Range: true, Full: true},
+					TokenTypes: []string{
+						"namespace", "type", "class", "enum", "interface", "struct",
+						"typeParameter", "parameter", "variable", "property", "enumMember",
+						"event", "function", "method", "macro", "keyword", "modifier",
+						"comment", "string", "number", "regexp", "operator",
+					},
+					TokenModifiers: []string{
+						"declaration", "definition", "readonly", "static", "deprecated",
+						"abstract", "async", "modification", "documentation", "defaultLibrary",
+					},
+					Formats: []string{"relative"},
+				},
+				LinkedEditingRange: DynamicRegistration{DynamicRegistration: true},
 				PublishDiagnostics: PublishDiagnosticsCapability{
 					RelatedInformation: true,
 				},
@@ -310,7 +356,7 @@ func NewInitializeParams(workspaceRoot string) *InitializeParams {
 				WorkDoneProgress: true,
 			},
 		},
-		Trace: "verbose",
+		Trace: "off",
 		WorkspaceFolders: []WorkspaceFolder{
 			{
 				URI:  PathToFileURI(workspaceRoot),
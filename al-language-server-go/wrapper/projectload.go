@@ -0,0 +1,173 @@
+package wrapper
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// When al/hasProjectClosureLoadedRequest never reports the project as loaded
+// (a corrupt symbol package, a bad path in the settings, ...), every request
+// on that project half-works. The wrapper records the failure, names the
+// likely cause from the AL server's stderr and, if enabled, initializes the
+// project again with code analysis off to rule out the analyzers as the cause.
+
+// stderrTailLines is how many recent AL server stderr lines are kept for diagnosis
+const stderrTailLines = 200
+
+// loadFailurePatterns map AL server stderr output to a suspected cause, most specific first
+var loadFailurePatterns = []struct {
+	pattern *regexp.Regexp
+	cause   string
+}{
+	{regexp.MustCompile(`(?i)end of central directory|InvalidDataException|(corrupt|invalid).*(\.app|package|zip)`),
+		"a corrupt symbol package (.app) in the package cache; delete it and download symbols again"},
+	{regexp.MustCompile(`(?i)PathTooLongException|path.*too long`),
+		"a path exceeds the Windows path length limit; move the project to a shorter path"},
+	{regexp.MustCompile(`(?i)DirectoryNotFoundException|FileNotFoundException|could not find (a part of )?the (path|file)`),
+		"a path in app.json or the workspace settings does not exist"},
+	{regexp.MustCompile(`(?i)(could not|unable to|cannot|failed to) (find|load|resolve|locate).*(\.app|symbol|dependenc|package)`),
+		"a dependency's symbol package is missing; download symbols or check packageCachePaths"},
+	{regexp.MustCompile(`(?i)UnauthorizedAccessException|access to the path .* is denied|being used by another process`),
+		"a file could not be accessed (permissions, or locked by another process or antivirus)"},
+	{regexp.MustCompile(`(?i)JsonReaderException|JsonException|app\.json.*(invalid|unexpected|error)`),
+		"app.json could not be parsed"},
+	{regexp.MustCompile(`(?i)OutOfMemoryException|out of memory`),
+		"the AL server ran out of memory"},
+}
+
+// ProjectLoadStatus records how loading an AL project went
+type ProjectLoadStatus struct {
+	Project string `json:"project"`
+	Loaded  bool   `json:"loaded"`
+	// Recovered is set when the project only loaded after re-initialization
+	// with code analysis disabled
+	Recovered bool `json:"recovered,omitempty"`
+	// SuspectedCause and Evidence explain a load that did not complete
+	SuspectedCause string    `json:"suspectedCause,omitempty"`
+	Evidence       string    `json:"evidence,omitempty"`
+	CheckedAt      time.Time `json:"checkedAt"`
+}
+
+// recordStderr keeps a bounded tail of AL server stderr lines
+func (w *ALLSPWrapper) recordStderr(line string) {
+	w.stderrMu.Lock()
+	defer w.stderrMu.Unlock()
+	w.stderrTail = append(w.stderrTail, line)
+	if len(w.stderrTail) > stderrTailLines {
+		w.stderrTail = w.stderrTail[len(w.stderrTail)-stderrTailLines:]
+	}
+}
+
+// recentStderr returns a copy of the recent AL server stderr lines
+func (w *ALLSPWrapper) recentStderr() []string {
+	w.stderrMu.Lock()
+	defer w.stderrMu.Unlock()
+	return append([]string(nil), w.stderrTail...)
+}
+
+// diagnoseLoadFailure names the most likely cause of a stuck project load
+// and the stderr line that points to it
+func diagnoseLoadFailure(stderr []string) (cause string, evidence string) {
+	for _, p := range loadFailurePatterns {
+		for i := len(stderr) - 1; i >= 0; i-- {
+			if p.pattern.MatchString(stderr[i]) {
+				return p.cause, strings.TrimSpace(stderr[i])
+			}
+		}
+	}
+	return "unknown; the AL server reported no recognizable error", ""
+}
+
+// projectLoadPolls returns how many times to poll for project load, every 500ms
+func (w *ALLSPWrapper) projectLoadPolls() int {
+	return max(1, w.Config().ProjectLoad.TimeoutSeconds*2)
+}
+
+// handleStuckProjectLoad diagnoses a project that did not finish loading,
+// re-initializes it with code analysis disabled if configured, tells the
+// client and records the outcome. It returns whether the project loaded.
+func (w *ALLSPWrapper) handleStuckProjectLoad(scope WrapperInterface, projectRoot string) bool {
+	status := &ProjectLoadStatus{Project: projectRoot}
+	status.SuspectedCause, status.Evidence = diagnoseLoadFailure(w.recentStderr())
+	scope.Log("Project %s did not finish loading; suspected cause: %s", projectRoot, status.SuspectedCause)
+	if status.Evidence != "" {
+		scope.Log("Project load evidence: %s", status.Evidence)
+	}
+
+	if w.Config().ProjectLoad.AutoRecover {
+		scope.Log("Re-initializing %s with code analysis disabled", projectRoot)
+		settings := w.workspaceSettings(scope, projectRoot)
+		settings.ALResourceConfigurationSettings.EnableCodeAnalysis = false
+		settings.ALResourceConfigurationSettings.BackgroundCodeAnalysis = "None"
+		settings.ALResourceConfigurationSettings.CodeAnalyzers = []string{}
+		if err := scope.SendNotificationToLSP("workspace/didChangeConfiguration", DidChangeConfigurationParams{Settings: settings}); err != nil {
+			scope.Log("Failed to send workspace configuration: %v", err)
+		}
+		activeParams := NewActiveWorkspaceParams(projectRoot)
+		activeParams.Settings = settings
+		if _, err := scope.SendRequestToLSP("al/setActiveWorkspace", activeParams); err != nil {
+			scope.Log("Failed to set active workspace: %v", err)
+		}
+		status.Recovered = w.waitForProjectLoad(scope)
+		status.Loaded = status.Recovered
+	}
+	status.CheckedAt = time.Now()
+	w.setProjectLoadStatus(status)
+
+	message := fmt.Sprintf("AL LSP wrapper: project %s did not finish loading (suspected cause: %s).", projectRoot, status.SuspectedCause)
+	switch {
+	case status.Recovered:
+		message += " It loaded after re-initializing with code analysis disabled."
+	case w.Config().ProjectLoad.AutoRecover:
+		message += " Re-initializing with code analysis disabled did not help; results may be incomplete."
+	default:
+		message += " Results may be incomplete; set projectLoad.autoRecover to retry with code analysis disabled."
+	}
+	w.notifyClient(MessageTypeWarning, message)
+	return status.Loaded
+}
+
+// setProjectLoadStatus records the load outcome of a project
+func (w *ALLSPWrapper) setProjectLoadStatus(status *ProjectLoadStatus) {
+	w.loadMu.Lock()
+	defer w.loadMu.Unlock()
+	w.projectLoads[status.Project] = status
+}
+
+// ProjectLoadStatuses returns the load outcome of every initialized project
+func (w *ALLSPWrapper) ProjectLoadStatuses() []ProjectLoadStatus {
+	w.loadMu.Lock()
+	defer w.loadMu.Unlock()
+	statuses := make([]ProjectLoadStatus, 0, len(w.projectLoads))
+	for _, status := range w.projectLoads {
+		statuses = append(statuses, *status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Project < statuses[j].Project })
+	return statuses
+}
+
+// notifyClient shows a message to the user through window/showMessage
+func (w *ALLSPWrapper) notifyClient(messageType int, message string) {
+	msg, err := NewNotification("window/showMessage", LogMessageParams{Type: messageType, Message: message})
+	if err != nil {
+		return
+	}
+	if err := w.writeToClient(msg); err != nil {
+		w.Log("Error sending message to client: %v", err)
+	}
+}
+
+// LogToClient sends a message to the client's log through window/logMessage,
+// for what the user may want to know without being interrupted
+func (w *ALLSPWrapper) LogToClient(messageType int, message string) {
+	msg, err := NewNotification("window/logMessage", LogMessageParams{Type: messageType, Message: message})
+	if err != nil {
+		return
+	}
+	if err := w.writeToClient(msg); err != nil {
+		w.Log("Error sending message to client: %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+)
+
+// Client requests are handled concurrently. Each project has its own init
+// state: requests for an initialized project see it is ready without waiting
+// on any lock, and concurrent requests for a project being initialized share
+// one init sequence, singleflight-style, and its result.
+//
+// The AL server answers every request from its single active workspace, so a
+// request about a document of an initialized project is only sent with that
+// project active. Requests for the active project are sent together, holding
+// activationMu for reading; activating another project, and the init
+// sequences, hold it for writing, so they wait for the requests in flight and
+// the requests of other projects wait for them.
+
+// projectState is the initialization state of one project
+type projectState struct {
+	initialized atomic.Bool
+	// init is the init sequence in progress, nil when none is
+	init *projectInit
+}
+
+// projectInit is an init sequence in progress; done is closed when it ends
+type projectInit struct {
+	done chan struct{}
+	err  error
+}
+
+// beginProjectInit returns the init sequence in progress for a project, or
+// starts one. The caller that started it (leader) must run it and call
+// finishProjectInit; the others wait on done.
+func (w *ALLSPWrapper) beginProjectInit(projectRoot string) (call *projectInit, leader bool) {
+	w.projectMu.Lock()
+	defer w.projectMu.Unlock()
+	state, ok := w.projects[projectRoot]
+	if !ok {
+		state = &projectState{}
+		w.projects[projectRoot] = state
+	}
+	if state.init != nil {
+		return state.init, false
+	}
+	state.init = &projectInit{done: make(chan struct{})}
+	return state.init, true
+}
+
+// finishProjectInit ends an init sequence, releasing the callers waiting on it
+func (w *ALLSPWrapper) finishProjectInit(projectRoot string, call *projectInit) {
+	w.projectMu.Lock()
+	if state, ok := w.projects[projectRoot]; ok && state.init == call {
+		state.init = nil
+	}
+	w.projectMu.Unlock()
+	close(call.done)
+}
+
+// markProjectInitialized records that a project's init sequence completed
+func (w *ALLSPWrapper) markProjectInitialized(projectRoot string) {
+	w.projectMu.Lock()
+	defer w.projectMu.Unlock()
+	state, ok := w.projects[projectRoot]
+	if !ok {
+		state = &projectState{}
+		w.projects[projectRoot] = state
+	}
+	state.initialized.Store(true)
+}
+
+// isProjectInitialized reports whether a project has been initialized
+func (w *ALLSPWrapper) isProjectInitialized(projectRoot string) bool {
+	w.projectMu.Lock()
+	defer w.projectMu.Unlock()
+	state, ok := w.projects[projectRoot]
+	return ok && state.initialized.Load()
+}
+
+// initializedProjectRoots returns the roots of the initialized projects
+func (w *ALLSPWrapper) initializedProjectRoots() []string {
+	w.projectMu.Lock()
+	defer w.projectMu.Unlock()
+	var roots []string
+	for root, state := range w.projects {
+		if state.initialized.Load() {
+			roots = append(roots, root)
+		}
+	}
+	return roots
+}
+
+// resetProjects forgets every project's init state and the active project,
+// e.g. after a restart of the AL server
+func (w *ALLSPWrapper) resetProjects() {
+	w.projectMu.Lock()
+	defer w.projectMu.Unlock()
+	w.projects = make(map[string]*projectState)
+	w.activeProject = ""
+}
+
+// setActiveProject records the most recently activated project
+func (w *ALLSPWrapper) setActiveProject(projectRoot string) {
+	w.projectMu.Lock()
+	defer w.projectMu.Unlock()
+	w.activeProject = projectRoot
+}
+
+// requestProject returns the initialized project of the document a request
+// is about (its textDocument or, for call and type hierarchy requests, its
+// item), or "" if it is not about a document of one
+func (w *ALLSPWrapper) requestProject(params interface{}) string {
+	data, ok := params.(json.RawMessage)
+	if !ok {
+		var err error
+		if data, err = json.Marshal(params); err != nil {
+			return ""
+		}
+	}
+	var document struct {
+		TextDocument struct {
+			URI string `json:"uri"`
+		} `json:"textDocument"`
+		Item struct {
+			URI string `json:"uri"`
+		} `json:"item"`
+	}
+	if json.Unmarshal(data, &document) != nil {
+		return ""
+	}
+	uri := document.TextDocument.URI
+	if uri == "" {
+		uri = document.Item.URI
+	}
+	path, err := FileURIToPath(uri)
+	if uri == "" || err != nil {
+		return ""
+	}
+	projectRoot := GetProjectRoot(path)
+	if projectRoot == "" {
+		return ""
+	}
+	projectRoot = NormalizePath(projectRoot)
+	if !w.isProjectInitialized(projectRoot) {
+		return ""
+	}
+	return projectRoot
+}
+
+// inProject runs send with a project active on the AL server, activating it
+// first if another project is active. send runs holding activationMu for
+// reading, so no project is activated until it returns.
+func (w *ALLSPWrapper) inProject(span string, projectRoot string, send func() error) error {
+	if projectRoot == "" {
+		return send()
+	}
+	for {
+		w.activationMu.RLock()
+		if w.ActiveProject() == projectRoot {
+			defer w.activationMu.RUnlock()
+			return send()
+		}
+		w.activationMu.RUnlock()
+
+		w.logTagged(span, "Activating %s", projectRoot)
+		w.activationMu.Lock()
+		err := w.activateProject(w, projectRoot)
+		w.activationMu.Unlock()
+		if err != nil {
+			return fmt.Errorf("failed to activate %s: %w", projectRoot, err)
+		}
+	}
+}
+
+// openedVersion returns the version of an open document
+func (w *ALLSPWrapper) openedVersion(path string) (int, bool) {
+	w.docMu.Lock()
+	defer w.docMu.Unlock()
+	version, ok := w.openedFiles[path]
+	return version, ok
+}
+
+// openedDocuments returns a copy of the open documents and their versions
+func (w *ALLSPWrapper) openedDocuments() map[string]int {
+	w.docMu.Lock()
+	defer w.docMu.Unlock()
+	documents := make(map[string]int, len(w.openedFiles))
+	for path, version := range w.openedFiles {
+		documents[path] = version
+	}
+	return documents
+}
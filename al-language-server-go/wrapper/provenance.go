@@ -0,0 +1,90 @@
+package wrapper
+
+import "encoding/json"
+
+// Results the wrapper produces itself, instead of passing on the AL server's
+// answer to the request, are logged with where they came from, and with
+// provenance.annotate also tagged: a "provenance" property on the result (or
+// on each entry of a list result). Someone chasing a wrong result can tell a
+// genuine AL server answer, which has no provenance, from a wrapper fallback.
+
+// Provenance of results not answered by the AL server's own handling of the request
+const (
+	// provenanceDocumentSymbol is a definition found in the document's symbols
+	// by the name hover gives for the position
+	provenanceDocumentSymbol = "wrapper:documentSymbol"
+	// provenanceSymbolSearch is a workspace/symbol answer from al/symbolSearch
+	provenanceSymbolSearch = "server:al/symbolSearch"
+	// provenanceSymbolIndex is an answer from the wrapper's own symbol index,
+	// which may have been restored from the warm-start cache
+	provenanceSymbolIndex = "wrapper:symbolIndex"
+	// provenanceSuggestions are the nearest indexed symbols to an unmatched query
+	provenanceSuggestions = "wrapper:suggestions"
+	// provenanceProjectScan is an answer from scanning the project's sources
+	provenanceProjectScan = "wrapper:projectScan"
+	// provenanceImplementsClauses are interface implementations found in the
+	// implements clauses of the project's objects
+	provenanceImplementsClauses = "wrapper:implementsClauses"
+	// provenanceIdentifier is the identifier at a position, read from the file
+	provenanceIdentifier = "wrapper:identifier"
+	// provenanceCallHierarchy is a call hierarchy synthesized from references
+	// and definition lookups
+	provenanceCallHierarchy = "wrapper:callHierarchy"
+	// provenanceTypeHierarchy is a type hierarchy built from the extension
+	// objects of the workspace
+	provenanceTypeHierarchy = "wrapper:typeHierarchy"
+	// provenancePublishedDiagnostics is a pull diagnostics report made of the
+	// diagnostics the AL server published for the file
+	provenancePublishedDiagnostics = "server:publishDiagnostics"
+	// provenanceTextualMatch is a reference found by searching the
+	// workspace's text for the identifier
+	provenanceTextualMatch = "wrapper:textualMatch"
+	// provenanceKeywordDocs is a hover from the bundled AL language reference
+	provenanceKeywordDocs = "wrapper:keywordDocs"
+	// provenanceLocalParse is a hover built from parsing the file locally
+	provenanceLocalParse = "wrapper:localParse"
+	// provenanceObjectLinks is a document link to the declaration of an AL
+	// object referenced in the file
+	provenanceObjectLinks = "wrapper:objectLinks"
+	// provenanceSnippets are completion items from the bundled AL snippets
+	provenanceSnippets = "wrapper:snippets"
+)
+
+// markProvenance logs where a result came from and, if enabled, adds it as a
+// provenance property to the result object or to each object in a result list
+func markProvenance(result json.RawMessage, method string, source string, w WrapperInterface) json.RawMessage {
+	w.Log("Result provenance: method=%s source=%s", method, source)
+	if !w.Config().Provenance.Annotate {
+		return result
+	}
+	tag, _ := json.Marshal(source)
+
+	var entry map[string]json.RawMessage
+	if json.Unmarshal(result, &entry) == nil && entry != nil {
+		entry["provenance"] = tag
+		if data, err := json.Marshal(entry); err == nil {
+			return data
+		}
+		return result
+	}
+
+	var entries []json.RawMessage
+	if json.Unmarshal(result, &entries) != nil || len(entries) == 0 {
+		return result
+	}
+	for i, raw := range entries {
+		var item map[string]json.RawMessage
+		if json.Unmarshal(raw, &item) != nil || item == nil {
+			continue
+		}
+		item["provenance"] = tag
+		if data, err := json.Marshal(item); err == nil {
+			entries[i] = data
+		}
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return result
+	}
+	return data
+}
@@ -0,0 +1,169 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// PublishCommand deploys the project to the sandbox described in launch.json
+const PublishCommand = "al.publish"
+
+// LaunchConfiguration is a single entry of .vscode/launch.json.
+// Only the fields the wrapper inspects are typed; Raw holds the full entry.
+type LaunchConfiguration struct {
+	Name    string          `json:"name"`
+	Type    string          `json:"type"`
+	Request string          `json:"request"`
+	Raw     json.RawMessage `json:"-"`
+}
+
+// ReadLaunchConfigurations reads the AL launch configurations of a project
+func ReadLaunchConfigurations(projectRoot string) ([]LaunchConfiguration, error) {
+	launchPath := filepath.Join(projectRoot, ".vscode", "launch.json")
+	data, err := os.ReadFile(launchPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read launch.json: %w", err)
+	}
+
+	var launch struct {
+		Configurations []json.RawMessage `json:"configurations"`
+	}
+	if err := json.Unmarshal(StripJSONComments(data), &launch); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", launchPath, err)
+	}
+
+	var configs []LaunchConfiguration
+	for _, raw := range launch.Configurations {
+		var cfg LaunchConfiguration
+		if err := json.Unmarshal(raw, &cfg); err != nil {
+			continue
+		}
+		if cfg.Type != "al" {
+			continue
+		}
+		cfg.Raw = raw
+		configs = append(configs, cfg)
+	}
+
+	return configs, nil
+}
+
+// SelectLaunchConfiguration picks the named AL launch configuration,
+// or the first one when name is empty
+func SelectLaunchConfiguration(projectRoot string, name string) (*LaunchConfiguration, error) {
+	configs, err := ReadLaunchConfigurations(projectRoot)
+	if err != nil {
+		return nil, err
+	}
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("no AL launch configurations in %s", filepath.Join(projectRoot, ".vscode", "launch.json"))
+	}
+
+	if name == "" {
+		return &configs[0], nil
+	}
+	for i := range configs {
+		if strings.EqualFold(configs[i].Name, name) {
+			return &configs[i], nil
+		}
+	}
+	return nil, fmt.Errorf("launch configuration %q not found", name)
+}
+
+// PublishCommandArgs represents the optional argument object of al.publish
+type PublishCommandArgs struct {
+	// Project is a file or folder URI/path inside the project to publish
+	Project string `json:"project"`
+	// Configuration overrides the configured launch.json entry name
+	Configuration string `json:"configuration"`
+	// SkipBuild publishes the existing .app without compiling first
+	SkipBuild bool `json:"skipBuild"`
+}
+
+// ALPublishParams represents parameters for al/publish
+type ALPublishParams struct {
+	Configuration json.RawMessage `json:"configuration"`
+	WorkspacePath string          `json:"workspacePath"`
+	SkipBuild     bool            `json:"skipBuild"`
+}
+
+// PublishResult is returned to the client after a deployment attempt
+type PublishResult struct {
+	Success       bool            `json:"success"`
+	Project       string          `json:"project"`
+	Configuration string          `json:"configuration"`
+	Result        json.RawMessage `json:"result,omitempty"`
+}
+
+// publishDisabledResponse refuses a deployment requested by name (al.publish,
+// or al/publish sent by the client) while publish.enabled is off
+func publishDisabledResponse(msg *Message, name string) *Message {
+	return NewErrorResponse(msg.ID, InvalidRequest,
+		name+" is disabled. Set \"publish\": {\"enabled\": true} in the user config file "+
+			GetUserConfigPath()+" to allow deployments to the sandbox in launch.json; "+
+			"the workspace's .claude/al-lsp.json and initializationOptions cannot enable it.")
+}
+
+func publishCommand(msg *Message, args []json.RawMessage, w WrapperInterface) (*Message, *Message) {
+	cfg := w.Config().Publish
+	if !cfg.Enabled {
+		return nil, publishDisabledResponse(msg, PublishCommand)
+	}
+
+	var cmdArgs PublishCommandArgs
+	if err := decodeCommandArgs(args, &cmdArgs); err != nil {
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "Invalid al.publish arguments: "+err.Error())
+	}
+
+	projectRoot := resolveCommandProject(cmdArgs.Project, w)
+	if projectRoot == "" {
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "No AL project found to publish")
+	}
+
+	name := cmdArgs.Configuration
+	if name == "" {
+		name = cfg.Configuration
+	}
+	launch, err := SelectLaunchConfiguration(projectRoot, name)
+	if err != nil {
+		w.Log("Failed to select launch configuration: %v", err)
+		return nil, NewErrorResponse(msg.ID, InvalidParams, err.Error())
+	}
+
+	if errResp := ensureProjectForRequest(msg, filepath.Join(projectRoot, "app.json"), w); errResp != nil {
+		return nil, errResp
+	}
+
+	w.Log("Publishing %s using launch configuration %q", projectRoot, launch.Name)
+	publishParams := ALPublishParams{
+		Configuration: launch.Raw,
+		WorkspacePath: projectRoot,
+		SkipBuild:     cmdArgs.SkipBuild,
+	}
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	response, err := w.SendRequestToLSPWithTimeout("al/publish", publishParams, timeout)
+	if err != nil {
+		w.Log("Failed to send publish request: %v", err)
+		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	}
+
+	if response.Error != nil {
+		w.Log("Publish failed: %s", response.Error.Message)
+		return nil, &Message{
+			JSONRPC: "2.0",
+			ID:      msg.ID,
+			Error:   response.Error,
+		}
+	}
+
+	return newResultMessage(msg.ID, PublishResult{
+		Success:       true,
+		Project:       projectRoot,
+		Configuration: launch.Name,
+		Result:        response.Result,
+	})
+}
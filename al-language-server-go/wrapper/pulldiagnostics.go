@@ -0,0 +1,117 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// textDocument/diagnostic (LSP 3.17 pull diagnostics) lets a client ask for
+// a file's problems instead of waiting for publishDiagnostics it may never
+// see. The request is forwarded to the AL server; as the server only pushes
+// diagnostics, the wrapper usually answers it from the newest set the server
+// published for the file, after the suppression and severity rules. A file
+// the server has not compiled yet is opened and the request waits, up to
+// diagnostics.pullTimeoutSeconds, for its first diagnostics. The result ID is
+// derived from the diagnostics, so a client sending it back as
+// previousResultId gets an "unchanged" report while nothing changed.
+
+// FullDocumentDiagnosticReport is a textDocument/diagnostic result with the
+// file's diagnostics
+type FullDocumentDiagnosticReport struct {
+	Kind     string       `json:"kind"`
+	ResultID string       `json:"resultId,omitempty"`
+	Items    []Diagnostic `json:"items"`
+}
+
+// UnchangedDocumentDiagnosticReport is a textDocument/diagnostic result for
+// diagnostics the client already has
+type UnchangedDocumentDiagnosticReport struct {
+	Kind     string `json:"kind"`
+	ResultID string `json:"resultId"`
+}
+
+// DiagnosticHandler handles textDocument/diagnostic
+type DiagnosticHandler struct{}
+
+func (h *DiagnosticHandler) ShouldHandle(method string) bool {
+	return method == "textDocument/diagnostic"
+}
+
+func (h *DiagnosticHandler) Handle(msg *Message, w WrapperInterface) (*Message, *Message) {
+	var params struct {
+		TextDocument     TextDocumentIdentifier `json:"textDocument"`
+		Identifier       string                 `json:"identifier,omitempty"`
+		PreviousResultID string                 `json:"previousResultId,omitempty"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		w.Log("Failed to parse diagnostic params: %v", err)
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "Invalid parameters")
+	}
+
+	filePath, err := FileURIToPath(params.TextDocument.URI)
+	if err != nil {
+		w.Log("Failed to convert URI: %v", err)
+		return nil, NewErrorResponse(msg.ID, InternalError, "Invalid file URI")
+	}
+
+	// Ensure the file is opened
+	if err := w.EnsureFileOpened(filePath); err != nil {
+		w.Log("Failed to open file: %v", err)
+		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	}
+
+	// Ensure project is initialized, or degrade to the file alone
+	if errResp := ensureProjectForRequest(msg, filePath, w); errResp != nil {
+		return nil, errResp
+	}
+
+	// Forward to AL LSP
+	response, err := w.SendRequestToLSP("textDocument/diagnostic", params)
+	if err != nil {
+		w.Log("Failed to send diagnostic request: %v", err)
+		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	}
+	if response.Error == nil {
+		return &Message{
+			JSONRPC: "2.0",
+			ID:      msg.ID,
+			Result:  response.Result,
+		}, nil
+	}
+	if response.Error.Code != MethodNotFound {
+		return nil, &Message{
+			JSONRPC: "2.0",
+			ID:      msg.ID,
+			Error:   response.Error,
+		}
+	}
+
+	// Answer from the diagnostics the AL server published
+	timeout := time.Duration(w.Config().Diagnostics.PullTimeoutSeconds) * time.Second
+	diagnostics, published := w.FileDiagnostics(filePath, timeout)
+	var report interface{}
+	if !published {
+		// No result ID, so the next pull asks again instead of "unchanged"
+		w.Log("No diagnostics published for %s within %s", filePath, timeout)
+		report = FullDocumentDiagnosticReport{Kind: "full", Items: []Diagnostic{}}
+	} else {
+		resultID := contentHash([]byte(diagnosticsFingerprint(diagnostics)))[:16]
+		if params.PreviousResultID == resultID {
+			w.Log("Pull diagnostics for %s: unchanged", filePath)
+			report = UnchangedDocumentDiagnosticReport{Kind: "unchanged", ResultID: resultID}
+		} else {
+			w.Log("Pull diagnostics for %s: %d item(s)", filePath, len(diagnostics))
+			full := FullDocumentDiagnosticReport{Kind: "full", ResultID: resultID, Items: diagnostics}
+			if full.Items == nil {
+				full.Items = []Diagnostic{}
+			}
+			report = full
+		}
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	}
+	return newResultMessage(msg.ID, markProvenance(data, msg.Method, provenancePublishedDiagnostics, w))
+}
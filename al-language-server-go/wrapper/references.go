@@ -0,0 +1,189 @@
+package wrapper
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ReferenceLocation is a references result location, optionally annotated
+// with the object and procedure or trigger that contains it
+type ReferenceLocation struct {
+	Location
+	// ContainerName is e.g. `codeunit 50000 CustomerMgt > ProcessCustomer`
+	ContainerName string `json:"containerName,omitempty"`
+}
+
+var (
+	// memberDeclPattern matches procedure and trigger declarations
+	memberDeclPattern = regexp.MustCompile(`(?i)^\s*(?:(?:local|internal|protected)\s+)?(procedure|trigger)\s+("(?:[^"]|"")+"|[A-Za-z_][A-Za-z0-9_]*)`)
+	// fieldDeclPattern matches table fields, field(1; "No."; Code[20]), and page fields, field("No."; Rec."No.")
+	fieldDeclPattern = regexp.MustCompile(`(?i)^\s*field\s*\(\s*(?:\d+\s*;\s*)?("(?:[^"]|"")+"|[A-Za-z_][A-Za-z0-9_]*)`)
+)
+
+// alMember is a procedure, trigger or field and the lines it spans
+type alMember struct {
+	kind      string
+	name      string
+	startLine int
+	endLine   int
+}
+
+// alOutline lists the objects, members and fields of one AL file
+type alOutline struct {
+	objects []ALObject
+	members []alMember
+	fields  []alMember
+}
+
+// parseOutline reads the objects, procedures, triggers and fields of an AL file.
+// A member ends at the next member declaration or when the braces enclosing
+// its declaration close, which also scopes field and action triggers.
+func parseOutline(path string) alOutline {
+	outline := alOutline{objects: parseObjectFile(path)}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return outline
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	inComment := false
+	depth := 0
+	open := -1 // index of the member still open
+	openDepth := 0
+
+	line := 0
+	for ; scanner.Scan(); line++ {
+		code, stillInComment := stripALComments(scanner.Text(), inComment)
+		inComment = stillInComment
+
+		if m := memberDeclPattern.FindStringSubmatch(code); m != nil {
+			if open >= 0 {
+				outline.members[open].endLine = line - 1
+			}
+			outline.members = append(outline.members, alMember{
+				kind:      strings.ToLower(m[1]),
+				name:      unquoteALName(m[2]),
+				startLine: line,
+				endLine:   -1,
+			})
+			open, openDepth = len(outline.members)-1, depth
+		} else if m := fieldDeclPattern.FindStringSubmatch(code); m != nil {
+			outline.fields = append(outline.fields, alMember{kind: "field", name: unquoteALName(m[1]), startLine: line, endLine: line})
+		}
+
+		depth += strings.Count(code, "{") - strings.Count(code, "}")
+		if open >= 0 && depth < openDepth {
+			outline.members[open].endLine = line
+			open = -1
+		}
+	}
+	if open >= 0 {
+		outline.members[open].endLine = line
+	}
+	return outline
+}
+
+// containerAt describes the object and member containing a zero-based line
+func (o alOutline) containerAt(line int) string {
+	var container string
+	for _, obj := range o.objects {
+		if obj.Line <= line {
+			container = obj.DisplayName()
+		}
+	}
+	for _, member := range o.members {
+		if member.startLine <= line && line <= member.endLine {
+			if container != "" {
+				container += " > "
+			}
+			container += quoteALName(member.name)
+		}
+	}
+	return container
+}
+
+// locationFile returns the normalized path of a file URI, so that differently
+// encoded URIs of a file compare equal, or the URI itself if it is no file URI
+func locationFile(uri string) string {
+	if !strings.HasPrefix(uri, "file://") {
+		return uri
+	}
+	path, err := FileURIToPath(uri)
+	if err != nil {
+		return uri
+	}
+	return NormalizePath(path)
+}
+
+// processReferences sorts references by file and position, removes duplicate
+// ranges, applies the result limit and, if IncludeContainer is set, names the
+// enclosing object and procedure. Results that are not a location array are
+// returned unchanged.
+func processReferences(result json.RawMessage, cfg ReferencesConfig, w WrapperInterface) json.RawMessage {
+	var locations []Location
+	if err := json.Unmarshal(result, &locations); err != nil || len(locations) == 0 {
+		return result
+	}
+
+	// Results merged from several projects may encode a file's URI
+	// differently, so locations are compared by file
+	files := make(map[string]string, len(locations))
+	for _, loc := range locations {
+		if _, ok := files[loc.URI]; !ok {
+			files[loc.URI] = locationFile(loc.URI)
+		}
+	}
+	sort.SliceStable(locations, func(i, j int) bool {
+		a, b := locations[i], locations[j]
+		if files[a.URI] != files[b.URI] {
+			return files[a.URI] < files[b.URI]
+		}
+		if a.Range.Start.Line != b.Range.Start.Line {
+			return a.Range.Start.Line < b.Range.Start.Line
+		}
+		return a.Range.Start.Character < b.Range.Start.Character
+	})
+
+	unique := make([]Location, 0, len(locations))
+	for _, loc := range locations {
+		if n := len(unique); n > 0 && loc.Range == unique[n-1].Range && files[loc.URI] == files[unique[n-1].URI] {
+			continue
+		}
+		unique = append(unique, loc)
+	}
+	if removed := len(locations) - len(unique); removed > 0 {
+		w.Log("Removed %d duplicate reference(s)", removed)
+	}
+
+	refs := make([]ReferenceLocation, len(unique))
+	outlines := make(map[string]alOutline)
+	for i, loc := range unique {
+		refs[i].Location = loc
+		if !cfg.IncludeContainer || (cfg.MaxResults > 0 && i >= cfg.MaxResults) {
+			continue
+		}
+		path, err := FileURIToPath(loc.URI)
+		if err != nil || !IsALFile(path) {
+			continue
+		}
+		outline, ok := outlines[path]
+		if !ok {
+			outline = parseOutline(path)
+			outlines[path] = outline
+		}
+		refs[i].ContainerName = outline.containerAt(loc.Range.Start.Line)
+	}
+
+	data, err := json.Marshal(limitReferences(refs, cfg.MaxResults, w))
+	if err != nil {
+		return result
+	}
+	return data
+}
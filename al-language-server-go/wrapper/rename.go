@@ -0,0 +1,348 @@
+package wrapper
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// RenameHandler handles textDocument/rename and textDocument/prepareRename.
+// The AL server's WorkspaceEdit is returned with its file URIs in the form
+// the client uses, so clients match the edits to their documents.
+// prepareRename is answered by the AL server or, if it does not implement
+// it, with the identifier at the position.
+type RenameHandler struct{}
+
+func (h *RenameHandler) ShouldHandle(method string) bool {
+	return method == "textDocument/rename" || method == "textDocument/prepareRename"
+}
+
+func (h *RenameHandler) Handle(msg *Message, w WrapperInterface) (*Message, *Message) {
+	if msg.Method == "textDocument/prepareRename" {
+		return h.prepare(msg, w)
+	}
+
+	var params struct {
+		TextDocument TextDocumentIdentifier `json:"textDocument"`
+		Position     Position               `json:"position"`
+		NewName      string                 `json:"newName"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		w.Log("Failed to parse rename params: %v", err)
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "Invalid parameters")
+	}
+	if params.NewName == "" {
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "newName must not be empty")
+	}
+
+	filePath, err := FileURIToPath(params.TextDocument.URI)
+	if err != nil {
+		w.Log("Failed to convert URI: %v", err)
+		return nil, NewErrorResponse(msg.ID, InternalError, "Invalid file URI")
+	}
+
+	// Ensure the file is opened
+	if err := w.EnsureFileOpened(filePath); err != nil {
+		w.Log("Failed to open file: %v", err)
+		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	}
+
+	// Ensure project is initialized, or degrade to the file alone
+	if errResp := ensureProjectForRequest(msg, filePath, w); errResp != nil {
+		return nil, errResp
+	}
+
+	// Forward to AL LSP, noting the client's text the edit is computed on
+	synced := w.SyncedDocuments()
+	response, err := w.SendRequestToLSP("textDocument/rename", params)
+	if err != nil {
+		w.Log("Failed to send rename request: %v", err)
+		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	}
+
+	if response.Error != nil {
+		return nil, &Message{
+			JSONRPC: "2.0",
+			ID:      msg.ID,
+			Error:   response.Error,
+		}
+	}
+
+	known := map[string]string{NormalizePath(filePath): params.TextDocument.URI}
+	result := normalizeEditURIs(unwrapWorkspaceEdit(response.Result), known)
+
+	// Refuse an edit computed against text the files no longer hold
+	var edit WorkspaceEdit
+	if w.Config().WorkspaceEdit.CheckDrift && json.Unmarshal(result, &edit) == nil {
+		if err := w.CheckEditDrift(&edit, synced); err != nil {
+			w.Log("Refusing rename: %v", err)
+			return nil, NewErrorResponse(msg.ID, ContentModified,
+				"Rename refused, the files changed since the AL server computed it: "+err.Error()+"; retry the rename")
+		}
+	}
+	w.AuditResult("textDocument/rename", result)
+
+	return &Message{
+		JSONRPC: "2.0",
+		ID:      msg.ID,
+		Result:  result,
+	}, nil
+}
+
+// prepare handles textDocument/prepareRename
+func (h *RenameHandler) prepare(msg *Message, w WrapperInterface) (*Message, *Message) {
+	var params TextDocumentPositionParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		w.Log("Failed to parse prepareRename params: %v", err)
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "Invalid parameters")
+	}
+
+	filePath, err := FileURIToPath(params.TextDocument.URI)
+	if err != nil {
+		w.Log("Failed to convert URI: %v", err)
+		return nil, NewErrorResponse(msg.ID, InternalError, "Invalid file URI")
+	}
+
+	// Ensure the file is opened
+	if err := w.EnsureFileOpened(filePath); err != nil {
+		w.Log("Failed to open file: %v", err)
+		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	}
+
+	// Ensure project is initialized, or degrade to the file alone
+	if errResp := ensureProjectForRequest(msg, filePath, w); errResp != nil {
+		return nil, errResp
+	}
+
+	// Forward to AL LSP
+	response, err := w.SendRequestToLSP("textDocument/prepareRename", params)
+	if err != nil {
+		w.Log("Failed to send prepareRename request: %v", err)
+		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	}
+
+	if response.Error == nil {
+		return &Message{
+			JSONRPC: "2.0",
+			ID:      msg.ID,
+			Result:  response.Result,
+		}, nil
+	}
+	if response.Error.Code != MethodNotFound {
+		return nil, &Message{
+			JSONRPC: "2.0",
+			ID:      msg.ID,
+			Error:   response.Error,
+		}
+	}
+
+	// The AL server has no prepareRename: offer the identifier at the position
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	}
+	rng, name, ok := identifierAt(content, params.Position)
+	if !ok {
+		w.Log("prepareRename: no renameable identifier at %d:%d", params.Position.Line, params.Position.Character)
+		return newResultMessage(msg.ID, nil)
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"range":       rng,
+		"placeholder": name,
+	})
+	if err != nil {
+		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	}
+	return newResultMessage(msg.ID, markProvenance(data, msg.Method, provenanceIdentifier, w))
+}
+
+// renameKeywords are AL keywords that look like identifiers but cannot be renamed
+var renameKeywords = map[string]bool{
+	"begin": true, "end": true, "procedure": true, "trigger": true, "var": true,
+	"local": true, "internal": true, "if": true, "then": true, "else": true,
+	"case": true, "of": true, "for": true, "to": true, "downto": true, "do": true,
+	"while": true, "repeat": true, "until": true, "exit": true, "not": true,
+	"and": true, "or": true, "xor": true, "div": true, "mod": true, "true": true,
+	"false": true, "with": true, "in": true, "this": true,
+}
+
+// identifierAt returns the range and text of the identifier or quoted
+// identifier at a position, rejecting keywords and object types
+func identifierAt(content []byte, pos Position) (Range, string, bool) {
+	r, name, ok := wordAt(content, pos)
+	if !ok {
+		return Range{}, "", false
+	}
+	if _, objectType := alObjectSymbolKinds[strings.ToLower(name)]; objectType || renameKeywords[strings.ToLower(name)] {
+		return Range{}, "", false
+	}
+	return r, name, true
+}
+
+// wordAt returns the range and text of the word or quoted identifier at a
+// position in code, outside comments and string literals
+func wordAt(content []byte, pos Position) (Range, string, bool) {
+	lineStart := positionOffset(content, Position{Line: pos.Line})
+	offset := positionOffset(content, pos)
+	lineEnd := len(content)
+	if i := bytes.IndexByte(content[lineStart:], '\n'); i >= 0 {
+		lineEnd = lineStart + i
+	}
+	line := strings.TrimSuffix(string(content[lineStart:lineEnd]), "\r")
+	column := offset - lineStart
+
+	// Identifiers in comments and string literals are not symbols
+	for _, loc := range identifierPattern.FindAllStringIndex(maskALNonCode(line), -1) {
+		if column < loc[0] || column > loc[1] {
+			continue
+		}
+		name := line[loc[0]:loc[1]]
+		start := Position{Line: pos.Line, Character: utf16Length(line[:loc[0]])}
+		end := Position{Line: pos.Line, Character: start.Character + utf16Length(name)}
+		return Range{Start: start, End: end}, name, true
+	}
+	return Range{}, "", false
+}
+
+// maskALNonCode blanks the comments and string literals of a line, keeping
+// the byte offsets of the code
+func maskALNonCode(line string) string {
+	masked := []byte(line)
+	inString, inIdent := false, false
+	for i := 0; i < len(masked); i++ {
+		c := masked[i]
+		switch {
+		case inString:
+			inString = c != '\''
+			masked[i] = ' '
+		case inIdent:
+			inIdent = c != '"'
+		case c == '\'':
+			inString = true
+			masked[i] = ' '
+		case c == '"':
+			inIdent = true
+		case c == '/' && i+1 < len(masked) && (masked[i+1] == '/' || masked[i+1] == '*'):
+			end := len(masked)
+			if masked[i+1] == '*' {
+				if j := strings.Index(line[i+2:], "*/"); j >= 0 {
+					end = i + 2 + j + 2
+				}
+			}
+			for ; i < end; i++ {
+				masked[i] = ' '
+			}
+			i--
+		}
+	}
+	return string(masked)
+}
+
+// identifierPattern matches AL identifiers and quoted identifiers
+var identifierPattern = regexp.MustCompile(`"(?:[^"]|"")+"|[A-Za-z_][A-Za-z0-9_]*`)
+
+// utf16Length returns the length of a string in UTF-16 code units
+func utf16Length(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// unwrapWorkspaceEdit returns the WorkspaceEdit of a rename result. Some AL
+// server versions wrap it in an object, e.g. {"edit": {"changes": ...}}.
+func unwrapWorkspaceEdit(result json.RawMessage) json.RawMessage {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(result, &fields); err != nil || fields == nil {
+		return result
+	}
+	if _, ok := fields["changes"]; ok {
+		return result
+	}
+	if _, ok := fields["documentChanges"]; ok {
+		return result
+	}
+	for _, key := range []string{"edit", "workspaceEdit"} {
+		if inner, ok := fields[key]; ok && len(fields) == 1 {
+			return inner
+		}
+	}
+	return result
+}
+
+// normalizeEditURIs rewrites the file URIs of a WorkspaceEdit to the client's
+// form: the URI the client sent for a known path, else PathToFileURI's
+func normalizeEditURIs(result json.RawMessage, known map[string]string) json.RawMessage {
+	var edit map[string]json.RawMessage
+	if err := json.Unmarshal(result, &edit); err != nil || edit == nil {
+		return result
+	}
+
+	if raw, ok := edit["changes"]; ok {
+		var changes map[string]json.RawMessage
+		if json.Unmarshal(raw, &changes) == nil {
+			normalized := make(map[string]json.RawMessage, len(changes))
+			for uri, edits := range changes {
+				normalized[clientFileURI(uri, known)] = edits
+			}
+			edit["changes"], _ = json.Marshal(normalized)
+		}
+	}
+
+	if raw, ok := edit["documentChanges"]; ok {
+		var changes []map[string]json.RawMessage
+		if json.Unmarshal(raw, &changes) == nil {
+			for _, change := range changes {
+				// TextDocumentEdit
+				var document map[string]json.RawMessage
+				if json.Unmarshal(change["textDocument"], &document) == nil && document != nil {
+					normalizeURIField(document, "uri", known)
+					change["textDocument"], _ = json.Marshal(document)
+				}
+				// CreateFile, RenameFile and DeleteFile
+				for _, key := range []string{"uri", "oldUri", "newUri"} {
+					normalizeURIField(change, key, known)
+				}
+			}
+			edit["documentChanges"], _ = json.Marshal(changes)
+		}
+	}
+
+	data, err := json.Marshal(edit)
+	if err != nil {
+		return result
+	}
+	return data
+}
+
+// normalizeURIField rewrites the URI string stored under key, if any
+func normalizeURIField(fields map[string]json.RawMessage, key string, known map[string]string) {
+	var uri string
+	if raw, ok := fields[key]; !ok || json.Unmarshal(raw, &uri) != nil {
+		return
+	}
+	fields[key], _ = json.Marshal(clientFileURI(uri, known))
+}
+
+// clientFileURI returns the client's form of a file URI. Non-file URIs are
+// returned unchanged.
+func clientFileURI(uri string, known map[string]string) string {
+	if !strings.HasPrefix(strings.ToLower(uri), "file:") {
+		return uri
+	}
+	path, err := FileURIToPath(uri)
+	if err != nil {
+		return uri
+	}
+	if clientURI, ok := known[NormalizePath(path)]; ok {
+		return clientURI
+	}
+	return PathToFileURI(path)
+}
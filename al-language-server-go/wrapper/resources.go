@@ -0,0 +1,121 @@
+package wrapper
+
+import (
+	"fmt"
+	"time"
+)
+
+// The AL server's memory and CPU use are sampled periodically, logged and
+// reported by al-wrapper/status, so a busy machine can be traced to it. The
+// user is warned through window/showMessage when a sample crosses one of the
+// configured thresholds; the warning is repeated only after usage has dropped
+// below the threshold again.
+
+// ProcessUsage is a sample of the AL server's resource use
+type ProcessUsage struct {
+	PID      int   `json:"pid"`
+	MemoryMB int64 `json:"memoryMB"`
+	// CPUPercent is the average CPU use since the previous sample, in percent
+	// of one core
+	CPUPercent float64   `json:"cpuPercent"`
+	SampledAt  time.Time `json:"sampledAt"`
+}
+
+// resourceSampler holds the previous sample and the thresholds crossed
+type resourceSampler struct {
+	pid        int
+	cpuTime    time.Duration
+	sampledAt  time.Time
+	usage      *ProcessUsage
+	memoryHigh bool
+	cpuHigh    bool
+}
+
+// superviseResources samples the AL server's resource use at the configured interval
+func (w *ALLSPWrapper) superviseResources() {
+	for {
+		interval := time.Duration(w.Config().Resources.SampleSeconds) * time.Second
+		if interval <= 0 {
+			return
+		}
+		time.Sleep(interval)
+		w.sampleResources(time.Now())
+	}
+}
+
+// sampleResources samples the running AL server, logs the sample and warns
+// about crossed thresholds
+func (w *ALLSPWrapper) sampleResources(now time.Time) {
+	if w.disabled.Load() || w.serverIdleStopped() {
+		return
+	}
+	w.serverMu.Lock()
+	pid := 0
+	if w.cmd != nil && w.cmd.Process != nil {
+		pid = w.cmd.Process.Pid
+	}
+	w.serverMu.Unlock()
+	if pid == 0 {
+		return
+	}
+
+	memory, cpuTime, err := processUsage(pid)
+	if err != nil {
+		w.Log("Failed to sample AL LSP resource use: %v", err)
+		return
+	}
+
+	w.resourceMu.Lock()
+	s := &w.resources
+	usage := &ProcessUsage{PID: pid, MemoryMB: int64(memory >> 20), SampledAt: now}
+	if s.pid == pid && now.After(s.sampledAt) {
+		usage.CPUPercent = 100 * float64(cpuTime-s.cpuTime) / float64(now.Sub(s.sampledAt))
+	}
+	if s.pid != pid {
+		// A restarted server starts below every threshold
+		s.memoryHigh, s.cpuHigh = false, false
+	}
+	s.pid, s.cpuTime, s.sampledAt, s.usage = pid, cpuTime, now, usage
+	warnings := w.crossedThresholds(s, usage)
+	w.resourceMu.Unlock()
+
+	w.Log("AL LSP resource use: pid=%d memory=%d MB cpu=%.1f%%", pid, usage.MemoryMB, usage.CPUPercent)
+	for _, warning := range warnings {
+		w.Log("%s", warning)
+		w.notifyClient(MessageTypeWarning, warning)
+	}
+}
+
+// crossedThresholds returns a warning for each threshold a sample newly crossed
+func (w *ALLSPWrapper) crossedThresholds(s *resourceSampler, usage *ProcessUsage) []string {
+	cfg := w.Config().Resources
+	var warnings []string
+
+	memoryHigh := cfg.WarnMemoryMB > 0 && usage.MemoryMB >= int64(cfg.WarnMemoryMB)
+	if memoryHigh && !s.memoryHigh {
+		warnings = append(warnings, fmt.Sprintf(
+			"AL LSP wrapper: the AL language server (pid %d) is using %d MB of memory (resources.warnMemoryMB = %d).",
+			usage.PID, usage.MemoryMB, cfg.WarnMemoryMB))
+	}
+	s.memoryHigh = memoryHigh
+
+	cpuHigh := cfg.WarnCPUPercent > 0 && usage.CPUPercent >= float64(cfg.WarnCPUPercent)
+	if cpuHigh && !s.cpuHigh {
+		warnings = append(warnings, fmt.Sprintf(
+			"AL LSP wrapper: the AL language server (pid %d) is using %.0f%% CPU (resources.warnCpuPercent = %d).",
+			usage.PID, usage.CPUPercent, cfg.WarnCPUPercent))
+	}
+	s.cpuHigh = cpuHigh
+	return warnings
+}
+
+// ServerUsage returns the latest resource sample of the AL server, or nil
+func (w *ALLSPWrapper) ServerUsage() *ProcessUsage {
+	w.resourceMu.Lock()
+	defer w.resourceMu.Unlock()
+	if w.resources.usage == nil {
+		return nil
+	}
+	usage := *w.resources.usage
+	return &usage
+}
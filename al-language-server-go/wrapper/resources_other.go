@@ -0,0 +1,103 @@
+//go:build !windows
+
+package wrapper
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicksPerSecond is USER_HZ, the unit of CPU times in /proc
+const clockTicksPerSecond = 100
+
+// processUsage returns the resident memory in bytes and the CPU time used by a
+// process, from /proc where available and from ps otherwise (macOS)
+func processUsage(pid int) (uint64, time.Duration, error) {
+	if memory, cpuTime, err := procUsage(pid); err == nil {
+		return memory, cpuTime, nil
+	}
+	return psUsage(pid)
+}
+
+// procUsage reads a process's usage from /proc/<pid>/stat and /proc/<pid>/status
+func procUsage(pid int) (uint64, time.Duration, error) {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, 0, err
+	}
+	// The command name may contain spaces; the fields after it start with the state
+	end := strings.LastIndexByte(string(stat), ')')
+	fields := strings.Fields(string(stat[end+1:]))
+	if end < 0 || len(fields) < 13 {
+		return 0, 0, fmt.Errorf("unexpected /proc/%d/stat format", pid)
+	}
+	utime, _ := strconv.ParseUint(fields[11], 10, 64)
+	stime, _ := strconv.ParseUint(fields[12], 10, 64)
+	cpuTime := time.Duration(utime+stime) * time.Second / clockTicksPerSecond
+
+	status, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, line := range strings.Split(string(status), "\n") {
+		if value, ok := strings.CutPrefix(line, "VmRSS:"); ok {
+			kb, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimSpace(value), " kB"), 10, 64)
+			if err != nil {
+				return 0, 0, err
+			}
+			return kb << 10, cpuTime, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("no VmRSS in /proc/%d/status", pid)
+}
+
+// psUsage reads a process's usage with ps
+func psUsage(pid int) (uint64, time.Duration, error) {
+	out, err := exec.Command("ps", "-o", "rss=,time=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return 0, 0, fmt.Errorf("ps failed: %w", err)
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("unexpected ps output %q", strings.TrimSpace(string(out)))
+	}
+	kb, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	cpuTime, err := parsePsTime(fields[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	return kb << 10, cpuTime, nil
+}
+
+// parsePsTime parses a ps CPU time, [[dd-]hh:]mm:ss[.ss]
+func parsePsTime(value string) (time.Duration, error) {
+	var total time.Duration
+	if days, rest, ok := strings.Cut(value, "-"); ok {
+		d, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid ps time %q", value)
+		}
+		total += time.Duration(d) * 24 * time.Hour
+		value = rest
+	}
+	parts := strings.Split(value, ":")
+	units := []time.Duration{time.Second, time.Minute, time.Hour}
+	if len(parts) > len(units) {
+		return 0, fmt.Errorf("invalid ps time %q", value)
+	}
+	for i := range parts {
+		n, err := strconv.ParseFloat(parts[len(parts)-1-i], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid ps time %q", value)
+		}
+		total += time.Duration(n * float64(units[i]))
+	}
+	return total, nil
+}
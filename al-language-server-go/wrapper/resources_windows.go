@@ -0,0 +1,59 @@
+//go:build windows
+
+package wrapper
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+var (
+	psapi                    = syscall.NewLazyDLL("psapi.dll")
+	procGetProcessMemoryInfo = psapi.NewProc("GetProcessMemoryInfo")
+)
+
+const processQueryLimitedInformation = 0x1000
+
+// PROCESS_MEMORY_COUNTERS structure
+type processMemoryCounters struct {
+	Cb                         uint32
+	PageFaultCount             uint32
+	PeakWorkingSetSize         uintptr
+	WorkingSetSize             uintptr
+	QuotaPeakPagedPoolUsage    uintptr
+	QuotaPagedPoolUsage        uintptr
+	QuotaPeakNonPagedPoolUsage uintptr
+	QuotaNonPagedPoolUsage     uintptr
+	PagefileUsage              uintptr
+	PeakPagefileUsage          uintptr
+}
+
+// processUsage returns the working set in bytes and the CPU time used by a process
+func processUsage(pid int) (uint64, time.Duration, error) {
+	handle, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return 0, 0, fmt.Errorf("OpenProcess failed: %w", err)
+	}
+	defer syscall.CloseHandle(handle)
+
+	var creation, exit, kernel, user syscall.Filetime
+	if err := syscall.GetProcessTimes(handle, &creation, &exit, &kernel, &user); err != nil {
+		return 0, 0, fmt.Errorf("GetProcessTimes failed: %w", err)
+	}
+	cpuTime := time.Duration(filetimeTicks(kernel)+filetimeTicks(user)) * 100
+
+	var counters processMemoryCounters
+	counters.Cb = uint32(unsafe.Sizeof(counters))
+	ret, _, callErr := procGetProcessMemoryInfo.Call(uintptr(handle), uintptr(unsafe.Pointer(&counters)), uintptr(counters.Cb))
+	if ret == 0 {
+		return 0, 0, fmt.Errorf("GetProcessMemoryInfo failed: %w", callErr)
+	}
+	return uint64(counters.WorkingSetSize), cpuTime, nil
+}
+
+// filetimeTicks returns a FILETIME duration in 100-nanosecond ticks
+func filetimeTicks(ft syscall.Filetime) int64 {
+	return int64(ft.HighDateTime)<<32 | int64(ft.LowDateTime)
+}
@@ -0,0 +1,162 @@
+package wrapper
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// When VS Code updates the AL extension it installs the new version next to
+// the old one and later deletes the old directory, taking the running
+// EditorServices binary with it. The wrapper watches for the executable to
+// disappear and then restarts against the newest installed extension,
+// re-initializing the server and replaying the projects and documents it had.
+
+// executableCheckInterval is how often the running server's executable is checked
+const executableCheckInterval = 30 * time.Second
+
+// errExecutableRemoved reports that the running server's executable was deleted
+var errExecutableRemoved = errors.New("AL LSP executable was removed")
+
+// superviseServer reads from the AL LSP until it exits. If the AL extension
+// was updated or removed underneath it, the server is restarted and reading
+// continues; otherwise the read error is returned.
+func (w *ALLSPWrapper) superviseServer() error {
+	ticker := time.NewTicker(executableCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		w.serverMu.Lock()
+		stdout := w.stdout
+		w.serverMu.Unlock()
+
+		done := make(chan error, 1)
+		go func() { done <- w.readFromLSP(stdout) }()
+
+		var err error
+	wait:
+		for {
+			select {
+			case err = <-done:
+				break wait
+			case <-ticker.C:
+				if w.executableRemoved() {
+					err = errExecutableRemoved
+					break wait
+				}
+			}
+		}
+
+		if w.disabled.Load() {
+			// Stopped on purpose; the client loop ends the session
+			w.Log("AL LSP stopped: wrapper disabled for this workspace")
+			select {}
+		}
+		resumed, resumeErr := w.awaitIdleResume(stdout)
+		if resumeErr != nil {
+			return fmt.Errorf("AL LSP stopped for being idle could not be restarted: %w", resumeErr)
+		}
+		if resumed {
+			continue
+		}
+		if !w.executableRemoved() {
+			return err
+		}
+		w.Log("AL LSP stopped (%v) and its executable %s is gone; assuming the AL extension was updated", err, w.serverExecutable())
+		if restartErr := w.restartServer(); restartErr != nil {
+			return fmt.Errorf("%v; restart failed: %w", err, restartErr)
+		}
+	}
+}
+
+// serverExecutable returns the path of the running server's executable
+func (w *ALLSPWrapper) serverExecutable() string {
+	w.serverMu.Lock()
+	defer w.serverMu.Unlock()
+	return w.executable
+}
+
+// executableRemoved reports whether the running server's executable no longer exists
+func (w *ALLSPWrapper) executableRemoved() bool {
+	executable := w.serverExecutable()
+	if executable == "" {
+		return false
+	}
+	_, err := os.Stat(executable)
+	return os.IsNotExist(err)
+}
+
+// stopServer kills the current AL LSP process
+func (w *ALLSPWrapper) stopServer() {
+	w.serverMu.Lock()
+	cmd := w.cmd
+	w.serverMu.Unlock()
+
+	if cmd != nil && cmd.Process != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}
+}
+
+// restartServer replaces the AL LSP process with one from the newest AL
+// extension and replays the session state in the background
+func (w *ALLSPWrapper) restartServer() error {
+	state := w.captureWarmState()
+	oldPath := w.serverExtensionPath()
+	oldVersion := ALExtensionVersion(oldPath)
+
+	w.stopServer()
+	w.failPendingRequests("AL language server is restarting after an AL extension update")
+	w.resetCircuits()
+
+	if err := w.startServer(); err != nil {
+		return err
+	}
+	newPath := w.serverExtensionPath()
+	w.Log("AL extension changed during session: %s (%s) -> %s (%s)",
+		oldVersion, oldPath, ALExtensionVersion(newPath), newPath)
+
+	// The replay waits for responses, so it must run while superviseServer reads
+	go w.replayAfterRestart(state)
+	return nil
+}
+
+// replayAfterRestart initializes a restarted server as the client did and
+// reopens the projects and documents of the previous server
+func (w *ALLSPWrapper) replayAfterRestart(state *warmState) {
+	scope := w.newRequestScope()
+	start := time.Now()
+
+	if w.serverInitParams == nil {
+		scope.Log("Server restarted before initialize; nothing to replay")
+		return
+	}
+	if _, err := scope.SendRequestToLSP("initialize", w.initParamsWithTrace()); err != nil {
+		scope.Log("Failed to initialize restarted AL LSP: %v", err)
+		return
+	}
+	scope.SendNotificationToLSP("initialized", nil)
+	w.probeALMethods(scope)
+
+	w.docMu.Lock()
+	w.openedFiles = make(map[string]int)
+	w.serverDocs = make(map[string]serverDocument)
+	w.docMu.Unlock()
+	w.resetProjects()
+
+	projects, files := w.replayState(scope, state, true)
+	scope.Log("Replayed %d project(s) and %d document(s) on the restarted AL LSP in %s",
+		projects, files, time.Since(start).Round(time.Millisecond))
+}
+
+// failPendingRequests answers every request still waiting on the AL LSP with an error
+func (w *ALLSPWrapper) failPendingRequests(reason string) {
+	w.pendingMu.Lock()
+	defer w.pendingMu.Unlock()
+
+	for id, ch := range w.pendingReqs {
+		ch <- &Message{JSONRPC: "2.0", Error: &RPCError{Code: InternalError, Message: reason}}
+		delete(w.pendingReqs, id)
+	}
+}
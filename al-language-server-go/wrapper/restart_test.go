@@ -0,0 +1,104 @@
+package wrapper
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/SShadowS/claude-code-lsps/al-language-server-go/internal/hostarch"
+)
+
+// installFakeExtension installs an AL extension whose EditorServices host is
+// a script that never answers. It returns the extension and a file the host
+// creates once it runs.
+func installFakeExtension(t *testing.T, home, version string) (extension, started string) {
+	t.Helper()
+	extension = filepath.Join(home, ".vscode", "extensions", "ms-dynamics-smb.al-"+version)
+	candidates := executableCandidates(extension, runtime.GOOS, hostarch.Native())
+	host := candidates[len(candidates)-1]
+	if err := os.MkdirAll(filepath.Dir(host), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	started = filepath.Join(home, "started-"+version)
+	script := "#!/bin/sh\ntouch '" + started + "'\nexec sleep 600\n"
+	if err := os.WriteFile(host, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return extension, started
+}
+
+// fileExists reports whether path exists
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// killServer kills the AL server process as a crash would, leaving it to the
+// wrapper to reap
+func killServer(t *testing.T, w *ALLSPWrapper) {
+	t.Helper()
+	w.serverMu.Lock()
+	cmd := w.cmd
+	w.serverMu.Unlock()
+	if err := cmd.Process.Kill(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitFor polls cond until it holds or the test times out
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRestartAfterExtensionUpdate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake AL server is a shell script")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	oldExtension, oldStarted := installFakeExtension(t, home, "16.0.1")
+
+	w := New()
+	if err := w.startServer(); err != nil {
+		t.Fatalf("startServer error: %v", err)
+	}
+	supervised := make(chan error, 1)
+	go func() { supervised <- w.superviseServer() }()
+	waitFor(t, "the AL server to start", func() bool { return fileExists(oldStarted) })
+
+	// VS Code installs the update next to the old version, then deletes the old one
+	newExtension, newStarted := installFakeExtension(t, home, "17.0.1")
+	if err := os.RemoveAll(oldExtension); err != nil {
+		t.Fatal(err)
+	}
+	killServer(t, w)
+	waitFor(t, "the restart", func() bool {
+		return fileExists(newStarted) && w.serverExtensionPath() == newExtension
+	})
+	if removed := w.executableRemoved(); removed {
+		t.Error("restarted AL server's executable reported as removed")
+	}
+
+	// With no extension left, the restart fails and supervision ends
+	if err := os.RemoveAll(newExtension); err != nil {
+		t.Fatal(err)
+	}
+	killServer(t, w)
+	select {
+	case err := <-supervised:
+		if err == nil {
+			t.Error("superviseServer returned no error after the AL extension was removed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("superviseServer did not return after the AL extension was removed")
+	}
+}
@@ -0,0 +1,97 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Teams tune rule severities in a ruleset.json that VS Code passes to the AL
+// server through al.ruleSetPath. The wrapper sends a project's ruleSetPath
+// from, in order:
+//
+//  1. ruleSet.path from the wrapper config
+//  2. al.ruleSetPath from the project's .vscode/settings.json
+//  3. with ruleSet.discover, a *.ruleset.json file in the project folder or,
+//     for rulesets shared by the apps of a repository, in a folder above it
+//     up to the workspace root
+//
+// Relative paths are resolved against the project, and ${workspaceFolder}
+// is the project folder as in VS Code. A configured path that does not exist
+// is ignored with a log message rather than sent to the AL server.
+
+// ruleSetSuffix ends the file names of discovered rulesets
+const ruleSetSuffix = ".ruleset.json"
+
+// vscodeRuleSetPath returns al.ruleSetPath from a project's .vscode/settings.json
+func vscodeRuleSetPath(projectRoot string) string {
+	data, err := os.ReadFile(filepath.Join(projectRoot, ".vscode", "settings.json"))
+	if err != nil {
+		return ""
+	}
+	var settings struct {
+		Path string `json:"al.ruleSetPath"`
+	}
+	json.Unmarshal(StripJSONComments(data), &settings)
+	return settings.Path
+}
+
+// discoverRuleSet returns the first *.ruleset.json, by name, in the project
+// folder or the nearest folder above it up to the workspace root
+func discoverRuleSet(projectRoot string, workspaceRoot string) string {
+	dir := projectRoot
+	for {
+		matches, _ := filepath.Glob(filepath.Join(dir, "*"+ruleSetSuffix))
+		var files []string
+		for _, match := range matches {
+			if info, err := os.Stat(match); err == nil && !info.IsDir() {
+				files = append(files, match)
+			}
+		}
+		if len(files) > 0 {
+			sort.Strings(files)
+			return files[0]
+		}
+
+		parent := filepath.Dir(dir)
+		if workspaceRoot == "" || parent == dir || !isWithin(parent, workspaceRoot) {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// ruleSetPath returns the ruleset of a project ("" if it has none) and
+// where it came from
+func ruleSetPath(projectRoot string, workspaceRoot string, cfg RuleSetConfig, logf func(format string, args ...interface{})) (string, string) {
+	configured := []struct {
+		path, source string
+	}{
+		{cfg.Path, "ruleSet.path"},
+		{vscodeRuleSetPath(projectRoot), "al.ruleSetPath"},
+	}
+	for _, c := range configured {
+		if c.path == "" {
+			continue
+		}
+		path := strings.ReplaceAll(c.path, "${workspaceFolder}", projectRoot)
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(projectRoot, path)
+		}
+		path = filepath.Clean(path)
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			logf("Ignoring %s %s of %s: not a file", c.source, c.path, projectRoot)
+			continue
+		}
+		return path, c.source
+	}
+
+	if cfg.Discover {
+		if path := discoverRuleSet(projectRoot, workspaceRoot); path != "" {
+			return path, "discovered"
+		}
+	}
+	return "", ""
+}
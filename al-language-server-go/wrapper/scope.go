@@ -0,0 +1,94 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// requestScope is the WrapperInterface handed to handlers for a single client message.
+// Every log line it writes carries the message's correlation ID, and each request
+// the wrapper sends to the AL server on its behalf gets a numbered span, so
+// multi-hop fallback chains (definition -> hover -> documentSymbol) can be
+// followed in the log.
+type requestScope struct {
+	*ALLSPWrapper
+	correlationID string
+	spans         int64
+	// batch collects the responses of the client batch the message came in, if any
+	batch *clientBatch
+	// progress holds the client request's progress tokens, if it has any
+	progress *clientProgress
+}
+
+// newRequestScope creates a scope with a fresh correlation ID
+func (w *ALLSPWrapper) newRequestScope() *requestScope {
+	id := atomic.AddInt64(&w.correlationSeq, 1)
+	return &requestScope{
+		ALLSPWrapper:  w,
+		correlationID: fmt.Sprintf("req-%d", id),
+	}
+}
+
+// newSpan returns the tag for the next internal request of this scope
+func (s *requestScope) newSpan() string {
+	return fmt.Sprintf("%s.%d", s.correlationID, atomic.AddInt64(&s.spans, 1))
+}
+
+// Log logs a message tagged with the correlation ID
+func (s *requestScope) Log(format string, args ...interface{}) {
+	s.logTagged(s.correlationID, format, args...)
+}
+
+// EnsureFileOpened ensures a file is opened in the AL LSP
+func (s *requestScope) EnsureFileOpened(filePath string) error {
+	return s.ensureFileOpened(s, filePath)
+}
+
+// EnsureProjectInitialized ensures the project for a file is initialized
+func (s *requestScope) EnsureProjectInitialized(filePath string) error {
+	return s.ensureProjectInitialized(s, filePath)
+}
+
+// ApplyWorkspaceEdit applies a WorkspaceEdit to disk and updates the AL LSP
+func (s *requestScope) ApplyWorkspaceEdit(edit *WorkspaceEdit, source string) (*AppliedEdit, error) {
+	return s.applyWorkspaceEdit(s, edit, source)
+}
+
+// AuditResult records the edits in a result forwarded to the client
+func (s *requestScope) AuditResult(method string, result json.RawMessage) {
+	s.auditResult(s, method, result)
+}
+
+// CheckEditDrift verifies the files of a WorkspaceEdit still hold the text
+// the AL server computed it against
+func (s *requestScope) CheckEditDrift(edit *WorkspaceEdit, synced map[string]string) error {
+	return s.checkEditDrift(s, edit, synced)
+}
+
+// SendRequestToLSP sends a request to the AL LSP as a new span
+func (s *requestScope) SendRequestToLSP(method string, params interface{}) (*Message, error) {
+	return s.SendRequestToLSPWithTimeout(method, params, defaultRequestTimeout)
+}
+
+// SendRequestToLSPWithTimeout sends a request to the AL LSP as a new span
+func (s *requestScope) SendRequestToLSPWithTimeout(method string, params interface{}, timeout time.Duration) (*Message, error) {
+	if s.progress != nil {
+		params = s.progress.withTokens(method, params)
+	}
+	return s.sendRequest(s.newSpan(), method, params, timeout)
+}
+
+// SendRequestToLSPWithBudget sends a request within its method's latency budget as a new span
+func (s *requestScope) SendRequestToLSPWithBudget(method string, params interface{}) (*Message, bool, error) {
+	if s.progress != nil {
+		params = s.progress.withTokens(method, params)
+	}
+	return s.sendRequestWithBudget(s.newSpan(), method, params)
+}
+
+// SendNotificationToLSP sends a notification to the AL LSP
+func (s *requestScope) SendNotificationToLSP(method string, params interface{}) error {
+	return s.sendNotification(s.correlationID, method, params)
+}
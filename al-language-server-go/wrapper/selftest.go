@@ -0,0 +1,116 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SShadowS/claude-code-lsps/al-language-server-go/internal/hostarch"
+)
+
+// SelfTestReport summarizes the wrapper's environment and startup for support purposes
+type SelfTestReport struct {
+	WrapperVersion   string          `json:"wrapperVersion"`
+	GoVersion        string          `json:"goVersion"`
+	Platform         string          `json:"platform"`
+	HostArch         string          `json:"hostArch"`
+	PID              int             `json:"pid"`
+	SessionID        string          `json:"sessionId"`
+	StartedAt        time.Time       `json:"startedAt"`
+	ExtensionPath    string          `json:"extensionPath"`
+	ExtensionVersion string          `json:"extensionVersion"`
+	Executable       string          `json:"executable"`
+	ExecutableExists bool            `json:"executableExists"`
+	ExecutableArch   string          `json:"executableArch"`
+	ExecutableAdvice string          `json:"executableAdvice,omitempty"`
+	LogPath          string          `json:"logPath"`
+	ConfigSources    []string        `json:"configSources"`
+	ALMethods        map[string]bool `json:"alMethods,omitempty"`
+	Phases           []StartupPhase  `json:"phases"`
+}
+
+// StartupPhase records the duration and outcome of one startup step
+type StartupPhase struct {
+	Name       string  `json:"name"`
+	DurationMs float64 `json:"durationMs"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// selfTest collects the report while the wrapper starts
+type selfTest struct {
+	mu     sync.Mutex
+	report SelfTestReport
+}
+
+func newSelfTest() *selfTest {
+	return &selfTest{
+		report: SelfTestReport{
+			WrapperVersion: Version,
+			GoVersion:      runtime.Version(),
+			Platform:       runtime.GOOS + "/" + runtime.GOARCH,
+			HostArch:       hostarch.Native(),
+			PID:            os.Getpid(),
+			SessionID:      SessionID(),
+			StartedAt:      time.Now(),
+		},
+	}
+}
+
+// update modifies the report under lock
+func (t *selfTest) update(fn func(r *SelfTestReport)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fn(&t.report)
+}
+
+// phase records a startup phase that began at start
+func (t *selfTest) phase(name string, start time.Time, err error) {
+	p := StartupPhase{
+		Name:       name,
+		DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		p.Error = err.Error()
+	}
+	t.update(func(r *SelfTestReport) {
+		r.Phases = append(r.Phases, p)
+	})
+}
+
+// Snapshot returns a copy of the current report
+func (t *selfTest) Snapshot() SelfTestReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r := t.report
+	r.ConfigSources = append([]string(nil), t.report.ConfigSources...)
+	r.Phases = append([]StartupPhase(nil), t.report.Phases...)
+	return r
+}
+
+// logSelfTest writes the report to the log as a single structured block
+func (w *ALLSPWrapper) logSelfTest() {
+	data, err := json.MarshalIndent(w.selfTest.Snapshot(), "", "  ")
+	if err != nil {
+		return
+	}
+	w.Log("=== Self-test report ===\n%s\n=== End self-test report ===", strings.TrimSpace(string(data)))
+}
+
+// SelfTest returns the startup self-test report
+func (w *ALLSPWrapper) SelfTest() SelfTestReport {
+	return w.selfTest.Snapshot()
+}
+
+// SelfTestHandler handles al-wrapper/selfTest, returning the startup self-test report
+type SelfTestHandler struct{}
+
+func (h *SelfTestHandler) ShouldHandle(method string) bool {
+	return method == "al-wrapper/selfTest"
+}
+
+func (h *SelfTestHandler) Handle(msg *Message, w WrapperInterface) (*Message, *Message) {
+	return newResultMessage(msg.ID, w.SelfTest())
+}
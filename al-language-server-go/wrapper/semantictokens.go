@@ -0,0 +1,66 @@
+package wrapper
+
+import (
+	"encoding/json"
+)
+
+// Semantic tokens are encoded against the legend the AL server declares in
+// its initialize result, so the legend is passed to the client unchanged and
+// token data is forwarded as raw JSON. The wrapper asks for the tokens of a
+// whole document or of a range; delta requests are not forwarded, so the
+// advertised capability drops full.delta.
+
+// semanticTokensMethods are the semantic token requests the wrapper forwards
+var semanticTokensMethods = map[string]bool{
+	"textDocument/semanticTokens/full":  true,
+	"textDocument/semanticTokens/range": true,
+}
+
+// SemanticTokensHandler handles textDocument/semanticTokens/full and
+// textDocument/semanticTokens/range
+type SemanticTokensHandler struct{}
+
+func (h *SemanticTokensHandler) ShouldHandle(method string) bool {
+	return semanticTokensMethods[method]
+}
+
+func (h *SemanticTokensHandler) Handle(msg *Message, w WrapperInterface) (*Message, *Message) {
+	var params struct {
+		TextDocument TextDocumentIdentifier `json:"textDocument"`
+		Range        *Range                 `json:"range"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		w.Log("Failed to parse semanticTokens params: %v", err)
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "Invalid parameters")
+	}
+	if msg.Method == "textDocument/semanticTokens/range" && params.Range == nil {
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "Missing range")
+	}
+
+	return forwardDocumentRequest(msg, w)
+}
+
+// advertiseSemanticTokens adjusts the semanticTokensProvider of an initialize
+// result to the requests the wrapper forwards, keeping the AL server's legend.
+// A result without a legend is returned as is.
+func advertiseSemanticTokens(result json.RawMessage) json.RawMessage {
+	var initResult map[string]interface{}
+	if err := json.Unmarshal(result, &initResult); err != nil || initResult == nil {
+		return result
+	}
+	capabilities, _ := initResult["capabilities"].(map[string]interface{})
+	provider, _ := capabilities["semanticTokensProvider"].(map[string]interface{})
+	if provider == nil || provider["legend"] == nil {
+		return result
+	}
+	if _, ok := provider["full"].(map[string]interface{}); ok {
+		// full.delta is not forwarded; full alone still is
+		provider["full"] = true
+	}
+
+	merged, err := json.Marshal(initResult)
+	if err != nil {
+		return result
+	}
+	return merged
+}
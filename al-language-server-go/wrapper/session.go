@@ -0,0 +1,168 @@
+package wrapper
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// logFilePrefix starts every wrapper log file name
+	logFilePrefix = "al-lsp-wrapper-go-"
+	// logRetention is how long logs of finished sessions are kept
+	logRetention = 7 * 24 * time.Hour
+	// maxLogFiles caps how many session logs are kept per user
+	maxLogFiles = 20
+
+	// cacheLockName is the lock file guarding a shared cache directory
+	cacheLockName = ".lock"
+	// staleLockAge is when a cache lock is assumed abandoned by a crashed session
+	staleLockAge = 2 * time.Minute
+)
+
+// sessionID identifies this wrapper process across log files and cache locks.
+// PIDs are recycled, so a random component keeps concurrent and successive
+// Claude sessions apart.
+var sessionID = newSessionID()
+
+// logPath is computed once so a session never switches log files
+var logPath = filepath.Join(GetStateDir(), logFilePrefix+fmt.Sprintf("%s-%d-%s.log", safeUserName(), os.Getpid(), sessionID))
+
+func newSessionID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano()&0xffffffff, 16)
+	}
+	return hex.EncodeToString(b)
+}
+
+// SessionID returns the identifier of this wrapper process
+func SessionID() string {
+	return sessionID
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// safeUserName returns the current user name, without domain, usable in a file name
+func safeUserName() string {
+	name := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	if i := strings.LastIndexAny(name, `\/`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = unsafeFileChars.ReplaceAllString(name, "_")
+	if name == "" {
+		return "unknown"
+	}
+	return name
+}
+
+// GetLogPath returns this session's log file:
+// al-lsp-wrapper-go-<user>-<pid>-<session>.log in the state directory
+func GetLogPath() string {
+	return logPath
+}
+
+// FindLatestLogPath returns the most recently written wrapper log of the
+// current user, for tools (like support-bundle) that run as a separate process
+func FindLatestLogPath() (string, error) {
+	logs := listLogFiles(GetStateDir(), safeUserName())
+	if len(logs) == 0 {
+		return "", fmt.Errorf("no wrapper logs found in %s", GetStateDir())
+	}
+	return logs[0].path, nil
+}
+
+type logFile struct {
+	path    string
+	modTime time.Time
+}
+
+// listLogFiles returns a user's session logs in dir, newest first
+func listLogFiles(dir string, userName string) []logFile {
+	matches, _ := filepath.Glob(filepath.Join(dir, logFilePrefix+userName+"-*.log"))
+	var logs []logFile
+	for _, path := range matches {
+		if info, err := os.Stat(path); err == nil {
+			logs = append(logs, logFile{path: path, modTime: info.ModTime()})
+		}
+	}
+	sort.Slice(logs, func(i, j int) bool {
+		return logs[i].modTime.After(logs[j].modTime)
+	})
+	return logs
+}
+
+// pruneLogFiles removes old session logs, keeping this session's log, logs
+// written within logRetention and at most maxLogFiles overall
+func pruneLogFiles() (removed int) {
+	for i, lf := range listLogFiles(GetStateDir(), safeUserName()) {
+		if lf.path == logPath {
+			continue
+		}
+		if i < maxLogFiles && time.Since(lf.modTime) < logRetention {
+			continue
+		}
+		if os.Remove(lf.path) == nil {
+			removed++
+		}
+	}
+	return removed
+}
+
+// ErrCacheLocked is returned when another session holds a cache lock
+var ErrCacheLocked = errors.New("cache is locked by another session")
+
+// AcquireCacheLock takes the lock for a cache directory shared between
+// sessions, waiting up to timeout. The lock file records the owning
+// session so a stuck lock can be traced to its log. Locks older than
+// staleLockAge are treated as left behind by a crashed session and taken over.
+// The returned function releases the lock.
+func AcquireCacheLock(dir string, timeout time.Duration) (func(), error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	lockPath := filepath.Join(dir, cacheLockName)
+	owner := fmt.Sprintf("pid=%d session=%s user=%s\n", os.Getpid(), sessionID, safeUserName())
+	deadline := time.Now().Add(timeout)
+
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.WriteString(owner)
+			f.Close()
+			return func() { releaseCacheLock(lockPath, owner) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		if info, statErr := os.Stat(lockPath); statErr == nil && time.Since(info.ModTime()) > staleLockAge {
+			os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			holder, _ := os.ReadFile(lockPath)
+			return nil, fmt.Errorf("%w: %s (%s)", ErrCacheLocked, dir, strings.TrimSpace(string(holder)))
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// releaseCacheLock removes a lock file if this session still owns it
+func releaseCacheLock(lockPath string, owner string) {
+	if data, err := os.ReadFile(lockPath); err == nil && string(data) == owner {
+		os.Remove(lockPath)
+	}
+}
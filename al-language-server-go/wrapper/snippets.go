@@ -0,0 +1,201 @@
+package wrapper
+
+import (
+	_ "embed"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// The AL extension's snippets (ttable, tpage, tcodeunit, ...) live in VS
+// Code, not in the AL server, so other clients never see them. When the
+// server has no completion items for a position and completion.snippets is
+// on, the wrapper offers the snippets bundled into the binary (alsnippets.json)
+// that fit where the cursor is: object snippets outside any object, member
+// snippets (procedures, triggers, event subscribers, fields, keys) inside an
+// object, and statement snippets inside a procedure or trigger. Clients
+// without snippet support get the snippet's text with the placeholders
+// filled in with their defaults.
+
+//go:embed alsnippets.json
+var alSnippetsData []byte
+
+// alSnippet is an entry of the bundled snippet library
+type alSnippet struct {
+	Prefix string `json:"prefix"`
+	// Context is "object", "member" or "statement"
+	Context     string `json:"context"`
+	Description string `json:"description"`
+	// Body is in LSP snippet syntax, indented with four spaces
+	Body string `json:"body"`
+}
+
+// Completion item kind and insert text formats (LSP)
+const (
+	completionKindSnippet   = 15
+	insertTextFormatPlain   = 1
+	insertTextFormatSnippet = 2
+)
+
+// CompletionItem is a completion item the wrapper produces
+type CompletionItem struct {
+	Label            string         `json:"label"`
+	Kind             int            `json:"kind"`
+	Detail           string         `json:"detail,omitempty"`
+	Documentation    *MarkupContent `json:"documentation,omitempty"`
+	InsertText       string         `json:"insertText"`
+	InsertTextFormat int            `json:"insertTextFormat"`
+}
+
+var (
+	alSnippetsOnce sync.Once
+	alSnippets     []alSnippet
+)
+
+// loadALSnippets parses the bundled snippets on first use
+func loadALSnippets() []alSnippet {
+	alSnippetsOnce.Do(func() {
+		json.Unmarshal(alSnippetsData, &alSnippets)
+	})
+	return alSnippets
+}
+
+// snippetPlaceholder matches tab stops and placeholders: $0, $1, ${2:Name}
+var snippetPlaceholder = regexp.MustCompile(`\$\{\d+:([^}]*)\}|\$\d+`)
+
+// snippetPlainText returns a snippet body with its placeholders replaced by
+// their defaults and its tab stops removed
+func snippetPlainText(body string) string {
+	lines := strings.Split(snippetPlaceholder.ReplaceAllString(body, "$1"), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], " \t")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// snippetContext returns which snippets fit a position: "object",
+// "member" or "statement", and the word typed before it. ok is false in
+// comments and strings and after a dot or "::".
+func snippetContext(lines []string, pos Position) (context string, word string, ok bool) {
+	if pos.Line >= len(lines) {
+		return "", "", false
+	}
+	// depth counts open braces, blocks open begin and case statements
+	depth, blocks := 0, 0
+	inComment := false
+	for i := 0; i < pos.Line; i++ {
+		code, stillInComment := stripALComments(lines[i], inComment)
+		inComment = stillInComment
+		depth += strings.Count(code, "{") - strings.Count(code, "}")
+		blocks += snippetBlockDelta(code)
+	}
+
+	line := lines[pos.Line]
+	column := pos.Character
+	if column > len(line) {
+		column = len(line)
+	}
+	prefix := line[:column]
+	// A character typed at the cursor would be dropped with a comment or string
+	code, _ := stripALComments(prefix+"x", inComment)
+	if !strings.HasSuffix(code, "x") {
+		return "", "", false
+	}
+	depth += strings.Count(code, "{") - strings.Count(code, "}")
+	blocks += snippetBlockDelta(code)
+
+	word = prefix[len(strings.TrimRight(prefix, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_")):]
+	before := strings.TrimRight(prefix[:len(prefix)-len(word)], " \t")
+	if strings.HasSuffix(before, ".") || strings.HasSuffix(before, ":") || strings.HasSuffix(before, `"`) {
+		return "", "", false
+	}
+
+	switch {
+	case depth <= 0:
+		return "object", word, true
+	case blocks > 0:
+		return "statement", word, true
+	}
+	return "member", word, true
+}
+
+// snippetBlockDelta returns how many statement blocks a line of code opens
+// (begin, case) less those it closes (end)
+func snippetBlockDelta(code string) int {
+	delta := 0
+	for _, token := range identifierPattern.FindAllString(code, -1) {
+		switch strings.ToLower(token) {
+		case "begin", "case":
+			delta++
+		case "end":
+			delta--
+		}
+	}
+	return delta
+}
+
+// snippetCompletions returns the bundled snippets fitting a position of a
+// file as completion items, or false if none fits
+func snippetCompletions(filePath string, pos Position, snippetSupport bool) (json.RawMessage, bool) {
+	lines := readSourceLines(filePath)
+	context, word, ok := snippetContext(lines, pos)
+	if !ok {
+		return nil, false
+	}
+
+	// Lines after the first are indented like the line of the cursor
+	line := lines[pos.Line]
+	indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+
+	items := []CompletionItem{}
+	for _, snippet := range loadALSnippets() {
+		if snippet.Context != context || !strings.Contains(snippet.Prefix, strings.ToLower(word)) {
+			continue
+		}
+		body := indentSnippet(snippet.Body, indent)
+		item := CompletionItem{
+			Label:            snippet.Prefix,
+			Kind:             completionKindSnippet,
+			Detail:           snippet.Description,
+			Documentation:    &MarkupContent{Kind: "markdown", Value: "```al\n" + snippetPlainText(snippet.Body) + "\n```"},
+			InsertText:       body,
+			InsertTextFormat: insertTextFormatSnippet,
+		}
+		if !snippetSupport {
+			item.InsertText = snippetPlainText(body)
+			item.InsertTextFormat = insertTextFormatPlain
+		}
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		return nil, false
+	}
+	data, err := marshalUnescaped(items)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// indentSnippet indents the lines of a snippet body after the first
+func indentSnippet(body string, indent string) string {
+	lines := strings.Split(body, "\n")
+	for i := 1; i < len(lines); i++ {
+		if lines[i] != "" {
+			lines[i] = indent + lines[i]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// isEmptyCompletion reports whether a completion result has no items
+func isEmptyCompletion(result json.RawMessage) bool {
+	if isEmptyDefinitionResult(result) {
+		return true
+	}
+	var list struct {
+		Items []json.RawMessage `json:"items"`
+	}
+	return json.Unmarshal(result, &list) == nil && len(list.Items) == 0
+}
@@ -0,0 +1,314 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/SShadowS/claude-code-lsps/al-language-server-go/internal/project"
+)
+
+// ProjectStatisticsCommand summarizes a project: its objects, lines of
+// code, ID range use, dependencies and the issues the AL server reports
+const ProjectStatisticsCommand = "al-wrapper.projectStatistics"
+
+// maxStatisticsRules bounds the rules listed by issue count
+const maxStatisticsRules = 20
+
+// ProjectStatisticsArgs represents the optional argument object of al-wrapper.projectStatistics
+type ProjectStatisticsArgs struct {
+	// Project is a file or folder URI/path inside the project
+	Project string `json:"project"`
+}
+
+// LineCounts counts the lines of source files
+type LineCounts struct {
+	Total   int `json:"total"`
+	Code    int `json:"code"`
+	Comment int `json:"comment"`
+	Blank   int `json:"blank"`
+}
+
+// IDRangeUsage is how much of an app.json ID range the project's objects use
+type IDRangeUsage struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+	// Used counts the distinct IDs of objects in the range, of any type
+	Used    int     `json:"used"`
+	Percent float64 `json:"percent"`
+	// ByType counts the objects in the range by type
+	ByType map[string]int `json:"byType"`
+}
+
+// DependencyStatistics counts a project's dependencies by how they are satisfied
+type DependencyStatistics struct {
+	// Declared counts the dependencies of app.json, platform and application included
+	Declared int `json:"declared"`
+	// Workspace counts those satisfied by projects of the workspace
+	Workspace int `json:"workspace"`
+	// Packages counts those satisfied by a package in the package caches
+	Packages int `json:"packages"`
+	// Missing names the dependencies without a project or package
+	Missing []string `json:"missing"`
+}
+
+// RuleCount is the number of diagnostics of a rule
+type RuleCount struct {
+	Rule  string `json:"rule"`
+	Count int    `json:"count"`
+}
+
+// IssueStatistics counts the diagnostics last published for a project's files
+type IssueStatistics struct {
+	// Files counts the files with diagnostics
+	Files       int `json:"files"`
+	Errors      int `json:"errors"`
+	Warnings    int `json:"warnings"`
+	Information int `json:"information"`
+	Hints       int `json:"hints"`
+	// ByAnalyzer counts the diagnostics by rule prefix: AL (compiler),
+	// AA (CodeCop), AS (AppSourceCop), AW (UICop), PTE, LC (LinterCop), ...
+	ByAnalyzer map[string]int `json:"byAnalyzer"`
+	// TopRules are the rules with the most diagnostics
+	TopRules []RuleCount `json:"topRules"`
+}
+
+// ProjectStatistics is returned by al-wrapper.projectStatistics
+type ProjectStatistics struct {
+	Project string `json:"project"`
+	// App is the app.json identity, e.g. "Sales Tools by Contoso v1.2.0.0"
+	App   string     `json:"app,omitempty"`
+	Files int        `json:"files"`
+	Lines LineCounts `json:"lines"`
+	// Objects counts the declared objects, ObjectsByType by object type
+	Objects       int            `json:"objects"`
+	ObjectsByType map[string]int `json:"objectsByType"`
+	Procedures    int            `json:"procedures"`
+	Fields        int            `json:"fields"`
+	IDRanges      []IDRangeUsage `json:"idRanges"`
+	// OutsideRanges counts the objects with IDs outside all ID ranges
+	OutsideRanges int                  `json:"outsideRanges"`
+	Dependencies  DependencyStatistics `json:"dependencies"`
+	// Issues covers the files the AL server has published diagnostics for
+	Issues IssueStatistics `json:"issues"`
+}
+
+// countLines counts the code, comment and blank lines of a source file
+func countLines(path string, counts *LineCounts) {
+	lines := readLines(path)
+	// The final newline does not start a line
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	inComment := false
+	for _, line := range lines {
+		counts.Total++
+		startsInComment := inComment
+		var code string
+		code, inComment = stripALComments(line, inComment)
+		switch {
+		case strings.TrimSpace(line) == "" && !startsInComment:
+			counts.Blank++
+		case strings.TrimSpace(code) == "":
+			counts.Comment++
+		default:
+			counts.Code++
+		}
+	}
+}
+
+// CollectProjectStatistics summarizes a project from its sources, the
+// wrapper's symbol index and the diagnostics last published for its files
+func CollectProjectStatistics(projectRoot string, w WrapperInterface) ProjectStatistics {
+	stats := ProjectStatistics{
+		Project:       projectRoot,
+		ObjectsByType: make(map[string]int),
+		IDRanges:      []IDRangeUsage{},
+		Dependencies:  DependencyStatistics{Missing: []string{}},
+		Issues:        IssueStatistics{ByAnalyzer: make(map[string]int), TopRules: []RuleCount{}},
+	}
+
+	files := alSourceFiles(projectRoot)
+	stats.Files = len(files)
+	for _, path := range files {
+		countLines(path, &stats.Lines)
+	}
+
+	var objects []IndexedSymbol
+	for _, symbol := range w.ProjectSymbols(projectRoot) {
+		switch {
+		case symbol.Type != "":
+			objects = append(objects, symbol)
+			stats.ObjectsByType[symbol.Type]++
+		case symbol.Kind == symbolKindMethod:
+			stats.Procedures++
+		case symbol.Kind == symbolKindField:
+			stats.Fields++
+		}
+	}
+	stats.Objects = len(objects)
+
+	app, err := w.ProjectApp(projectRoot)
+	if err != nil {
+		app = &project.App{}
+	} else {
+		stats.App = app.String()
+	}
+	stats.IDRanges, stats.OutsideRanges = idRangeUsage(app, objects)
+	stats.Dependencies = dependencyStatistics(projectRoot, app, w)
+	stats.Issues = issueStatistics(w.ProjectDiagnostics(projectRoot))
+	return stats
+}
+
+// idRangeUsage measures the use of an app's ID ranges by its objects and
+// counts the objects outside them
+func idRangeUsage(app *project.App, objects []IndexedSymbol) ([]IDRangeUsage, int) {
+	usage := []IDRangeUsage{}
+	for _, r := range app.IDRanges {
+		u := IDRangeUsage{From: r.From, To: r.To, ByType: make(map[string]int)}
+		ids := make(map[int]bool)
+		for _, o := range objects {
+			if o.ID >= r.From && o.ID <= r.To {
+				ids[o.ID] = true
+				u.ByType[o.Type]++
+			}
+		}
+		u.Used = len(ids)
+		if size := r.To - r.From + 1; size > 0 {
+			u.Percent = math.Round(float64(u.Used)*1000/float64(size)) / 10
+		}
+		usage = append(usage, u)
+	}
+
+	outside := 0
+	for _, o := range objects {
+		if o.ID > 0 && len(app.IDRanges) > 0 && !app.ContainsID(o.ID) {
+			outside++
+		}
+	}
+	return usage, outside
+}
+
+// dependencyStatistics resolves a project's dependencies like the
+// initialization plan: against the workspace's projects, then the packages
+func dependencyStatistics(projectRoot string, app *project.App, w WrapperInterface) DependencyStatistics {
+	stats := DependencyStatistics{Missing: []string{}}
+	var dependencies []PlanDependency
+	if app.Platform != "" {
+		dependencies = append(dependencies, PlanDependency{Name: "System", Publisher: "Microsoft", Version: app.Platform})
+	}
+	if app.Application != "" {
+		dependencies = append(dependencies, PlanDependency{Name: "Application", Publisher: "Microsoft", Version: app.Application})
+	}
+	for _, dep := range app.Dependencies {
+		dependencies = append(dependencies, PlanDependency{Name: dep.Name, Publisher: dep.Publisher, Version: dep.Version})
+	}
+	stats.Declared = len(dependencies)
+
+	apps := make(map[string]*project.App)
+	for _, root := range workspaceProjects(w.WorkspaceRoot(), projectRoot) {
+		if root == projectRoot {
+			continue
+		}
+		if other, err := w.ProjectApp(root); err == nil {
+			apps[root] = other
+		}
+	}
+	packages := w.DependencyPackages(projectRoot)
+	for _, dep := range dependencies {
+		if workspaceDependency(dep, apps) != "" {
+			stats.Workspace++
+			continue
+		}
+		resolveDependency(&dep, packages)
+		if dep.Package == "" {
+			stats.Missing = append(stats.Missing, dep.Name+" by "+dep.Publisher)
+			continue
+		}
+		stats.Packages++
+	}
+	return stats
+}
+
+// issueStatistics counts diagnostics by severity, analyzer and rule
+func issueStatistics(files map[string][]Diagnostic) IssueStatistics {
+	stats := IssueStatistics{ByAnalyzer: make(map[string]int), TopRules: []RuleCount{}}
+	rules := make(map[string]int)
+	for _, diagnostics := range files {
+		if len(diagnostics) > 0 {
+			stats.Files++
+		}
+		for i := range diagnostics {
+			switch diagnostics[i].Severity {
+			case SeverityError:
+				stats.Errors++
+			case SeverityWarning:
+				stats.Warnings++
+			case SeverityInformation:
+				stats.Information++
+			default:
+				stats.Hints++
+			}
+			rule := diagnostics[i].RuleID()
+			if rule == "" {
+				continue
+			}
+			rules[rule]++
+			stats.ByAnalyzer[strings.TrimRight(rule, "0123456789")]++
+		}
+	}
+
+	for rule, count := range rules {
+		stats.TopRules = append(stats.TopRules, RuleCount{Rule: rule, Count: count})
+	}
+	sort.Slice(stats.TopRules, func(i, j int) bool {
+		if stats.TopRules[i].Count != stats.TopRules[j].Count {
+			return stats.TopRules[i].Count > stats.TopRules[j].Count
+		}
+		return stats.TopRules[i].Rule < stats.TopRules[j].Rule
+	})
+	if len(stats.TopRules) > maxStatisticsRules {
+		stats.TopRules = stats.TopRules[:maxStatisticsRules]
+	}
+	return stats
+}
+
+// ProjectDiagnostics returns the diagnostics last published for the files of
+// a project, with the wrapper's own, by file path
+func (w *ALLSPWrapper) ProjectDiagnostics(projectRoot string) map[string][]Diagnostic {
+	q := w.diagnostics
+	q.mu.Lock()
+	candidates := make(map[string][]Diagnostic)
+	for path, diagnostics := range q.published {
+		if isWithin(path, projectRoot) {
+			candidates[path] = diagnostics
+		}
+	}
+	q.mu.Unlock()
+
+	// Files of nested projects belong to those
+	files := make(map[string][]Diagnostic)
+	for path, diagnostics := range candidates {
+		if root := GetProjectRoot(path); root != "" && NormalizePath(root) == projectRoot {
+			files[path] = w.withWrapperDiagnostics(path, diagnostics)
+		}
+	}
+	return files
+}
+
+func projectStatisticsCommand(msg *Message, args []json.RawMessage, w WrapperInterface) (*Message, *Message) {
+	var cmdArgs ProjectStatisticsArgs
+	if err := decodeCommandArgs(args, &cmdArgs); err != nil {
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "Invalid "+ProjectStatisticsCommand+" arguments: "+err.Error())
+	}
+	projectRoot := resolveCommandProject(cmdArgs.Project, w)
+	if projectRoot == "" {
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "No AL project found to summarize")
+	}
+
+	stats := CollectProjectStatistics(projectRoot, w)
+	w.Log("Project statistics of %s: %d file(s), %d object(s)", filepath.Base(projectRoot), stats.Files, stats.Objects)
+	return newResultMessage(msg.ID, stats)
+}
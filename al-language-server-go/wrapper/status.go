@@ -0,0 +1,125 @@
+package wrapper
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// maxRecentErrors is how many recent errors the status report keeps
+const maxRecentErrors = 20
+
+// WrapperStatus is the live health report returned by al-wrapper/status
+type WrapperStatus struct {
+	WrapperVersion    string              `json:"wrapperVersion"`
+	PID               int                 `json:"pid"`
+	SessionID         string              `json:"sessionId"`
+	StartedAt         time.Time           `json:"startedAt"`
+	Uptime            string              `json:"uptime"`
+	Disabled          bool                `json:"disabled"`
+	Initialized       bool                `json:"initialized"`
+	ServerPID         int                 `json:"serverPid,omitempty"`
+	ServerIdle        bool                `json:"serverIdle"`
+	ServerUsage       *ProcessUsage       `json:"serverUsage,omitempty"`
+	ExtensionPath     string              `json:"extensionPath"`
+	ExtensionVersion  string              `json:"extensionVersion"`
+	WorkspaceRoot     string              `json:"workspaceRoot"`
+	ActiveProject     string              `json:"activeProject"`
+	Projects          []ProjectLoadStatus `json:"projects"`
+	OpenedFiles       int                 `json:"openedFiles"`
+	PendingRequests   int                 `json:"pendingRequests"`
+	AbandonedRequests int                 `json:"abandonedRequests"`
+	ALMethods         map[string]bool     `json:"alMethods,omitempty"`
+	Circuits          []CircuitStatus     `json:"circuits"`
+	RecentErrors      []StatusError       `json:"recentErrors"`
+	// ProtocolViolations counts the messages strict validation found malformed
+	ProtocolViolations int                 `json:"protocolViolations"`
+	RecentViolations   []ProtocolViolation `json:"recentViolations,omitempty"`
+	LogPath            string              `json:"logPath"`
+}
+
+// StatusError is a recent error seen by the wrapper
+type StatusError struct {
+	Time time.Time `json:"time"`
+	// Source is "client" for error responses sent to the client, or the AL
+	// server method that failed
+	Source  string `json:"source"`
+	Message string `json:"message"`
+}
+
+// recordError remembers an error for the status report
+func (w *ALLSPWrapper) recordError(source string, message string) {
+	w.errorsMu.Lock()
+	defer w.errorsMu.Unlock()
+	w.recentErrors = append(w.recentErrors, StatusError{Time: time.Now(), Source: source, Message: message})
+	if len(w.recentErrors) > maxRecentErrors {
+		w.recentErrors = w.recentErrors[len(w.recentErrors)-maxRecentErrors:]
+	}
+}
+
+// Status returns the wrapper's current health report
+func (w *ALLSPWrapper) Status() WrapperStatus {
+	report := w.selfTest.Snapshot()
+	status := WrapperStatus{
+		WrapperVersion: Version,
+		PID:            os.Getpid(),
+		SessionID:      SessionID(),
+		StartedAt:      report.StartedAt,
+		Uptime:         time.Since(report.StartedAt).Round(time.Second).String(),
+		Disabled:       w.disabled.Load(),
+		ServerIdle:     w.serverIdleStopped(),
+		ServerUsage:    w.ServerUsage(),
+		WorkspaceRoot:  w.workspaceRoot,
+		ActiveProject:  w.ActiveProject(),
+		Projects:       w.ProjectLoadStatuses(),
+		OpenedFiles:    len(w.openedDocuments()),
+		Circuits:       w.CircuitStatuses(),
+		LogPath:        GetLogPath(),
+	}
+
+	w.initMu.Lock()
+	status.Initialized = w.initialized
+	w.initMu.Unlock()
+
+	w.serverMu.Lock()
+	if w.cmd != nil && w.cmd.Process != nil {
+		status.ServerPID = w.cmd.Process.Pid
+	}
+	status.ExtensionPath = w.extensionPath
+	w.serverMu.Unlock()
+	if status.ExtensionPath != "" {
+		status.ExtensionVersion = ALExtensionVersion(status.ExtensionPath)
+	}
+
+	w.pendingMu.Lock()
+	status.PendingRequests = len(w.pendingReqs)
+	status.AbandonedRequests = len(w.abandonedReqs)
+	w.pendingMu.Unlock()
+
+	w.capMu.Lock()
+	status.ALMethods = w.alMethods
+	w.capMu.Unlock()
+
+	w.errorsMu.Lock()
+	status.RecentErrors = append([]StatusError{}, w.recentErrors...)
+	w.errorsMu.Unlock()
+
+	status.ProtocolViolations, status.RecentViolations = w.ProtocolViolations()
+	return status
+}
+
+// StatusHandler handles al-wrapper/status, returning the live health report
+type StatusHandler struct{}
+
+func (h *StatusHandler) ShouldHandle(method string) bool {
+	return method == "al-wrapper/status"
+}
+
+func (h *StatusHandler) Handle(msg *Message, w WrapperInterface) (*Message, *Message) {
+	return newResultMessage(msg.ID, w.Status())
+}
+
+// errorSummary formats a JSON-RPC error for the status report
+func errorSummary(err *RPCError) string {
+	return fmt.Sprintf("%d: %s", err.Code, err.Message)
+}
@@ -0,0 +1,77 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// documentSymbolCache holds the AL server's documentSymbol results per file,
+// so repeated outline queries on large objects are answered without asking
+// the server again. An entry is valid while the file's modification time and
+// size and the open document's version are those it was cached with, and is
+// dropped when the client changes, saves or closes the document.
+type documentSymbolCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedDocumentSymbols
+}
+
+// cachedDocumentSymbols is a documentSymbol result and the file state it was computed for
+type cachedDocumentSymbols struct {
+	modTime time.Time
+	size    int64
+	version int
+	result  json.RawMessage
+}
+
+func newDocumentSymbolCache() *documentSymbolCache {
+	return &documentSymbolCache{entries: make(map[string]cachedDocumentSymbols)}
+}
+
+// get returns the cached result for a file at a document version
+func (c *documentSymbolCache) get(path string, version int) (json.RawMessage, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.entries[path]
+	if !ok || !cached.modTime.Equal(info.ModTime()) || cached.size != info.Size() || cached.version != version {
+		return nil, false
+	}
+	return cached.result, true
+}
+
+// put caches the result for a file at a document version
+func (c *documentSymbolCache) put(path string, version int, result json.RawMessage) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[path] = cachedDocumentSymbols{modTime: info.ModTime(), size: info.Size(), version: version, result: result}
+}
+
+// invalidate drops the cached result for a file
+func (c *documentSymbolCache) invalidate(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, path)
+}
+
+// CachedDocumentSymbols returns the cached documentSymbol result for a file
+func (w *ALLSPWrapper) CachedDocumentSymbols(filePath string) (json.RawMessage, bool) {
+	path := NormalizePath(filePath)
+	version, _ := w.openedVersion(path)
+	return w.documentSymbols.get(path, version)
+}
+
+// CacheDocumentSymbols caches the documentSymbol result for a file
+func (w *ALLSPWrapper) CacheDocumentSymbols(filePath string, result json.RawMessage) {
+	path := NormalizePath(filePath)
+	version, _ := w.openedVersion(path)
+	w.documentSymbols.put(path, version, result)
+}
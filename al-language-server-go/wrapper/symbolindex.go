@@ -0,0 +1,282 @@
+package wrapper
+
+import (
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IndexedSymbol is a symbol from the wrapper's own index of a project's sources
+type IndexedSymbol struct {
+	// Name is the symbol name without quotes
+	Name string
+	// Kind is the LSP SymbolKind
+	Kind int
+	// Container is the declaring object's display name ("" for objects)
+	Container string
+	// Type and ID are the object type and ID of object symbols
+	Type string `json:",omitempty"`
+	ID   int    `json:",omitempty"`
+	// Path and Line locate the declaration (zero-based line)
+	Path string
+	Line int
+}
+
+// LSP SymbolKinds used for indexed members
+const (
+	symbolKindMethod = 6
+	symbolKindField  = 8
+)
+
+// SymbolInformation converts the symbol into a workspace/symbol result
+func (s IndexedSymbol) SymbolInformation() SymbolInformation {
+	pos := Position{Line: s.Line}
+	return SymbolInformation{
+		Name:          s.Name,
+		Kind:          s.Kind,
+		ContainerName: s.Container,
+		Location: Location{
+			URI:   PathToFileURI(s.Path),
+			Range: Range{Start: pos, End: pos},
+		},
+	}
+}
+
+// indexedFile caches the symbols of one source file until it changes
+type indexedFile struct {
+	modTime time.Time
+	size    int64
+	symbols []IndexedSymbol
+}
+
+// symbolIndex caches the objects, procedures and fields of AL
+// projects, parsed locally. Files are re-parsed only when their size or
+// modification time changes, so refreshing on every query stays cheap.
+type symbolIndex struct {
+	mu       sync.Mutex
+	projects map[string]map[string]*indexedFile
+}
+
+func newSymbolIndex() *symbolIndex {
+	return &symbolIndex{projects: make(map[string]map[string]*indexedFile)}
+}
+
+// symbols refreshes and returns the index of a project
+func (idx *symbolIndex) symbols(projectRoot string) []IndexedSymbol {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	files := idx.projects[projectRoot]
+	if files == nil {
+		files = make(map[string]*indexedFile)
+		idx.projects[projectRoot] = files
+	}
+
+	seen := make(map[string]bool, len(files))
+	walkDir(projectRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if path != projectRoot && (strings.HasPrefix(name, ".") || name == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.EqualFold(filepath.Ext(path), ".al") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		seen[path] = true
+		if cached := files[path]; cached != nil && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+			return nil
+		}
+		files[path] = &indexedFile{modTime: info.ModTime(), size: info.Size(), symbols: indexFile(path)}
+		return nil
+	})
+
+	var symbols []IndexedSymbol
+	for path, file := range files {
+		if !seen[path] {
+			delete(files, path)
+			continue
+		}
+		symbols = append(symbols, file.symbols...)
+	}
+	sort.Slice(symbols, func(i, j int) bool {
+		if symbols[i].Path != symbols[j].Path {
+			return symbols[i].Path < symbols[j].Path
+		}
+		return symbols[i].Line < symbols[j].Line
+	})
+	return symbols
+}
+
+// export returns the cached files of all projects, for the warm state
+func (idx *symbolIndex) export() map[string][]warmSymbolFile {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	projects := make(map[string][]warmSymbolFile, len(idx.projects))
+	for root, files := range idx.projects {
+		for path, file := range files {
+			projects[root] = append(projects[root], warmSymbolFile{
+				Path:    path,
+				ModTime: file.modTime,
+				Size:    file.size,
+				Symbols: file.symbols,
+			})
+		}
+	}
+	return projects
+}
+
+// restore seeds the cache from a warm state. Restored files are still
+// checked against their size and modification time on the next query.
+func (idx *symbolIndex) restore(projects map[string][]warmSymbolFile) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for root, cached := range projects {
+		if idx.projects[root] != nil {
+			continue
+		}
+		files := make(map[string]*indexedFile, len(cached))
+		for _, file := range cached {
+			files[file.Path] = &indexedFile{modTime: file.ModTime, size: file.Size, symbols: file.Symbols}
+		}
+		idx.projects[root] = files
+	}
+}
+
+// indexFile extracts the indexable symbols of one AL file
+func indexFile(path string) []IndexedSymbol {
+	outline := parseOutline(path)
+	var symbols []IndexedSymbol
+
+	for _, obj := range outline.objects {
+		symbols = append(symbols, IndexedSymbol{
+			Name: obj.Name,
+			Kind: obj.SymbolKind(),
+			Type: obj.Type,
+			ID:   obj.ID,
+			Path: path,
+			Line: obj.Line,
+		})
+	}
+
+	add := func(member alMember, kind int) {
+		var container string
+		if obj, ok := outline.objectAt(member.startLine); ok {
+			container = obj.DisplayName()
+		}
+		symbols = append(symbols, IndexedSymbol{
+			Name:      member.name,
+			Kind:      kind,
+			Container: container,
+			Path:      path,
+			Line:      member.startLine,
+		})
+	}
+	for _, member := range outline.members {
+		// Triggers (OnRun, OnValidate, ...) are not searchable by name
+		if member.kind == "procedure" {
+			add(member, symbolKindMethod)
+		}
+	}
+	for _, field := range outline.fields {
+		add(field, symbolKindField)
+	}
+	return symbols
+}
+
+// objectAt returns the object declared last at or before a line
+func (o alOutline) objectAt(line int) (ALObject, bool) {
+	var found ALObject
+	ok := false
+	for _, obj := range o.objects {
+		if obj.Line <= line {
+			found, ok = obj, true
+		}
+	}
+	return found, ok
+}
+
+// ProjectSymbols returns the wrapper's symbol index for a project
+func (w *ALLSPWrapper) ProjectSymbols(projectRoot string) []IndexedSymbol {
+	if projectRoot == "" {
+		return nil
+	}
+	return w.symbols.symbols(projectRoot)
+}
+
+// levenshtein returns the edit distance between two strings, by rune
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+// suggestSymbols returns up to limit indexed symbols whose names are within a
+// small edit distance of query, closest first
+func suggestSymbols(query string, symbols []IndexedSymbol, limit int) []IndexedSymbol {
+	q := strings.ToLower(query)
+	qLen := len([]rune(q))
+	maxDistance := max(2, qLen/3)
+
+	type scored struct {
+		symbol   IndexedSymbol
+		distance int
+	}
+	var candidates []scored
+	seen := make(map[string]bool)
+	for _, s := range symbols {
+		name := strings.ToLower(s.Name)
+		d := levenshtein(q, name)
+		// A query that is a typo of a prefix (e.g. "CustmerM" for "CustomerMgt") still counts
+		if nameRunes := []rune(name); len(nameRunes) > qLen {
+			d = min(d, levenshtein(q, string(nameRunes[:qLen]))+1)
+		}
+		key := s.Container + "|" + name
+		if d > maxDistance || seen[key] {
+			continue
+		}
+		seen[key] = true
+		candidates = append(candidates, scored{s, d})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].symbol.Name < candidates[j].symbol.Name
+	})
+
+	var result []IndexedSymbol
+	for i := 0; i < len(candidates) && i < limit; i++ {
+		result = append(result, candidates[i].symbol)
+	}
+	return result
+}
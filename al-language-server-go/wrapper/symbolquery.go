@@ -0,0 +1,219 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// symbolQuery is a workspace/symbol query normalized for AL naming:
+// "Sales Line", Sales Line, "Sales Line"."Document No." and file names
+// such as Tab18.Customer.dal or Customer.Table.al all resolve to a name
+// and, for compound queries, the object it belongs to.
+type symbolQuery struct {
+	// Raw is the query as sent by the client
+	Raw string
+	// Name is the unquoted symbol name sent to the AL server
+	Name string
+	// Container is the unquoted object name of a compound query ("" if none)
+	Container string
+	// Pattern matches whole names for glob queries such as Cust*Entry (nil otherwise)
+	Pattern *regexp.Regexp
+}
+
+// regexQueryPrefix marks a workspace/symbol query as a regular expression,
+// e.g. re:^Sales.*Post$, evaluated against the wrapper's symbol index
+const regexQueryPrefix = "re:"
+
+// legacyFilePrefix matches the object prefix of symbol file names, e.g. Tab18 or Cod80
+var legacyFilePrefix = regexp.MustCompile(`(?i)^(tab|pag|cod|rep|que|xml|enu|tabext|pagext|enumext|repext)\d+$`)
+
+// fileTypeSuffixes are the object type parts of Name.Type.al file names
+var fileTypeSuffixes = map[string]bool{
+	"table": true, "tableext": true, "tableextension": true,
+	"page": true, "pageext": true, "pageextension": true, "pagecustomization": true,
+	"codeunit": true, "report": true, "reportext": true, "reportextension": true,
+	"query": true, "xmlport": true, "enum": true, "enumext": true, "enumextension": true,
+	"interface": true, "permissionset": true, "permissionsetext": true, "permissionsetextension": true,
+	"profile": true, "controladdin": true, "entitlement": true,
+}
+
+// parseSymbolQuery normalizes a workspace/symbol query
+func parseSymbolQuery(raw string, paths bool) symbolQuery {
+	q := symbolQuery{Raw: raw}
+	text := strings.TrimSpace(raw)
+
+	// Claude Code sometimes sends file paths instead of symbol names
+	if paths && strings.ContainsAny(text, `/\`) {
+		text = filepath.Base(strings.ReplaceAll(text, `\`, "/"))
+	}
+
+	if ext := strings.ToLower(filepath.Ext(text)); paths && (ext == ".al" || ext == ".dal") {
+		q.Name = nameFromFileName(strings.TrimSuffix(text, filepath.Ext(text)))
+		return q
+	}
+
+	parts := splitCompoundName(text)
+	if len(parts) == 2 {
+		q.Container, q.Name = parts[0], parts[1]
+	} else {
+		q.Name = unquoteALName(text)
+	}
+
+	if strings.ContainsAny(q.Name, "*?") {
+		q.Pattern = globToRegexp(q.Name)
+		q.Name = longestLiteral(q.Name)
+	}
+	return q
+}
+
+// globToRegexp converts a glob (* and ?) into a case-insensitive regexp
+// matching whole names
+func globToRegexp(glob string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("(?i)^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// longestLiteral returns the longest wildcard-free part of a glob, which is
+// what the AL server is asked for before the wrapper applies the full pattern
+func longestLiteral(glob string) string {
+	longest := ""
+	for _, part := range strings.FieldsFunc(glob, func(r rune) bool { return r == '*' || r == '?' }) {
+		if len(part) > len(longest) {
+			longest = part
+		}
+	}
+	return longest
+}
+
+// nameFromFileName extracts the object name from Tab18.Customer or Customer.Table
+func nameFromFileName(base string) string {
+	parts := strings.Split(base, ".")
+	if len(parts) > 1 && legacyFilePrefix.MatchString(parts[0]) {
+		parts = parts[1:]
+	}
+	if len(parts) > 1 && fileTypeSuffixes[strings.ToLower(parts[len(parts)-1])] {
+		parts = parts[:len(parts)-1]
+	}
+	return strings.Join(parts, ".")
+}
+
+// splitCompoundName splits Object.Member on the first dot outside double
+// quotes, returning the unquoted parts, or nil if the name is not compound.
+// Dots inside quotes ("No.") and trailing dots (No.) do not split.
+func splitCompoundName(text string) []string {
+	inQuotes := false
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '"':
+			inQuotes = !inQuotes
+		case '.':
+			if inQuotes || i == 0 || i == len(text)-1 {
+				continue
+			}
+			left, right := strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:])
+			if left == "" || right == "" {
+				return nil
+			}
+			return []string{unquoteALName(left), unquoteALName(right)}
+		}
+	}
+	return nil
+}
+
+// normalizeSymbolName lower-cases a symbol name and removes quotes and
+// surrounding spaces, so "Sales Line" and sales line compare equal
+func normalizeSymbolName(name string) string {
+	return strings.ToLower(strings.TrimSpace(strings.ReplaceAll(name, `"`, "")))
+}
+
+// matchesName reports whether a candidate name matches the query name.
+// Matching is case-insensitive, as AL identifiers are.
+func (q symbolQuery) matchesName(name string) bool {
+	if q.Pattern != nil {
+		return q.Pattern.MatchString(strings.TrimSpace(strings.ReplaceAll(name, `"`, "")))
+	}
+	return strings.Contains(normalizeSymbolName(name), normalizeSymbolName(q.Name))
+}
+
+// matchesContainer reports whether a candidate's container matches the query's object part
+func (q symbolQuery) matchesContainer(container string) bool {
+	if q.Container == "" {
+		return true
+	}
+	c := normalizeSymbolName(container)
+	want := normalizeSymbolName(q.Container)
+	if strings.Contains(c, want) {
+		return true
+	}
+	// Containers are rendered as `table 18 Customer`; compare the object name too
+	return strings.HasSuffix(c, " "+want)
+}
+
+// filter keeps the server results that match a glob pattern and, for compound
+// queries, whose containerName matches the object part. Results without a
+// containerName are kept, as are results that cannot be parsed.
+func (q symbolQuery) filter(result json.RawMessage) json.RawMessage {
+	if q.Container == "" && q.Pattern == nil {
+		return result
+	}
+	var items []map[string]json.RawMessage
+	if err := json.Unmarshal(result, &items); err != nil {
+		return result
+	}
+
+	kept := make([]map[string]json.RawMessage, 0, len(items))
+	for _, item := range items {
+		var name, container string
+		json.Unmarshal(item["name"], &name)
+		json.Unmarshal(item["containerName"], &container)
+		if q.Pattern != nil && !q.matchesName(name) {
+			continue
+		}
+		if container != "" && !q.matchesContainer(container) {
+			continue
+		}
+		kept = append(kept, item)
+	}
+	data, err := json.Marshal(kept)
+	if err != nil {
+		return result
+	}
+	return data
+}
+
+// matchIndex returns the indexed symbols matching the normalized query
+func (q symbolQuery) matchIndex(symbols []IndexedSymbol) []SymbolInformation {
+	var results []SymbolInformation
+	for _, s := range symbols {
+		if q.matchesName(s.Name) && q.matchesContainer(s.Container) {
+			results = append(results, s.SymbolInformation())
+		}
+	}
+	return results
+}
+
+// matchSymbolsRegexp returns the indexed symbols whose name matches re.
+// Symbol names are matched without quotes; add (?i) for case-insensitive matching.
+func matchSymbolsRegexp(re *regexp.Regexp, symbols []IndexedSymbol) []SymbolInformation {
+	results := []SymbolInformation{}
+	for _, s := range symbols {
+		if re.MatchString(s.Name) {
+			results = append(results, s.SymbolInformation())
+		}
+	}
+	return results
+}
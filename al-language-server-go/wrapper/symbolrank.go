@@ -0,0 +1,188 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// workspace/symbol results come back from the AL server in index order, so
+// the symbol a query names is often buried among members of unrelated
+// objects. With workspaceSymbol.rank on, results are sorted by how well the
+// name matches the query, before the result is capped:
+//
+//  1. exact: the name equals the query, ignoring case, quotes and punctuation
+//  2. prefix: the name starts with the query (CustLedger -> "Cust. Ledger Entry")
+//  3. word boundary: the query's parts start words of the name in order
+//     (LedgEntry or CLE -> "Cust. Ledger Entry")
+//  4. substring: the query occurs inside the name
+//  5. fuzzy: the query's letters occur in the name in order
+//  6. anything else the server returned
+//
+// Within a tier objects come before their members (tables first), then
+// shorter names, then the server's order.
+
+// Match tiers, best first
+const (
+	matchExact = iota
+	matchPrefix
+	matchWordBoundary
+	matchSubstring
+	matchFuzzy
+	matchNone
+)
+
+// symbolKindBoosts rank the symbol kinds of objects above members; tables,
+// the most searched objects, first
+var symbolKindBoosts = map[int]int{
+	23: 3, // Struct: table, tableextension
+	19: 2, // Object: page, report, query, xmlport, ...
+	5:  2, // Class: codeunit
+	10: 1, // Enum
+	11: 1, // Interface
+}
+
+// rankWorkspaceSymbols sorts workspace/symbol results by how well they match
+// the query. Results that cannot be parsed are returned unchanged.
+func rankWorkspaceSymbols(result json.RawMessage, query string) json.RawMessage {
+	var items []json.RawMessage
+	if json.Unmarshal(result, &items) != nil || len(items) < 2 {
+		return result
+	}
+	compactQuery := compactSymbolName(query)
+	if compactQuery == "" {
+		return result
+	}
+
+	type ranked struct {
+		item   json.RawMessage
+		tier   int
+		boost  int
+		length int
+	}
+	rankedItems := make([]ranked, len(items))
+	for i, item := range items {
+		var symbol struct {
+			Name string `json:"name"`
+			Kind int    `json:"kind"`
+		}
+		json.Unmarshal(item, &symbol)
+		name := compactSymbolName(symbol.Name)
+		rankedItems[i] = ranked{
+			item:   item,
+			tier:   symbolMatchTier(compactQuery, name, symbolNameWords(symbol.Name)),
+			boost:  symbolKindBoosts[symbol.Kind],
+			length: len(name),
+		}
+	}
+
+	sort.SliceStable(rankedItems, func(i, j int) bool {
+		a, b := rankedItems[i], rankedItems[j]
+		if a.tier != b.tier {
+			return a.tier < b.tier
+		}
+		if a.boost != b.boost {
+			return a.boost > b.boost
+		}
+		return a.length < b.length
+	})
+
+	for i := range rankedItems {
+		items[i] = rankedItems[i].item
+	}
+	data, err := json.Marshal(items)
+	if err != nil {
+		return result
+	}
+	return data
+}
+
+// symbolMatchTier returns how well a name matches a query, both compacted
+func symbolMatchTier(query string, name string, nameWords []string) int {
+	switch {
+	case name == query:
+		return matchExact
+	case strings.HasPrefix(name, query):
+		return matchPrefix
+	case matchesWordPrefixes(query, nameWords):
+		return matchWordBoundary
+	case strings.Contains(name, query):
+		return matchSubstring
+	case isSubsequence(query, name):
+		return matchFuzzy
+	}
+	return matchNone
+}
+
+// compactSymbolName lower-cases a name and keeps only its letters and digits,
+// so "Cust. Ledger Entry" and CustLedgerEntry compare equal
+func compactSymbolName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// symbolNameWords splits a name into lower-case words at punctuation, spaces
+// and camelCase humps: "Cust. Ledger Entry" and CustLedgerEntry both give
+// cust, ledger, entry
+func symbolNameWords(name string) []string {
+	var words []string
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, strings.ToLower(string(word)))
+			word = word[:0]
+		}
+	}
+	runes := []rune(name)
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush()
+			continue
+		}
+		if i > 0 && len(word) > 0 {
+			prev := runes[i-1]
+			hump := unicode.IsUpper(r) && unicode.IsLower(prev)
+			digits := unicode.IsDigit(r) != unicode.IsDigit(prev)
+			if hump || digits {
+				flush()
+			}
+		}
+		word = append(word, r)
+	}
+	flush()
+	return words
+}
+
+// matchesWordPrefixes reports whether a compacted query can be split into
+// parts that each start a word of the name, in order (CLE or custledgent for
+// "Cust. Ledger Entry")
+func matchesWordPrefixes(query string, words []string) bool {
+	if query == "" {
+		return true
+	}
+	for i, word := range words {
+		for n := min(len(query), len(word)); n > 0; n-- {
+			if query[:n] == word[:n] && matchesWordPrefixes(query[n:], words[i+1:]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isSubsequence reports whether the characters of s occur in t in order
+func isSubsequence(s string, t string) bool {
+	i := 0
+	for j := 0; i < len(s) && j < len(t); j++ {
+		if s[i] == t[j] {
+			i++
+		}
+	}
+	return i == len(s)
+}
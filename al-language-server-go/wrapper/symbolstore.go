@@ -0,0 +1,81 @@
+package wrapper
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// maxStoredPackages bounds how many packages' symbols the store keeps; the
+// symbols of Base Application alone take tens of megabytes
+const maxStoredPackages = 8
+
+// SymbolStore holds the symbols of dependency packages, read from their
+// SymbolReference.json, for navigation into packages (source stubs), hovers,
+// the package search and the obsolete scan. A package is parsed on first use
+// and kept while its file is unchanged; the least recently used package is
+// dropped when the store is full.
+type SymbolStore struct {
+	mu       sync.Mutex
+	packages map[string]*storedSymbols
+	// recent lists the stored packages' paths, most recently used last
+	recent []string
+}
+
+// storedSymbols are the symbols of a package and the file state they were read from
+type storedSymbols struct {
+	modTime time.Time
+	size    int64
+	objects *symbolReferenceObjects
+}
+
+func newSymbolStore() *SymbolStore {
+	return &SymbolStore{packages: make(map[string]*storedSymbols)}
+}
+
+// objects returns the objects and members of a package
+func (s *SymbolStore) objects(app AppManifest) (*symbolReferenceObjects, error) {
+	info, err := os.Stat(app.Path)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stored, ok := s.packages[app.Path]; ok && stored.modTime.Equal(info.ModTime()) && stored.size == info.Size() {
+		s.touch(app.Path)
+		return stored.objects, nil
+	}
+	pkg, err := OpenAppFile(app.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer pkg.Close()
+	var objects symbolReferenceObjects
+	if err := pkg.decodeSymbols(&objects); err != nil {
+		return nil, err
+	}
+	s.packages[app.Path] = &storedSymbols{modTime: info.ModTime(), size: info.Size(), objects: &objects}
+	s.touch(app.Path)
+	for len(s.recent) > maxStoredPackages {
+		delete(s.packages, s.recent[0])
+		s.recent = s.recent[1:]
+	}
+	return &objects, nil
+}
+
+// touch marks a package as most recently used; mu must be held
+func (s *SymbolStore) touch(path string) {
+	for i, p := range s.recent {
+		if p == path {
+			s.recent = append(s.recent[:i], s.recent[i+1:]...)
+			break
+		}
+	}
+	s.recent = append(s.recent, path)
+}
+
+// SymbolStore returns the store of dependency package symbols
+func (w *ALLSPWrapper) SymbolStore() *SymbolStore {
+	return w.symbolStore
+}
@@ -0,0 +1,405 @@
+package wrapper
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TableFieldsCommand lists the fields and keys of a table, including those
+// added by table extensions in the workspace and its dependencies
+const TableFieldsCommand = "al-wrapper.tableFields"
+
+var (
+	// fieldListPattern matches the start of a table field declaration, field(
+	fieldListPattern = regexp.MustCompile(`(?i)^\s*field\s*\(`)
+	// keyListPattern matches the start of a key declaration, key(
+	keyListPattern = regexp.MustCompile(`(?i)^\s*key\s*\(`)
+	// clusteredPattern matches the Clustered property of a key
+	clusteredPattern = regexp.MustCompile(`(?i)^\s*Clustered\s*=\s*true\s*;`)
+)
+
+// TableFieldsArgs is the argument object of al-wrapper.tableFields. The
+// argument may also be the table's name or ID itself.
+type TableFieldsArgs struct {
+	// Table is the table name (quoted or not) or ID
+	Table string `json:"table"`
+	// Project is a file or folder URI/path inside the project whose
+	// dependencies are searched (defaults to the active project)
+	Project string `json:"project"`
+}
+
+// TableField is a field of a table
+type TableField struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Source is the object declaring the field: the table itself or a table
+	// extension, e.g. `tableextension 50100 "Customer Ext"`, and the
+	// dependency app for fields declared in dependencies
+	Source string `json:"source"`
+	// URI and Line (zero-based) locate declarations in the workspace
+	URI  string `json:"uri,omitempty"`
+	Line *int   `json:"line,omitempty"`
+}
+
+// TableKey is a key of a table
+type TableKey struct {
+	Name      string   `json:"name"`
+	Fields    []string `json:"fields"`
+	Clustered bool     `json:"clustered"`
+	Source    string   `json:"source"`
+}
+
+// TableFieldsResult is returned by al-wrapper.tableFields
+type TableFieldsResult struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	// Source is "workspace" or the dependency app declaring the table
+	Source string       `json:"source"`
+	URI    string       `json:"uri,omitempty"`
+	Fields []TableField `json:"fields"`
+	Keys   []TableKey   `json:"keys"`
+	// Extensions lists the table extensions whose fields and keys are included
+	Extensions []string `json:"extensions"`
+}
+
+// tableSource holds the fields and keys declared by one table or table extension
+type tableSource struct {
+	object ALObject
+	// app is the dependency app declaring the object, empty for the workspace
+	app    string
+	fields []TableField
+	keys   []TableKey
+}
+
+// parseTableFile reads the fields and keys of the tables and table
+// extensions declared in an AL file
+func parseTableFile(path string) []tableSource {
+	objects := parseObjectFile(path)
+	if len(objects) == 0 {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var tables []tableSource
+	var current *tableSource
+	next := 0
+	lastKey := -1
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	inComment := false
+	for line := 0; scanner.Scan(); line++ {
+		if next < len(objects) && objects[next].Line == line {
+			current = nil
+			if o := objects[next]; o.Type == "table" || o.Type == "tableextension" {
+				tables = append(tables, tableSource{object: o})
+				current = &tables[len(tables)-1]
+			}
+			next++
+			lastKey = -1
+		}
+		code, stillInComment := stripALComments(scanner.Text(), inComment)
+		inComment = stillInComment
+		if current == nil {
+			continue
+		}
+
+		source := current.object.DisplayName()
+		switch {
+		case fieldListPattern.MatchString(code):
+			lastKey = -1
+			start := strings.Index(code, "(")
+			inner, ok := enclosedList(code[start:])
+			if !ok {
+				continue
+			}
+			parts := splitTopLevel(inner, ';')
+			if len(parts) < 3 {
+				// Page-style field(Name; Expression) inside a table, e.g. in a fieldgroup
+				continue
+			}
+			id, err := strconv.Atoi(parts[0])
+			if err != nil {
+				continue
+			}
+			fieldLine := line
+			current.fields = append(current.fields, TableField{
+				ID:     id,
+				Name:   unquoteALName(parts[1]),
+				Type:   strings.Join(parts[2:], "; "),
+				Source: source,
+				URI:    PathToFileURI(path),
+				Line:   &fieldLine,
+			})
+		case keyListPattern.MatchString(code):
+			start := strings.Index(code, "(")
+			inner, ok := enclosedList(code[start:])
+			if !ok {
+				continue
+			}
+			parts := splitTopLevel(inner, ';')
+			if len(parts) < 2 {
+				continue
+			}
+			key := TableKey{Name: unquoteALName(parts[0]), Fields: []string{}, Source: source}
+			for _, field := range splitTopLevel(parts[1], ',') {
+				key.Fields = append(key.Fields, unquoteALName(field))
+			}
+			current.keys = append(current.keys, key)
+			lastKey = len(current.keys) - 1
+		case lastKey >= 0 && clusteredPattern.MatchString(code):
+			current.keys[lastKey].Clustered = true
+		}
+	}
+	return tables
+}
+
+// symbolReferenceField is a field of a table in SymbolReference.json
+type symbolReferenceField struct {
+	ID             int    `json:"Id"`
+	Name           string `json:"Name"`
+	TypeDefinition struct {
+		Name    string `json:"Name"`
+		Subtype *struct {
+			Name string `json:"Name"`
+		} `json:"Subtype"`
+	} `json:"TypeDefinition"`
+}
+
+// symbolReferenceKey is a key of a table in SymbolReference.json
+type symbolReferenceKey struct {
+	Name       string   `json:"Name"`
+	FieldNames []string `json:"FieldNames"`
+	Properties []struct {
+		Name  string `json:"Name"`
+		Value string `json:"Value"`
+	} `json:"Properties"`
+}
+
+// symbolReferenceTable is a table or table extension in SymbolReference.json
+type symbolReferenceTable struct {
+	ID           int                    `json:"Id"`
+	Name         string                 `json:"Name"`
+	TargetObject string                 `json:"TargetObject"`
+	Fields       []symbolReferenceField `json:"Fields"`
+	Keys         []symbolReferenceKey   `json:"Keys"`
+}
+
+// symbolReferenceTables holds the tables of SymbolReference.json, at the top
+// level and in each namespace
+type symbolReferenceTables struct {
+	Tables          []symbolReferenceTable  `json:"Tables"`
+	TableExtensions []symbolReferenceTable  `json:"TableExtensions"`
+	Namespaces      []symbolReferenceTables `json:"Namespaces"`
+}
+
+// collect returns the tables and table extensions matching keep as sources
+func (n *symbolReferenceTables) collect(sources []tableSource, appName string, keep func(ALObject) bool) []tableSource {
+	lists := []struct {
+		typ     string
+		entries []symbolReferenceTable
+	}{{"table", n.Tables}, {"tableextension", n.TableExtensions}}
+	for _, list := range lists {
+		for _, entry := range list.entries {
+			object := ALObject{Type: list.typ, ID: entry.ID, Name: entry.Name, Extends: entry.TargetObject}
+			if !keep(object) {
+				continue
+			}
+			source := tableSource{object: object, app: appName}
+			from := object.DisplayName() + " in " + appName
+			for _, field := range entry.Fields {
+				typ := field.TypeDefinition.Name
+				if field.TypeDefinition.Subtype != nil && field.TypeDefinition.Subtype.Name != "" {
+					typ += " " + quoteALName(field.TypeDefinition.Subtype.Name)
+				}
+				source.fields = append(source.fields, TableField{ID: field.ID, Name: field.Name, Type: typ, Source: from})
+			}
+			for _, key := range entry.Keys {
+				tableKey := TableKey{Name: key.Name, Fields: append([]string{}, key.FieldNames...), Source: from}
+				for _, property := range key.Properties {
+					if strings.EqualFold(property.Name, "Clustered") && strings.EqualFold(property.Value, "true") {
+						tableKey.Clustered = true
+					}
+				}
+				source.keys = append(source.keys, tableKey)
+			}
+			sources = append(sources, source)
+		}
+	}
+	for i := range n.Namespaces {
+		sources = n.Namespaces[i].collect(sources, appName, keep)
+	}
+	return sources
+}
+
+// readAppTables reads the tables and table extensions of an .app file that
+// match keep
+func readAppTables(app AppManifest, keep func(ALObject) bool) ([]tableSource, error) {
+	pkg, err := OpenAppFile(app.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer pkg.Close()
+
+	var tables symbolReferenceTables
+	if err := pkg.decodeSymbols(&tables); err != nil {
+		return nil, err
+	}
+	return tables.collect(nil, app.Name, keep), nil
+}
+
+// isTableNamed reports whether an object is the table identified by a name or ID
+func isTableNamed(object ALObject, table string) bool {
+	return isObjectNamed(object, "table", table)
+}
+
+// isObjectNamed reports whether an object is of the given type and identified
+// by a name or ID
+func isObjectNamed(object ALObject, objectType string, nameOrID string) bool {
+	if object.Type != objectType {
+		return false
+	}
+	if id, err := strconv.Atoi(nameOrID); err == nil {
+		return object.ID == id
+	}
+	return strings.EqualFold(object.Name, unquoteALName(nameOrID))
+}
+
+// FindTableFields assembles the fields and keys of a table from the
+// workspace's source files and the dependencies of project. It returns
+// false if no table has the given name or ID.
+func FindTableFields(workspaceRoot string, project string, table string, w WrapperInterface) (*TableFieldsResult, bool) {
+	var sources []tableSource
+	for _, root := range workspaceProjects(workspaceRoot, project) {
+		objects, _ := ScanProjectObjects(root)
+		files := make(map[string]bool)
+		for _, o := range objects {
+			if (o.Type == "table" || o.Type == "tableextension") && !files[o.Path] {
+				files[o.Path] = true
+				sources = append(sources, parseTableFile(o.Path)...)
+			}
+		}
+	}
+
+	// Dependency tables are read only from apps declaring a candidate table
+	// or a table extension, as SymbolReference.json files can be large
+	seen := make(map[string]bool)
+	for _, app := range w.DependencyPackages(project) {
+		key := app.ID
+		if key == "" {
+			key = app.Path
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		relevant := false
+		for _, o := range w.DependencyObjects(app) {
+			if o.Type == "tableextension" || isTableNamed(ALObject{Type: o.Type, ID: o.ID, Name: o.Name}, table) {
+				relevant = true
+				break
+			}
+		}
+		if !relevant {
+			continue
+		}
+		appSources, err := readAppTables(app, func(o ALObject) bool {
+			return o.Type == "tableextension" || isTableNamed(o, table)
+		})
+		if err != nil {
+			w.Log("Skipping package tables: %v", err)
+			continue
+		}
+		sources = append(sources, appSources...)
+	}
+
+	var base *tableSource
+	for i := range sources {
+		if isTableNamed(sources[i].object, table) {
+			base = &sources[i]
+			break
+		}
+	}
+	if base == nil {
+		return nil, false
+	}
+
+	result := &TableFieldsResult{
+		ID:         base.object.ID,
+		Name:       base.object.Name,
+		Source:     "workspace",
+		Fields:     append([]TableField{}, base.fields...),
+		Keys:       append([]TableKey{}, base.keys...),
+		Extensions: []string{},
+	}
+	if base.app != "" {
+		result.Source = base.app
+	} else {
+		result.URI = PathToFileURI(base.object.Path)
+	}
+	for _, source := range sources {
+		if source.object.Type != "tableextension" || !strings.EqualFold(source.object.Extends, base.object.Name) {
+			continue
+		}
+		extension := source.object.DisplayName()
+		if source.app != "" {
+			extension += " in " + source.app
+		}
+		result.Extensions = append(result.Extensions, extension)
+		result.Fields = append(result.Fields, source.fields...)
+		result.Keys = append(result.Keys, source.keys...)
+	}
+	sort.SliceStable(result.Fields, func(i, j int) bool { return result.Fields[i].ID < result.Fields[j].ID })
+	return result, true
+}
+
+// decodeTableFieldsArgs accepts the argument object or a bare table name or ID
+func decodeTableFieldsArgs(args []json.RawMessage) (TableFieldsArgs, error) {
+	var cmdArgs TableFieldsArgs
+	if len(args) == 0 || string(args[0]) == "null" {
+		return cmdArgs, fmt.Errorf("missing table")
+	}
+	var number int
+	if json.Unmarshal(args[0], &number) == nil {
+		cmdArgs.Table = strconv.Itoa(number)
+		return cmdArgs, nil
+	}
+	if json.Unmarshal(args[0], &cmdArgs.Table) == nil {
+		return cmdArgs, nil
+	}
+	err := decodeCommandArgs(args, &cmdArgs)
+	return cmdArgs, err
+}
+
+func tableFieldsCommand(msg *Message, args []json.RawMessage, w WrapperInterface) (*Message, *Message) {
+	cmdArgs, err := decodeTableFieldsArgs(args)
+	if err == nil && strings.TrimSpace(cmdArgs.Table) == "" {
+		err = fmt.Errorf("missing table")
+	}
+	if err != nil {
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "Invalid "+TableFieldsCommand+" arguments: "+err.Error())
+	}
+
+	project := resolveCommandProject(cmdArgs.Project, w)
+	if project == "" && w.WorkspaceRoot() == "" {
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "No AL project found to search")
+	}
+
+	result, ok := FindTableFields(w.WorkspaceRoot(), project, strings.TrimSpace(cmdArgs.Table), w)
+	if !ok {
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "Table not found: "+cmdArgs.Table)
+	}
+	w.Log("Found %d field(s) and %d key(s) of table %s", len(result.Fields), len(result.Keys), result.Name)
+	return newResultMessage(msg.ID, result)
+}
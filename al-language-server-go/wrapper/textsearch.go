@@ -0,0 +1,113 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// When the AL server cannot answer textDocument/references (the project does
+// not load, symbols are missing, or it finds nothing), the opt-in
+// references.textFallback searches the .al files of the workspace's projects
+// for the identifier at the position instead. Matches are case-insensitive
+// and whole-identifier: "Sales Header" matches the quoted identifier but not
+// Header, and Customer matches "Customer". Comments and string literals are
+// skipped. Every location is tagged with the wrapper:textualMatch provenance,
+// as a text search cannot tell a symbol from another of the same name.
+
+// textReferences searches the workspace for the identifier at a position of
+// a file, false if there is no identifier there
+func textReferences(filePath string, pos Position, includeDeclaration bool, w WrapperInterface) (json.RawMessage, bool) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, false
+	}
+	_, name, ok := identifierAt(content, pos)
+	if !ok {
+		return nil, false
+	}
+	name = unquoteALName(name)
+
+	progress := w.BeginProgress("Searching the workspace for " + name)
+	defer progress.End("")
+
+	locations := []Location{}
+	roots := workspaceProjects(w.WorkspaceRoot(), NormalizePath(GetProjectRoot(filePath)))
+	for i, root := range roots {
+		progress.Report(filepath.Base(root), i*100/len(roots))
+		walkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() {
+				dir := d.Name()
+				if path != root && (strings.HasPrefix(dir, ".") || dir == "node_modules") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if strings.EqualFold(filepath.Ext(path), ".al") {
+				locations = append(locations, findIdentifier(path, name, includeDeclaration)...)
+			}
+			return nil
+		})
+	}
+	w.Log("Text search found %d match(es) of %s", len(locations), name)
+
+	data, err := json.Marshal(locations)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// findIdentifier returns the locations of an identifier in the code of a file
+func findIdentifier(path string, name string, includeDeclaration bool) []Location {
+	var locations []Location
+	uri := PathToFileURI(path)
+	inComment := false
+	for line, text := range readSourceLines(path) {
+		code := text
+		if inComment {
+			end := strings.Index(code, "*/")
+			if end < 0 {
+				continue
+			}
+			code = strings.Repeat(" ", end+2) + code[end+2:]
+		}
+		_, inComment = stripALComments(code, false)
+		code = maskALNonCode(code)
+
+		declared := declaredNameOffsets(code)
+		for _, loc := range identifierPattern.FindAllStringIndex(code, -1) {
+			if !strings.EqualFold(unquoteALName(text[loc[0]:loc[1]]), name) {
+				continue
+			}
+			if !includeDeclaration && declared[loc[0]] {
+				continue
+			}
+			start := Position{Line: line, Character: utf16Length(text[:loc[0]])}
+			end := Position{Line: line, Character: utf16Length(text[:loc[1]])}
+			locations = append(locations, Location{URI: uri, Range: Range{Start: start, End: end}})
+		}
+	}
+	return locations
+}
+
+// declaredNameOffsets returns the offsets of the names an object, procedure,
+// trigger or field declaration on a masked line declares
+func declaredNameOffsets(code string) map[int]bool {
+	offsets := make(map[int]bool)
+	if m := objectDeclPattern.FindStringSubmatchIndex(code); m != nil {
+		offsets[m[6]] = true
+	}
+	if m := memberDeclPattern.FindStringSubmatchIndex(code); m != nil {
+		offsets[m[4]] = true
+	}
+	if m := fieldDeclPattern.FindStringSubmatchIndex(code); m != nil {
+		offsets[m[2]] = true
+	}
+	return offsets
+}
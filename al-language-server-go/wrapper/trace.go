@@ -0,0 +1,69 @@
+package wrapper
+
+import "encoding/json"
+
+// The AL server is initialized with the trace level of server.trace ("off"
+// unless configured, as "verbose" makes the server log every message it
+// handles). $/setTrace from the client is forwarded and remembered, so a
+// server restarted after an extension update or an idle stop gets the level
+// the client last set.
+
+// traceLevels are the trace values of the LSP specification
+var traceLevels = map[string]bool{"off": true, "messages": true, "verbose": true}
+
+// SetTraceParams are the params of $/setTrace
+type SetTraceParams struct {
+	Value string `json:"value"`
+}
+
+// validTrace returns level if it is a trace value of the specification, else "off"
+func validTrace(level string) (string, bool) {
+	if traceLevels[level] {
+		return level, true
+	}
+	return "off", false
+}
+
+// traceLevel returns the trace level the AL server was last given
+func (w *ALLSPWrapper) traceLevel() string {
+	w.traceMu.Lock()
+	defer w.traceMu.Unlock()
+	return w.trace
+}
+
+// setTraceLevel records the trace level the AL server was given
+func (w *ALLSPWrapper) setTraceLevel(level string) {
+	w.traceMu.Lock()
+	defer w.traceMu.Unlock()
+	w.trace = level
+}
+
+// handleSetTrace forwards $/setTrace to the AL server and remembers the level
+func (w *ALLSPWrapper) handleSetTrace(scope *requestScope, msg *Message) {
+	var params SetTraceParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		scope.Log("Failed to parse $/setTrace params: %v", err)
+		return
+	}
+	level, ok := validTrace(params.Value)
+	if !ok {
+		scope.Log("Ignoring $/setTrace with invalid value %q", params.Value)
+		return
+	}
+
+	scope.Log("Setting AL server trace level: %s", level)
+	w.setTraceLevel(level)
+	if w.serverIdleStopped() {
+		// The level is given to the server when it is started again
+		return
+	}
+	scope.SendNotificationToLSP("$/setTrace", SetTraceParams{Value: level})
+}
+
+// initParamsWithTrace returns the initialize params sent to the AL server,
+// with the current trace level, for replaying initialize
+func (w *ALLSPWrapper) initParamsWithTrace() *InitializeParams {
+	params := *w.serverInitParams
+	params.Trace = w.traceLevel()
+	return &params
+}
@@ -0,0 +1,315 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// The AL server has no type hierarchy, so the wrapper builds one from AL
+// extension relationships: a table extension's supertype is the table it
+// extends, a page's subtypes are its page extensions and customizations, and
+// so on for enums, reports and permission sets. The extensions are indexed
+// from the object declarations of the workspace's projects, scanned for each
+// request. A base object not declared in the workspace (one of a dependency)
+// is located with a definition lookup of its name in the extension's
+// declaration; extensions declared by dependencies are not found.
+
+// extensionBaseTypes maps each extension object type to the type it extends
+var extensionBaseTypes = map[string]string{
+	"tableextension":         "table",
+	"pageextension":          "page",
+	"pagecustomization":      "page",
+	"enumextension":          "enum",
+	"reportextension":        "report",
+	"permissionsetextension": "permissionset",
+}
+
+// TypeHierarchyItem is an AL object in a type hierarchy
+type TypeHierarchyItem struct {
+	Name           string          `json:"name"`
+	Kind           int             `json:"kind"`
+	Detail         string          `json:"detail,omitempty"`
+	URI            string          `json:"uri"`
+	Range          Range           `json:"range"`
+	SelectionRange Range           `json:"selectionRange"`
+	Data           json.RawMessage `json:"data,omitempty"`
+}
+
+// typeHierarchyData identifies the object of an item in its data property,
+// so items outside the workspace's sources can be resolved
+type typeHierarchyData struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+// typeIndex holds the objects declared in the workspace's projects
+type typeIndex struct {
+	objects []ALObject
+}
+
+// buildTypeIndex scans the objects of the workspace's projects, and of the
+// project of filePath
+func buildTypeIndex(w WrapperInterface, filePath string) typeIndex {
+	var index typeIndex
+	for _, root := range workspaceProjects(w.WorkspaceRoot(), NormalizePath(GetProjectRoot(filePath))) {
+		objects, _ := ScanProjectObjects(root)
+		index.objects = append(index.objects, objects...)
+	}
+	return index
+}
+
+// find returns the object of a type and name, if declared in the workspace
+func (idx typeIndex) find(typ string, name string) (ALObject, bool) {
+	for _, obj := range idx.objects {
+		if obj.Type == typ && strings.EqualFold(obj.Name, name) {
+			return obj, true
+		}
+	}
+	return ALObject{}, false
+}
+
+// extensionsOf returns the objects extending an object of a type and name
+func (idx typeIndex) extensionsOf(typ string, name string) []ALObject {
+	var extensions []ALObject
+	for _, obj := range idx.objects {
+		if extensionBaseTypes[obj.Type] == typ && strings.EqualFold(obj.Extends, name) {
+			extensions = append(extensions, obj)
+		}
+	}
+	return extensions
+}
+
+// TypeHierarchyHandler handles textDocument/prepareTypeHierarchy,
+// typeHierarchy/supertypes and typeHierarchy/subtypes
+type TypeHierarchyHandler struct{}
+
+func (h *TypeHierarchyHandler) ShouldHandle(method string) bool {
+	return method == "textDocument/prepareTypeHierarchy" ||
+		method == "typeHierarchy/supertypes" ||
+		method == "typeHierarchy/subtypes"
+}
+
+func (h *TypeHierarchyHandler) Handle(msg *Message, w WrapperInterface) (*Message, *Message) {
+	if msg.Method == "textDocument/prepareTypeHierarchy" {
+		return h.prepare(msg, w)
+	}
+
+	var params struct {
+		Item TypeHierarchyItem `json:"item"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil || params.Item.URI == "" {
+		w.Log("Failed to parse %s params: %v", msg.Method, err)
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "Invalid parameters")
+	}
+	var object typeHierarchyData
+	if err := json.Unmarshal(params.Item.Data, &object); err != nil || object.Type == "" {
+		w.Log("%s: item %s carries no object data", msg.Method, params.Item.Name)
+		return newResultMessage(msg.ID, nil)
+	}
+
+	// Items outside the sources (a dependency's objects) are resolved
+	// against the workspace's projects
+	filePath, err := FileURIToPath(params.Item.URI)
+	if err != nil {
+		filePath = w.WorkspaceRoot()
+	}
+	index := buildTypeIndex(w, filePath)
+
+	items := []TypeHierarchyItem{}
+	if msg.Method == "typeHierarchy/subtypes" {
+		for _, extension := range index.extensionsOf(object.Type, object.Name) {
+			items = append(items, typeHierarchyItem(extension))
+		}
+	} else if base, ok := h.supertype(object, params.Item, index, w); ok {
+		items = append(items, base)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].URI != items[j].URI {
+			return items[i].URI < items[j].URI
+		}
+		return items[i].SelectionRange.Start.Line < items[j].SelectionRange.Start.Line
+	})
+	w.Log("Found %d %s of %s", len(items), strings.TrimPrefix(msg.Method, "typeHierarchy/"), params.Item.Name)
+
+	data, err := json.Marshal(items)
+	if err != nil {
+		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	}
+	return newResultMessage(msg.ID, markProvenance(data, msg.Method, provenanceTypeHierarchy, w))
+}
+
+// prepare handles textDocument/prepareTypeHierarchy
+func (h *TypeHierarchyHandler) prepare(msg *Message, w WrapperInterface) (*Message, *Message) {
+	var params TextDocumentPositionParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		w.Log("Failed to parse prepareTypeHierarchy params: %v", err)
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "Invalid parameters")
+	}
+
+	filePath, err := FileURIToPath(params.TextDocument.URI)
+	if err != nil {
+		w.Log("Failed to convert URI: %v", err)
+		return nil, NewErrorResponse(msg.ID, InternalError, "Invalid file URI")
+	}
+
+	// Ensure the file is opened
+	if err := w.EnsureFileOpened(filePath); err != nil {
+		w.Log("Failed to open file: %v", err)
+		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	}
+
+	// Ensure project is initialized, or degrade to the file alone
+	if errResp := ensureProjectForRequest(msg, filePath, w); errResp != nil {
+		return nil, errResp
+	}
+
+	// The object declared at the position, the object the identifier there
+	// is defined as, or else the object containing the position
+	outline := parseOutline(filePath)
+	obj, ok := objectDeclaredAt(outline, params.Position.Line)
+	if !ok {
+		method, definitionParams := definitionRequest(params, w)
+		response, err := w.SendRequestToLSP(method, definitionParams)
+		if err != nil {
+			w.Log("Failed to send definition request: %v", err)
+			return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+		}
+		if response.Error == nil {
+			obj, ok = objectAtDefinition(response.Result)
+		}
+	}
+	if !ok {
+		obj, ok = outline.objectAt(params.Position.Line)
+	}
+	if !ok {
+		w.Log("prepareTypeHierarchy: no object at %d:%d", params.Position.Line, params.Position.Character)
+		return newResultMessage(msg.ID, nil)
+	}
+
+	data, err := json.Marshal([]TypeHierarchyItem{typeHierarchyItem(obj)})
+	if err != nil {
+		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	}
+	return newResultMessage(msg.ID, markProvenance(data, msg.Method, provenanceTypeHierarchy, w))
+}
+
+// supertype returns the object an extension extends: from the workspace's
+// sources, or else where the AL server defines the name in the declaration
+func (h *TypeHierarchyHandler) supertype(object typeHierarchyData, item TypeHierarchyItem, index typeIndex, w WrapperInterface) (TypeHierarchyItem, bool) {
+	baseType, ok := extensionBaseTypes[object.Type]
+	if !ok {
+		return TypeHierarchyItem{}, false
+	}
+	extension, ok := index.find(object.Type, object.Name)
+	if !ok || extension.Extends == "" {
+		return TypeHierarchyItem{}, false
+	}
+	if base, ok := index.find(baseType, extension.Extends); ok {
+		return typeHierarchyItem(base), true
+	}
+
+	// Look up the name after extends in the declaration
+	lines := readSourceLines(extension.Path)
+	if extension.Line >= len(lines) {
+		return TypeHierarchyItem{}, false
+	}
+	declaration := lines[extension.Line]
+	m := objectDeclPattern.FindStringSubmatchIndex(maskALNonCode(declaration))
+	if m == nil || m[8] < 0 {
+		return TypeHierarchyItem{}, false
+	}
+	params := TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: PathToFileURI(extension.Path)},
+		Position:     Position{Line: extension.Line, Character: utf16Length(declaration[:m[8]])},
+	}
+	if known, err := FileURIToPath(item.URI); err == nil && NormalizePath(known) == NormalizePath(extension.Path) {
+		params.TextDocument.URI = item.URI
+	}
+	method, definitionParams := definitionRequest(params, w)
+	response, err := w.SendRequestToLSP(method, definitionParams)
+	if err != nil || response.Error != nil {
+		return TypeHierarchyItem{}, false
+	}
+	uri, line, found := firstDefinitionLocation(response.Result)
+	if !found {
+		return TypeHierarchyItem{}, false
+	}
+
+	base := ALObject{Type: baseType, Name: extension.Extends, Line: line}
+	result := typeHierarchyItem(base)
+	result.URI = uri
+	result.Range = Range{Start: Position{Line: line}, End: Position{Line: line}}
+	result.SelectionRange = result.Range
+	return result, true
+}
+
+// objectDeclaredAt returns the object declared at a line
+func objectDeclaredAt(outline alOutline, line int) (ALObject, bool) {
+	for _, obj := range outline.objects {
+		if obj.Line == line {
+			return obj, true
+		}
+	}
+	return ALObject{}, false
+}
+
+// objectAtDefinition returns the object declared at the first location of a
+// definition result
+func objectAtDefinition(result json.RawMessage) (ALObject, bool) {
+	uri, line, ok := firstDefinitionLocation(result)
+	if !ok {
+		return ALObject{}, false
+	}
+	path, err := FileURIToPath(uri)
+	if err != nil {
+		return ALObject{}, false
+	}
+	return objectDeclaredAt(parseOutline(path), line)
+}
+
+// typeHierarchyItem describes an object declared in the sources for the
+// type hierarchy. Its range runs to the line before the next object declared
+// in the file.
+func typeHierarchyItem(obj ALObject) TypeHierarchyItem {
+	data, _ := json.Marshal(typeHierarchyData{Type: obj.Type, Name: obj.Name})
+	item := TypeHierarchyItem{
+		Name:   obj.Name,
+		Kind:   obj.SymbolKind(),
+		Detail: obj.DisplayName(),
+		URI:    PathToFileURI(obj.Path),
+		Data:   data,
+	}
+	if obj.Path == "" {
+		return item
+	}
+
+	lines := readSourceLines(obj.Path)
+	end := len(lines) - 1
+	if end > 0 && strings.TrimSpace(lines[end]) == "" {
+		end--
+	}
+	for _, other := range parseObjectFile(obj.Path) {
+		if other.Line > obj.Line && other.Line-1 < end {
+			end = other.Line - 1
+		}
+	}
+	if end < obj.Line {
+		end = obj.Line
+	}
+	item.Range.Start = Position{Line: obj.Line}
+	item.Range.End = Position{Line: end}
+	if end < len(lines) {
+		item.Range.End.Character = utf16Length(lines[end])
+	}
+	item.SelectionRange = Range{Start: item.Range.Start, End: item.Range.Start}
+	if obj.Line < len(lines) {
+		declaration := lines[obj.Line]
+		if m := objectDeclPattern.FindStringSubmatchIndex(maskALNonCode(declaration)); m != nil {
+			start := Position{Line: obj.Line, Character: utf16Length(declaration[:m[6]])}
+			end := Position{Line: obj.Line, Character: utf16Length(declaration[:m[7]])}
+			item.SelectionRange = Range{Start: start, End: end}
+		}
+	}
+	return item
+}
@@ -0,0 +1,449 @@
+package wrapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Strict validation (validation.strict) checks every message crossing the
+// wrapper against the shapes the LSP specification gives its known methods:
+// the JSON-RPC envelope, the required params of requests and notifications,
+// and the result of responses, whose method is looked up from the request
+// they answer. Violations do not change the message; they are logged with the
+// side that produced the message and reported by al-wrapper/status, so a
+// malformed payload can be traced to the client, the wrapper or the AL server.
+
+// maxPendingValidations caps the requests remembered to validate responses
+// against, in case some are never answered
+const maxPendingValidations = 1000
+
+// ProtocolViolation is a message found not to match the LSP specification
+type ProtocolViolation struct {
+	Time time.Time `json:"time"`
+	// From and To are "client", "wrapper" or "server"
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Method  string `json:"method,omitempty"`
+	ID      string `json:"id,omitempty"`
+	Problem string `json:"problem"`
+}
+
+// protocolValidator remembers the methods of requests in flight and the
+// violations found
+type protocolValidator struct {
+	pending    map[string]string
+	violations int
+	recent     []ProtocolViolation
+}
+
+// fieldRule requires a field, by dotted path, to have one of the JSON kinds
+// listed (separated by |). Alternative paths, such as the uri of a Location
+// and the targetUri of a LocationLink, are separated by |.
+type fieldRule struct {
+	path     string
+	kinds    string
+	optional bool
+}
+
+// resultRule describes the result of a method: its kinds, the fields of an
+// object result and the fields of each element of an array result
+type resultRule struct {
+	kinds  string
+	fields []fieldRule
+	items  []fieldRule
+}
+
+var (
+	textDocumentRule = fieldRule{path: "textDocument.uri", kinds: "string"}
+	positionRules    = []fieldRule{
+		textDocumentRule,
+		{path: "position.line", kinds: "integer"},
+		{path: "position.character", kinds: "integer"},
+	}
+	locationRules = []fieldRule{
+		{path: "uri|targetUri", kinds: "string"},
+		{path: "range|targetRange", kinds: "object"},
+	}
+)
+
+// rangeRules requires a Range at a path
+func rangeRules(path string) []fieldRule {
+	return []fieldRule{
+		{path: path + ".start.line", kinds: "integer"},
+		{path: path + ".start.character", kinds: "integer"},
+		{path: path + ".end.line", kinds: "integer"},
+		{path: path + ".end.character", kinds: "integer"},
+	}
+}
+
+// withRules joins rule lists
+func withRules(lists ...[]fieldRule) []fieldRule {
+	var rules []fieldRule
+	for _, list := range lists {
+		rules = append(rules, list...)
+	}
+	return rules
+}
+
+// paramRules are the params of the methods validated
+var paramRules = map[string][]fieldRule{
+	"initialize": {
+		{path: "processId", kinds: "integer|null"},
+		{path: "capabilities", kinds: "object"},
+		{path: "rootUri", kinds: "string|null", optional: true},
+		{path: "workspaceFolders", kinds: "array|null", optional: true},
+	},
+	"textDocument/didOpen": {
+		textDocumentRule,
+		{path: "textDocument.languageId", kinds: "string"},
+		{path: "textDocument.version", kinds: "integer"},
+		{path: "textDocument.text", kinds: "string"},
+	},
+	"textDocument/didChange": {
+		textDocumentRule,
+		{path: "textDocument.version", kinds: "integer"},
+		{path: "contentChanges", kinds: "array"},
+	},
+	"textDocument/didClose":             {textDocumentRule},
+	"textDocument/didSave":              {textDocumentRule, {path: "text", kinds: "string", optional: true}},
+	"textDocument/definition":           positionRules,
+	"textDocument/declaration":          positionRules,
+	"textDocument/implementation":       positionRules,
+	"textDocument/typeDefinition":       positionRules,
+	"textDocument/hover":                positionRules,
+	"textDocument/completion":           positionRules,
+	"textDocument/signatureHelp":        positionRules,
+	"textDocument/documentHighlight":    positionRules,
+	"textDocument/linkedEditingRange":   positionRules,
+	"textDocument/prepareRename":        positionRules,
+	"textDocument/prepareCallHierarchy": positionRules,
+	"callHierarchy/incomingCalls":       {{path: "item.uri", kinds: "string"}, {path: "item.selectionRange", kinds: "object"}},
+	"callHierarchy/outgoingCalls":       {{path: "item.uri", kinds: "string"}, {path: "item.selectionRange", kinds: "object"}},
+	"textDocument/prepareTypeHierarchy": positionRules,
+	"typeHierarchy/supertypes":          {{path: "item.uri", kinds: "string"}, {path: "item.selectionRange", kinds: "object"}},
+	"textDocument/diagnostic":           {textDocumentRule, {path: "previousResultId", kinds: "string", optional: true}},
+	"typeHierarchy/subtypes":            {{path: "item.uri", kinds: "string"}, {path: "item.selectionRange", kinds: "object"}},
+	"textDocument/references": withRules(positionRules, []fieldRule{
+		{path: "context.includeDeclaration", kinds: "boolean"},
+	}),
+	"textDocument/rename": withRules(positionRules, []fieldRule{
+		{path: "newName", kinds: "string"},
+	}),
+	"textDocument/documentSymbol":       {textDocumentRule},
+	"textDocument/foldingRange":         {textDocumentRule},
+	"textDocument/selectionRange":       {textDocumentRule, {path: "positions", kinds: "array"}},
+	"textDocument/codeLens":             {textDocumentRule},
+	"textDocument/documentLink":         {textDocumentRule},
+	"textDocument/semanticTokens/full":  {textDocumentRule},
+	"textDocument/semanticTokens/range": withRules([]fieldRule{textDocumentRule}, rangeRules("range")),
+	"textDocument/formatting": {
+		textDocumentRule,
+		{path: "options.tabSize", kinds: "integer"},
+		{path: "options.insertSpaces", kinds: "boolean"},
+	},
+	"textDocument/rangeFormatting": withRules([]fieldRule{
+		textDocumentRule,
+		{path: "options.tabSize", kinds: "integer"},
+		{path: "options.insertSpaces", kinds: "boolean"},
+	}, rangeRules("range")),
+	"textDocument/codeAction": withRules([]fieldRule{
+		textDocumentRule,
+		{path: "context.diagnostics", kinds: "array"},
+	}, rangeRules("range")),
+	"textDocument/publishDiagnostics": {
+		{path: "uri", kinds: "string"},
+		{path: "diagnostics", kinds: "array"},
+		{path: "version", kinds: "integer", optional: true},
+	},
+	"workspace/symbol": {{path: "query", kinds: "string"}},
+	"workspace/executeCommand": {
+		{path: "command", kinds: "string"},
+		{path: "arguments", kinds: "array", optional: true},
+	},
+	"workspace/didChangeWatchedFiles": {{path: "changes", kinds: "array"}},
+	"workspace/applyEdit": {
+		{path: "edit", kinds: "object"},
+		{path: "label", kinds: "string", optional: true},
+	},
+	"workspace/configuration":        {{path: "items", kinds: "array"}},
+	"client/registerCapability":      {{path: "registrations", kinds: "array"}},
+	"window/showMessage":             {{path: "type", kinds: "integer"}, {path: "message", kinds: "string"}},
+	"window/showMessageRequest":      {{path: "type", kinds: "integer"}, {path: "message", kinds: "string"}},
+	"window/logMessage":              {{path: "type", kinds: "integer"}, {path: "message", kinds: "string"}},
+	"window/workDoneProgress/create": {{path: "token", kinds: "integer|string"}},
+	"$/progress":                     {{path: "token", kinds: "integer|string"}},
+	"$/cancelRequest":                {{path: "id", kinds: "integer|string"}},
+	"$/setTrace":                     {{path: "value", kinds: "string"}},
+}
+
+// resultRules are the results of the methods validated
+var resultRules = map[string]resultRule{
+	"initialize":                  {kinds: "object", fields: []fieldRule{{path: "capabilities", kinds: "object"}}},
+	"shutdown":                    {kinds: "null"},
+	"textDocument/definition":     {kinds: "null|object|array", fields: locationRules, items: locationRules},
+	"textDocument/declaration":    {kinds: "null|object|array", fields: locationRules, items: locationRules},
+	"textDocument/implementation": {kinds: "null|object|array", fields: locationRules, items: locationRules},
+	"textDocument/typeDefinition": {kinds: "null|object|array", fields: locationRules, items: locationRules},
+	"textDocument/references":     {kinds: "null|array", items: locationRules},
+	"textDocument/hover":          {kinds: "null|object", fields: []fieldRule{{path: "contents", kinds: "object|string|array"}}},
+	"textDocument/completion": {
+		kinds:  "null|object|array",
+		fields: []fieldRule{{path: "isIncomplete", kinds: "boolean"}, {path: "items", kinds: "array"}},
+		items:  []fieldRule{{path: "label", kinds: "string"}},
+	},
+	"textDocument/signatureHelp":        {kinds: "null|object", fields: []fieldRule{{path: "signatures", kinds: "array"}}},
+	"textDocument/documentSymbol":       {kinds: "null|array", items: []fieldRule{{path: "name", kinds: "string"}, {path: "kind", kinds: "integer"}}},
+	"workspace/symbol":                  {kinds: "null|array", items: []fieldRule{{path: "name", kinds: "string"}, {path: "kind", kinds: "integer"}, {path: "location", kinds: "object"}}},
+	"textDocument/rename":               {kinds: "null|object"},
+	"textDocument/prepareRename":        {kinds: "null|object"},
+	"textDocument/prepareCallHierarchy": {kinds: "null|array", items: []fieldRule{{path: "name", kinds: "string"}, {path: "uri", kinds: "string"}, {path: "selectionRange", kinds: "object"}}},
+	"callHierarchy/incomingCalls":       {kinds: "null|array", items: []fieldRule{{path: "from", kinds: "object"}, {path: "fromRanges", kinds: "array"}}},
+	"callHierarchy/outgoingCalls":       {kinds: "null|array", items: []fieldRule{{path: "to", kinds: "object"}, {path: "fromRanges", kinds: "array"}}},
+	"textDocument/prepareTypeHierarchy": {kinds: "null|array", items: []fieldRule{{path: "name", kinds: "string"}, {path: "uri", kinds: "string"}, {path: "selectionRange", kinds: "object"}}},
+	"typeHierarchy/supertypes":          {kinds: "null|array", items: []fieldRule{{path: "name", kinds: "string"}, {path: "uri", kinds: "string"}, {path: "selectionRange", kinds: "object"}}},
+	"typeHierarchy/subtypes":            {kinds: "null|array", items: []fieldRule{{path: "name", kinds: "string"}, {path: "uri", kinds: "string"}, {path: "selectionRange", kinds: "object"}}},
+	"textDocument/diagnostic":           {kinds: "object", fields: []fieldRule{{path: "kind", kinds: "string"}, {path: "items", kinds: "array", optional: true}}},
+	"textDocument/documentHighlight":    {kinds: "null|array", items: rangeRules("range")},
+	"textDocument/foldingRange":         {kinds: "null|array", items: []fieldRule{{path: "startLine", kinds: "integer"}, {path: "endLine", kinds: "integer"}}},
+	"textDocument/selectionRange":       {kinds: "null|array", items: rangeRules("range")},
+	"textDocument/linkedEditingRange":   {kinds: "null|object", fields: []fieldRule{{path: "ranges", kinds: "array"}, {path: "wordPattern", kinds: "string", optional: true}}},
+	"textDocument/documentLink":         {kinds: "null|array", items: rangeRules("range")},
+	"textDocument/codeAction":           {kinds: "null|array", items: []fieldRule{{path: "title", kinds: "string"}}},
+	"textDocument/codeLens":             {kinds: "null|array", items: rangeRules("range")},
+	"textDocument/formatting":           {kinds: "null|array", items: withRules(rangeRules("range"), []fieldRule{{path: "newText", kinds: "string"}})},
+	"textDocument/rangeFormatting":      {kinds: "null|array", items: withRules(rangeRules("range"), []fieldRule{{path: "newText", kinds: "string"}})},
+	"textDocument/semanticTokens/full":  {kinds: "null|object", fields: []fieldRule{{path: "data", kinds: "array"}}},
+	"textDocument/semanticTokens/range": {kinds: "null|object", fields: []fieldRule{{path: "data", kinds: "array"}}},
+	"workspace/applyEdit":               {kinds: "object", fields: []fieldRule{{path: "applied", kinds: "boolean"}}},
+	"window/workDoneProgress/create":    {kinds: "null"},
+}
+
+// validateMessage checks a message sent from one side to another when strict
+// validation is enabled, recording the violations found
+func (w *ALLSPWrapper) validateMessage(from string, to string, msg *Message) {
+	if msg == nil || !w.Config().Validation.Strict {
+		return
+	}
+
+	// Responses are validated against the method of the request they answer
+	method := msg.Method
+	id := msg.GetIDString()
+	w.validationMu.Lock()
+	if msg.IsRequest() {
+		w.validator.expect(from+">"+to+":"+id, method)
+	} else if msg.IsResponse() {
+		method = w.validator.answered(to + ">" + from + ":" + id)
+	}
+	w.validationMu.Unlock()
+
+	for _, problem := range messageProblems(msg, method) {
+		w.Log("Protocol violation (%s -> %s) method=%s id=%s: %s", from, to, method, id, problem)
+		w.validationMu.Lock()
+		w.validator.record(ProtocolViolation{
+			Time:    time.Now(),
+			From:    from,
+			To:      to,
+			Method:  method,
+			ID:      id,
+			Problem: problem,
+		})
+		w.validationMu.Unlock()
+	}
+}
+
+// expect remembers the method of a request in flight
+func (v *protocolValidator) expect(key string, method string) {
+	if v.pending == nil {
+		v.pending = make(map[string]string)
+	}
+	if len(v.pending) >= maxPendingValidations {
+		for k := range v.pending {
+			delete(v.pending, k)
+			break
+		}
+	}
+	v.pending[key] = method
+}
+
+// answered returns and forgets the method of an answered request, "" if unknown
+func (v *protocolValidator) answered(key string) string {
+	method := v.pending[key]
+	delete(v.pending, key)
+	return method
+}
+
+// record counts a violation and keeps it among the recent ones
+func (v *protocolValidator) record(violation ProtocolViolation) {
+	v.violations++
+	v.recent = append(v.recent, violation)
+	if len(v.recent) > maxRecentErrors {
+		v.recent = v.recent[len(v.recent)-maxRecentErrors:]
+	}
+}
+
+// ProtocolViolations returns the number of violations found and the recent ones
+func (w *ALLSPWrapper) ProtocolViolations() (int, []ProtocolViolation) {
+	w.validationMu.Lock()
+	defer w.validationMu.Unlock()
+	return w.validator.violations, append([]ProtocolViolation{}, w.validator.recent...)
+}
+
+// messageProblems returns how a message deviates from JSON-RPC and from the
+// rules of its method
+func messageProblems(msg *Message, method string) []string {
+	var problems []string
+	if msg.JSONRPC != "2.0" {
+		problems = append(problems, fmt.Sprintf("jsonrpc is %q, not \"2.0\"", msg.JSONRPC))
+	}
+	if msg.ID != nil && !jsonKindIn(decodeJSON(*msg.ID), "integer|string") &&
+		!(msg.IsResponse() && msg.Error != nil && jsonKind(decodeJSON(*msg.ID)) == "null") {
+		problems = append(problems, "id is not an integer or a string")
+	}
+
+	switch {
+	case msg.Method == "" && msg.ID == nil && msg.Error != nil:
+		// An error response to a message whose id could not be read has a null id
+	case msg.Method == "" && msg.ID == nil:
+		problems = append(problems, "message has neither a method nor an id")
+	case msg.IsResponse():
+		switch {
+		case msg.Result != nil && msg.Error != nil:
+			problems = append(problems, "response has both a result and an error")
+		case msg.Result == nil && msg.Error == nil:
+			problems = append(problems, "response has neither a result nor an error")
+		case msg.Error != nil:
+			if msg.Error.Message == "" {
+				problems = append(problems, "error has no message")
+			}
+		default:
+			if rule, ok := resultRules[method]; ok {
+				problems = append(problems, resultProblems(decodeJSON(msg.Result), rule)...)
+			}
+		}
+	default:
+		if msg.Params == nil {
+			if _, ok := paramRules[method]; ok {
+				problems = append(problems, "params are missing")
+			}
+			break
+		}
+		params := decodeJSON(msg.Params)
+		if !jsonKindIn(params, "object|array") {
+			problems = append(problems, "params are not an object or an array")
+			break
+		}
+		for _, rule := range paramRules[method] {
+			if problem := fieldProblem(params, rule, "params"); problem != "" {
+				problems = append(problems, problem)
+			}
+		}
+	}
+	return problems
+}
+
+// resultProblems checks a result against the rule of its method
+func resultProblems(result interface{}, rule resultRule) []string {
+	if !jsonKindIn(result, rule.kinds) {
+		return []string{fmt.Sprintf("result is %s, expected %s", jsonKind(result), rule.kinds)}
+	}
+	var problems []string
+	switch value := result.(type) {
+	case map[string]interface{}:
+		for _, field := range rule.fields {
+			if problem := fieldProblem(value, field, "result"); problem != "" {
+				problems = append(problems, problem)
+			}
+		}
+	case []interface{}:
+		for i, item := range value {
+			for _, field := range rule.items {
+				if problem := fieldProblem(item, field, fmt.Sprintf("result[%d]", i)); problem != "" {
+					problems = append(problems, problem)
+				}
+			}
+			// One malformed element is enough to tell
+			if len(problems) > 0 {
+				break
+			}
+		}
+	}
+	return problems
+}
+
+// fieldProblem checks one field of a value, returning "" if it matches
+func fieldProblem(value interface{}, rule fieldRule, prefix string) string {
+	paths := strings.Split(rule.path, "|")
+	for _, path := range paths {
+		field, ok := lookupJSONPath(value, path)
+		if !ok {
+			continue
+		}
+		if !jsonKindIn(field, rule.kinds) {
+			return fmt.Sprintf("%s.%s is %s, expected %s", prefix, path, jsonKind(field), rule.kinds)
+		}
+		return ""
+	}
+	if rule.optional {
+		return ""
+	}
+	return fmt.Sprintf("%s.%s is missing", prefix, strings.Join(paths, " or "))
+}
+
+// lookupJSONPath returns the value at a dotted path of decoded JSON
+func lookupJSONPath(value interface{}, path string) (interface{}, bool) {
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = object[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// decodeJSON decodes raw JSON, returning nil for invalid JSON
+func decodeJSON(data json.RawMessage) interface{} {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil
+	}
+	return value
+}
+
+// jsonKind returns the JSON kind of a decoded value; whole numbers are "integer"
+func jsonKind(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	return "unknown"
+}
+
+// jsonKindIn reports whether a decoded value has one of the kinds listed
+func jsonKindIn(value interface{}, kinds string) bool {
+	kind := jsonKind(value)
+	for _, k := range strings.Split(kinds, "|") {
+		if k == kind || (k == "number" && kind == "integer") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,5 @@
+package wrapper
+
+// Version is the wrapper version reported in logs and status requests.
+// Release builds may override it with -ldflags "-X .../wrapper.Version=x.y.z".
+var Version = "1.3.6"
@@ -0,0 +1,362 @@
+package wrapper
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The wrapper persists what it learned about a workspace (the AL projects it
+// initialized, the open documents with their versions, the active project and
+// its symbol index) in the cache directory on shutdown. On the next start of
+// the same workspace the projects and symbol index are replayed right after
+// the client's initialized notification, so the AL server is already loading
+// the known projects before the first request arrives. Restoring the session
+// itself (documents and active project) is opt-in.
+//
+// A restored symbol index must never point at stale locations, so it is
+// dropped when the wrapper or AL extension version changed since it was
+// saved, and per project when the project's sources changed (its content
+// hash differs). The cache clear subcommand removes warm state by hand.
+
+// warmStateVersion is bumped when the warm state format changes; files with
+// another version are ignored
+const warmStateVersion = 4
+
+// warmStateLockTimeout bounds how long saving waits for another session's cache lock
+const warmStateLockTimeout = 2 * time.Second
+
+// warmState is the persisted state of one workspace
+type warmState struct {
+	Version       int       `json:"version"`
+	WorkspaceRoot string    `json:"workspaceRoot"`
+	SavedAt       time.Time `json:"savedAt"`
+	// WrapperVersion and ExtensionVersion are the versions of the wrapper and
+	// the AL extension that built the symbol index
+	WrapperVersion   string `json:"wrapperVersion"`
+	ExtensionVersion string `json:"extensionVersion"`
+	// Projects are the AL project roots that were initialized
+	Projects []string `json:"projects"`
+	// ActiveProject is the project that was active in the AL server
+	ActiveProject string `json:"activeProject,omitempty"`
+	// Documents are the documents open in the AL server
+	Documents []warmDocument `json:"documents"`
+	// Symbols is the symbol index per project root
+	Symbols map[string][]warmSymbolFile `json:"symbols,omitempty"`
+	// ProjectHashes are the content hashes of the projects in Symbols
+	ProjectHashes map[string]string `json:"projectHashes,omitempty"`
+}
+
+// warmDocument is an open document and its version
+type warmDocument struct {
+	Path    string `json:"path"`
+	Version int    `json:"version"`
+}
+
+// warmSymbolFile is the persisted form of an indexedFile
+type warmSymbolFile struct {
+	Path    string          `json:"path"`
+	ModTime time.Time       `json:"modTime"`
+	Size    int64           `json:"size"`
+	Symbols []IndexedSymbol `json:"symbols"`
+}
+
+// warmStateDir returns the directory holding warm state files
+func warmStateDir() string {
+	dir := GetCacheDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "workspaces")
+}
+
+// warmStatePath returns the warm state file of a workspace root
+func warmStatePath(workspaceRoot string) string {
+	dir := warmStateDir()
+	if dir == "" || workspaceRoot == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(NormalizePath(workspaceRoot)))
+	return filepath.Join(dir, hex.EncodeToString(sum[:8])+".json")
+}
+
+// loadWarmState reads the warm state of a workspace, or returns nil if there is none
+func loadWarmState(workspaceRoot string) (*warmState, error) {
+	path := warmStatePath(workspaceRoot)
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var state warmState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("invalid warm state %s: %w", path, err)
+	}
+	if state.Version != warmStateVersion || NormalizePath(state.WorkspaceRoot) != NormalizePath(workspaceRoot) {
+		return nil, nil
+	}
+	return &state, nil
+}
+
+// saveWarmState writes a workspace's warm state atomically under the cache lock
+func saveWarmState(state *warmState) error {
+	path := warmStatePath(state.WorkspaceRoot)
+	if path == "" {
+		return fmt.Errorf("no cache directory")
+	}
+	release, err := AcquireCacheLock(filepath.Dir(path), warmStateLockTimeout)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// captureWarmState snapshots the wrapper's workspace state
+func (w *ALLSPWrapper) captureWarmState() *warmState {
+	state := &warmState{
+		Version:          warmStateVersion,
+		WorkspaceRoot:    w.workspaceRoot,
+		SavedAt:          time.Now(),
+		WrapperVersion:   Version,
+		ExtensionVersion: w.extensionVersion(),
+		ActiveProject:    w.ActiveProject(),
+		Symbols:          w.symbols.export(),
+		ProjectHashes:    make(map[string]string),
+	}
+	for root := range state.Symbols {
+		state.ProjectHashes[root] = projectContentHash(root)
+	}
+	state.Projects = w.initializedProjectRoots()
+	for path, version := range w.openedDocuments() {
+		state.Documents = append(state.Documents, warmDocument{Path: path, Version: version})
+	}
+	sort.Strings(state.Projects)
+	sort.Slice(state.Documents, func(i, j int) bool { return state.Documents[i].Path < state.Documents[j].Path })
+	return state
+}
+
+// persistWarmState saves the workspace state if warm start is enabled
+func (w *ALLSPWrapper) persistWarmState() {
+	if !w.Config().WarmStart.Enabled || w.workspaceRoot == "" || len(w.initializedProjectRoots()) == 0 {
+		return
+	}
+	state := w.captureWarmState()
+	if err := saveWarmState(state); err != nil {
+		w.Log("Failed to save warm state: %v", err)
+		return
+	}
+	w.Log("Saved warm state for %s (%d project(s), %d open document(s))",
+		w.workspaceRoot, len(state.Projects), len(state.Documents))
+}
+
+// warmStart replays the persisted state of the workspace: the symbol index is
+// restored and known projects that still exist are initialized. With
+// RestoreSession, documents are reopened at their saved versions and the
+// saved active project is made active again.
+func (w *ALLSPWrapper) warmStart(scope WrapperInterface) {
+	if !w.Config().WarmStart.Enabled || w.workspaceRoot == "" {
+		return
+	}
+	state, err := loadWarmState(w.workspaceRoot)
+	if err != nil {
+		scope.Log("Ignoring warm state: %v", err)
+		return
+	}
+	if state == nil {
+		return
+	}
+
+	start := time.Now()
+	for _, reason := range invalidateWarmSymbols(state, Version, w.extensionVersion()) {
+		scope.Log("Discarding saved symbol index: %s", reason)
+	}
+	w.symbols.restore(state.Symbols)
+	projects, files := w.replayState(scope, state, w.Config().WarmStart.RestoreSession)
+
+	scope.Log("Warm start from state saved %s: %d project(s), %d document(s) in %s",
+		state.SavedAt.Format(time.RFC3339), projects, files, time.Since(start).Round(time.Millisecond))
+}
+
+// replayState initializes the saved projects that still exist and, with
+// restoreSession, restores the documents and active project. It returns how
+// many projects and documents were replayed.
+func (w *ALLSPWrapper) replayState(scope WrapperInterface, state *warmState, restoreSession bool) (int, int) {
+	projects := 0
+	for _, root := range state.Projects {
+		appJSON := filepath.Join(root, "app.json")
+		if _, err := os.Stat(appJSON); err != nil {
+			continue
+		}
+		if err := w.ensureProjectInitialized(scope, appJSON); err != nil {
+			scope.Log("Failed to reinitialize %s: %v", root, err)
+			continue
+		}
+		projects++
+	}
+
+	files := 0
+	if restoreSession {
+		files = w.restoreSession(scope, state)
+	}
+	return projects, files
+}
+
+// restoreSession reopens the saved documents that still exist and reactivates
+// the saved active project, returning how many documents were reopened
+func (w *ALLSPWrapper) restoreSession(scope WrapperInterface, state *warmState) int {
+	files := 0
+	for _, doc := range state.Documents {
+		if _, err := os.Stat(doc.Path); err != nil {
+			continue
+		}
+		if err := w.openFileVersion(scope, doc.Path, max(doc.Version, 1)); err == nil {
+			files++
+		}
+	}
+
+	if active := state.ActiveProject; active != "" && active != w.ActiveProject() && w.isProjectInitialized(active) {
+		w.activationMu.Lock()
+		err := w.activateProject(scope, active)
+		w.activationMu.Unlock()
+		if err != nil {
+			scope.Log("Session restore: failed to reactivate %s: %v", active, err)
+		} else {
+			scope.Log("Session restore: active project %s", active)
+		}
+	}
+	return files
+}
+
+// invalidateWarmSymbols drops the parts of a warm state's symbol index that
+// may be stale, returning why
+func invalidateWarmSymbols(state *warmState, wrapperVersion string, extensionVersion string) []string {
+	if len(state.Symbols) == 0 {
+		return nil
+	}
+	if state.WrapperVersion != wrapperVersion || state.ExtensionVersion != extensionVersion {
+		state.Symbols = nil
+		return []string{fmt.Sprintf("built by wrapper %s with AL extension %s, now wrapper %s with AL extension %s",
+			state.WrapperVersion, state.ExtensionVersion, wrapperVersion, extensionVersion)}
+	}
+
+	var reasons []string
+	roots := make([]string, 0, len(state.Symbols))
+	for root := range state.Symbols {
+		roots = append(roots, root)
+	}
+	sort.Strings(roots)
+	for _, root := range roots {
+		if hash := projectContentHash(root); hash != state.ProjectHashes[root] {
+			delete(state.Symbols, root)
+			reasons = append(reasons, fmt.Sprintf("sources of %s changed since it was saved", root))
+		}
+	}
+	return reasons
+}
+
+// projectContentHash fingerprints a project's sources: app.json and the path,
+// size and modification time of each .al file
+func projectContentHash(projectRoot string) string {
+	h := sha256.New()
+	if manifest, err := os.ReadFile(filepath.Join(projectRoot, "app.json")); err == nil {
+		h.Write(manifest)
+	}
+	var files []string
+	walkDir(projectRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if path != projectRoot && (strings.HasPrefix(name, ".") || name == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.EqualFold(filepath.Ext(path), ".al") {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			rel, _ := filepath.Rel(projectRoot, path)
+			files = append(files, fmt.Sprintf("%s\x00%d\x00%d", filepath.ToSlash(rel), info.Size(), info.ModTime().UnixNano()))
+		}
+		return nil
+	})
+	sort.Strings(files)
+	for _, file := range files {
+		h.Write([]byte(file + "\n"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// serverExtensionPath returns the AL extension the server was started from
+func (w *ALLSPWrapper) serverExtensionPath() string {
+	w.serverMu.Lock()
+	defer w.serverMu.Unlock()
+	return w.extensionPath
+}
+
+// extensionVersion returns the version of the running AL extension
+func (w *ALLSPWrapper) extensionVersion() string {
+	path := w.serverExtensionPath()
+	if path == "" {
+		return ""
+	}
+	return ALExtensionVersion(path)
+}
+
+// ClearWarmState removes the saved warm state of a workspace, or of every
+// workspace if workspaceRoot is empty, returning how many files were removed
+func ClearWarmState(workspaceRoot string) (int, error) {
+	dir := warmStateDir()
+	if dir == "" {
+		return 0, fmt.Errorf("no cache directory")
+	}
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return 0, nil
+	}
+	release, err := AcquireCacheLock(dir, warmStateLockTimeout)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	var paths []string
+	if workspaceRoot != "" {
+		paths = []string{warmStatePath(workspaceRoot)}
+	} else {
+		paths, _ = filepath.Glob(filepath.Join(dir, "*.json"))
+	}
+	removed := 0
+	for _, path := range paths {
+		if err := os.Remove(path); err == nil {
+			removed++
+		} else if !os.IsNotExist(err) {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
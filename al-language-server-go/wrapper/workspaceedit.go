@@ -0,0 +1,674 @@
+package wrapper
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+	"unicode/utf8"
+)
+
+// Minimal clients cannot apply the WorkspaceEdits that renames and code
+// actions produce. The wrapper can apply them to disk itself: every edit is
+// first applied to an in-memory copy of the affected files, so an invalid
+// edit changes nothing; then the originals are backed up (every file of a
+// deleted folder included), the new contents are written atomically, and the
+// AL server is told through didChange and didChangeWatchedFiles. If a write
+// fails, the changes made so far are undone from the backup. Edits are
+// applied one at a time.
+
+// ApplyWorkspaceEditCommand applies a WorkspaceEdit (the first argument) to disk
+const ApplyWorkspaceEditCommand = "al-wrapper.applyWorkspaceEdit"
+
+// File change types of workspace/didChangeWatchedFiles
+const (
+	FileCreated = 1
+	FileChanged = 2
+	FileDeleted = 3
+)
+
+// TextEdit represents an LSP text edit
+type TextEdit struct {
+	Range   Range  `json:"range"`
+	NewText string `json:"newText"`
+}
+
+// WorkspaceEdit represents an LSP workspace edit. DocumentChanges entries are
+// text document edits or create, rename and delete file operations.
+type WorkspaceEdit struct {
+	Changes         map[string][]TextEdit `json:"changes,omitempty"`
+	DocumentChanges []json.RawMessage     `json:"documentChanges,omitempty"`
+}
+
+// documentChange is any entry of WorkspaceEdit.DocumentChanges
+type documentChange struct {
+	Kind         string `json:"kind"`
+	URI          string `json:"uri"`
+	OldURI       string `json:"oldUri"`
+	NewURI       string `json:"newUri"`
+	TextDocument struct {
+		URI     string `json:"uri"`
+		Version *int   `json:"version"`
+	} `json:"textDocument"`
+	Edits   []TextEdit `json:"edits"`
+	Options struct {
+		Overwrite         bool `json:"overwrite"`
+		IgnoreIfExists    bool `json:"ignoreIfExists"`
+		Recursive         bool `json:"recursive"`
+		IgnoreIfNotExists bool `json:"ignoreIfNotExists"`
+	} `json:"options"`
+}
+
+// ApplyWorkspaceEditParams represents workspace/applyEdit parameters
+type ApplyWorkspaceEditParams struct {
+	Label string        `json:"label,omitempty"`
+	Edit  WorkspaceEdit `json:"edit"`
+}
+
+// ApplyWorkspaceEditResult represents the workspace/applyEdit result
+type ApplyWorkspaceEditResult struct {
+	Applied       bool   `json:"applied"`
+	FailureReason string `json:"failureReason,omitempty"`
+}
+
+// FileEvent represents a changed file in workspace/didChangeWatchedFiles
+type FileEvent struct {
+	URI  string `json:"uri"`
+	Type int    `json:"type"`
+}
+
+// DidChangeWatchedFilesParams represents workspace/didChangeWatchedFiles parameters
+type DidChangeWatchedFilesParams struct {
+	Changes []FileEvent `json:"changes"`
+}
+
+// FileChange is one file written or removed by an applied WorkspaceEdit
+type FileChange struct {
+	Path string `json:"path"`
+	// Type is FileCreated, FileChanged or FileDeleted
+	Type        int `json:"type"`
+	BytesBefore int `json:"bytesBefore"`
+	BytesAfter  int `json:"bytesAfter"`
+}
+
+// AppliedEdit describes a WorkspaceEdit applied to disk
+type AppliedEdit struct {
+	Files []FileChange `json:"files"`
+	// BackupDir holds the original files ("" if backups are disabled or
+	// no existing file changed)
+	BackupDir string `json:"backupDir,omitempty"`
+}
+
+// virtualFile is the planned content of a file; nil content means deleted
+type virtualFile struct {
+	original []byte
+	existed  bool
+	content  []byte
+	isDir    bool
+	// wasDir is set for a path that was a folder before the edit
+	wasDir bool
+}
+
+// editPlan is a WorkspaceEdit applied to in-memory copies of the files it touches
+type editPlan struct {
+	files map[string]*virtualFile
+	order []string
+}
+
+// file returns the planned state of path, loading it from disk on first use
+func (p *editPlan) file(path string) (*virtualFile, error) {
+	if f, ok := p.files[path]; ok {
+		return f, nil
+	}
+	f := &virtualFile{}
+	info, err := os.Stat(path)
+	switch {
+	case err == nil && info.IsDir():
+		f.existed, f.isDir, f.wasDir = true, true, true
+	case err == nil:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		f.existed, f.original, f.content = true, data, data
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+	p.files[path] = f
+	p.order = append(p.order, path)
+	return f, nil
+}
+
+// exists reports whether path exists in the planned state
+func (f *virtualFile) exists() bool {
+	return f.content != nil || f.isDir
+}
+
+// planWorkspaceEdit applies a WorkspaceEdit to in-memory copies of the files.
+// openVersion returns the version of an open document, or false if it is not open.
+func planWorkspaceEdit(edit *WorkspaceEdit, openVersion func(path string) (int, bool)) (*editPlan, error) {
+	plan := &editPlan{files: make(map[string]*virtualFile)}
+
+	editFile := func(uri string, version *int, edits []TextEdit) error {
+		path, err := editPath(uri)
+		if err != nil {
+			return err
+		}
+		if version != nil {
+			if open, ok := openVersion(path); ok && open != *version {
+				return fmt.Errorf("%s changed since the edit was computed (version %d, edit is for %d)", path, open, *version)
+			}
+		}
+		f, err := plan.file(path)
+		if err != nil {
+			return err
+		}
+		if f.content == nil {
+			return fmt.Errorf("cannot edit %s: file does not exist", path)
+		}
+		content, err := applyTextEdits(f.content, edits)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		f.content = content
+		return nil
+	}
+
+	if len(edit.DocumentChanges) == 0 {
+		uris := make([]string, 0, len(edit.Changes))
+		for uri := range edit.Changes {
+			uris = append(uris, uri)
+		}
+		sort.Strings(uris)
+		for _, uri := range uris {
+			if err := editFile(uri, nil, edit.Changes[uri]); err != nil {
+				return nil, err
+			}
+		}
+		return plan, nil
+	}
+
+	for _, raw := range edit.DocumentChanges {
+		var change documentChange
+		if err := json.Unmarshal(raw, &change); err != nil {
+			return nil, fmt.Errorf("invalid document change: %w", err)
+		}
+		var err error
+		switch change.Kind {
+		case "":
+			err = editFile(change.TextDocument.URI, change.TextDocument.Version, change.Edits)
+		case "create":
+			err = plan.create(change)
+		case "rename":
+			err = plan.rename(change)
+		case "delete":
+			err = plan.delete(change)
+		default:
+			err = fmt.Errorf("unsupported document change kind %q", change.Kind)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+// create plans a create file operation
+func (p *editPlan) create(change documentChange) error {
+	path, err := editPath(change.URI)
+	if err != nil {
+		return err
+	}
+	f, err := p.file(path)
+	if err != nil {
+		return err
+	}
+	if f.exists() {
+		if change.Options.IgnoreIfExists && !change.Options.Overwrite {
+			return nil
+		}
+		if !change.Options.Overwrite || f.isDir {
+			return fmt.Errorf("cannot create %s: it already exists", path)
+		}
+	}
+	f.content = []byte{}
+	return nil
+}
+
+// rename plans a rename file operation
+func (p *editPlan) rename(change documentChange) error {
+	oldPath, err := editPath(change.OldURI)
+	if err != nil {
+		return err
+	}
+	newPath, err := editPath(change.NewURI)
+	if err != nil {
+		return err
+	}
+	from, err := p.file(oldPath)
+	if err != nil {
+		return err
+	}
+	if from.isDir {
+		return fmt.Errorf("cannot rename %s: renaming folders is not supported", oldPath)
+	}
+	if from.content == nil {
+		return fmt.Errorf("cannot rename %s: file does not exist", oldPath)
+	}
+	to, err := p.file(newPath)
+	if err != nil {
+		return err
+	}
+	if to.exists() {
+		if change.Options.IgnoreIfExists && !change.Options.Overwrite {
+			return nil
+		}
+		if !change.Options.Overwrite || to.isDir {
+			return fmt.Errorf("cannot rename %s to %s: target exists", oldPath, newPath)
+		}
+	}
+	to.content = from.content
+	from.content = nil
+	return nil
+}
+
+// delete plans a delete file operation
+func (p *editPlan) delete(change documentChange) error {
+	path, err := editPath(change.URI)
+	if err != nil {
+		return err
+	}
+	f, err := p.file(path)
+	if err != nil {
+		return err
+	}
+	if !f.exists() {
+		if change.Options.IgnoreIfNotExists {
+			return nil
+		}
+		return fmt.Errorf("cannot delete %s: it does not exist", path)
+	}
+	if f.isDir && !change.Options.Recursive {
+		return fmt.Errorf("cannot delete folder %s without the recursive option", path)
+	}
+	f.content = nil
+	f.isDir = false
+	return nil
+}
+
+// editPath converts a WorkspaceEdit URI to a normalized file path
+func editPath(uri string) (string, error) {
+	path, err := FileURIToPath(uri)
+	if err != nil {
+		return "", fmt.Errorf("invalid URI %q: %w", uri, err)
+	}
+	return NormalizePath(path), nil
+}
+
+// applyTextEdits applies LSP text edits to content. Edits must not overlap;
+// edits at the same position are applied in order.
+func applyTextEdits(content []byte, edits []TextEdit) ([]byte, error) {
+	type span struct {
+		start, end int
+		text       string
+	}
+	spans := make([]span, 0, len(edits))
+	for _, edit := range edits {
+		start := positionOffset(content, edit.Range.Start)
+		end := positionOffset(content, edit.Range.End)
+		if end < start {
+			return nil, fmt.Errorf("edit range ends before it starts at line %d", edit.Range.Start.Line+1)
+		}
+		spans = append(spans, span{start, end, edit.NewText})
+	}
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+
+	var out bytes.Buffer
+	last := 0
+	for _, s := range spans {
+		if s.start < last {
+			return nil, fmt.Errorf("overlapping edits")
+		}
+		out.Write(content[last:s.start])
+		out.WriteString(s.text)
+		last = s.end
+	}
+	out.Write(content[last:])
+	return out.Bytes(), nil
+}
+
+// positionOffset converts an LSP position (UTF-16 code units) to a byte
+// offset, clamping positions past the end of a line or the document
+func positionOffset(content []byte, pos Position) int {
+	offset := 0
+	for line := 0; line < pos.Line; line++ {
+		i := bytes.IndexByte(content[offset:], '\n')
+		if i < 0 {
+			return len(content)
+		}
+		offset += i + 1
+	}
+	end := len(content)
+	if i := bytes.IndexByte(content[offset:], '\n'); i >= 0 {
+		end = offset + i
+	}
+	if end > offset && content[end-1] == '\r' {
+		end--
+	}
+
+	for units := 0; offset < end && units < pos.Character; {
+		r, size := utf8.DecodeRune(content[offset:end])
+		if r >= 0x10000 {
+			units += 2
+		} else {
+			units++
+		}
+		offset += size
+	}
+	return offset
+}
+
+// changes returns the files the plan creates, changes or deletes
+func (p *editPlan) changes() []FileChange {
+	var changes []FileChange
+	for _, path := range p.order {
+		f := p.files[path]
+		change := FileChange{Path: path, BytesBefore: len(f.original), BytesAfter: len(f.content)}
+		switch {
+		case !f.existed && f.content != nil:
+			change.Type = FileCreated
+		case f.existed && !f.exists():
+			change.Type = FileDeleted
+		case f.content != nil && !bytes.Equal(f.original, f.content):
+			change.Type = FileChanged
+		default:
+			continue
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// commit backs up and writes the planned files, returning what changed. If
+// a write fails, the files written or removed so far are restored from the
+// backup. The backup is kept only if keepBackup is set.
+func (p *editPlan) commit(keepBackup bool) (*AppliedEdit, error) {
+	changes := p.changes()
+	dir, manifest, err := p.backup(changes)
+	if err != nil {
+		if dir != "" {
+			os.RemoveAll(dir)
+		}
+		return nil, fmt.Errorf("backing up files: %w", err)
+	}
+
+	applied := &AppliedEdit{}
+	for i, change := range changes {
+		var err error
+		if change.Type == FileDeleted {
+			err = os.RemoveAll(change.Path)
+		} else {
+			err = writeFileAtomic(change.Path, p.files[change.Path].content)
+		}
+		if err != nil {
+			err = fmt.Errorf("writing %s: %w", change.Path, err)
+			// Writes are atomic, but a folder may be partly removed
+			undo := changes[:i]
+			if change.Type == FileDeleted {
+				undo = changes[:i+1]
+			}
+			if restoreErr := restoreBackup(undo, dir, manifest); restoreErr != nil {
+				return nil, fmt.Errorf("%w; undoing the edit failed, the original files are in %s: %v", err, dir, restoreErr)
+			}
+			if !keepBackup && dir != "" {
+				os.RemoveAll(dir)
+			}
+			return nil, fmt.Errorf("%w; the files written so far were restored", err)
+		}
+		applied.Files = append(applied.Files, change)
+	}
+
+	if keepBackup {
+		applied.BackupDir = dir
+	} else if dir != "" {
+		os.RemoveAll(dir)
+	}
+	return applied, nil
+}
+
+// backup copies the existing files about to change, and every file of a
+// folder about to be deleted, into a new backup directory with a manifest
+// mapping the copies to their original paths
+func (p *editPlan) backup(changes []FileChange) (string, map[string]string, error) {
+	manifest := make(map[string]string)
+	var dir string
+	save := func(name string, path string, data []byte) error {
+		if dir == "" {
+			dir = filepath.Join(GetDataDir(), "backups", fmt.Sprintf("%s-%d", time.Now().Format("20060102-150405.000"), os.Getpid()))
+		}
+		copyPath := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(copyPath), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(copyPath, data, 0644); err != nil {
+			return err
+		}
+		manifest[name] = path
+		return nil
+	}
+
+	for i, change := range changes {
+		f := p.files[change.Path]
+		if !f.existed {
+			continue
+		}
+		name := fmt.Sprintf("%03d-%s", i, filepath.Base(change.Path))
+		if !f.wasDir {
+			if err := save(name, change.Path, f.original); err != nil {
+				return dir, nil, err
+			}
+			continue
+		}
+		err := filepath.WalkDir(change.Path, func(path string, entry os.DirEntry, err error) error {
+			if err != nil || !entry.Type().IsRegular() {
+				return err
+			}
+			rel, err := filepath.Rel(change.Path, path)
+			if err != nil {
+				return err
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			return save(name+"/"+filepath.ToSlash(rel), path, data)
+		})
+		if err != nil {
+			return dir, nil, err
+		}
+	}
+	if dir == "" {
+		return "", manifest, nil
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return dir, nil, err
+	}
+	return dir, manifest, os.WriteFile(filepath.Join(dir, "manifest.json"), data, 0644)
+}
+
+// restoreBackup undoes changes, last first: created files are removed, and
+// changed and deleted files and folders are restored from the backup
+func restoreBackup(changes []FileChange, dir string, manifest map[string]string) error {
+	var errs []error
+	for i := len(changes) - 1; i >= 0; i-- {
+		change := changes[i]
+		if change.Type == FileCreated {
+			if err := os.Remove(change.Path); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		for name, path := range manifest {
+			if path != change.Path && !isWithin(path, change.Path) {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+			if err == nil {
+				err = writeFileAtomic(path, data)
+			}
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// writeFileAtomic replaces path with data through a temporary file in the
+// same directory, keeping the mode of an existing file
+func writeFileAtomic(path string, data []byte) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(path), fmt.Sprintf(".%s.al-lsp-%d.tmp", filepath.Base(path), os.Getpid()))
+	if err := os.WriteFile(tmp, data, mode); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// ApplyWorkspaceEdit applies a WorkspaceEdit to disk. source names what
+// produced the edit, for the audit log.
+func (w *ALLSPWrapper) ApplyWorkspaceEdit(edit *WorkspaceEdit, source string) (*AppliedEdit, error) {
+	return w.applyWorkspaceEdit(w, edit, source)
+}
+
+// applyWorkspaceEdit applies a WorkspaceEdit to disk on behalf of scope and
+// brings the AL server up to date with the new file contents
+func (w *ALLSPWrapper) applyWorkspaceEdit(scope WrapperInterface, edit *WorkspaceEdit, source string) (*AppliedEdit, error) {
+	// An edit is planned against the files as the previous one left them
+	w.editMu.Lock()
+	defer w.editMu.Unlock()
+
+	plan, err := w.planEdit(edit)
+	if err != nil {
+		w.audit(scope, AuditEntry{Action: AuditApplied, Method: source, Error: err.Error()})
+		return nil, err
+	}
+	applied, err := plan.commit(w.Config().WorkspaceEdit.Backup)
+	if applied != nil {
+		w.syncAppliedEdit(scope, plan, applied)
+	}
+	entry := AuditEntry{Action: AuditApplied, Method: source}
+	if applied != nil {
+		entry.Files = auditFiles(applied.Files)
+		entry.BackupDir = applied.BackupDir
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	w.audit(scope, entry)
+	if err != nil {
+		return applied, err
+	}
+	scope.Log("Applied workspace edit to %d file(s) on disk (backup: %s)", len(applied.Files), applied.BackupDir)
+	return applied, nil
+}
+
+// planEdit applies a WorkspaceEdit to in-memory copies of its files,
+// checking versioned edits against the open documents
+func (w *ALLSPWrapper) planEdit(edit *WorkspaceEdit) (*editPlan, error) {
+	return planWorkspaceEdit(edit, w.openedVersion)
+}
+
+// syncAppliedEdit sends the AL server the new content of open documents and
+// the changed files
+func (w *ALLSPWrapper) syncAppliedEdit(scope WrapperInterface, plan *editPlan, applied *AppliedEdit) {
+	events := make([]FileEvent, 0, len(applied.Files))
+	for _, change := range applied.Files {
+		uri := PathToFileURI(change.Path)
+		events = append(events, FileEvent{URI: uri, Type: change.Type})
+
+		version, open := w.openedVersion(change.Path)
+		switch {
+		case !open:
+		case change.Type == FileDeleted:
+			scope.SendNotificationToLSP("textDocument/didClose", map[string]interface{}{
+				"textDocument": TextDocumentIdentifier{URI: uri},
+			})
+			w.docMu.Lock()
+			delete(w.openedFiles, change.Path)
+			delete(w.serverDocs, change.Path)
+			w.docMu.Unlock()
+		default:
+			version++
+			scope.SendNotificationToLSP("textDocument/didChange", map[string]interface{}{
+				"textDocument":   map[string]interface{}{"uri": uri, "version": version},
+				"contentChanges": []map[string]string{{"text": string(plan.files[change.Path].content)}},
+			})
+			w.docMu.Lock()
+			w.openedFiles[change.Path] = version
+			w.serverDocs[change.Path] = serverDocument{hash: contentHash(plan.files[change.Path].content), byWrapper: w.serverDocs[change.Path].byWrapper}
+			w.docMu.Unlock()
+		}
+	}
+	if len(events) > 0 {
+		scope.SendNotificationToLSP("workspace/didChangeWatchedFiles", DidChangeWatchedFilesParams{Changes: events})
+	}
+}
+
+// applyServerEdit answers a workspace/applyEdit request of the AL server for
+// a client that cannot apply edits itself
+func (w *ALLSPWrapper) applyServerEdit(msg *Message) {
+	scope := w.newRequestScope()
+	result := ApplyWorkspaceEditResult{}
+
+	var params ApplyWorkspaceEditParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		result.FailureReason = "invalid workspace/applyEdit parameters: " + err.Error()
+	} else if !w.Config().WorkspaceEdit.ApplyOnDisk {
+		result.FailureReason = "the client does not support workspace/applyEdit and workspaceEdit.applyOnDisk is off"
+	} else if _, err := w.applyWorkspaceEdit(scope, &params.Edit, "workspace/applyEdit "+params.Label); err != nil {
+		result.FailureReason = err.Error()
+	} else {
+		result.Applied = true
+	}
+	if !result.Applied {
+		scope.Log("Workspace edit %q not applied: %s", params.Label, result.FailureReason)
+	}
+
+	resp, err := NewResponse(msg.ID, result)
+	if err != nil {
+		return
+	}
+	if err := w.writeToServer(resp); err != nil {
+		scope.Log("Error answering workspace/applyEdit: %v", err)
+	}
+}
+
+// applyWorkspaceEditCommand implements ApplyWorkspaceEditCommand
+func applyWorkspaceEditCommand(msg *Message, args []json.RawMessage, w WrapperInterface) (*Message, *Message) {
+	var edit WorkspaceEdit
+	if err := decodeCommandArgs(args, &edit); err != nil {
+		return nil, NewErrorResponse(msg.ID, InvalidParams, "Invalid WorkspaceEdit argument: "+err.Error())
+	}
+	applied, err := w.ApplyWorkspaceEdit(&edit, ApplyWorkspaceEditCommand)
+	if err != nil {
+		w.Log("Failed to apply workspace edit: %v", err)
+		return nil, NewErrorResponse(msg.ID, InternalError, err.Error())
+	}
+	return newResultMessage(msg.ID, applied)
+}
@@ -8,70 +8,282 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// defaultRequestTimeout bounds how long to wait for an AL LSP response
+const defaultRequestTimeout = 30 * time.Second
+
 // ALLSPWrapper wraps the AL Language Server
 type ALLSPWrapper struct {
-	// AL LSP process
-	cmd    *exec.Cmd
-	stdin  io.WriteCloser
-	stdout *bufio.Reader
-	stderr io.ReadCloser
+	// AL LSP process, replaced when the server is restarted
+	cmd           *exec.Cmd
+	stdin         io.WriteCloser
+	stdout        *bufio.Reader
+	stderr        io.ReadCloser
+	extensionPath string
+	executable    string
+	serverMu      sync.Mutex
+
+	// serverInitParams are the initialize params sent to the AL LSP, replayed on restart
+	serverInitParams *InitializeParams
+	// trace is the AL server's trace level, set in initialize and by $/setTrace
+	trace   string
+	traceMu sync.Mutex
+
+	// clientCapabilities are the capabilities the client sent in initialize,
+	// guarded by initMu
+	clientCapabilities ClientCapabilities
 
 	// Client (Claude Code) communication
 	clientReader *bufio.Reader
 	clientWriter io.Writer
-
-	// State tracking
-	openedFiles         map[string]bool
-	initializedProjects map[string]bool
-	workspaceRoot       string
+	clientMu     sync.Mutex
+
+	// Diagnostics forwarding
+	diagnostics *diagnosticsQueue
+
+	// State tracking (openedFiles maps each open document to its version)
+	openedFiles map[string]int
+	docMu       sync.Mutex
+	// serverDocs holds what is known of the text the AL server has for each
+	// open document, for the rename drift check
+	serverDocs    map[string]serverDocument
+	projects      map[string]*projectState
+	projectMu     sync.Mutex
+	workspaceRoot string
+	activeProject string
+
+	// activationMu is held for reading by requests sent with the active
+	// project and for writing while a project is activated
+	activationMu sync.RWMutex
+
+	// inflight counts client messages being handled concurrently or queued;
+	// inflightCount is its current value, for the idle check
+	inflight      sync.WaitGroup
+	inflightCount atomic.Int64
+
+	// Per-document FIFOs of client messages, by document URI
+	docQueues map[string]*documentQueue
+	queueMu   sync.Mutex
+
+	// Idle reclamation: lastActivity is the time of the last client message
+	// (UnixNano); idleState is the session kept while the server is stopped
+	// for being idle, idleResumed is closed when it is started again (or
+	// starting it failed with idleResumeErr) and idleHeld are the client
+	// messages held until the session is replayed
+	lastActivity  atomic.Int64
+	idleState     *warmState
+	idleResumed   chan struct{}
+	idleResumeErr error
+	idleHeld      []heldMessage
+	idleMu        sync.Mutex
+
+	// Resource use samples of the AL server
+	resources  resourceSampler
+	resourceMu sync.Mutex
+
+	// editMu serializes applying WorkspaceEdits to disk
+	editMu sync.Mutex
+
+	// Strict protocol validation state
+	validator    protocolValidator
+	validationMu sync.Mutex
+
+	// Configuration, replaced in initialize and guarded by initMu
+	config *Config
+
+	// Locally parsed project symbols
+	symbols *symbolIndex
+
+	// Manifests of dependency packages
+	packages *packageIndex
+
+	// Object sources extracted or generated from dependency packages
+	sources *packageSources
+
+	// Symbols of dependency packages
+	symbolStore *SymbolStore
+
+	// documentSymbol results by file
+	documentSymbols *documentSymbolCache
+
+	// Duplicate object warnings by file
+	duplicates *duplicateChecker
+
+	// Diagnostics of alc builds by project
+	builds *buildDiagnostics
 
 	// Request tracking
 	requestID      int
+	correlationSeq int64
 	pendingMu      sync.Mutex
 	pendingReqs    map[int]chan *Message
+	abandonedReqs  map[int]abandonedRequest
+
+	// Results streamed for requests sent with a latency budget, by partialResultToken
+	partials   map[string]*partialResults
+	partialSeq int64
 
 	// Response queue for requests we sent to LSP
-	responseMu     sync.Mutex
-	responseQueue  map[int]*Message
+	responseMu    sync.Mutex
+	responseQueue map[int]*Message
 
 	// Handlers
 	handlers []Handler
 
-	// Logging
+	// Logging (logTail keeps the recent lines for error excerpts)
 	logFile *os.File
+	logTail []loggedLine
 	logMu   sync.Mutex
 
-	// Initialization
+	// Startup self-test report
+	selfTest *selfTest
+
+	// Initialization (initMu also guards config and clientCapabilities)
 	initialized bool
 	initMu      sync.Mutex
+
+	// disabled is set when the wrapper is switched off for the workspace
+	disabled atomic.Bool
+
+	// Project load outcomes and the AL server stderr tail used to diagnose them
+	projectLoads map[string]*ProjectLoadStatus
+	loadMu       sync.Mutex
+	stderrTail   []string
+	stderrMu     sync.Mutex
+
+	// Projects whose symbols were downloaded automatically, guarded by loadMu
+	symbolDownloads map[string]bool
+
+	// Per-method circuit breakers for AL server requests that keep failing
+	circuits  map[string]*circuit
+	circuitMu sync.Mutex
+
+	// al/* methods probed at startup, false for those the AL server lacks
+	alMethods map[string]bool
+	capMu     sync.Mutex
+
+	// Recent errors for the al-wrapper/status report
+	recentErrors []StatusError
+	errorsMu     sync.Mutex
+
+	// Serializes audit log appends
+	auditMu sync.Mutex
 }
 
 // New creates a new ALLSPWrapper
 func New() *ALLSPWrapper {
 	return &ALLSPWrapper{
-		openedFiles:         make(map[string]bool),
-		initializedProjects: make(map[string]bool),
-		pendingReqs:         make(map[int]chan *Message),
-		responseQueue:       make(map[int]*Message),
-		handlers:            GetDefaultHandlers(),
+		openedFiles:   make(map[string]int),
+		serverDocs:    make(map[string]serverDocument),
+		projects:      make(map[string]*projectState),
+		pendingReqs:   make(map[int]chan *Message),
+		abandonedReqs: make(map[int]abandonedRequest),
+		partials:      make(map[string]*partialResults),
+		docQueues:     make(map[string]*documentQueue),
+		projectLoads:  make(map[string]*ProjectLoadStatus),
+		circuits:      make(map[string]*circuit),
+		responseQueue: make(map[int]*Message),
+		handlers:      GetDefaultHandlers(),
+		config:        DefaultConfig(),
+		diagnostics:   newDiagnosticsQueue(),
+		selfTest:      newSelfTest(),
+		symbols:       newSymbolIndex(),
+		packages:      newPackageIndex(),
+		sources:       newPackageSources(),
+		symbolStore:   newSymbolStore(),
+
+		documentSymbols: newDocumentSymbolCache(),
+		duplicates:      newDuplicateChecker(),
+		builds:          newBuildDiagnostics(),
+		symbolDownloads: make(map[string]bool),
 	}
 }
 
 // Run starts the wrapper
 func (w *ALLSPWrapper) Run() error {
 	// Setup logging
-	if err := w.setupLogging(); err != nil {
+	start := time.Now()
+	err := w.setupLogging()
+	w.selfTest.phase("logging", start, err)
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Warning: failed to setup logging: %v\n", err)
 	}
+	w.selfTest.update(func(r *SelfTestReport) { r.LogPath = GetLogPath() })
+
+	w.Log("AL LSP Wrapper (Go) %s starting... (session %s, pid %d)", Version, SessionID(), os.Getpid())
+	if removed := pruneLogFiles(); removed > 0 {
+		w.Log("Removed %d old session log(s)", removed)
+	}
+
+	// Log the self-test report even if startup fails part way
+	startupDone := false
+	defer func() {
+		if !startupDone {
+			w.logSelfTest()
+		}
+	}()
+
+	// Find the AL extension and start the AL LSP process, unless the
+	// wrapper is disabled for the workspace it was started in
+	cwd, _ := os.Getwd()
+	if reason := DisabledReason(cwd); reason != "" {
+		w.Log("Wrapper disabled (%s); the AL server will not be started", reason)
+		w.disabled.Store(true)
+	} else if err = w.startServer(); err != nil {
+		return err
+	}
+	startupDone = true
+	w.logSelfTest()
+
+	// Setup client communication
+	w.clientReader = bufio.NewReader(os.Stdin)
+	w.clientWriter = os.Stdout
+
+	// Start goroutines
+	errChan := make(chan error, 2)
+
+	// Read from AL LSP and forward notifications/handle responses,
+	// restarting the server if the AL extension is updated underneath it
+	if !w.disabled.Load() {
+		go func() {
+			errChan <- w.superviseServer()
+		}()
+	}
+
+	// Stop the AL LSP while it is idle, if configured, and sample its
+	// resource use
+	if !w.disabled.Load() {
+		go w.superviseIdleTime()
+		go w.superviseResources()
+	}
+
+	// Main loop: read from client and process
+	go func() {
+		errChan <- w.readFromClient()
+	}()
+
+	// Wait for error or completion
+	err = <-errChan
+	w.Log("Wrapper stopping: %v", err)
+	w.persistWarmState()
+
+	// Cleanup
+	w.stopServer()
 
-	w.Log("AL LSP Wrapper (Go) starting...")
+	return err
+}
 
+// startServer finds the newest AL extension and starts its EditorServices process
+func (w *ALLSPWrapper) startServer() error {
 	// Find AL extension
+	start := time.Now()
 	extensionPath, err := FindALExtension()
+	w.selfTest.phase("findExtension", start, err)
 	if err != nil {
 		w.Log("Failed to find AL extension: %v", err)
 		return fmt.Errorf("AL extension not found: %w", err)
@@ -79,77 +291,77 @@ func (w *ALLSPWrapper) Run() error {
 	w.Log("Found AL extension: %s", extensionPath)
 
 	// Get executable path
-	executable := GetALLSPExecutable(extensionPath)
-	w.Log("AL LSP executable: %s", executable)
+	selection := SelectALLSPExecutable(extensionPath)
+	executable := selection.Path
+	w.Log("AL LSP executable: %s (arch: %s)", executable, selection.Arch)
+	if selection.Advice != "" {
+		w.Log("AL LSP executable advice: %s", selection.Advice)
+	}
 
 	// Check executable exists
-	if _, err := os.Stat(executable); os.IsNotExist(err) {
-		w.Log("AL LSP executable not found: %s", executable)
+	_, statErr := os.Stat(executable)
+	w.selfTest.update(func(r *SelfTestReport) {
+		r.ExtensionPath = extensionPath
+		r.ExtensionVersion = ALExtensionVersion(extensionPath)
+		r.Executable = executable
+		r.ExecutableExists = statErr == nil
+		r.ExecutableArch = selection.Arch
+		r.ExecutableAdvice = selection.Advice
+	})
+	if os.IsNotExist(statErr) {
+		w.Log("AL LSP executable not found: %s (probed: %s)", executable, strings.Join(selection.Probed, ", "))
 		return fmt.Errorf("AL LSP executable not found: %s", executable)
 	}
 
 	// Start AL LSP process
-	w.cmd = exec.Command(executable)
-	w.cmd.Dir = extensionPath
+	cmd := exec.Command(executable)
+	cmd.Dir = extensionPath
 
-	w.stdin, err = w.cmd.StdinPipe()
+	stdin, err := cmd.StdinPipe()
 	if err != nil {
 		return fmt.Errorf("failed to get stdin pipe: %w", err)
 	}
 
-	stdoutPipe, err := w.cmd.StdoutPipe()
+	stdoutPipe, err := cmd.StdoutPipe()
 	if err != nil {
 		return fmt.Errorf("failed to get stdout pipe: %w", err)
 	}
-	w.stdout = bufio.NewReader(stdoutPipe)
 
-	w.stderr, err = w.cmd.StderrPipe()
+	stderr, err := cmd.StderrPipe()
 	if err != nil {
 		return fmt.Errorf("failed to get stderr pipe: %w", err)
 	}
 
-	if err := w.cmd.Start(); err != nil {
+	start = time.Now()
+	err = cmd.Start()
+	w.selfTest.phase("startServer", start, err)
+	if err != nil {
 		return fmt.Errorf("failed to start AL LSP: %w", err)
 	}
-	w.Log("AL LSP process started (PID: %d)", w.cmd.Process.Pid)
+	w.Log("AL LSP process started (PID: %d)", cmd.Process.Pid)
 
 	// Add to Windows job object for automatic cleanup on parent exit
-	addProcessToJob(w.cmd.Process)
+	addProcessToJob(cmd.Process)
 
-	// Setup client communication
-	w.clientReader = bufio.NewReader(os.Stdin)
-	w.clientWriter = os.Stdout
-
-	// Start goroutines
-	errChan := make(chan error, 2)
+	w.serverMu.Lock()
+	w.cmd = cmd
+	w.stdin = stdin
+	w.stdout = bufio.NewReader(stdoutPipe)
+	w.stderr = stderr
+	w.extensionPath = extensionPath
+	w.executable = executable
+	w.serverMu.Unlock()
 
 	// Read stderr in background
-	go w.readStderr()
-
-	// Read from AL LSP and forward notifications/handle responses
-	go func() {
-		errChan <- w.readFromLSP()
-	}()
-
-	// Main loop: read from client and process
-	go func() {
-		errChan <- w.readFromClient()
-	}()
-
-	// Wait for error or completion
-	err = <-errChan
-	w.Log("Wrapper stopping: %v", err)
-
-	// Cleanup
-	if w.cmd.Process != nil {
-		w.cmd.Process.Kill()
-	}
-
-	return err
+	go w.readStderr(stderr)
+	return nil
 }
 
 func (w *ALLSPWrapper) setupLogging() error {
 	logPath := GetLogPath()
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		return err
+	}
 	f, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 	if err != nil {
 		return err
@@ -160,29 +372,52 @@ func (w *ALLSPWrapper) setupLogging() error {
 
 // Log logs a message
 func (w *ALLSPWrapper) Log(format string, args ...interface{}) {
+	w.logTagged("", format, args...)
+}
+
+// logTagged logs a message prefixed with a correlation or span tag
+func (w *ALLSPWrapper) logTagged(tag string, format string, args ...interface{}) {
 	w.logMu.Lock()
 	defer w.logMu.Unlock()
 
+	now := time.Now()
+	msg := fmt.Sprintf(format, args...)
+	w.recordLogLine(tag, now, msg)
 	if w.logFile == nil {
 		return
 	}
 
-	timestamp := time.Now().Format("2006-01-02 15:04:05.000")
-	msg := fmt.Sprintf(format, args...)
-	fmt.Fprintf(w.logFile, "[%s] %s\n", timestamp, msg)
+	timestamp := now.Format("2006-01-02 15:04:05.000")
+	if tag != "" {
+		fmt.Fprintf(w.logFile, "[%s] [%s] %s\n", timestamp, tag, msg)
+	} else {
+		fmt.Fprintf(w.logFile, "[%s] %s\n", timestamp, msg)
+	}
 	w.logFile.Sync()
 }
 
-func (w *ALLSPWrapper) readStderr() {
-	scanner := bufio.NewScanner(w.stderr)
+// writeToClient writes a message to the client, serializing concurrent writers
+func (w *ALLSPWrapper) writeToClient(msg *Message) error {
+	w.validateMessage("wrapper", "client", msg)
+	if msg.Error != nil {
+		w.recordError("client", errorSummary(msg.Error))
+	}
+	w.clientMu.Lock()
+	defer w.clientMu.Unlock()
+	return WriteMessage(w.clientWriter, msg)
+}
+
+func (w *ALLSPWrapper) readStderr(stderr io.Reader) {
+	scanner := bufio.NewScanner(stderr)
 	for scanner.Scan() {
+		w.recordStderr(scanner.Text())
 		w.Log("[AL LSP stderr] %s", scanner.Text())
 	}
 }
 
-func (w *ALLSPWrapper) readFromLSP() error {
+func (w *ALLSPWrapper) readFromLSP(stdout *bufio.Reader) error {
 	for {
-		msg, err := ReadMessage(w.stdout)
+		msg, err := ReadMessage(stdout)
 		if err != nil {
 			if err == io.EOF {
 				return fmt.Errorf("AL LSP connection closed")
@@ -190,29 +425,69 @@ func (w *ALLSPWrapper) readFromLSP() error {
 			w.Log("Error reading from AL LSP: %v", err)
 			return err
 		}
+		w.validateMessage("server", "wrapper", msg)
+		msg.Params = canonicalFileURIs(msg.Params)
+		msg.Result = canonicalFileURIs(msg.Result)
 
 		if msg.IsResponse() {
 			// This is a response to a request we sent
 			id := msg.GetIDInt()
 			w.pendingMu.Lock()
-			if ch, ok := w.pendingReqs[id]; ok {
+			ch, ok := w.pendingReqs[id]
+			if ok {
 				ch <- msg
 				delete(w.pendingReqs, id)
 			}
 			w.pendingMu.Unlock()
+			if !ok {
+				w.handleUnmatchedResponse(msg)
+			}
 		} else if msg.IsNotification() {
+			if msg.Method == "textDocument/publishDiagnostics" {
+				w.processDiagnostics(msg)
+				continue
+			}
+			if msg.Method == "$/progress" && w.collectPartialResult(msg) {
+				continue
+			}
+
 			// Forward notifications to client
 			w.Log("Forwarding notification to client: %s", msg.Method)
-			if err := WriteMessage(w.clientWriter, msg); err != nil {
+			if err := w.writeToClient(msg); err != nil {
 				w.Log("Error forwarding notification: %v", err)
 			}
+		} else if msg.IsRequest() {
+			w.handleServerRequest(msg)
 		}
 	}
 }
 
+// handleServerRequest answers or forwards a request the AL server sends to
+// the client. Edits the client cannot apply are applied by the wrapper.
+func (w *ALLSPWrapper) handleServerRequest(msg *Message) {
+	if msg.Method == "workspace/applyEdit" && !w.ClientCapabilities().Workspace.ApplyEdit {
+		// Applying the edit waits for nothing from the server, but must not
+		// hold up reading its messages
+		go w.applyServerEdit(msg)
+		return
+	}
+
+	if msg.Method == "workspace/applyEdit" {
+		var params ApplyWorkspaceEditParams
+		if json.Unmarshal(msg.Params, &params) == nil {
+			w.auditEdit(w, msg.Method, params.Label, &params.Edit)
+		}
+	}
+
+	w.Log("Forwarding request to client: method=%s id=%s", msg.Method, msg.GetIDString())
+	if err := w.writeToClient(msg); err != nil {
+		w.Log("Error forwarding request: %v", err)
+	}
+}
+
 func (w *ALLSPWrapper) readFromClient() error {
 	for {
-		msg, err := ReadMessage(w.clientReader)
+		msgs, isBatch, err := ReadMessages(w.clientReader)
 		if err != nil {
 			if err == io.EOF {
 				return fmt.Errorf("client connection closed")
@@ -221,44 +496,158 @@ func (w *ALLSPWrapper) readFromClient() error {
 			return err
 		}
 
-		w.Log("Received from client: method=%s id=%s", msg.Method, msg.GetIDString())
-
-		// Handle the message
-		response, err := w.handleMessage(msg)
-		if err != nil {
-			w.Log("Error handling message: %v", err)
-			if msg.IsRequest() {
-				errResp := NewErrorResponse(msg.ID, InternalError, err.Error())
-				WriteMessage(w.clientWriter, errResp)
+		var batch *clientBatch
+		if isBatch {
+			w.Log("Received batch of %d message(s) from client", len(msgs))
+			if len(msgs) == 0 {
+				w.writeToClient(NewErrorResponse(nil, InvalidRequest, "Empty batch"))
+				continue
 			}
-			continue
+			batch = newClientBatch(msgs)
 		}
-
-		// Send response if any
-		if response != nil {
-			w.Log("Sending response to client: id=%s", response.GetIDString())
-			if err := WriteMessage(w.clientWriter, response); err != nil {
-				w.Log("Error writing response: %v", err)
+		for _, msg := range msgs {
+			scope := w.newRequestScope()
+			scope.batch = batch
+			if msg == nil {
+				scope.Log("Invalid message in batch")
+				batch.add(w, NewErrorResponse(nil, InvalidRequest, "Invalid request"))
+				continue
 			}
+			w.dispatchClientMessage(scope, msg)
+		}
+	}
+}
+
+// dispatchClientMessage handles a client message in order, in its document's
+// queue or concurrently
+func (w *ALLSPWrapper) dispatchClientMessage(scope *requestScope, msg *Message) {
+	scope.Log("Received from client: method=%s id=%s", msg.Method, msg.GetIDString())
+	w.validateMessage("client", "wrapper", msg)
+	w.touchActivity()
+
+	// A server stopped for being idle is started again first
+	if w.holdForIdleResume(scope, msg) {
+		return
+	}
+	w.routeClientMessage(scope, msg)
+}
+
+// routeClientMessage handles a client message in its document's queue,
+// concurrently or in order
+func (w *ALLSPWrapper) routeClientMessage(scope *requestScope, msg *Message) {
+	// Messages about a document are handled in order per document
+	if uri := documentURI(msg); uri != "" {
+		w.enqueueDocumentMessage(uri, func() { w.serveMessage(scope, msg) })
+		return
+	}
+
+	// Other requests are handled concurrently, so one waiting on a project
+	// load does not hold up the rest; notifications and lifecycle messages
+	// are handled in order
+	if isConcurrentRequest(msg) {
+		w.beginInflight()
+		go func() {
+			defer w.endInflight()
+			w.serveMessage(scope, msg)
+		}()
+		return
+	}
+	w.serveMessage(scope, msg)
+}
+
+// beginInflight counts a client message as in flight until endInflight
+func (w *ALLSPWrapper) beginInflight() {
+	w.inflight.Add(1)
+	w.inflightCount.Add(1)
+}
+
+// endInflight ends a client message counted by beginInflight
+func (w *ALLSPWrapper) endInflight() {
+	w.inflightCount.Add(-1)
+	w.inflight.Done()
+}
+
+// isConcurrentRequest reports whether a client message is a request that may
+// be handled alongside others
+func isConcurrentRequest(msg *Message) bool {
+	return msg.IsRequest() && msg.Method != "initialize" && msg.Method != "shutdown"
+}
+
+// serveMessage handles a client message and writes the response, if any
+func (w *ALLSPWrapper) serveMessage(scope *requestScope, msg *Message) {
+	response, err := w.handleMessage(scope, msg)
+	if err != nil {
+		scope.Log("Error handling message: %v", err)
+		response = nil
+		if msg.IsRequest() {
+			response = NewErrorResponse(msg.ID, InternalError, err.Error())
 		}
 	}
+	w.respond(scope, msg, response)
 }
 
-func (w *ALLSPWrapper) handleMessage(msg *Message) (*Message, error) {
+// respond sends the response to a client message, if any; responses to the
+// requests of a batch are collected and sent together
+func (w *ALLSPWrapper) respond(scope *requestScope, msg *Message, response *Message) {
+	w.attachLogExcerpt(scope, response)
+	if scope.batch != nil && msg.IsRequest() {
+		scope.batch.add(w, response)
+		return
+	}
+	if response == nil {
+		return
+	}
+	scope.Log("Sending response to client: id=%s", response.GetIDString())
+	if err := w.writeToClient(response); err != nil {
+		scope.Log("Error writing response: %v", err)
+	}
+}
+
+// handlerFor returns the handler of a method, nil if no handler handles it or
+// its handling is switched off in the config
+func (w *ALLSPWrapper) handlerFor(method string) Handler {
+	if enabled, ok := w.Config().Handlers[method]; ok && !enabled {
+		return nil
+	}
+	for _, handler := range w.handlers {
+		if handler.ShouldHandle(method) {
+			return handler
+		}
+	}
+	return nil
+}
+
+func (w *ALLSPWrapper) handleMessage(scope *requestScope, msg *Message) (*Message, error) {
+	if w.disabled.Load() {
+		return w.handleDisabled(scope, msg)
+	}
+
+	// Responses to requests the AL server sent the client go back to the server
+	if msg.IsResponse() {
+		return nil, w.writeToServer(msg)
+	}
+
 	// Handle initialize specially
 	if msg.Method == "initialize" {
-		return w.handleInitialize(msg)
+		return w.handleInitialize(scope, msg)
 	}
 
 	// Handle initialized notification
 	if msg.Method == "initialized" {
-		w.SendNotificationToLSP("initialized", nil)
+		scope.SendNotificationToLSP("initialized", nil)
+		w.probeALMethods(scope)
+		w.warmStart(scope)
 		return nil, nil
 	}
 
-	// Handle shutdown
+	// Handle shutdown, once the messages in flight are handled
 	if msg.Method == "shutdown" {
-		resp, err := w.SendRequestToLSP("shutdown", nil)
+		w.inflight.Wait()
+		w.persistWarmState()
+		if w.serverIdleStopped() {
+			return &Message{JSONRPC: "2.0", ID: msg.ID, Result: json.RawMessage("null")}, nil
+		}
+		resp, err := scope.SendRequestToLSP("shutdown", nil)
 		if err != nil {
 			return nil, err
 		}
@@ -271,20 +660,39 @@ func (w *ALLSPWrapper) handleMessage(msg *Message) (*Message, error) {
 
 	// Handle exit
 	if msg.Method == "exit" {
-		w.SendNotificationToLSP("exit", nil)
+		scope.SendNotificationToLSP("exit", nil)
+		w.persistWarmState()
 		os.Exit(0)
 		return nil, nil
 	}
 
+	// Keep the client's progress tokens for the requests answering it
+	if msg.IsRequest() {
+		scope.progress = newClientProgress(msg, !w.hasHandler(msg.Method))
+	}
+
+	// Remember the trace level, for a restarted AL server
+	if msg.Method == "$/setTrace" {
+		w.handleSetTrace(scope, msg)
+		return nil, nil
+	}
+
 	// Check handlers
-	for _, handler := range w.handlers {
-		if handler.ShouldHandle(msg.Method) {
-			response, errResp := handler.Handle(msg, w)
-			if errResp != nil {
-				return errResp, nil
-			}
-			return response, nil
+	if handler := w.handlerFor(msg.Method); handler != nil {
+		response, errResp := handler.Handle(msg, scope)
+		if errResp != nil {
+			return errResp, nil
+		}
+		return response, nil
+	}
+
+	// A raw al/publish deploys like al.publish, and is gated the same way
+	if msg.Method == "al/publish" && !w.Config().Publish.Enabled {
+		scope.Log("Refusing al/publish from the client: publish.enabled is off")
+		if msg.IsRequest() {
+			return publishDisabledResponse(msg, msg.Method), nil
 		}
+		return nil, nil
 	}
 
 	// Pass through to AL LSP
@@ -293,10 +701,13 @@ func (w *ALLSPWrapper) handleMessage(msg *Message) (*Message, error) {
 		if len(msg.Params) > 0 {
 			json.Unmarshal(msg.Params, &params)
 		}
-		resp, err := w.SendRequestToLSP(msg.Method, params)
+		resp, err := scope.SendRequestToLSP(msg.Method, params)
 		if err != nil {
 			return nil, err
 		}
+		if resp.Error == nil {
+			w.auditResult(scope, msg.Method, resp.Result)
+		}
 		return &Message{
 			JSONRPC: "2.0",
 			ID:      msg.ID,
@@ -307,37 +718,69 @@ func (w *ALLSPWrapper) handleMessage(msg *Message) (*Message, error) {
 
 	// Forward notification
 	if msg.IsNotification() {
+		w.trackDocument(scope, msg)
+		w.scheduleDuplicateCheck(msg)
+		w.clearBuildDiagnostics(msg)
 		var params interface{}
 		if len(msg.Params) > 0 {
 			json.Unmarshal(msg.Params, &params)
 		}
-		w.SendNotificationToLSP(msg.Method, params)
+		scope.SendNotificationToLSP(msg.Method, params)
 	}
 
 	return nil, nil
 }
 
-func (w *ALLSPWrapper) handleInitialize(msg *Message) (*Message, error) {
+func (w *ALLSPWrapper) handleInitialize(scope *requestScope, msg *Message) (*Message, error) {
 	var params InitializeParams
 	if err := json.Unmarshal(msg.Params, &params); err != nil {
-		w.Log("Failed to parse initialize params: %v", err)
+		scope.Log("Failed to parse initialize params: %v", err)
 	}
 
 	// Extract workspace root
 	if params.RootURI != "" {
 		if path, err := FileURIToPath(params.RootURI); err == nil {
 			w.workspaceRoot = path
-			w.Log("Workspace root: %s", w.workspaceRoot)
+			scope.Log("Workspace root: %s", w.workspaceRoot)
 		}
 	}
 
+	if reason := DisabledReason(w.workspaceRoot); reason != "" {
+		w.disable(scope, reason)
+		return w.handleDisabled(scope, msg)
+	}
+	w.initMu.Lock()
+	w.clientCapabilities = params.Capabilities
+	w.initMu.Unlock()
+
 	// Find app.json to determine AL project root
 	projectRoot := ""
 	if w.workspaceRoot != "" {
 		appJson := FindAppJSON(w.workspaceRoot, 5)
 		if appJson != "" {
 			projectRoot = filepath.Dir(appJson)
-			w.Log("Found AL project at: %s", projectRoot)
+			scope.Log("Found AL project at: %s", projectRoot)
+		}
+	}
+
+	// Load configuration for this workspace
+	start := time.Now()
+	cfg, err := LoadConfig(w.workspaceRoot)
+	if err != nil {
+		scope.Log("Config warnings: %v", err)
+	}
+	if err := cfg.ApplyInitializationOptions(params.InitializationOptions); err != nil {
+		scope.Log("initializationOptions: %v", err)
+	}
+	w.initMu.Lock()
+	w.config = cfg
+	w.initMu.Unlock()
+	w.selfTest.phase("loadConfig", start, err)
+	w.selfTest.update(func(r *SelfTestReport) { r.ConfigSources = cfg.Sources() })
+	scope.Log("Config sources: %v", cfg.Sources())
+	for method, enabled := range cfg.Handlers {
+		if !enabled {
+			scope.Log("Handler switched off, forwarding unchanged: %s", method)
 		}
 	}
 
@@ -352,9 +795,21 @@ func (w *ALLSPWrapper) handleInitialize(msg *Message) (*Message, error) {
 		cwd, _ := os.Getwd()
 		initParams = NewInitializeParams(cwd)
 	}
+	if projectRoot != "" {
+		w.setActiveProject(NormalizePath(projectRoot))
+	}
+	trace, ok := validTrace(cfg.Server.Trace)
+	if !ok {
+		scope.Log("Invalid server.trace %q; using %q", cfg.Server.Trace, trace)
+	}
+	initParams.Trace = trace
+	w.setTraceLevel(trace)
+	w.serverInitParams = initParams
 
 	// Send initialize to AL LSP
-	response, err := w.SendRequestToLSP("initialize", initParams)
+	start = time.Now()
+	response, err := scope.SendRequestToLSP("initialize", initParams)
+	w.selfTest.phase("initialize", start, err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize AL LSP: %w", err)
 	}
@@ -363,22 +818,248 @@ func (w *ALLSPWrapper) handleInitialize(msg *Message) (*Message, error) {
 	w.initialized = true
 	w.initMu.Unlock()
 
+	// Advertise the commands implemented by the wrapper
+	result := response.Result
+	for _, handler := range w.handlers {
+		if commands, ok := handler.(*ExecuteCommandHandler); ok {
+			result = addExecuteCommands(result, commands.Commands())
+		}
+	}
+
+	// Pass on the semantic tokens legend, for the requests the wrapper forwards
+	result = advertiseSemanticTokens(result)
+
+	// Advertise the requests the wrapper answers even if the AL server does not
+	result = addProviders(result, "declarationProvider", "implementationProvider", "callHierarchyProvider", "typeHierarchyProvider")
+	result = advertisePrepareRename(result)
+	result = advertisePullDiagnostics(result)
+	result = advertiseDocumentLinks(result)
+
 	// Return response to client
 	return &Message{
 		JSONRPC: "2.0",
 		ID:      msg.ID,
-		Result:  response.Result,
+		Result:  result,
 	}, nil
 }
 
+// addExecuteCommands merges commands into the executeCommandProvider of an initialize result
+func addExecuteCommands(result json.RawMessage, commands []string) json.RawMessage {
+	var initResult map[string]interface{}
+	if err := json.Unmarshal(result, &initResult); err != nil || initResult == nil {
+		return result
+	}
+	capabilities, _ := initResult["capabilities"].(map[string]interface{})
+	if capabilities == nil {
+		capabilities = map[string]interface{}{}
+		initResult["capabilities"] = capabilities
+	}
+	provider, _ := capabilities["executeCommandProvider"].(map[string]interface{})
+	if provider == nil {
+		provider = map[string]interface{}{}
+		capabilities["executeCommandProvider"] = provider
+	}
+	existing, _ := provider["commands"].([]interface{})
+	for _, command := range commands {
+		existing = append(existing, command)
+	}
+	provider["commands"] = existing
+
+	merged, err := json.Marshal(initResult)
+	if err != nil {
+		return result
+	}
+	return merged
+}
+
+// advertisePrepareRename sets prepareProvider on the renameProvider of an
+// initialize result, as the wrapper answers prepareRename itself when the AL
+// server does not
+func advertisePrepareRename(result json.RawMessage) json.RawMessage {
+	var initResult map[string]interface{}
+	if err := json.Unmarshal(result, &initResult); err != nil || initResult == nil {
+		return result
+	}
+	capabilities, _ := initResult["capabilities"].(map[string]interface{})
+	if capabilities == nil {
+		return result
+	}
+	switch provider := capabilities["renameProvider"].(type) {
+	case bool:
+		if !provider {
+			return result
+		}
+		capabilities["renameProvider"] = map[string]interface{}{"prepareProvider": true}
+	case map[string]interface{}:
+		provider["prepareProvider"] = true
+	default:
+		return result
+	}
+
+	merged, err := json.Marshal(initResult)
+	if err != nil {
+		return result
+	}
+	return merged
+}
+
+// advertisePullDiagnostics sets the diagnosticProvider of an initialize
+// result, as the wrapper answers textDocument/diagnostic from the diagnostics
+// the AL server publishes
+func advertisePullDiagnostics(result json.RawMessage) json.RawMessage {
+	var initResult map[string]interface{}
+	if err := json.Unmarshal(result, &initResult); err != nil || initResult == nil {
+		return result
+	}
+	capabilities, _ := initResult["capabilities"].(map[string]interface{})
+	if capabilities == nil {
+		return result
+	}
+	if _, ok := capabilities["diagnosticProvider"]; ok {
+		return result
+	}
+	capabilities["diagnosticProvider"] = map[string]interface{}{
+		"interFileDependencies": true,
+		"workspaceDiagnostics":  false,
+	}
+
+	merged, err := json.Marshal(initResult)
+	if err != nil {
+		return result
+	}
+	return merged
+}
+
+// advertiseDocumentLinks sets the documentLinkProvider of an initialize
+// result, as the wrapper links the AL objects referenced in a file
+func advertiseDocumentLinks(result json.RawMessage) json.RawMessage {
+	var initResult map[string]interface{}
+	if err := json.Unmarshal(result, &initResult); err != nil || initResult == nil {
+		return result
+	}
+	capabilities, _ := initResult["capabilities"].(map[string]interface{})
+	if capabilities == nil {
+		return result
+	}
+	if _, ok := capabilities["documentLinkProvider"]; ok {
+		return result
+	}
+	capabilities["documentLinkProvider"] = map[string]interface{}{
+		"resolveProvider": false,
+	}
+
+	merged, err := json.Marshal(initResult)
+	if err != nil {
+		return result
+	}
+	return merged
+}
+
+// addProviders enables capability providers in an initialize result, keeping
+// the options of providers the AL server already advertises
+func addProviders(result json.RawMessage, providers ...string) json.RawMessage {
+	var initResult map[string]interface{}
+	if err := json.Unmarshal(result, &initResult); err != nil || initResult == nil {
+		return result
+	}
+	capabilities, _ := initResult["capabilities"].(map[string]interface{})
+	if capabilities == nil {
+		capabilities = map[string]interface{}{}
+		initResult["capabilities"] = capabilities
+	}
+	for _, provider := range providers {
+		if value, ok := capabilities[provider]; !ok || value == false {
+			capabilities[provider] = true
+		}
+	}
+
+	merged, err := json.Marshal(initResult)
+	if err != nil {
+		return result
+	}
+	return merged
+}
+
+// Config returns the effective wrapper configuration
+func (w *ALLSPWrapper) Config() *Config {
+	w.initMu.Lock()
+	defer w.initMu.Unlock()
+	return w.config
+}
+
+// ClientCapabilities returns the capabilities the client sent in initialize
+func (w *ALLSPWrapper) ClientCapabilities() ClientCapabilities {
+	w.initMu.Lock()
+	defer w.initMu.Unlock()
+	return w.clientCapabilities
+}
+
+// ActiveProject returns the root of the most recently activated AL project
+func (w *ALLSPWrapper) ActiveProject() string {
+	w.projectMu.Lock()
+	defer w.projectMu.Unlock()
+	return w.activeProject
+}
+
 // SendRequestToLSP sends a request to the AL LSP and waits for response
 func (w *ALLSPWrapper) SendRequestToLSP(method string, params interface{}) (*Message, error) {
+	return w.SendRequestToLSPWithTimeout(method, params, defaultRequestTimeout)
+}
+
+// SendRequestToLSPWithTimeout sends a request to the AL LSP and waits up to timeout for the response
+func (w *ALLSPWrapper) SendRequestToLSPWithTimeout(method string, params interface{}, timeout time.Duration) (*Message, error) {
+	return w.sendRequest("", method, params, timeout)
+}
+
+// sendRequest sends a request to the AL LSP, tagging its log lines with the given span
+func (w *ALLSPWrapper) sendRequest(span string, method string, params interface{}, timeout time.Duration) (*Message, error) {
+	return w.sendProjectRequest(span, w.requestProject(params), method, params, timeout)
+}
+
+// sendProjectRequest sends a request to the AL LSP with a project active, or
+// as it is if projectRoot is ""
+func (w *ALLSPWrapper) sendProjectRequest(span string, projectRoot string, method string, params interface{}, timeout time.Duration) (*Message, error) {
+	if err := w.checkCircuit(method); err != nil {
+		w.logTagged(span, "Short-circuiting request to AL LSP: %v", err)
+		return nil, err
+	}
+	var resp *Message
+	sent := false
+	err := w.inProject(span, projectRoot, func() (err error) {
+		sent = true
+		resp, err = w.roundTrip(span, method, params, timeout)
+		return err
+	})
+	if failure := requestFailure(resp, err); failure != nil {
+		w.recordError(method, failure.Error())
+	}
+	// A project that failed to activate says nothing about this method
+	if sent {
+		w.recordOutcome(span, method, err)
+	}
+	return resp, err
+}
+
+// roundTrip sends one request to the AL LSP and waits for its response
+func (w *ALLSPWrapper) roundTrip(span string, method string, params interface{}, timeout time.Duration) (*Message, error) {
+	id, respChan, err := w.startRequest(span, method, params)
+	if err != nil {
+		return nil, err
+	}
+	return w.awaitResponse(span, method, id, respChan, timeout)
+}
+
+// startRequest sends a request to the AL LSP and returns its ID and the
+// channel its response is delivered on
+func (w *ALLSPWrapper) startRequest(span string, method string, params interface{}) (int, chan *Message, error) {
+	w.pendingMu.Lock()
 	w.requestID++
 	id := w.requestID
+	w.pendingMu.Unlock()
 
 	msg, err := NewRequest(id, method, params)
 	if err != nil {
-		return nil, err
+		return 0, nil, err
 	}
 
 	// Create response channel
@@ -388,47 +1069,79 @@ func (w *ALLSPWrapper) SendRequestToLSP(method string, params interface{}) (*Mes
 	w.pendingMu.Unlock()
 
 	// Send request
-	w.Log("Sending request to AL LSP: method=%s id=%d", method, id)
-	if err := WriteMessage(w.stdin, msg); err != nil {
+	w.logTagged(span, "Sending request to AL LSP: method=%s id=%d", method, id)
+	if err := w.writeToServer(msg); err != nil {
 		w.pendingMu.Lock()
 		delete(w.pendingReqs, id)
 		w.pendingMu.Unlock()
-		return nil, err
+		return 0, nil, err
 	}
+	return id, respChan, nil
+}
 
-	// Wait for response with timeout
+// awaitResponse waits up to timeout for the response to a started request,
+// cancelling the request when the timeout expires
+func (w *ALLSPWrapper) awaitResponse(span string, method string, id int, respChan chan *Message, timeout time.Duration) (*Message, error) {
 	select {
 	case resp := <-respChan:
-		w.Log("Received response from AL LSP: id=%d", id)
+		w.logTagged(span, "Received response from AL LSP: id=%d", id)
 		return resp, nil
-	case <-time.After(30 * time.Second):
+	case <-time.After(timeout):
 		w.pendingMu.Lock()
 		delete(w.pendingReqs, id)
 		w.pendingMu.Unlock()
+		w.logTagged(span, "Timeout waiting for AL LSP: method=%s id=%d, cancelling", method, id)
+		w.abandonRequest(span, id, method)
 		return nil, fmt.Errorf("timeout waiting for response to %s", method)
 	}
 }
 
 // SendNotificationToLSP sends a notification to the AL LSP
 func (w *ALLSPWrapper) SendNotificationToLSP(method string, params interface{}) error {
+	return w.sendNotification("", method, params)
+}
+
+// sendNotification sends a notification to the AL LSP, tagging its log line
+func (w *ALLSPWrapper) sendNotification(tag string, method string, params interface{}) error {
 	msg, err := NewNotification(method, params)
 	if err != nil {
 		return err
 	}
 
-	w.Log("Sending notification to AL LSP: %s", method)
+	w.logTagged(tag, "Sending notification to AL LSP: %s", method)
+	return w.writeToServer(msg)
+}
+
+// writeToServer writes a message to the current AL LSP process
+func (w *ALLSPWrapper) writeToServer(msg *Message) error {
+	w.validateMessage("wrapper", "server", msg)
+	w.serverMu.Lock()
+	defer w.serverMu.Unlock()
 	return WriteMessage(w.stdin, msg)
 }
 
 // EnsureFileOpened ensures a file is opened in the AL LSP
 func (w *ALLSPWrapper) EnsureFileOpened(filePath string) error {
+	return w.ensureFileOpened(w, filePath)
+}
+
+// ensureFileOpened opens a file on behalf of scope, which receives the log lines
+func (w *ALLSPWrapper) ensureFileOpened(scope WrapperInterface, filePath string) error {
+	return w.openFileVersion(scope, filePath, 1)
+}
+
+// openFileVersion opens a file at the given document version unless it is already open
+func (w *ALLSPWrapper) openFileVersion(scope WrapperInterface, filePath string, version int) error {
 	normalizedPath := NormalizePath(filePath)
 
-	if w.openedFiles[normalizedPath] {
+	// Held until didOpen is sent, so concurrent requests open a file once
+	w.docMu.Lock()
+	defer w.docMu.Unlock()
+	if _, ok := w.openedFiles[normalizedPath]; ok {
 		return nil
 	}
 
-	w.Log("Opening file: %s", normalizedPath)
+	scope.Log("Opening file: %s", normalizedPath)
 
 	// Read file content
 	content, err := os.ReadFile(normalizedPath)
@@ -438,76 +1151,173 @@ func (w *ALLSPWrapper) EnsureFileOpened(filePath string) error {
 
 	// Send didOpen notification
 	params := NewDidOpenParams(normalizedPath, string(content))
-	if err := w.SendNotificationToLSP("textDocument/didOpen", params); err != nil {
+	params.TextDocument.Version = version
+	if err := scope.SendNotificationToLSP("textDocument/didOpen", params); err != nil {
 		return err
 	}
 
-	w.openedFiles[normalizedPath] = true
+	w.openedFiles[normalizedPath] = version
+	w.serverDocs[normalizedPath] = serverDocument{hash: contentHash(content), byWrapper: true}
 	return nil
 }
 
+// trackDocument records the documents the client opens, changes and closes,
+// so the wrapper does not reopen them and session snapshots carry their versions
+func (w *ALLSPWrapper) trackDocument(scope WrapperInterface, msg *Message) {
+	switch msg.Method {
+	case "textDocument/didOpen", "textDocument/didChange", "textDocument/didClose":
+	case "textDocument/didSave":
+		if path, err := FileURIToPath(documentURI(msg)); err == nil {
+			w.documentSymbols.invalidate(NormalizePath(path))
+		}
+		return
+	default:
+		return
+	}
+
+	var params struct {
+		TextDocument struct {
+			URI     string `json:"uri"`
+			Version int    `json:"version"`
+		} `json:"textDocument"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return
+	}
+	path, err := FileURIToPath(params.TextDocument.URI)
+	if err != nil {
+		return
+	}
+	normalizedPath := NormalizePath(path)
+	if msg.Method != "textDocument/didOpen" {
+		w.documentSymbols.invalidate(normalizedPath)
+	}
+
+	w.docMu.Lock()
+	defer w.docMu.Unlock()
+	if msg.Method == "textDocument/didClose" {
+		delete(w.openedFiles, normalizedPath)
+		delete(w.serverDocs, normalizedPath)
+		return
+	}
+	w.openedFiles[normalizedPath] = params.TextDocument.Version
+	w.trackServerContent(normalizedPath, msg)
+}
+
 // EnsureProjectInitialized ensures the project for a file is initialized
 func (w *ALLSPWrapper) EnsureProjectInitialized(filePath string) error {
+	return w.ensureProjectInitialized(w, filePath)
+}
+
+// ensureProjectInitialized initializes a project on behalf of scope, which
+// receives the log lines and tags the requests sent to the AL server
+func (w *ALLSPWrapper) ensureProjectInitialized(scope WrapperInterface, filePath string) error {
 	projectRoot := GetProjectRoot(filePath)
 	if projectRoot == "" {
-		w.Log("No AL project found for: %s", filePath)
+		scope.Log("No AL project found for: %s", filePath)
+		if IsALFile(filePath) {
+			return &ProjectInitError{File: filePath, Reason: "no app.json was found in its folder or any parent folder"}
+		}
 		return nil // Not an error - might not be an AL file
 	}
 
 	normalizedRoot := NormalizePath(projectRoot)
 
-	if w.initializedProjects[normalizedRoot] {
-		return nil
+	if w.isProjectInitialized(normalizedRoot) {
+		return w.projectLoadFailure(normalizedRoot, filePath)
+	}
+
+	// Concurrent callers for the same project share one init sequence;
+	// requests for other projects proceed
+	call, leader := w.beginProjectInit(normalizedRoot)
+	if leader {
+		call.err = w.initializeProject(scope, normalizedRoot, filePath)
+		w.finishProjectInit(normalizedRoot, call)
+	} else {
+		scope.Log("Waiting for the initialization of %s already in progress", normalizedRoot)
+		<-call.done
+	}
+
+	if w.isProjectInitialized(normalizedRoot) {
+		return w.projectLoadFailure(normalizedRoot, filePath)
 	}
+	return call.err
+}
 
-	w.Log("Initializing project: %s", normalizedRoot)
+// initializeProject runs the init sequence of a project: configuration,
+// app.json, activation and waiting for the load
+func (w *ALLSPWrapper) initializeProject(scope WrapperInterface, normalizedRoot string, filePath string) error {
+	// An unreadable app.json is reported on every request until it is fixed
+	if err := checkProjectManifest(normalizedRoot, filePath); err != nil {
+		scope.Log("Cannot initialize project: %v", err)
+		return err
+	}
+
+	scope.Log("Initializing project: %s", normalizedRoot)
+	w.activationMu.Lock()
+	defer w.activationMu.Unlock()
 
 	// Send workspace configuration
-	settings := NewWorkspaceSettings(normalizedRoot)
+	settings := w.workspaceSettings(scope, normalizedRoot)
 	configParams := DidChangeConfigurationParams{Settings: settings}
-	if err := w.SendNotificationToLSP("workspace/didChangeConfiguration", configParams); err != nil {
-		w.Log("Failed to send workspace configuration: %v", err)
+	if err := scope.SendNotificationToLSP("workspace/didChangeConfiguration", configParams); err != nil {
+		scope.Log("Failed to send workspace configuration: %v", err)
 	}
 
 	// Open app.json
 	appJsonPath := filepath.Join(normalizedRoot, "app.json")
-	if err := w.EnsureFileOpened(appJsonPath); err != nil {
-		w.Log("Failed to open app.json: %v", err)
+	if err := scope.EnsureFileOpened(appJsonPath); err != nil {
+		scope.Log("Failed to open app.json: %v", err)
 		// Continue anyway - app.json might not exist
 	}
 
 	// Set active workspace
 	activeParams := NewActiveWorkspaceParams(normalizedRoot)
-	if _, err := w.SendRequestToLSP("al/setActiveWorkspace", activeParams); err != nil {
-		w.Log("Failed to set active workspace: %v", err)
+	activeParams.Settings = settings
+	if _, err := scope.SendRequestToLSP("al/setActiveWorkspace", activeParams); err != nil {
+		scope.Log("Failed to set active workspace: %v", err)
 	}
 
-	// Wait for project to load
-	w.waitForProjectLoad()
-
-	w.initializedProjects[normalizedRoot] = true
-	w.Log("Project initialized: %s", normalizedRoot)
+	// Wait for project to load, diagnosing and retrying a load that never completes
+	if w.waitForProjectLoad(scope) {
+		w.setProjectLoadStatus(&ProjectLoadStatus{Project: normalizedRoot, Loaded: true, CheckedAt: time.Now()})
+	} else {
+		w.handleStuckProjectLoad(scope, normalizedRoot)
+	}
 
+	w.markProjectInitialized(normalizedRoot)
+	w.setActiveProject(normalizedRoot)
+	scope.Log("Project initialized: %s", normalizedRoot)
+	go w.prefetchPackages(scope, normalizedRoot)
+	go w.checkDuplicateObjects(scope)
 	return nil
 }
 
-func (w *ALLSPWrapper) waitForProjectLoad() {
+// waitForProjectLoad polls the AL server until the active project has loaded
+// or projectLoad.timeoutSeconds passes, and reports whether it loaded
+func (w *ALLSPWrapper) waitForProjectLoad(scope WrapperInterface) bool {
+	if !w.SupportsALMethod("al/hasProjectClosureLoadedRequest") {
+		scope.Log("AL server cannot report project load status; continuing")
+		return true
+	}
+
 	// Poll for project load status
-	for i := 0; i < 10; i++ {
-		resp, err := w.SendRequestToLSP("al/hasProjectClosureLoadedRequest", nil)
+	for i := 0; i < w.projectLoadPolls(); i++ {
+		resp, err := scope.SendRequestToLSP("al/hasProjectClosureLoadedRequest", nil)
 		if err != nil {
-			w.Log("Error checking project load status: %v", err)
+			scope.Log("Error checking project load status: %v", err)
 			break
 		}
 
 		var loaded bool
 		if err := json.Unmarshal(resp.Result, &loaded); err == nil && loaded {
-			w.Log("Project loaded successfully")
-			return
+			scope.Log("Project loaded successfully")
+			return true
 		}
 
 		time.Sleep(500 * time.Millisecond)
 	}
 
-	w.Log("Timeout waiting for project load, continuing anyway")
+	scope.Log("Timeout waiting for project load, continuing anyway")
+	return false
 }
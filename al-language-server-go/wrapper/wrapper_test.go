@@ -0,0 +1,81 @@
+package wrapper
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"sync"
+	"testing"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent writers and readers
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Close() error { return nil }
+
+// messages decodes the LSP messages written so far
+func (b *syncBuffer) messages(t *testing.T) []*Message {
+	t.Helper()
+	b.mu.Lock()
+	data := append([]byte(nil), b.buf.Bytes()...)
+	b.mu.Unlock()
+
+	var msgs []*Message
+	r := bufio.NewReader(bytes.NewReader(data))
+	for {
+		content, err := readContent(r)
+		if err != nil {
+			return msgs
+		}
+		var msg Message
+		if err := json.Unmarshal(content, &msg); err != nil {
+			t.Fatalf("invalid message %s: %v", content, err)
+		}
+		msgs = append(msgs, &msg)
+	}
+}
+
+// newTestWrapper returns a wrapper whose AL server and client are buffers
+// recording what the wrapper writes to them
+func newTestWrapper() (w *ALLSPWrapper, server *syncBuffer, client *syncBuffer) {
+	w = New()
+	server, client = &syncBuffer{}, &syncBuffer{}
+	w.stdin = server
+	w.clientWriter = client
+	return w, server, client
+}
+
+// testRequest builds a client request
+func testRequest(t *testing.T, id int, method string, params interface{}) *Message {
+	t.Helper()
+	msg, err := NewRequest(id, method, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestRawPublishRefusedWhenDisabled(t *testing.T) {
+	w, server, _ := newTestWrapper()
+	msg := testRequest(t, 1, "al/publish", ALPublishParams{WorkspacePath: t.TempDir()})
+
+	resp, err := w.handleMessage(w.newRequestScope(), msg)
+	if err != nil {
+		t.Fatalf("handleMessage error: %v", err)
+	}
+	if resp == nil || resp.Error == nil || resp.Error.Code != InvalidRequest {
+		t.Fatalf("al/publish with publishing disabled = %+v, want an InvalidRequest error", resp)
+	}
+	if sent := server.messages(t); len(sent) != 0 {
+		t.Errorf("al/publish reached the AL server: %+v", sent[0])
+	}
+}
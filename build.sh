@@ -106,6 +106,10 @@ if [ "$SKIP_GO" = false ]; then
     go build -ldflags="-s -w" -o ../al-language-server-go-windows/bin/al-lsp-launcher.exe ./cmd/launcher
     echo "  -> al-language-server-go-windows/bin/"
 
+    echo "Building for Windows ARM64..."
+    GOOS=windows GOARCH=arm64 go build -ldflags="-s -w" -o ../al-language-server-go-windows/bin/al-lsp-wrapper-arm64.exe .
+    echo "  -> al-language-server-go-windows/bin/al-lsp-wrapper-arm64.exe"
+
     echo "Building for Linux..."
     GOOS=linux GOARCH=amd64 go build -ldflags="-s -w" -o ../al-language-server-go-linux/bin/al-lsp-wrapper .
     GOOS=linux GOARCH=amd64 go build -ldflags="-s -w" -o ../al-language-server-go-linux/bin/al-lsp-launcher ./cmd/launcher
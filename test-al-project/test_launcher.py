@@ -12,6 +12,8 @@ import time
 import shutil
 from pathlib import Path
 
+from wrapper_logs import go_wrapper_log_path
+
 REPO_ROOT = os.path.dirname(os.path.dirname(os.path.abspath(__file__)))
 LAUNCHER_PATH = os.path.join(REPO_ROOT, "al-language-server-go", "bin", "al-lsp-launcher.exe")
 WRAPPER_PATH = os.path.join(REPO_ROOT, "al-language-server-go", "bin", "al-lsp-wrapper.exe")
@@ -195,7 +197,7 @@ def test_launcher_picks_newest_version():
 
         if response and "result" in response:
             # Check the log to see which version was used
-            log_path = os.path.join(os.environ.get("TEMP", "/tmp"), "al-lsp-wrapper-go.log")
+            log_path = go_wrapper_log_path()
             if os.path.exists(log_path):
                 with open(log_path) as f:
                     log_content = f.read()
@@ -13,6 +13,8 @@ from pathlib import Path
 from dataclasses import dataclass
 from typing import Optional, Any, List, Tuple
 
+from wrapper_logs import go_wrapper_log_path
+
 # Paths
 REPO_ROOT = os.path.dirname(os.path.dirname(os.path.abspath(__file__)))
 PYTHON_WRAPPER = os.path.join(REPO_ROOT, "al-language-server-python", "al_lsp_wrapper.py")
@@ -420,7 +422,7 @@ def show_log(wrapper_type: str):
     if wrapper_type == "python":
         log_path = os.path.join(os.environ.get("TEMP", "/tmp"), "al-lsp-wrapper.log")
     else:
-        log_path = os.path.join(os.environ.get("TEMP", "/tmp"), "al-lsp-wrapper-go.log")
+        log_path = go_wrapper_log_path()
 
     if os.path.exists(log_path):
         print(f"\n--- {wrapper_type.upper()} Wrapper Log (last 30 lines) ---")
@@ -0,0 +1,28 @@
+"""
+Locating the Go wrapper's log, shared by the test scripts.
+"""
+
+import os
+import sys
+from pathlib import Path
+
+
+def go_wrapper_log_path():
+    """Return the Go wrapper log path (mirrors wrapper.GetStateDir)."""
+    if sys.platform == "win32":
+        return newest_log(os.environ.get("TEMP", "/tmp"))
+    if sys.platform == "darwin":
+        base = os.path.expanduser("~/Library/Logs")
+    else:
+        base = os.environ.get("XDG_STATE_HOME", "")
+        if not os.path.isabs(base):
+            base = os.path.expanduser("~/.local/state")
+    return newest_log(os.path.join(base, "al-lsp-wrapper"))
+
+
+def newest_log(log_dir):
+    """Return the newest per-session Go wrapper log in log_dir."""
+    logs = list(Path(log_dir).glob("al-lsp-wrapper-go-*.log"))
+    if not logs:
+        return os.path.join(log_dir, "al-lsp-wrapper-go.log")
+    return str(max(logs, key=lambda p: p.stat().st_mtime))